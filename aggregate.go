@@ -0,0 +1,168 @@
+package pvoutput
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// AggregateMaxGap is the longest period between two Status updates power
+	// values are integrated over. Longer gaps are treated as missing data
+	AggregateMaxGap = 30 * time.Minute
+)
+
+// AggregateStatus aggregates a day's worth of Status updates into an Output.
+// Updates don't need to be in order, but should all be on the same day in
+// their time zone and share the same Cumulative setting.
+//
+// Generated and Consumed are taken from the energy values, which are either
+// energy so far today or lifetime energy, depending on Cumulative. When no
+// energy values are set, they are estimated by integrating the power values.
+// Exported is always an estimate, integrating the surplus of generation over
+// consumption. Gaps longer than AggregateMaxGap are not integrated over
+func AggregateStatus(statuses []Status) (Output, error) {
+	o := NewOutput()
+	if len(statuses) == 0 {
+		return o, errors.New("no statuses to aggregate")
+	}
+
+	sorted := make([]Status, len(statuses))
+	copy(sorted, statuses)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].DateTime.Before(sorted[j].DateTime)
+	})
+
+	first := sorted[0]
+	if first.DateTime.IsZero() {
+		return o, errors.New("DateTime is required on Status")
+	}
+
+	year, month, day := first.DateTime.Date()
+	for _, s := range sorted[1:] {
+		y, m, d := s.DateTime.Date()
+		if y != year || m != month || d != day {
+			return o, errors.New("statuses span multiple days")
+		}
+		if s.Cumulative != first.Cumulative {
+			return o, errors.New("statuses have mixed Cumulative settings")
+		}
+	}
+
+	o.Date = time.Date(year, month, day, 0, 0, 0, 0, first.DateTime.Location())
+
+	cumulativeGenerated := first.Cumulative == StatusCumulativeAll || first.Cumulative == StatusCumulativeGenerating
+	cumulativeConsumed := first.Cumulative == StatusCumulativeAll || first.Cumulative == StatusCumulativeConsuming
+
+	o.Generated = aggregateEnergy(sorted, cumulativeGenerated,
+		func(s Status) int { return s.Generated },
+		func(s Status) int { return s.Generating })
+	o.Consumed = aggregateEnergy(sorted, cumulativeConsumed,
+		func(s Status) int { return s.Consumed },
+		func(s Status) int { return s.Consuming })
+
+	// estimate export by integrating generation surplus
+	var (
+		exported float64
+		haveNet  bool
+	)
+	for i := 1; i < len(sorted); i++ {
+		s := sorted[i]
+		if s.Generating == UnsetInt || s.Consuming == UnsetInt {
+			continue
+		}
+		haveNet = true
+
+		gap := s.DateTime.Sub(sorted[i-1].DateTime)
+		if gap > AggregateMaxGap {
+			continue
+		}
+
+		if surplus := s.Generating - s.Consuming; surplus > 0 {
+			exported += float64(surplus) * gap.Hours()
+		}
+	}
+	if haveNet {
+		o.Exported = int(math.Round(exported))
+	}
+
+	for _, s := range sorted {
+		if s.Generating != UnsetInt && s.Generating > o.PeakPower {
+			o.PeakPower = s.Generating
+			o.PeakTime = s.DateTime
+		}
+
+		if s.Temperature != UnsetFloat {
+			if o.MinTemp == UnsetFloat || s.Temperature < o.MinTemp {
+				o.MinTemp = s.Temperature
+			}
+			if o.MaxTemp == UnsetFloat || s.Temperature > o.MaxTemp {
+				o.MaxTemp = s.Temperature
+			}
+		}
+	}
+
+	return o, nil
+}
+
+// aggregateEnergy returns the energy in watt hours for given sorted statuses
+// based on the energy values from energy, falling back to integrating the
+// power values from power
+func aggregateEnergy(sorted []Status, cumulative bool, energy, power func(Status) int) int {
+	first, last, max := UnsetInt, UnsetInt, UnsetInt
+	for _, s := range sorted {
+		e := energy(s)
+		if e == UnsetInt {
+			continue
+		}
+
+		if first == UnsetInt {
+			first = e
+		}
+		last = e
+		if e > max {
+			max = e
+		}
+	}
+
+	if first != UnsetInt {
+		if cumulative {
+			// lifetime values, so the day's energy is the difference between
+			// the first and last update of the day
+			if last < first {
+				return 0
+			}
+
+			return last - first
+		}
+
+		// energy so far today only increases during the day
+		return max
+	}
+
+	var (
+		total     float64
+		havePower bool
+	)
+	for i := 1; i < len(sorted); i++ {
+		p := power(sorted[i])
+		if p == UnsetInt {
+			continue
+		}
+		havePower = true
+
+		gap := sorted[i].DateTime.Sub(sorted[i-1].DateTime)
+		if gap > AggregateMaxGap {
+			continue
+		}
+
+		total += float64(p) * gap.Hours()
+	}
+
+	if !havePower {
+		return UnsetInt
+	}
+
+	return int(math.Round(total))
+}
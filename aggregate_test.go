@@ -0,0 +1,104 @@
+package pvoutput
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregateStatus(t *testing.T) {
+	_, err := AggregateStatus(nil)
+	assert.Error(t, err)
+
+	newStatus := func(hhmm string) Status {
+		s := NewStatus()
+		s.DateTime, _ = time.Parse("200601021504", "20200818"+hhmm)
+
+		return s
+	}
+
+	// energy so far today, out of order
+	b := []Status{newStatus("1020"), newStatus("1000"), newStatus("1010")}
+	b[0].Generated, b[0].Generating, b[0].Consumed, b[0].Consuming = 3000, 2500, 900, 500
+	b[1].Generated, b[1].Generating, b[1].Consumed, b[1].Consuming = 1000, 1500, 300, 700
+	b[2].Generated, b[2].Generating, b[2].Consumed, b[2].Consuming = 2000, 3000, 600, 400
+	b[0].Temperature, b[1].Temperature, b[2].Temperature = 24.5, 18.2, 21.0
+
+	o, err := AggregateStatus(b)
+	if assert.NoError(t, err) {
+		date, _ := time.Parse("20060102", "20200818")
+		assert.Equal(t, date, o.Date)
+		assert.Equal(t, 3000, o.Generated)
+		assert.Equal(t, 900, o.Consumed)
+		assert.Equal(t, 3000, o.PeakPower)
+		assert.Equal(t, b[2].DateTime, o.PeakTime)
+		assert.Equal(t, 18.2, o.MinTemp)
+		assert.Equal(t, 24.5, o.MaxTemp)
+		// (3000-400)W * 10m + (2500-500)W * 10m
+		assert.Equal(t, 767, o.Exported)
+	}
+
+	// lifetime generation values
+	b = []Status{newStatus("0800"), newStatus("0900"), newStatus("1000")}
+	for i := range b {
+		b[i].Cumulative = StatusCumulativeGenerating
+		b[i].Generated = 1000000 + i*750
+		b[i].Consumed = i * 100
+	}
+	o, err = AggregateStatus(b)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1500, o.Generated)
+		assert.Equal(t, 200, o.Consumed)
+		// no power values, so no peak or export
+		assert.Equal(t, UnsetInt, o.PeakPower)
+		assert.True(t, o.PeakTime.IsZero())
+		assert.Equal(t, UnsetInt, o.Exported)
+		assert.Equal(t, UnsetFloat, o.MinTemp)
+	}
+
+	// power values only, with a gap that is skipped
+	b = []Status{newStatus("0800"), newStatus("0815"), newStatus("0830"), newStatus("1030"), newStatus("1045")}
+	for i := range b {
+		b[i].Generating = 1000
+	}
+	o, err = AggregateStatus(b)
+	if assert.NoError(t, err) {
+		// 3 intervals of 15 minutes at 1000W, the 2 hour gap is skipped
+		assert.Equal(t, 750, o.Generated)
+		assert.Equal(t, UnsetInt, o.Consumed)
+	}
+
+	// DST days are measured in actual elapsed time
+	loc, err := time.LoadLocation("Europe/Amsterdam")
+	require.NoError(t, err)
+	b = []Status{NewStatus(), NewStatus()}
+	b[0].DateTime = time.Date(2020, 10, 25, 2, 50, 0, 0, loc)
+	b[1].DateTime = b[0].DateTime.Add(20 * time.Minute)
+	b[1].Generating = 600
+	o, err = AggregateStatus(b)
+	if assert.NoError(t, err) {
+		assert.Equal(t, time.Date(2020, 10, 25, 0, 0, 0, 0, loc), o.Date)
+		assert.Equal(t, 200, o.Generated)
+	}
+
+	// statuses should be on a single day
+	b = []Status{newStatus("2355"), newStatus("2355")}
+	b[1].DateTime = b[1].DateTime.Add(10 * time.Minute)
+	_, err = AggregateStatus(b)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "multiple days")
+	}
+
+	// statuses should share their cumulative setting
+	b = []Status{newStatus("1000"), newStatus("1005")}
+	b[1].Cumulative = StatusCumulativeAll
+	_, err = AggregateStatus(b)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Cumulative")
+	}
+
+	_, err = AggregateStatus([]Status{NewStatus()})
+	assert.Error(t, err)
+}
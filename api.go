@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 )
 
 const (
@@ -13,14 +15,36 @@ const (
 	apiAddOutputEndpoint      = "addoutput.jsp"
 	apiAddStatusEndpoint      = "addstatus.jsp"
 	apiAddBatchStatusEndpoint = "addbatchstatus.jsp"
+	apiPostSystemEndpoint     = "postsystem.jsp"
+	apiRegisterNotification   = "registernotification.jsp"
+	apiDeregisterNotification = "deregisternotification.jsp"
+	apiGetSupplyEndpoint      = "getsupply.jsp"
+	apiGetLadderEndpoint      = "getladder.jsp"
+	apiGetStatusEndpoint      = "getstatus.jsp"
+	apiGetOutputEndpoint      = "getoutput.jsp"
+	apiGetStatisticEndpoint   = "getstatistic.jsp"
+	apiGetSystemEndpoint      = "getsystem.jsp"
+	apiDeleteStatusEndpoint   = "deletestatus.jsp"
+	apiGetMissingEndpoint     = "getmissing.jsp"
 )
 
+// ErrNoData is returned when PVOutput has no statuses or outputs to return,
+// rather than failing the request
+var ErrNoData = errors.New("no data")
+
 // API is a struct holding relevant session data
 type API struct {
 	Key      string
 	SystemID string
-	client   http.Client
+	client   *http.Client
 	donating bool
+	baseURL  string
+	limiter  *rateLimiter
+	// waitForRateLimit makes requests wait for the rate limit to reset,
+	// rather than fail with ErrRateLimitExceeded
+	waitForRateLimit bool
+	now              func() time.Time
+	sleep            func(time.Duration)
 }
 
 // NewAPI returns a new API object for given systemID and API key
@@ -28,11 +52,43 @@ func NewAPI(key, systemID string, donating bool) API {
 	return API{
 		SystemID: systemID,
 		Key:      key,
-		client:   http.Client{},
+		client:   &http.Client{},
 		donating: donating,
+		baseURL:  apiBaseURL,
+		limiter:  &rateLimiter{},
+		now:      time.Now,
+		sleep:    time.Sleep,
 	}
 }
 
+// WithBaseURL returns a copy of the API sending its requests to given base
+// URL instead of PVOutput's, e.g. to go through a proxy or to test against a
+// fake service
+func (a API) WithBaseURL(baseURL string) API {
+	a.baseURL = baseURL
+
+	return a
+}
+
+// WithRateLimitWait returns a copy of the API that, when the rate limit is
+// exceeded, waits for it to reset and makes the request then, rather than
+// returning ErrRateLimitExceeded
+func (a API) WithRateLimitWait() API {
+	a.waitForRateLimit = true
+
+	return a
+}
+
+// RateLimit returns the rate limit as reported by PVOutput on the last
+// request. The second return value is false when no request was made yet
+func (a API) RateLimit() (RateLimit, bool) {
+	if a.limiter == nil {
+		return RateLimit{}, false
+	}
+
+	return a.limiter.get()
+}
+
 func (a API) getPOSTRequest(path string, enc PVEncodable) (*http.Request, error) {
 	req, err := a.getRequest(http.MethodPost, path)
 	if err != nil {
@@ -50,35 +106,82 @@ func (a API) getPOSTRequest(path string, enc PVEncodable) (*http.Request, error)
 	return req, nil
 }
 
+func (a API) getGETRequest(path string, params url.Values) (*http.Request, error) {
+	req, err := a.getRequest(http.MethodGet, path)
+	if err != nil {
+		return nil, err
+	}
+
+	req.URL.RawQuery = params.Encode()
+
+	return req, nil
+}
+
 func (a API) getRequest(method, path string) (*http.Request, error) {
-	req, err := http.NewRequest(method, fmt.Sprintf("%s/%s", apiBaseURL, path), nil)
+	base := a.baseURL
+	if base == "" {
+		base = apiBaseURL
+	}
+
+	req, err := http.NewRequest(method, fmt.Sprintf("%s/%s", strings.TrimRight(base, "/"), path), nil)
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Add("X-Pvoutput-Apikey", a.Key)
 	req.Header.Add("X-Pvoutput-SystemId", a.SystemID)
+	req.Header.Add("X-Rate-Limit", "1")
 
 	return req, nil
 }
 
 func (a API) handleRequest(req *http.Request) error {
-	resp, err := a.client.Do(req)
+	_, err := a.doRequest(req)
+
+	return err
+}
+
+// doRequest performs given request and returns the response body
+func (a API) doRequest(req *http.Request) (string, error) {
+	if err := a.allowRequest(); err != nil {
+		return "", err
+	}
+
+	client := a.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer resp.Body.Close()
 
+	if a.limiter != nil {
+		a.limiter.update(resp.Header)
+	}
+
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return errors.New(string(body))
+		if noData(string(body)) {
+			return "", ErrNoData
+		}
+
+		return "", errors.New(string(body))
 	}
 
-	return nil
+	return string(body), nil
+}
+
+// noData tells if given response body is PVOutput reporting there is
+// nothing to return
+func noData(body string) bool {
+	return strings.Contains(body, "No status found") || strings.Contains(body, "No outputs found")
 }
 
 // AddOutput implements PVOutput's /addoutput.jsp service
@@ -129,3 +232,281 @@ func (a API) AddBatchStatus(b BatchStatus) error {
 
 	return a.handleRequest(req)
 }
+
+// UpdateSystem implements PVOutput's /postsystem.jsp service
+func (a API) UpdateSystem(u SystemUpdate) error {
+	req, err := a.getPOSTRequest(apiPostSystemEndpoint, u)
+	if err != nil {
+		return err
+	}
+
+	return a.handleRequest(req)
+}
+
+// RegisterNotification implements PVOutput's /registernotification.jsp
+// service. PVOutput will call given url for alerts of given type
+func (a API) RegisterNotification(appID, callbackURL string, alertType AlertType) error {
+	if err := validateAppID(appID); err != nil {
+		return err
+	}
+
+	if callbackURL == "" {
+		return errors.New("url is required")
+	}
+	if len(callbackURL) > NotificationURLMaxLength {
+		return fmt.Errorf("url exceeds %d characters", NotificationURLMaxLength)
+	}
+
+	params := url.Values{}
+	params.Set("appid", appID)
+	params.Set("url", callbackURL)
+	params.Set("type", fmt.Sprintf("%d", alertType))
+
+	req, err := a.getGETRequest(apiRegisterNotification, params)
+	if err != nil {
+		return err
+	}
+
+	return a.handleRequest(req)
+}
+
+// DeregisterNotification implements PVOutput's /deregisternotification.jsp
+// service
+func (a API) DeregisterNotification(appID string, alertType AlertType) error {
+	if err := validateAppID(appID); err != nil {
+		return err
+	}
+
+	params := url.Values{}
+	params.Set("appid", appID)
+	params.Set("type", fmt.Sprintf("%d", alertType))
+
+	req, err := a.getGETRequest(apiDeregisterNotification, params)
+	if err != nil {
+		return err
+	}
+
+	return a.handleRequest(req)
+}
+
+// GetSupply implements PVOutput's /getsupply.jsp service. Both timezone (e.g.
+// Australia/Melbourne) and region (e.g. 1:victoria) are optional
+func (a API) GetSupply(timezone, region string) ([]Supply, error) {
+	params := url.Values{}
+	if timezone != "" {
+		params.Set("tz", timezone)
+	}
+	if region != "" {
+		params.Set("r", region)
+	}
+
+	req, err := a.getGETRequest(apiGetSupplyEndpoint, params)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := a.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeSupplies(body)
+}
+
+// GetLadder implements PVOutput's /getladder.jsp service
+func (a API) GetLadder(o LadderOptions) ([]LadderEntry, error) {
+	params, err := o.values()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := a.getGETRequest(apiGetLadderEndpoint, params)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := a.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeLadder(body)
+}
+
+// get performs a GET request to given path and returns the response body
+func (a API) get(path string, params url.Values) (string, error) {
+	req, err := a.getGETRequest(path, params)
+	if err != nil {
+		return "", err
+	}
+
+	return a.doRequest(req)
+}
+
+// dateRange returns the df and dt parameters for given dates, zero dates
+// are left out
+func dateRange(from, to time.Time) (url.Values, error) {
+	params := url.Values{}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return nil, errors.New("end date is before start date")
+	}
+
+	if !from.IsZero() {
+		params.Set("df", from.Format("20060102"))
+	}
+	if !to.IsZero() {
+		params.Set("dt", to.Format("20060102"))
+	}
+
+	return params, nil
+}
+
+// GetStatus implements PVOutput's /getstatus.jsp service for a single
+// status. When t is zero, the most recent status is returned, otherwise the
+// status at given date and time
+func (a API) GetStatus(t time.Time) (Status, error) {
+	params := url.Values{}
+	if !t.IsZero() {
+		params.Set("d", t.Format("20060102"))
+		params.Set("t", t.Format("15:04"))
+	}
+
+	body, err := a.get(apiGetStatusEndpoint, params)
+	if err != nil {
+		return NewStatus(), err
+	}
+
+	return decodeStatus(body)
+}
+
+// GetStatusHistory implements PVOutput's /getstatus.jsp service in history
+// mode, returning the statuses of a single day
+func (a API) GetStatusHistory(o StatusHistoryOptions) ([]Status, error) {
+	params, err := o.values()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := a.get(apiGetStatusEndpoint, params)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []Status{}
+	for _, line := range strings.Split(strings.TrimSpace(body), ";") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		s, err := decodeStatusHistory(line)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, s)
+	}
+
+	return statuses, nil
+}
+
+// GetOutput implements PVOutput's /getoutput.jsp service, returning the
+// daily outputs between from and to, both inclusive. Zero dates are not sent,
+// PVOutput then defaults to its most recent outputs
+func (a API) GetOutput(from, to time.Time) ([]Output, error) {
+	params, err := dateRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := a.get(apiGetOutputEndpoint, params)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := []Output{}
+	for _, line := range strings.Split(strings.TrimSpace(body), ";") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		o, err := decodeOutput(line)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, o)
+	}
+
+	return outputs, nil
+}
+
+// GetStatistic implements PVOutput's /getstatistic.jsp service, returning
+// the statistics between from and to, or over the system's lifetime when
+// both are zero. Consumption statistics are included
+func (a API) GetStatistic(from, to time.Time) (Statistic, error) {
+	params, err := dateRange(from, to)
+	if err != nil {
+		return Statistic{}, err
+	}
+	params.Set("c", "1")
+
+	body, err := a.get(apiGetStatisticEndpoint, params)
+	if err != nil {
+		return Statistic{}, err
+	}
+
+	return decodeStatistic(body)
+}
+
+// GetSystem implements PVOutput's /getsystem.jsp service for the API's
+// system
+func (a API) GetSystem() (System, error) {
+	body, err := a.get(apiGetSystemEndpoint, url.Values{})
+	if err != nil {
+		return System{}, err
+	}
+
+	return decodeSystem(body)
+}
+
+// DeleteStatus implements PVOutput's /deletestatus.jsp service, deleting the
+// status at given date and time
+func (a API) DeleteStatus(t time.Time) error {
+	req, err := a.getPOSTRequest(apiDeleteStatusEndpoint, statusDeletion{DateTime: t})
+	if err != nil {
+		return err
+	}
+
+	return a.handleRequest(req)
+}
+
+// GetMissing implements PVOutput's /getmissing.jsp service, returning the
+// dates between from and to without an output
+func (a API) GetMissing(from, to time.Time) ([]time.Time, error) {
+	if from.IsZero() || to.IsZero() {
+		return nil, errors.New("both from and to are required")
+	}
+
+	params, err := dateRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := a.get(apiGetMissingEndpoint, params)
+	if err != nil {
+		return nil, err
+	}
+
+	dates := []time.Time{}
+	for _, field := range strings.Split(strings.TrimSpace(body), ",") {
+		if field == "" {
+			continue
+		}
+
+		d, err := time.Parse("20060102", field)
+		if err != nil {
+			return nil, err
+		}
+		dates = append(dates, d)
+	}
+
+	return dates, nil
+}
@@ -2,9 +2,14 @@ package pvoutput
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewAPI(t *testing.T) {
@@ -31,3 +36,298 @@ func TestAPIAddBatchOutput(t *testing.T) {
 		assert.Equal(t, fmt.Sprintf("max batch size is %d", BatchOutputMaxSizeDonating), err.Error())
 	}
 }
+
+func TestAPINotifications(t *testing.T) {
+	var lastReq *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastReq = r
+		fmt.Fprint(w, "OK 200")
+	}))
+	defer srv.Close()
+
+	a := NewAPI("foo", "bar", false)
+	a.baseURL = srv.URL
+
+	err := a.RegisterNotification("example.app", "https://example.com/callback", AlertSystemIdle)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/registernotification.jsp", lastReq.URL.Path)
+		assert.Equal(t, "example.app", lastReq.URL.Query().Get("appid"))
+		assert.Equal(t, "https://example.com/callback", lastReq.URL.Query().Get("url"))
+		assert.Equal(t, "6", lastReq.URL.Query().Get("type"))
+		assert.Equal(t, "foo", lastReq.Header.Get("X-Pvoutput-Apikey"))
+		assert.Equal(t, "bar", lastReq.Header.Get("X-Pvoutput-SystemId"))
+	}
+
+	err = a.DeregisterNotification("example.app", AlertAll)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/deregisternotification.jsp", lastReq.URL.Path)
+		assert.Equal(t, "0", lastReq.URL.Query().Get("type"))
+	}
+
+	// validate input before calling PVOutput
+	lastReq = nil
+	err = a.RegisterNotification("", "https://example.com/callback", AlertAll)
+	assert.Error(t, err)
+	err = a.RegisterNotification("example.app", "https://example.com/"+strings.Repeat("x", NotificationURLMaxLength), AlertAll)
+	assert.Error(t, err)
+	err = a.DeregisterNotification(strings.Repeat("x", NotificationAppIDMaxLength+1), AlertAll)
+	assert.Error(t, err)
+	assert.Nil(t, lastReq)
+}
+
+func TestAPIGetSupply(t *testing.T) {
+	var lastReq *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastReq = r
+		http.ServeFile(w, r, "testdata/supply/normal")
+	}))
+	defer srv.Close()
+
+	a := NewAPI("foo", "bar", false)
+	a.baseURL = srv.URL
+
+	supplies, err := a.GetSupply("Australia/Melbourne", "1:victoria")
+	if assert.NoError(t, err) {
+		assert.Len(t, supplies, 2)
+		assert.Equal(t, "/getsupply.jsp", lastReq.URL.Path)
+		assert.Equal(t, "Australia/Melbourne", lastReq.URL.Query().Get("tz"))
+		assert.Equal(t, "1:victoria", lastReq.URL.Query().Get("r"))
+	}
+}
+
+func TestAPIGetLadder(t *testing.T) {
+	var lastReq *http.Request
+	a := newTestAPI(t, "testdata/ladder/normal", &lastReq)
+
+	entries, err := a.GetLadder(LadderOptions{Country: "NL", MinSize: 3000, MaxSize: 5000, TeamID: "42", Limit: 3})
+	if assert.NoError(t, err) && assert.Len(t, entries, 3) {
+		assert.Equal(t, "/getladder.jsp", lastReq.URL.Path)
+		q := lastReq.URL.Query()
+		assert.Equal(t, "NL", q.Get("c"))
+		assert.Equal(t, "3000", q.Get("sf"))
+		assert.Equal(t, "5000", q.Get("st"))
+		assert.Equal(t, "42", q.Get("tid"))
+		assert.Equal(t, "3", q.Get("limit"))
+		assert.Equal(t, "21473", entries[0].SystemID)
+		assert.Equal(t, "Sunny Side Up", entries[0].SystemName)
+		assert.Equal(t, 5.607, entries[0].Efficiency)
+		assert.Equal(t, 3, entries[2].Rank)
+	}
+
+	_, err = a.GetLadder(LadderOptions{})
+	if assert.NoError(t, err) {
+		assert.Empty(t, lastReq.URL.RawQuery)
+	}
+
+	// invalid options are not sent
+	lastReq = nil
+	_, err = a.GetLadder(LadderOptions{MinSize: 5000, MaxSize: 3000})
+	assert.Error(t, err)
+	assert.Nil(t, lastReq)
+}
+
+// newTestAPI returns an API talking to a fake PVOutput serving given file for
+// every request, the last request is stored in given pointer
+func newTestAPI(t *testing.T, file string, lastReq **http.Request) API {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		*lastReq = r
+		if file == "" {
+			fmt.Fprint(w, "OK 200: Deleted Status")
+			return
+		}
+		http.ServeFile(w, r, file)
+	}))
+	t.Cleanup(srv.Close)
+
+	return NewAPI("foo", "bar", false).WithBaseURL(srv.URL)
+}
+
+func TestAPIGetStatus(t *testing.T) {
+	var lastReq *http.Request
+	a := newTestAPI(t, "testdata/status/normal", &lastReq)
+
+	s, err := a.GetStatus(time.Time{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/getstatus.jsp", lastReq.URL.Path)
+		assert.Empty(t, lastReq.URL.RawQuery)
+		assert.Equal(t, 202, s.Generating)
+	}
+
+	_, err = a.GetStatus(time.Date(2010, 11, 7, 18, 30, 0, 0, time.UTC))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "20101107", lastReq.URL.Query().Get("d"))
+		assert.Equal(t, "18:30", lastReq.URL.Query().Get("t"))
+	}
+
+	// a response without all fields is not a status
+	a = newTestAPI(t, "testdata/status/short", &lastReq)
+	_, err = a.GetStatus(time.Time{})
+	assert.EqualError(t, err, "not enough fields in status")
+}
+
+func TestAPIGetStatusHistory(t *testing.T) {
+	var lastReq *http.Request
+	a := newTestAPI(t, "testdata/status/history", &lastReq)
+
+	statuses, err := a.GetStatusHistory(StatusHistoryOptions{
+		Date:      time.Date(2010, 11, 7, 0, 0, 0, 0, time.UTC),
+		From:      time.Date(0, 1, 1, 13, 0, 0, 0, time.UTC),
+		Ascending: true,
+		Limit:     10,
+	})
+	if assert.NoError(t, err) && assert.Len(t, statuses, 2) {
+		assert.Equal(t, "1", lastReq.URL.Query().Get("h"))
+		assert.Equal(t, "20101107", lastReq.URL.Query().Get("d"))
+		assert.Equal(t, "13:00", lastReq.URL.Query().Get("from"))
+		assert.Empty(t, lastReq.URL.Query().Get("to"))
+		assert.Equal(t, "1", lastReq.URL.Query().Get("asc"))
+		assert.Equal(t, "10", lastReq.URL.Query().Get("limit"))
+		assert.Equal(t, 1200, statuses[0].Generating)
+		assert.Equal(t, UnsetInt, statuses[1].Generating)
+	}
+
+	_, err = a.GetStatusHistory(StatusHistoryOptions{Limit: StatusHistoryMaxLimit + 1})
+	assert.Error(t, err)
+}
+
+func TestAPIGetOutput(t *testing.T) {
+	var lastReq *http.Request
+	a := newTestAPI(t, "testdata/output/list", &lastReq)
+
+	from := time.Date(2011, 3, 26, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2011, 3, 27, 0, 0, 0, 0, time.UTC)
+	outputs, err := a.GetOutput(from, to)
+	if assert.NoError(t, err) && assert.Len(t, outputs, 2) {
+		assert.Equal(t, "/getoutput.jsp", lastReq.URL.Path)
+		assert.Equal(t, "20110326", lastReq.URL.Query().Get("df"))
+		assert.Equal(t, "20110327", lastReq.URL.Query().Get("dt"))
+		assert.Equal(t, 4413, outputs[0].Generated)
+		assert.Equal(t, UnsetInt, outputs[1].Generated)
+		assert.True(t, outputs[1].PeakTime.IsZero())
+	}
+
+	_, err = a.GetOutput(to, from)
+	assert.Error(t, err)
+}
+
+func TestAPIGetStatistic(t *testing.T) {
+	var lastReq *http.Request
+	a := newTestAPI(t, "testdata/statistic/consumption", &lastReq)
+
+	st, err := a.GetStatistic(time.Time{}, time.Time{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/getstatistic.jsp", lastReq.URL.Path)
+		assert.Equal(t, "1", lastReq.URL.Query().Get("c"))
+		assert.Empty(t, lastReq.URL.Query().Get("df"))
+		assert.Equal(t, 24600, st.Generated)
+		assert.Equal(t, 10237, st.Consumed)
+	}
+}
+
+func TestAPIGetSystem(t *testing.T) {
+	var lastReq *http.Request
+	a := newTestAPI(t, "testdata/system/normal", &lastReq)
+
+	s, err := a.GetSystem()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/getsystem.jsp", lastReq.URL.Path)
+		assert.Equal(t, "Rooftop East", s.Name)
+	}
+}
+
+func TestAPIDeleteStatus(t *testing.T) {
+	var lastReq *http.Request
+	a := newTestAPI(t, "", &lastReq)
+
+	err := a.DeleteStatus(time.Date(2010, 11, 7, 18, 30, 0, 0, time.UTC))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/deletestatus.jsp", lastReq.URL.Path)
+		assert.Equal(t, http.MethodPost, lastReq.Method)
+		assert.Equal(t, "20101107", lastReq.PostForm.Get("d"))
+		assert.Equal(t, "18:30", lastReq.PostForm.Get("t"))
+	}
+
+	assert.Error(t, a.DeleteStatus(time.Time{}))
+}
+
+func TestAPIGetMissing(t *testing.T) {
+	var lastReq *http.Request
+	a := newTestAPI(t, "testdata/missing/normal", &lastReq)
+
+	from := time.Date(2020, 8, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2020, 8, 31, 0, 0, 0, 0, time.UTC)
+	dates, err := a.GetMissing(from, to)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/getmissing.jsp", lastReq.URL.Path)
+		assert.Equal(t, "20200801", lastReq.URL.Query().Get("df"))
+		assert.Equal(t, []time.Time{
+			time.Date(2020, 8, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2020, 8, 2, 0, 0, 0, 0, time.UTC),
+			time.Date(2020, 8, 15, 0, 0, 0, 0, time.UTC),
+		}, dates)
+	}
+
+	_, err = a.GetMissing(time.Time{}, to)
+	assert.Error(t, err)
+}
+
+func TestAPINoData(t *testing.T) {
+	body := "Bad request 400: No status found"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+
+	a := NewAPI("foo", "bar", false).WithBaseURL(srv.URL)
+	_, err := a.GetStatusHistory(StatusHistoryOptions{})
+	assert.Equal(t, ErrNoData, err)
+
+	body = "Bad request 400: No outputs found"
+	_, err = a.GetOutput(time.Time{}, time.Time{})
+	assert.Equal(t, ErrNoData, err)
+
+	// other errors are passed on
+	body = "Unauthorized 401: Invalid API Key"
+	_, err = a.GetOutput(time.Time{}, time.Time{})
+	assert.EqualError(t, err, body)
+}
+
+func TestAPIWithRateLimitWait(t *testing.T) {
+	start := time.Now()
+	now := start
+	reset := start.Add(10 * time.Minute).Truncate(time.Second)
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("X-Rate-Limit-Limit", "60")
+		w.Header().Set("X-Rate-Limit-Remaining", "0")
+		w.Header().Set("X-Rate-Limit-Reset", fmt.Sprintf("%d", reset.Unix()))
+	}))
+	defer srv.Close()
+
+	var slept time.Duration
+	a := NewAPI("foo", "bar", false).WithBaseURL(srv.URL)
+	a.now = func() time.Time { return now }
+	a.sleep = func(d time.Duration) {
+		slept += d
+		now = now.Add(d)
+	}
+
+	// without waiting, the request is not made
+	_, err := a.GetSupply("", "")
+	require.NoError(t, err)
+	_, err = a.GetSupply("", "")
+	assert.Equal(t, ErrRateLimitExceeded, err)
+	assert.Equal(t, 1, requests)
+	assert.Zero(t, slept)
+
+	// when waiting, the request is made after the reset
+	_, err = a.WithRateLimitWait().GetSupply("", "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, reset.Sub(start)+time.Second, slept)
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/skoef/pvoutput"
+	"github.com/skoef/pvoutput/internal/record"
+)
+
+const (
+	dateLayout = "20060102"
+	timeLayout = "15:04"
+)
+
+// intFlag is an integer flag that leaves its target untouched, typically
+// "unset", when not given
+type intFlag struct{ p *int }
+
+func (f intFlag) String() string {
+	if f.p == nil || *f.p == pvoutput.UnsetInt {
+		return ""
+	}
+
+	return strconv.Itoa(*f.p)
+}
+
+func (f intFlag) Set(s string) error {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return errors.New("not an integer")
+	}
+	*f.p = v
+
+	return nil
+}
+
+// floatFlag is the float equivalent of intFlag
+type floatFlag struct{ p *float64 }
+
+func (f floatFlag) String() string {
+	if f.p == nil || *f.p == pvoutput.UnsetFloat {
+		return ""
+	}
+
+	return strconv.FormatFloat(*f.p, 'f', -1, 64)
+}
+
+func (f floatFlag) Set(s string) error {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return errors.New("not a number")
+	}
+	*f.p = v
+
+	return nil
+}
+
+// stringFlag is the string equivalent of intFlag
+type stringFlag struct{ p *string }
+
+func (f stringFlag) String() string {
+	if f.p == nil || *f.p == pvoutput.UnsetString {
+		return ""
+	}
+
+	return *f.p
+}
+
+func (f stringFlag) Set(s string) error {
+	*f.p = s
+
+	return nil
+}
+
+// parseDate parses a date flag in the local timezone, an empty value
+// returns the zero time
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	d, err := time.ParseInLocation(dateLayout, value, time.Local)
+	if err != nil {
+		return d, fmt.Errorf("invalid date %s, expected YYYYMMDD", value)
+	}
+
+	return d, nil
+}
+
+// parseClock parses a time of day flag onto given date
+func parseClock(date time.Time, value string) (time.Time, error) {
+	t, err := time.Parse(timeLayout, value)
+	if err != nil {
+		return t, fmt.Errorf("invalid time %s, expected HH:MM", value)
+	}
+
+	y, m, d := date.Date()
+
+	return time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, date.Location()), nil
+}
+
+// dateTime parses the date and time flags into a moment. Missing values
+// default to the current date and time respectively
+func dateTime(date, clock string, now time.Time) (time.Time, error) {
+	d, err := parseDate(date)
+	if err != nil {
+		return d, err
+	}
+	if d.IsZero() {
+		d = now
+	}
+
+	if clock == "" {
+		if date != "" {
+			return d, errors.New("-time is required with -date")
+		}
+
+		return now.Truncate(time.Minute), nil
+	}
+
+	return parseClock(d, clock)
+}
+
+// env holds everything a command needs
+type env struct {
+	api      pvoutput.API
+	donating bool
+	format   string
+	stdout   io.Writer
+	stderr   io.Writer
+	now      func() time.Time
+}
+
+// command is a subcommand of the tool
+type command struct {
+	name  string
+	usage string
+	run   func(e env, args []string) error
+}
+
+var commands = []command{
+	{"add-status", "upload a status", addStatus},
+	{"add-output", "upload a daily output", addOutput},
+	{"get-status", "show the latest status, a status at some time or a day's statuses", getStatus},
+	{"get-output", "show daily outputs", getOutput},
+	{"get-statistic", "show statistics over a period or the system's lifetime", getStatistic},
+	{"get-system", "show the system's details", getSystem},
+	{"delete-status", "delete a status", deleteStatus},
+	{"missing", "list the dates without an output", missing},
+	{"import", "upload statuses or outputs from CSV files", importCSV},
+	{"export", "download statuses or outputs into a file, resuming an earlier export", exportHistory},
+	{"forward-influx", "upload statuses and outputs written in InfluxDB line protocol", forwardInflux},
+	{"reconcile", "compare statuses or outputs with the history of uploads, correcting outputs", reconcileHistory},
+}
+
+// newFlagSet returns a flag set for given command, which returns its errors
+// instead of exiting
+func newFlagSet(name string, output io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(output)
+
+	return fs
+}
+
+// parseArgs parses given arguments, rejecting positional arguments
+func parseArgs(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %s", fs.Arg(0))
+	}
+
+	return nil
+}
+
+func addStatus(e env, args []string) error {
+	s := pvoutput.NewStatus()
+	cumulative := int(s.Cumulative)
+
+	fs := newFlagSet("add-status", e.stderr)
+	date := fs.String("date", "", "date as YYYYMMDD, today when omitted")
+	clock := fs.String("time", "", "time as HH:MM, now when omitted")
+	fs.Var(intFlag{&s.Generated}, "generated", "energy generated in Wh")
+	fs.Var(intFlag{&s.Generating}, "generating", "power generated in W")
+	fs.Var(intFlag{&s.Consumed}, "consumed", "energy consumed in Wh")
+	fs.Var(intFlag{&s.Consuming}, "consuming", "power consumed in W")
+	fs.Var(floatFlag{&s.Temperature}, "temperature", "temperature in °C")
+	fs.Var(floatFlag{&s.Voltage}, "voltage", "voltage in V")
+	fs.Var(intFlag{&cumulative}, "cumulative", "1 when all energy values are lifetime values, 2 for generation only, 3 for consumption only")
+	for i := range s.Extended {
+		fs.Var(floatFlag{&s.Extended[i]}, fmt.Sprintf("v%d", pvoutput.ExtendedFirst+i), "extended data value")
+	}
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	var err error
+	if s.DateTime, err = dateTime(*date, *clock, e.now()); err != nil {
+		return err
+	}
+	s.Cumulative = pvoutput.StatusCumulative(cumulative)
+
+	return e.api.AddStatus(s)
+}
+
+func addOutput(e env, args []string) error {
+	o := pvoutput.NewOutput()
+
+	fs := newFlagSet("add-output", e.stderr)
+	date := fs.String("date", "", "date as YYYYMMDD, today when omitted")
+	peakTime := fs.String("peak-time", "", "time of peak power as HH:MM")
+	fs.Var(intFlag{&o.Generated}, "generated", "energy generated in Wh")
+	fs.Var(intFlag{&o.Exported}, "exported", "energy exported in Wh")
+	fs.Var(intFlag{&o.Consumed}, "consumed", "energy consumed in Wh")
+	fs.Var(intFlag{&o.PeakPower}, "peak-power", "peak power in W")
+	fs.Var(stringFlag{&o.Condition}, "condition", "weather condition, e.g. Fine or Showers")
+	fs.Var(floatFlag{&o.MinTemp}, "min-temperature", "minimum temperature in °C")
+	fs.Var(floatFlag{&o.MaxTemp}, "max-temperature", "maximum temperature in °C")
+	fs.Var(stringFlag{&o.Comments}, "comments", "comments")
+	fs.Var(intFlag{&o.ImportPeak}, "import-peak", "energy imported during peak in Wh")
+	fs.Var(intFlag{&o.ImportOffPeak}, "import-off-peak", "energy imported during off-peak in Wh")
+	fs.Var(intFlag{&o.ImportShoulder}, "import-shoulder", "energy imported during shoulder in Wh")
+	fs.Var(intFlag{&o.ImportHighShoulder}, "import-high-shoulder", "energy imported during high shoulder in Wh")
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	d, err := parseDate(*date)
+	if err != nil {
+		return err
+	}
+	if d.IsZero() {
+		y, m, day := e.now().Date()
+		d = time.Date(y, m, day, 0, 0, 0, 0, time.Local)
+	}
+	o.Date = d
+
+	if *peakTime != "" {
+		if o.PeakTime, err = parseClock(d, *peakTime); err != nil {
+			return err
+		}
+	}
+
+	return e.api.AddOutput(o)
+}
+
+func getStatus(e env, args []string) error {
+	fs := newFlagSet("get-status", e.stderr)
+	date := fs.String("date", "", "date as YYYYMMDD")
+	clock := fs.String("time", "", "time as HH:MM, requires -date")
+	history := fs.Bool("history", false, "show all statuses of the day")
+	from := fs.String("from", "", "with -history, first time as HH:MM")
+	to := fs.String("to", "", "with -history, last time as HH:MM")
+	asc := fs.Bool("asc", false, "with -history, show oldest status first")
+	limit := fs.Int("limit", 0, "with -history, maximum number of statuses")
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	d, err := parseDate(*date)
+	if err != nil {
+		return err
+	}
+
+	if !*history {
+		if *from != "" || *to != "" || *asc || *limit != 0 {
+			return errors.New("-from, -to, -asc and -limit require -history")
+		}
+
+		var t time.Time
+		if *clock != "" {
+			if d.IsZero() {
+				return errors.New("-time requires -date")
+			}
+			if t, err = parseClock(d, *clock); err != nil {
+				return err
+			}
+		} else if !d.IsZero() {
+			return errors.New("-date requires -time, or use -history")
+		}
+
+		s, err := e.api.GetStatus(t)
+		if err != nil {
+			return err
+		}
+
+		return printRecords(e.stdout, e.format, []record.Record{record.Status(s)}, true)
+	}
+
+	if *clock != "" {
+		return errors.New("-time can not be combined with -history")
+	}
+
+	o := pvoutput.StatusHistoryOptions{Date: d, Ascending: *asc, Limit: *limit}
+	if *from != "" {
+		if o.From, err = parseClock(d, *from); err != nil {
+			return err
+		}
+	}
+	if *to != "" {
+		if o.To, err = parseClock(d, *to); err != nil {
+			return err
+		}
+	}
+
+	statuses, err := e.api.GetStatusHistory(o)
+	if err != nil {
+		return err
+	}
+
+	records := []record.Record{}
+	for _, s := range statuses {
+		records = append(records, record.Status(s))
+	}
+
+	return printRecords(e.stdout, e.format, records, false)
+}
+
+// dateRangeFlags adds -from and -to to given flag set
+func dateRangeFlags(fs *flag.FlagSet) func() (time.Time, time.Time, error) {
+	from := fs.String("from", "", "first date as YYYYMMDD")
+	to := fs.String("to", "", "last date as YYYYMMDD")
+
+	return func() (time.Time, time.Time, error) {
+		f, err := parseDate(*from)
+		if err != nil {
+			return f, f, err
+		}
+		t, err := parseDate(*to)
+
+		return f, t, err
+	}
+}
+
+func getOutput(e env, args []string) error {
+	fs := newFlagSet("get-output", e.stderr)
+	dates := dateRangeFlags(fs)
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	from, to, err := dates()
+	if err != nil {
+		return err
+	}
+
+	outputs, err := e.api.GetOutput(from, to)
+	if err != nil {
+		return err
+	}
+
+	records := []record.Record{}
+	for _, o := range outputs {
+		records = append(records, record.Output(o))
+	}
+
+	return printRecords(e.stdout, e.format, records, false)
+}
+
+func getStatistic(e env, args []string) error {
+	fs := newFlagSet("get-statistic", e.stderr)
+	dates := dateRangeFlags(fs)
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	from, to, err := dates()
+	if err != nil {
+		return err
+	}
+
+	st, err := e.api.GetStatistic(from, to)
+	if err != nil {
+		return err
+	}
+
+	return printRecords(e.stdout, e.format, []record.Record{record.Statistic(st)}, true)
+}
+
+func getSystem(e env, args []string) error {
+	fs := newFlagSet("get-system", e.stderr)
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	s, err := e.api.GetSystem()
+	if err != nil {
+		return err
+	}
+
+	return printRecords(e.stdout, e.format, []record.Record{record.System(s)}, true)
+}
+
+func deleteStatus(e env, args []string) error {
+	fs := newFlagSet("delete-status", e.stderr)
+	date := fs.String("date", "", "date as YYYYMMDD, today when omitted")
+	clock := fs.String("time", "", "time as HH:MM")
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	// never default to now, to prevent deleting the wrong status
+	if *clock == "" {
+		return errors.New("-time is required")
+	}
+
+	t, err := dateTime(*date, *clock, e.now())
+	if err != nil {
+		return err
+	}
+
+	return e.api.DeleteStatus(t)
+}
+
+func missing(e env, args []string) error {
+	fs := newFlagSet("missing", e.stderr)
+	dates := dateRangeFlags(fs)
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	from, to, err := dates()
+	if err != nil {
+		return err
+	}
+	if to.IsZero() {
+		to = e.now()
+	}
+	if from.IsZero() {
+		from = to.AddDate(0, 0, -30)
+	}
+
+	missingDates, err := e.api.GetMissing(from, to)
+	if err != nil {
+		return err
+	}
+
+	records := []record.Record{}
+	for _, d := range missingDates {
+		records = append(records, record.Date(d))
+	}
+
+	return printRecords(e.stdout, e.format, records, false)
+}
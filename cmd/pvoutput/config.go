@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// environment variables overriding the config file
+const (
+	envConfig   = "PVOUTPUT_CONFIG"
+	envAPIKey   = "PVOUTPUT_API_KEY"
+	envSystemID = "PVOUTPUT_SYSTEM_ID"
+	envDonating = "PVOUTPUT_DONATING"
+	envBaseURL  = "PVOUTPUT_BASE_URL"
+)
+
+// config holds the settings needed to talk to PVOutput. They are read from
+// the config file first, then overridden by environment variables and
+// finally by flags
+type config struct {
+	APIKey   string `yaml:"api_key"`
+	SystemID string `yaml:"system_id"`
+	Donating bool   `yaml:"donating"`
+	BaseURL  string `yaml:"base_url"`
+}
+
+// defaultConfigPath returns the path of the config file used when none is
+// given, e.g. ~/.config/pvoutput/config.yaml
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "pvoutput", "config.yaml")
+}
+
+// loadConfig reads the config file at given path. When the file is the
+// default config file, it is not required to exist
+func loadConfig(path string, required bool) (config, error) {
+	c := config{}
+	if path == "" {
+		return c, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !required {
+			return c, nil
+		}
+
+		return c, err
+	}
+
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return c, err
+	}
+
+	return c, nil
+}
+
+// applyEnv overrides the config with the environment variables that are set
+func (c *config) applyEnv(getenv func(string) string) error {
+	if v := getenv(envAPIKey); v != "" {
+		c.APIKey = v
+	}
+	if v := getenv(envSystemID); v != "" {
+		c.SystemID = v
+	}
+	if v := getenv(envBaseURL); v != "" {
+		c.BaseURL = v
+	}
+	if v := getenv(envDonating); v != "" {
+		donating, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.New(envDonating + " should be a boolean")
+		}
+		c.Donating = donating
+	}
+
+	return nil
+}
+
+// validate checks whether all required settings are set
+func (c config) validate() error {
+	if c.APIKey == "" {
+		return errors.New("API key is required, use -key, " + envAPIKey + " or the config file")
+	}
+	if c.SystemID == "" {
+		return errors.New("system ID is required, use -system-id, " + envSystemID + " or the config file")
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/skoef/pvoutput/export"
+	"github.com/skoef/pvoutput/internal/record"
+)
+
+// exportFormats maps file extensions onto the export format they default to
+var exportFormats = map[string]export.Format{
+	".csv":   export.FormatCSV,
+	".jsonl": export.FormatJSONLines,
+}
+
+func exportHistory(e env, args []string) error {
+	fs := newFlagSet("export", e.stderr)
+	kind := fs.String("kind", "status", "what to export: status or output")
+	dates := dateRangeFlags(fs)
+	fileFormat := fs.String("file-format", "", "format of the file: csv or jsonl, derived from the file's extension by default")
+	wait := fs.Bool("wait", false, "wait for the rate limit to reset when exceeded, instead of stopping")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("expected a single file")
+	}
+	file := fs.Arg(0)
+
+	from, to, err := dates()
+	if err != nil {
+		return err
+	}
+
+	format := export.Format(*fileFormat)
+	if format == "" {
+		var ok bool
+		if format, ok = exportFormats[filepath.Ext(file)]; !ok {
+			return errors.New("-file-format is required for files without .csv or .jsonl extension")
+		}
+	}
+
+	api := e.api
+	if *wait {
+		api = api.WithRateLimitWait()
+	}
+	exporter := export.NewExporter(api, format)
+
+	var exported int
+	switch *kind {
+	case "status":
+		exported, err = exporter.ExportStatuses(file, from, to)
+	case "output":
+		exported, err = exporter.ExportOutputs(file, from, to)
+	default:
+		return fmt.Errorf("invalid kind %s, expected status or output", *kind)
+	}
+
+	// report what made it into the file, also when the export stopped
+	printRecords(e.stdout, e.format, []record.Record{{{Name: "file", Value: file}, {Name: "exported", Value: exported}}}, true)
+
+	return err
+}
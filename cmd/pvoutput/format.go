@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/skoef/pvoutput/internal/record"
+)
+
+// output formats
+const (
+	formatTable = "table"
+	formatCSV   = "csv"
+	formatJSON  = "json"
+)
+
+// printRecords prints given records in given format. A single record is
+// printed as JSON object rather than array when single is true
+func printRecords(w io.Writer, format string, records []record.Record, single bool) error {
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if single && len(records) == 1 {
+			return enc.Encode(records[0])
+		}
+
+		return enc.Encode(records)
+	case formatCSV:
+		cw := csv.NewWriter(w)
+		if len(records) > 0 {
+			cw.Write(records[0].Names())
+		}
+
+		for _, r := range records {
+			row := []string{}
+			for _, f := range r {
+				row = append(row, f.Text())
+			}
+			cw.Write(row)
+		}
+		cw.Flush()
+
+		return cw.Error()
+	case formatTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		if len(records) > 0 {
+			for i, f := range records[0] {
+				if i > 0 {
+					fmt.Fprint(tw, "\t")
+				}
+				fmt.Fprint(tw, f.Name)
+			}
+			fmt.Fprintln(tw)
+		}
+
+		for _, r := range records {
+			for i, f := range r {
+				if i > 0 {
+					fmt.Fprint(tw, "\t")
+				}
+				fmt.Fprint(tw, f.Text())
+			}
+			fmt.Fprintln(tw)
+		}
+
+		return tw.Flush()
+	}
+
+	return fmt.Errorf("unsupported format %s", format)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/skoef/pvoutput"
+	"github.com/skoef/pvoutput/csvimport"
+	"github.com/skoef/pvoutput/internal/record"
+)
+
+// columnsFlag collects field=column pairs
+type columnsFlag map[csvimport.Field]string
+
+func (f columnsFlag) String() string {
+	pairs := []string{}
+	for field, col := range f {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", field, col))
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func (f columnsFlag) Set(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return errors.New("expected field=column")
+	}
+	f[csvimport.Field(strings.ToLower(parts[0]))] = parts[1]
+
+	return nil
+}
+
+// importRecord returns the record summarising the import of given file
+func importRecord(file string, r *csvimport.Report) record.Record {
+	return record.Record{
+		{Name: "file", Value: file},
+		{Name: "rows", Value: r.Rows},
+		{Name: "imported", Value: r.Imported},
+		{Name: "uploaded", Value: r.Uploaded},
+		{Name: "skipped", Value: len(r.Skipped)},
+	}
+}
+
+func importCSV(e env, args []string) error {
+	columns := columnsFlag{}
+
+	fs := newFlagSet("import", e.stderr)
+	kind := fs.String("kind", "status", "what the rows are: status or output")
+	fs.Var(columns, "column", "maps a field onto a column as field=column, by header name or by number with -no-header; repeat for every field")
+	noHeader := fs.Bool("no-header", false, "the files have no header row")
+	skipLines := fs.Int("skip-lines", 0, "number of lines to skip before the header")
+	delimiter := fs.String("delimiter", ",", `field delimiter, "tab" for tabs`)
+	decimalComma := fs.Bool("decimal-comma", false, "numbers use a comma as decimal separator")
+	dateFormat := fs.String("date-format", "2006-01-02", `layout of the date column in Go's reference time, including the time when there is no time column, or "unix"`)
+	timeFormat := fs.String("time-format", "15:04", "layout of the time and peak time columns in Go's reference time")
+	timezone := fs.String("timezone", "", "time zone of the dates, e.g. Europe/Amsterdam, local time when omitted")
+	powerUnit := fs.String("power-unit", "W", "unit of power columns: W, kW or MW")
+	energyUnit := fs.String("energy-unit", "Wh", "unit of energy columns: Wh, kWh or MWh")
+	cumulative := fs.Int("cumulative", pvoutput.UnsetInt, "for statuses, 1 when all energy values are lifetime values, 2 for generation only, 3 for consumption only")
+	dryRun := fs.Bool("dry-run", false, "only read the files and report")
+	wait := fs.Bool("wait", false, "wait for the rate limit to reset when exceeded, instead of stopping")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("no files given")
+	}
+
+	m := csvimport.NewMapping(columns)
+	m.NoHeader = *noHeader
+	m.SkipLines = *skipLines
+	m.DecimalComma = *decimalComma
+	m.DateFormat = *dateFormat
+	m.TimeFormat = *timeFormat
+	m.PowerUnit = csvimport.Unit(*powerUnit)
+	m.EnergyUnit = csvimport.Unit(*energyUnit)
+	m.Cumulative = pvoutput.StatusCumulative(*cumulative)
+
+	if *delimiter == "tab" {
+		*delimiter = "\t"
+	}
+	if utf8.RuneCountInString(*delimiter) != 1 {
+		return errors.New("-delimiter should be a single character")
+	}
+	m.Comma, _ = utf8.DecodeRuneInString(*delimiter)
+
+	if *timezone != "" {
+		loc, err := time.LoadLocation(*timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone %s", *timezone)
+		}
+		m.Location = loc
+	}
+
+	if *kind != "status" && *kind != "output" {
+		return fmt.Errorf("invalid kind %s, expected status or output", *kind)
+	}
+
+	api := e.api
+	if *wait {
+		api = api.WithRateLimitWait()
+	}
+	importer := csvimport.NewImporter(api, e.donating)
+
+	records := []record.Record{}
+	for _, file := range fs.Args() {
+		report, err := importFile(importer, m, *kind, file, *dryRun)
+		if report != nil {
+			for _, s := range report.Skipped {
+				fmt.Fprintf(e.stderr, "%s: %s\n", file, s)
+			}
+			records = append(records, importRecord(file, report))
+		}
+		if err != nil {
+			printRecords(e.stdout, e.format, records, false)
+			return fmt.Errorf("%s: %s", file, err)
+		}
+	}
+
+	return printRecords(e.stdout, e.format, records, false)
+}
+
+// importFile reads given file and uploads its statuses or outputs, unless
+// dryRun is set
+func importFile(importer *csvimport.Importer, m csvimport.Mapping, kind, file string, dryRun bool) (*csvimport.Report, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if kind == "output" {
+		outputs, report, err := m.ReadOutputs(f)
+		if err != nil || dryRun {
+			return report, err
+		}
+
+		return report, importer.UploadOutputs(outputs, report)
+	}
+
+	statuses, report, err := m.ReadStatuses(f)
+	if err != nil || dryRun {
+		return report, err
+	}
+
+	return report, importer.UploadStatuses(statuses, report)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/skoef/pvoutput/influx"
+)
+
+// tagsFlag collects key=value tags
+type tagsFlag map[string]string
+
+func (f tagsFlag) String() string {
+	pairs := []string{}
+	for k, v := range f {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func (f tagsFlag) Set(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return errors.New("expected key=value")
+	}
+	f[parts[0]] = parts[1]
+
+	return nil
+}
+
+func forwardInflux(e env, args []string) error {
+	schema := influx.NewSchema()
+
+	fs := newFlagSet("forward-influx", e.stderr)
+	fs.StringVar(&schema.StatusMeasurement, "status-measurement", influx.DefaultStatusMeasurement, "measurement of statuses")
+	fs.StringVar(&schema.OutputMeasurement, "output-measurement", influx.DefaultOutputMeasurement, "measurement of daily outputs")
+	fs.Var(tagsFlag(schema.Tags), "tag", "only forward points with tag key=value; repeat for every tag")
+	precision := fs.String("precision", "ns", "precision of timestamps when reading files: ns, us, ms or s")
+	timezone := fs.String("timezone", "", "time zone of the dates of outputs, e.g. Europe/Amsterdam, local time when omitted")
+	listen := fs.String("listen", "", "address to accept writes on at /api/v2/write, instead of reading files")
+	flushInterval := fs.Duration("flush-interval", influx.DefaultFlushInterval, "how long to wait for more points of a status when reading files before uploading it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *timezone != "" {
+		loc, err := time.LoadLocation(*timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone %s", *timezone)
+		}
+		schema.Location = loc
+	}
+
+	forwarder := influx.NewForwarder(e.api, schema, e.donating)
+	forwarder.FlushInterval = *flushInterval
+
+	if *listen != "" {
+		if fs.NArg() > 0 {
+			return errors.New("-listen can not be combined with files")
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle("/api/v2/write", forwarder)
+		fmt.Fprintf(e.stderr, "accepting writes on %s\n", *listen)
+
+		return http.ListenAndServe(*listen, mux)
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	for _, file := range files {
+		if err := forwardFile(forwarder, file, influx.Precision(*precision)); err != nil {
+			return fmt.Errorf("%s: %s", file, err)
+		}
+	}
+
+	return nil
+}
+
+// forwardFile forwards the points in given file, or stdin for -
+func forwardFile(forwarder *influx.Forwarder, file string, precision influx.Precision) error {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	return forwarder.Forward(r, precision)
+}
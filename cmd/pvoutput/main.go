@@ -0,0 +1,141 @@
+// Command pvoutput uploads data to and queries data from PVOutput.org from
+// the command line
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/skoef/pvoutput"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Getenv, os.Stdout, os.Stderr))
+}
+
+// usage prints the tool's usage
+func usage(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintln(w, "usage: pvoutput [flags] <command> [command flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-14s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "flags:")
+	fs.PrintDefaults()
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "settings are read from the config file, then from %s, %s,\n", envAPIKey, envSystemID)
+	fmt.Fprintf(w, "%s and %s and finally from flags\n", envDonating, envBaseURL)
+}
+
+// run runs the tool with given arguments and returns its exit code
+func run(args []string, getenv func(string) string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("pvoutput", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	configPath := fs.String("config", "", "path to the config file (default "+defaultConfigPath()+")")
+	key := fs.String("key", "", "API key")
+	systemID := fs.String("system-id", "", "system ID")
+	donating := fs.Bool("donating", false, "the account is donating, allowing larger batches")
+	baseURL := fs.String("base-url", "", "base URL of the API, PVOutput's by default")
+	format := fs.String("format", formatTable, "output format: table, csv or json")
+	fs.Usage = func() { usage(stderr, fs) }
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	if fs.NArg() == 0 {
+		usage(stderr, fs)
+		return 2
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == fs.Arg(0) {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(stderr, "pvoutput: unknown command %s\n", fs.Arg(0))
+		usage(stderr, fs)
+		return 2
+	}
+
+	switch *format {
+	case formatTable, formatCSV, formatJSON:
+	default:
+		fmt.Fprintf(stderr, "pvoutput: unsupported format %s\n", *format)
+		return 2
+	}
+
+	path, required := *configPath, true
+	if path == "" {
+		path = getenv(envConfig)
+	}
+	if path == "" {
+		path, required = defaultConfigPath(), false
+	}
+
+	cfg, err := loadConfig(path, required)
+	if err != nil {
+		fmt.Fprintf(stderr, "pvoutput: could not load config: %s\n", err)
+		return 1
+	}
+	if err := cfg.applyEnv(getenv); err != nil {
+		fmt.Fprintf(stderr, "pvoutput: %s\n", err)
+		return 1
+	}
+
+	// flags override everything else
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "key":
+			cfg.APIKey = *key
+		case "system-id":
+			cfg.SystemID = *systemID
+		case "donating":
+			cfg.Donating = *donating
+		case "base-url":
+			cfg.BaseURL = *baseURL
+		}
+	})
+
+	if err := cfg.validate(); err != nil {
+		fmt.Fprintf(stderr, "pvoutput: %s\n", err)
+		return 2
+	}
+
+	api := pvoutput.NewAPI(cfg.APIKey, cfg.SystemID, cfg.Donating)
+	if cfg.BaseURL != "" {
+		api = api.WithBaseURL(cfg.BaseURL)
+	}
+
+	e := env{
+		api:      api,
+		donating: cfg.Donating,
+		format:   *format,
+		stdout:   stdout,
+		stderr:   stderr,
+		now:      time.Now,
+	}
+
+	if err := cmd.run(e, fs.Args()[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+
+		fmt.Fprintf(stderr, "pvoutput: %s: %s\n", cmd.name, err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/skoef/pvoutput"
+	"github.com/skoef/pvoutput/history"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePVOutput serves fixed responses per endpoint and records requests
+type fakePVOutput struct {
+	*httptest.Server
+	responses map[string]string
+	requests  []*http.Request
+	bodies    []string
+}
+
+func newFakePVOutput(t *testing.T) *fakePVOutput {
+	f := &fakePVOutput{responses: map[string]string{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		// batches hold semicolons, which ParseForm rejects, their bodies
+		// are checked instead
+		r.ParseForm()
+		f.requests = append(f.requests, r)
+		f.bodies = append(f.bodies, string(body))
+
+		if r.Header.Get("X-Pvoutput-Apikey") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, "Unauthorized 401: Invalid API Key")
+			return
+		}
+
+		resp, ok := f.responses[r.URL.Path]
+		if !ok {
+			resp = "OK 200: Added Status"
+		}
+		fmt.Fprint(w, resp)
+	}))
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+func (f *fakePVOutput) last() *http.Request {
+	if len(f.requests) == 0 {
+		return nil
+	}
+
+	return f.requests[len(f.requests)-1]
+}
+
+// runTest runs the tool against given fake with credentials from the
+// environment and returns its exit code and output
+func runTest(f *fakePVOutput, args ...string) (int, string, string) {
+	env := map[string]string{
+		envAPIKey:   "key",
+		envSystemID: "1234",
+		envBaseURL:  f.URL,
+		envConfig:   os.DevNull,
+	}
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run(args, func(k string) string { return env[k] }, stdout, stderr)
+
+	return code, stdout.String(), stderr.String()
+}
+
+func TestAddStatus(t *testing.T) {
+	f := newFakePVOutput(t)
+
+	code, _, stderr := runTest(f, "add-status", "-date", "20200818", "-time", "12:34", "-generating", "1500", "-temperature", "21.5", "-v7", "3.3")
+	require.Equal(t, 0, code, stderr)
+
+	req := f.last()
+	assert.Equal(t, "/addstatus.jsp", req.URL.Path)
+	assert.Equal(t, "20200818", req.PostForm.Get("d"))
+	assert.Equal(t, "12:34", req.PostForm.Get("t"))
+	assert.Equal(t, "1500", req.PostForm.Get("v2"))
+	assert.Equal(t, "21.5", req.PostForm.Get("v5"))
+	assert.Equal(t, "3.3", req.PostForm.Get("v7"))
+	assert.Empty(t, req.PostForm.Get("v1"))
+	assert.Empty(t, req.PostForm.Get("c1"))
+	assert.Equal(t, "1234", req.Header.Get("X-Pvoutput-SystemId"))
+
+	// date without time
+	code, _, _ = runTest(f, "add-status", "-date", "20200818", "-generating", "1500")
+	assert.Equal(t, 1, code)
+
+	code, _, _ = runTest(f, "add-status", "-generating", "lots")
+	assert.Equal(t, 1, code)
+}
+
+func TestAddOutput(t *testing.T) {
+	f := newFakePVOutput(t)
+
+	code, _, stderr := runTest(f, "add-output", "-date", "20200818", "-generated", "12000", "-peak-time", "12:30", "-condition", "Fine")
+	require.Equal(t, 0, code, stderr)
+
+	req := f.last()
+	assert.Equal(t, "/addoutput.jsp", req.URL.Path)
+	assert.Equal(t, "20200818", req.PostForm.Get("d"))
+	assert.Equal(t, "12000", req.PostForm.Get("g"))
+	assert.Equal(t, "12:30", req.PostForm.Get("pt"))
+	assert.Equal(t, "Fine", req.PostForm.Get("cd"))
+	assert.Empty(t, req.PostForm.Get("cm"))
+}
+
+func TestGetStatus(t *testing.T) {
+	f := newFakePVOutput(t)
+	f.responses["/getstatus.jsp"] = "20101107,18:30,12936,202,NaN,NaN,5.280,15.3,240.1"
+
+	code, stdout, stderr := runTest(f, "-format", "json", "get-status")
+	require.Equal(t, 0, code, stderr)
+	assert.JSONEq(t, `{"date":"2010-11-07","time":"18:30","generated_wh":12936,"generating_w":202,"normalised_output_kw_per_kw":5.28,"temperature_c":15.3,"voltage_v":240.1}`, stdout)
+
+	code, stdout, stderr = runTest(f, "-format", "csv", "get-status", "-date", "20101107", "-time", "18:30")
+	require.Equal(t, 0, code, stderr)
+	assert.Equal(t, "date,time,generated_wh,generating_w,consumed_wh,consuming_w,normalised_output_kw_per_kw,temperature_c,voltage_v\n2010-11-07,18:30,12936,202,,,5.28,15.3,240.1\n", stdout)
+	assert.Equal(t, "20101107", f.last().URL.Query().Get("d"))
+
+	f.responses["/getstatus.jsp"] = "20101107,14:00,12936,1.293,1400,1200,0.303,19832,459,15.3,240.1;20101107,13:55,12836,1.268,1350,1100,0.341,NaN,NaN,NaN,NaN"
+	code, stdout, stderr = runTest(f, "get-status", "-history", "-date", "20101107", "-limit", "2")
+	require.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "generating_w")
+	assert.Contains(t, stdout, "1200")
+	assert.Contains(t, stdout, "1100")
+	assert.Equal(t, "1", f.last().URL.Query().Get("h"))
+	assert.Equal(t, "2", f.last().URL.Query().Get("limit"))
+
+	// flag combinations that make no sense
+	code, _, _ = runTest(f, "get-status", "-limit", "2")
+	assert.Equal(t, 1, code)
+	code, _, _ = runTest(f, "get-status", "-time", "12:00")
+	assert.Equal(t, 1, code)
+}
+
+func TestGetOutput(t *testing.T) {
+	f := newFakePVOutput(t)
+	f.responses["/getoutput.jsp"] = "20110327,4413,0.460,1234,21859,2070,11:00,Showers,-3,6,4220,7308,2030,3888;20110326,3000,0.312,800,NaN,1800,12:05,Fine,NaN,NaN,NaN,NaN,NaN,NaN"
+
+	code, stdout, stderr := runTest(f, "-format", "json", "get-output", "-from", "20110326", "-to", "20110327")
+	require.Equal(t, 0, code, stderr)
+	assert.JSONEq(t, `[
+		{"date":"2011-03-27","generated_wh":4413,"efficiency_kwh_per_kw":0.46,"exported_wh":1234,"consumed_wh":21859,"peak_power_w":2070,"peak_time":"11:00","condition":"Showers","min_temperature_c":-3,"max_temperature_c":6,"import_peak_wh":4220,"import_off_peak_wh":7308,"import_shoulder_wh":2030,"import_high_shoulder_wh":3888},
+		{"date":"2011-03-26","generated_wh":3000,"efficiency_kwh_per_kw":0.312,"exported_wh":800,"peak_power_w":1800,"peak_time":"12:05","condition":"Fine"}
+	]`, stdout)
+	assert.Equal(t, "20110326", f.last().URL.Query().Get("df"))
+	assert.Equal(t, "20110327", f.last().URL.Query().Get("dt"))
+
+	code, _, _ = runTest(f, "get-output", "-from", "yesterday")
+	assert.Equal(t, 1, code)
+}
+
+func TestGetStatistic(t *testing.T) {
+	f := newFakePVOutput(t)
+	f.responses["/getstatistic.jsp"] = "24600,14220,913,2,2857,3.358,27,20100901,20100927,4.653,20100916"
+
+	code, stdout, stderr := runTest(f, "get-statistic")
+	require.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "24600")
+	assert.Contains(t, stdout, "2010-09-16")
+}
+
+func TestGetSystem(t *testing.T) {
+	f := newFakePVOutput(t)
+	f.responses["/getsystem.jsp"] = "Rooftop East,3960,3153,18,220,Sunpower,1,4000,Fronius,N,30.0,No,20100801,-37.8136,144.9631,5;1;;0"
+
+	code, stdout, stderr := runTest(f, "-format", "json", "get-system")
+	require.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, `"name": "Rooftop East"`)
+	assert.Contains(t, stdout, `"status_interval_min": 5`)
+}
+
+func TestDeleteStatus(t *testing.T) {
+	f := newFakePVOutput(t)
+
+	// time is always required
+	code, _, _ := runTest(f, "delete-status")
+	assert.Equal(t, 1, code)
+	assert.Nil(t, f.last())
+
+	code, _, stderr := runTest(f, "delete-status", "-date", "20200818", "-time", "12:35")
+	require.Equal(t, 0, code, stderr)
+	assert.Equal(t, "/deletestatus.jsp", f.last().URL.Path)
+	assert.Equal(t, "12:35", f.last().PostForm.Get("t"))
+}
+
+func TestMissing(t *testing.T) {
+	f := newFakePVOutput(t)
+	f.responses["/getmissing.jsp"] = "20200801,20200802"
+
+	code, stdout, stderr := runTest(f, "-format", "csv", "missing", "-from", "20200801", "-to", "20200831")
+	require.Equal(t, 0, code, stderr)
+	assert.Equal(t, "date\n2020-08-01\n2020-08-02\n", stdout)
+}
+
+func TestRun(t *testing.T) {
+	f := newFakePVOutput(t)
+
+	// usage
+	code, _, stderr := runTest(f)
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "get-statistic")
+
+	code, _, _ = runTest(f, "foobar")
+	assert.Equal(t, 2, code)
+
+	code, _, _ = runTest(f, "-format", "xml", "get-system")
+	assert.Equal(t, 2, code)
+
+	// flags override the environment
+	code, _, stderr = runTest(f, "-key", "invalid", "get-system")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "Invalid API Key")
+
+	// settings from a config file
+	dir, err := ioutil.TempDir("", "pvoutput")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte("api_key: key\nsystem_id: \"5678\"\nbase_url: "+f.URL+"\n"), 0600))
+
+	stdout, stderr2 := &bytes.Buffer{}, &bytes.Buffer{}
+	code = run([]string{"-config", path, "get-system"}, func(string) string { return "" }, stdout, stderr2)
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "5678", f.last().Header.Get("X-Pvoutput-SystemId"))
+
+	// missing credentials
+	code = run([]string{"-config", os.DevNull, "get-system"}, func(string) string { return "" }, stdout, stderr2)
+	assert.Equal(t, 2, code)
+}
+
+func TestDateTime(t *testing.T) {
+	now := time.Date(2020, 8, 18, 12, 34, 56, 0, time.Local)
+
+	dt, err := dateTime("", "", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 8, 18, 12, 34, 0, 0, time.Local), dt)
+
+	dt, err = dateTime("", "09:15", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 8, 18, 9, 15, 0, 0, time.Local), dt)
+
+	dt, err = dateTime("20200101", "23:59", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 1, 1, 23, 59, 0, 0, time.Local), dt)
+
+	_, err = dateTime("20200101", "", now)
+	assert.Error(t, err)
+	_, err = dateTime("", "25:00", now)
+	assert.Error(t, err)
+}
+
+func TestImport(t *testing.T) {
+	f := newFakePVOutput(t)
+
+	dir, err := ioutil.TempDir("", "pvoutput")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	path := filepath.Join(dir, "export.csv")
+	data := "Time;Power (kW)\n" +
+		now.Add(-10*time.Minute).Format("2006-01-02 15:04") + ";1,5\n" +
+		now.Add(-5*time.Minute).Format("2006-01-02 15:04") + ";1,6\n" +
+		now.AddDate(0, 0, -20).Format("2006-01-02 15:04") + ";1,7\n" +
+		"yesterday;1,8\n"
+	require.NoError(t, ioutil.WriteFile(path, []byte(data), 0600))
+
+	args := []string{"-format", "csv", "import", "-column", "date=Time", "-column", "generating=Power (kW)",
+		"-delimiter", ";", "-decimal-comma", "-date-format", "2006-01-02 15:04", "-power-unit", "kW"}
+
+	// dry run
+	code, stdout, stderr := runTest(f, append(args, "-dry-run", path)...)
+	require.Equal(t, 0, code, stderr)
+	assert.Equal(t, "file,rows,imported,uploaded,skipped\n"+path+",4,3,0,1\n", stdout)
+	assert.Contains(t, stderr, path+`: line 5: invalid date "yesterday"`)
+	assert.Nil(t, f.last())
+
+	code, stdout, stderr = runTest(f, append(args, path)...)
+	require.Equal(t, 0, code, stderr)
+	assert.Equal(t, "file,rows,imported,uploaded,skipped\n"+path+",4,3,2,2\n", stdout)
+	assert.Contains(t, stderr, ": older than 14 days")
+
+	req := f.last()
+	assert.Equal(t, "/addbatchstatus.jsp", req.URL.Path)
+	// batches hold semicolons, which ParseForm doesn't accept
+	assert.Equal(t, "data="+now.Add(-10*time.Minute).Format("20060102,15:04")+",,1500;"+now.Add(-5*time.Minute).Format("20060102,15:04")+",,1600", f.bodies[len(f.bodies)-1])
+
+	code, _, stderr = runTest(f, "import", "-kind", "daily", path)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "invalid kind daily")
+
+	code, _, stderr = runTest(f, "import", "-column", "date=Time", "-column", "power=Power (kW)", path)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "field power is not supported")
+}
+
+func TestExport(t *testing.T) {
+	f := newFakePVOutput(t)
+	f.responses["/getoutput.jsp"] = "20110327,4413,0.460,1234,21859,2070,11:00,Showers,-3,6,4220,7308,2030,3888;20110326,3000,0.312,800,NaN,1800,12:05,Fine,NaN,NaN,NaN,NaN,NaN,NaN"
+
+	dir, err := ioutil.TempDir("", "pvoutput")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "outputs.csv")
+
+	code, stdout, stderr := runTest(f, "-format", "csv", "export", "-kind", "output", "-from", "20110320", "-to", "20110327", path)
+	require.Equal(t, 0, code, stderr)
+	assert.Equal(t, "file,exported\n"+path+",2\n", stdout)
+	assert.Equal(t, "/getoutput.jsp", f.last().URL.Path)
+	assert.Equal(t, "20110320", f.last().URL.Query().Get("df"))
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "date,generated_wh,efficiency_kwh_per_kw,exported_wh,consumed_wh,peak_power_w,peak_time,condition,min_temperature_c,max_temperature_c,import_peak_wh,import_off_peak_wh,import_shoulder_wh,import_high_shoulder_wh,export_peak_wh,export_off_peak_wh,export_shoulder_wh,export_high_shoulder_wh\n"+
+		"2011-03-26,3000,0.312,800,,1800,12:05,Fine,,,,,,,,,,\n"+
+		"2011-03-27,4413,0.46,1234,21859,2070,11:00,Showers,-3,6,4220,7308,2030,3888,,,,\n", string(data))
+
+	// resuming continues after the last output
+	code, stdout, stderr = runTest(f, "-format", "csv", "export", "-kind", "output", "-to", "20110327", path)
+	require.Equal(t, 0, code, stderr)
+	assert.Equal(t, "file,exported\n"+path+",0\n", stdout)
+
+	code, _, stderr = runTest(f, "export", "-from", "20110320", filepath.Join(dir, "statuses.txt"))
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "-file-format is required")
+}
+
+func TestForwardInflux(t *testing.T) {
+	f := newFakePVOutput(t)
+
+	dir, err := ioutil.TempDir("", "pvoutput")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "points.txt")
+	data := "solar,site=roof power=1500i,energy=10000i 1597753800\n" +
+		"solar,site=shed power=200i 1597753800\n" +
+		"solar_daily,site=roof generated_wh=12000i 1597708800\n"
+	require.NoError(t, ioutil.WriteFile(path, []byte(data), 0600))
+
+	// fields are named like the JSON representation, so these points carry
+	// no status fields
+	code, _, stderr := runTest(f, "forward-influx", "-status-measurement", "solar", "-tag", "site=roof", "-precision", "s", path)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, path+": line 1: no status fields")
+
+	data = "solar,site=roof generating_w=1500i,generated_wh=10000i 1597753800\n" +
+		"solar,site=shed generating_w=200i 1597753800\n" +
+		"solar_daily,site=roof generated_wh=12000i 1597708800\n"
+	require.NoError(t, ioutil.WriteFile(path, []byte(data), 0600))
+
+	code, _, stderr = runTest(f, "forward-influx", "-status-measurement", "solar", "-output-measurement", "solar_daily",
+		"-tag", "site=roof", "-precision", "s", "-timezone", "UTC", path)
+	require.Equal(t, 0, code, stderr)
+	require.Len(t, f.requests, 2)
+	assert.Equal(t, "/addbatchstatus.jsp", f.requests[0].URL.Path)
+	assert.Equal(t, "data=20200818,12:30,10000,1500", f.bodies[0])
+	assert.Equal(t, "/addoutput.jsp", f.requests[1].URL.Path)
+	assert.Equal(t, "20200818", f.requests[1].PostForm.Get("d"))
+	assert.Equal(t, "12000", f.requests[1].PostForm.Get("g"))
+
+	code, _, stderr = runTest(f, "forward-influx", "-tag", "site", path)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "expected key=value")
+}
+
+func TestReconcile(t *testing.T) {
+	f := newFakePVOutput(t)
+	f.responses["/getoutput.jsp"] = "20110327,4413,0.460,1234,21859,2070,11:00,Showers,-3,6,4220,7308,2030,3888;20110326,3000,0.312,800,NaN,1800,12:05,Fine,NaN,NaN,NaN,NaN,NaN,NaN"
+
+	dir, err := ioutil.TempDir("", "pvoutput")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := history.NewFileStore(dir)
+	require.NoError(t, err)
+	records := []history.OutputRecord{}
+	for _, o := range []struct {
+		date      time.Time
+		generated int
+	}{
+		{time.Date(2011, 3, 26, 0, 0, 0, 0, time.Local), 3010},
+		{time.Date(2011, 3, 27, 0, 0, 0, 0, time.Local), 4500},
+	} {
+		op := pvoutput.NewOutput()
+		op.Date = o.date
+		op.Generated = o.generated
+		records = append(records, history.OutputRecord{Output: op, Upload: history.Upload{Uploaded: true}})
+	}
+	require.NoError(t, store.AddOutputs(records))
+
+	code, stdout, stderr := runTest(f, "-format", "csv", "reconcile", "-history", dir, "-from", "20110326", "-to", "20110327", "-tolerance", "generated_wh=10")
+	require.Equal(t, 0, code, stderr)
+	assert.Equal(t, "date,difference,field,local,remote\n2011-03-27,mismatch,generated_wh,4500,4413\n", stdout)
+	assert.Equal(t, "/getoutput.jsp", f.last().URL.Path)
+
+	code, stdout, stderr = runTest(f, "-format", "csv", "reconcile", "-history", dir, "-from", "20110326", "-to", "20110327", "-tolerance", "2%")
+	require.Equal(t, 0, code, stderr)
+	assert.Equal(t, "", stdout)
+
+	code, _, stderr = runTest(f, "reconcile", "-history", dir, "-from", "20110326", "-to", "20110327", "-correct")
+	require.Equal(t, 0, code, stderr)
+	assert.Equal(t, "corrected output of 2011-03-26\ncorrected output of 2011-03-27\n", stderr)
+	assert.Equal(t, "/addoutput.jsp", f.last().URL.Path)
+	assert.Equal(t, "20110327", f.last().PostForm.Get("d"))
+	assert.Equal(t, "4500", f.last().PostForm.Get("g"))
+
+	code, _, stderr = runTest(f, "reconcile", "-kind", "status", "-correct", "-history", dir)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "-correct only applies to outputs")
+
+	code, _, stderr = runTest(f, "reconcile", "-history", dir, "-tolerance", "lots")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "invalid tolerance lots")
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/skoef/pvoutput/history"
+	"github.com/skoef/pvoutput/internal/record"
+	"github.com/skoef/pvoutput/reconcile"
+)
+
+// tolerancesFlag collects tolerances as field=tolerance, or as a single
+// tolerance applying to all other fields. Tolerances are absolute, or
+// relative when ending in %
+type tolerancesFlag struct {
+	tolerances map[string]reconcile.Tolerance
+	def        *reconcile.Tolerance
+}
+
+func (f tolerancesFlag) String() string {
+	return ""
+}
+
+func (f tolerancesFlag) Set(s string) error {
+	name, value := "", s
+	if parts := strings.SplitN(s, "=", 2); len(parts) == 2 {
+		name, value = parts[0], parts[1]
+		if name == "" {
+			return errors.New("expected field=tolerance or tolerance")
+		}
+	}
+
+	t := reconcile.Tolerance{}
+	if strings.HasSuffix(value, "%") {
+		v, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil || v < 0 {
+			return fmt.Errorf("invalid tolerance %s", value)
+		}
+		t.Relative = v / 100
+	} else {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || v < 0 {
+			return fmt.Errorf("invalid tolerance %s", value)
+		}
+		t.Absolute = v
+	}
+
+	if name == "" {
+		*f.def = t
+	} else {
+		f.tolerances[name] = t
+	}
+
+	return nil
+}
+
+// differenceRecord returns the record of given difference of a status, or
+// of an output when dateOnly is set
+func differenceRecord(d history.Difference, dateOnly bool) record.Record {
+	r := record.Record{{Name: "date", Value: d.Time.Format("2006-01-02")}}
+	if !dateOnly {
+		r = append(r, record.Field{Name: "time", Value: d.Time.Format(timeLayout)})
+	}
+
+	var fieldName interface{}
+	if d.Field != "" {
+		fieldName = d.Field
+	}
+
+	return append(r,
+		record.Field{Name: "difference", Value: string(d.Kind)},
+		record.Field{Name: "field", Value: fieldName},
+		record.Field{Name: "local", Value: d.Local},
+		record.Field{Name: "remote", Value: d.Remote},
+	)
+}
+
+func reconcileHistory(e env, args []string) error {
+	fs := newFlagSet("reconcile", e.stderr)
+	kind := fs.String("kind", "output", "what to compare: status or output")
+	dates := dateRangeFlags(fs)
+	dir := fs.String("history", "", "directory of the history of uploads to compare with, as recorded by pvoutputd")
+	tolerances := tolerancesFlag{tolerances: map[string]reconcile.Tolerance{}, def: &reconcile.Tolerance{}}
+	fs.Var(tolerances, "tolerance", "allowed difference as field=tolerance, or tolerance for all other fields; absolute, or relative when ending in %")
+	correct := fs.Bool("correct", false, "upload the local outputs of the dates that differ again")
+	wait := fs.Bool("wait", false, "wait for the rate limit to reset when exceeded, instead of stopping")
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	if *dir == "" {
+		return errors.New("-history is required")
+	}
+	if *kind != "status" && *kind != "output" {
+		return fmt.Errorf("invalid kind %s, expected status or output", *kind)
+	}
+	if *correct && *kind != "output" {
+		return errors.New("-correct only applies to outputs")
+	}
+
+	from, to, err := dates()
+	if err != nil {
+		return err
+	}
+
+	store, err := history.NewFileStore(*dir)
+	if err != nil {
+		return err
+	}
+
+	api := e.api
+	if *wait {
+		api = api.WithRateLimitWait()
+	}
+	r := reconcile.NewReconciler(api, reconcile.FromHistory(store))
+	r.Tolerances = tolerances.tolerances
+	r.DefaultTolerance = *tolerances.def
+	r.Correct = *correct
+	r.Donating = e.donating
+
+	var report reconcile.Report
+	if *kind == "status" {
+		report, err = r.ReconcileStatuses(from, to)
+	} else {
+		report, err = r.ReconcileOutputs(from, to)
+	}
+
+	records := []record.Record{}
+	for _, d := range report.Differences {
+		records = append(records, differenceRecord(d, *kind == "output"))
+	}
+	printErr := printRecords(e.stdout, e.format, records, false)
+
+	for _, d := range report.Corrected {
+		fmt.Fprintf(e.stderr, "corrected output of %s\n", d.Format("2006-01-02"))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return printErr
+}
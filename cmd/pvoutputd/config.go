@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaults for optional settings
+const (
+	defaultInterval       = 5 * time.Minute
+	defaultSampleInterval = 30 * time.Second
+	defaultOutputDelay    = 30 * time.Minute
+)
+
+// config is the daemon's configuration, read from a YAML file
+type config struct {
+	APIKey   string `yaml:"api_key"`
+	SystemID string `yaml:"system_id"`
+	Donating bool   `yaml:"donating"`
+	BaseURL  string `yaml:"base_url"`
+	// Interval is the system's status interval
+	Interval time.Duration `yaml:"interval"`
+	// SampleInterval is how often the sources are polled
+	SampleInterval time.Duration `yaml:"sample_interval"`
+	// Timezone the system is in, the local time zone when empty
+	Timezone string `yaml:"timezone"`
+	// Latitude and Longitude locate the system, to close the day after
+	// sunset. Without them, the day is closed when it ends
+	Latitude  *float64 `yaml:"latitude"`
+	Longitude *float64 `yaml:"longitude"`
+	// OutputDelay is how long after sunset the day is closed
+	OutputDelay time.Duration `yaml:"output_delay"`
+	// HealthAddress is the address the health endpoint listens on, e.g.
+	// :8080. The endpoint is disabled when empty
+	HealthAddress string `yaml:"health_address"`
+	// Metrics serves Prometheus metrics of the uploaded statuses on the
+	// health endpoint's address, at /metrics
+	Metrics bool `yaml:"metrics"`
+	// MetricsPollInterval is how often PVOutput's own status and statistics
+	// are read for the metrics. They are not read when zero
+	MetricsPollInterval time.Duration `yaml:"metrics_poll_interval"`
+	// HistoryDir is the directory every upload is recorded in, with its
+	// outcome. Uploads are not recorded when empty
+	HistoryDir string         `yaml:"history_dir"`
+	Sources    []sourceConfig `yaml:"sources"`
+}
+
+// sourceConfig configures a single data source. Which settings apply
+// depends on its type
+type sourceConfig struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+	// Host is the host name or address of fronius and enphase sources
+	Host string `yaml:"host"`
+	// Token is the access token of enphase sources with firmware D7 and up
+	Token string `yaml:"token"`
+	// ExtendedInverters lists the serial numbers of the microinverters of
+	// enphase sources mapped onto extended data fields v7 to v12
+	ExtendedInverters []string `yaml:"extended_inverters"`
+	// Address is the host:port of sunspec sources and of dsmr sources read
+	// through a TCP-to-serial bridge
+	Address string `yaml:"address"`
+	// UnitID is the Modbus unit ID of sunspec sources
+	UnitID byte `yaml:"unit_id"`
+	// Device is the serial device of dsmr sources, which should be
+	// configured for the meter's baud rate beforehand
+	Device string `yaml:"device"`
+	// Fields limits which fields are taken from the source, all fields it
+	// reports by default
+	Fields []string `yaml:"fields"`
+}
+
+// loadConfig reads the config file at given path and fills in defaults
+func loadConfig(path string) (config, error) {
+	c := config{}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return c, err
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&c); err != nil && err != io.EOF {
+		return c, err
+	}
+
+	if c.Interval == 0 {
+		c.Interval = defaultInterval
+	}
+	if c.SampleInterval == 0 {
+		c.SampleInterval = defaultSampleInterval
+	}
+	if c.OutputDelay == 0 {
+		c.OutputDelay = defaultOutputDelay
+	}
+
+	for i := range c.Sources {
+		if c.Sources[i].Name == "" {
+			c.Sources[i].Name = fmt.Sprintf("%s%d", c.Sources[i].Type, i+1)
+		}
+	}
+
+	return c, c.validate()
+}
+
+// validate checks whether the config is complete and consistent
+func (c config) validate() error {
+	if c.APIKey == "" {
+		return errors.New("api_key is required")
+	}
+	if c.SystemID == "" {
+		return errors.New("system_id is required")
+	}
+
+	if c.Interval < time.Minute || (24*time.Hour)%c.Interval != 0 {
+		return errors.New("interval should be a whole number of minutes evenly dividing a day")
+	}
+	if c.SampleInterval <= 0 || c.SampleInterval > c.Interval {
+		return errors.New("sample_interval should be positive and at most interval")
+	}
+
+	if _, err := c.location(); err != nil {
+		return err
+	}
+
+	if (c.Latitude == nil) != (c.Longitude == nil) {
+		return errors.New("latitude and longitude should be set together")
+	}
+	if c.Latitude != nil && (*c.Latitude < -90 || *c.Latitude > 90) {
+		return errors.New("latitude should be between -90 and 90")
+	}
+	if c.Longitude != nil && (*c.Longitude < -180 || *c.Longitude > 180) {
+		return errors.New("longitude should be between -180 and 180")
+	}
+
+	if c.Metrics && c.HealthAddress == "" {
+		return errors.New("metrics require health_address")
+	}
+	if c.MetricsPollInterval < 0 || (c.MetricsPollInterval > 0 && !c.Metrics) {
+		return errors.New("metrics_poll_interval should be positive and requires metrics")
+	}
+
+	if len(c.Sources) == 0 {
+		return errors.New("at least one source is required")
+	}
+
+	names := map[string]bool{}
+	for _, s := range c.Sources {
+		if names[s.Name] {
+			return fmt.Errorf("source name %s is used more than once", s.Name)
+		}
+		names[s.Name] = true
+
+		if err := s.validate(); err != nil {
+			return fmt.Errorf("source %s: %s", s.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// location returns the time zone of the system
+func (c config) location() (*time.Location, error) {
+	if c.Timezone == "" {
+		return time.Local, nil
+	}
+
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone: %s", err)
+	}
+
+	return loc, nil
+}
+
+// validate checks whether the settings required by the source's type are
+// set
+func (s sourceConfig) validate() error {
+	t, ok := sourceTypes[s.Type]
+	if !ok {
+		return fmt.Errorf("unknown type %q", s.Type)
+	}
+
+	if _, err := parseFields(s.Fields); err != nil {
+		return err
+	}
+
+	return t.validate(s)
+}
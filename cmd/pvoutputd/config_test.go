@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+	c, err := loadConfig("testdata/config.yaml")
+	require.NoError(t, err)
+
+	assert.Equal(t, "secret", c.APIKey)
+	assert.Equal(t, "12345", c.SystemID)
+	assert.True(t, c.Donating)
+	assert.Equal(t, 10*time.Minute, c.Interval)
+	assert.Equal(t, time.Minute, c.SampleInterval)
+	assert.Equal(t, defaultOutputDelay, c.OutputDelay)
+	assert.InDelta(t, 52.37, *c.Latitude, 0.001)
+	assert.InDelta(t, 4.90, *c.Longitude, 0.001)
+	assert.Equal(t, "127.0.0.1:9522", c.HealthAddress)
+	assert.True(t, c.Metrics)
+	assert.Equal(t, 15*time.Minute, c.MetricsPollInterval)
+	assert.Equal(t, "/var/lib/pvoutputd/history", c.HistoryDir)
+
+	loc, err := c.location()
+	require.NoError(t, err)
+	assert.Equal(t, "Europe/Amsterdam", loc.String())
+
+	require.Len(t, c.Sources, 3)
+	assert.Equal(t, "roof", c.Sources[0].Name)
+	assert.Equal(t, []string{"generating", "generated", "voltage"}, c.Sources[0].Fields)
+	// sources are named after their type and position by default
+	assert.Equal(t, "dsmr2", c.Sources[1].Name)
+	assert.Equal(t, "192.168.1.30:2001", c.Sources[1].Address)
+	assert.Equal(t, "sunspec3", c.Sources[2].Name)
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pvoutputd")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = loadConfig(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+
+	tests := map[string]string{
+		"":                                     "api_key is required",
+		"api_key: x":                           "system_id is required",
+		"api_key: x\nsystem_id: 1":             "at least one source is required",
+		"api_key: x\nsystem_id: 1\nunknown: 1": "field unknown not found",
+		"api_key: x\nsystem_id: 1\ninterval: 7m\nsources: [{type: fronius, host: x}]":                               "interval should be",
+		"api_key: x\nsystem_id: 1\nsample_interval: 10m\nsources: [{type: fronius, host: x}]":                       "sample_interval should be",
+		"api_key: x\nsystem_id: 1\ntimezone: Mars/Olympus\nsources: [{type: fronius, host: x}]":                     "invalid timezone",
+		"api_key: x\nsystem_id: 1\nlatitude: 52\nsources: [{type: fronius, host: x}]":                               "latitude and longitude should be set together",
+		"api_key: x\nsystem_id: 1\nlatitude: 91\nlongitude: 0\nsources: [{type: fronius, host: x}]":                 "latitude should be",
+		"api_key: x\nsystem_id: 1\nmetrics: true\nsources: [{type: fronius, host: x}]":                              "metrics require health_address",
+		"api_key: x\nsystem_id: 1\nmetrics_poll_interval: 5m\nsources: [{type: fronius, host: x}]":                  "metrics_poll_interval should be positive and requires metrics",
+		"api_key: x\nsystem_id: 1\nsources: [{type: solaredge}]":                                                    `source solaredge1: unknown type "solaredge"`,
+		"api_key: x\nsystem_id: 1\nsources: [{type: fronius}]":                                                      "source fronius1: host is required",
+		"api_key: x\nsystem_id: 1\nsources: [{type: sunspec}]":                                                      "source sunspec1: address is required",
+		"api_key: x\nsystem_id: 1\nsources: [{type: dsmr}]":                                                         "source dsmr1: either address or device is required",
+		"api_key: x\nsystem_id: 1\nsources: [{type: fronius, host: x, fields: [power]}]":                            `source fronius1: unknown field "power"`,
+		"api_key: x\nsystem_id: 1\nsources: [{name: a, type: fronius, host: x}, {name: a, type: fronius, host: y}]": "source name a is used more than once",
+	}
+
+	for input, expected := range tests {
+		path := filepath.Join(dir, "config.yaml")
+		require.NoError(t, ioutil.WriteFile(path, []byte(input), 0600))
+
+		_, err := loadConfig(path)
+		if assert.Error(t, err, input) {
+			assert.Contains(t, err.Error(), expected, input)
+		}
+	}
+}
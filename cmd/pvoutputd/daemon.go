@@ -0,0 +1,429 @@
+package main
+
+import (
+	"io"
+	"math"
+	"time"
+
+	"github.com/skoef/pvoutput"
+)
+
+// uploader uploads statuses and outputs, it is implemented by pvoutput.API
+type uploader interface {
+	AddStatus(s pvoutput.Status) error
+	AddBatchStatus(b pvoutput.BatchStatus) error
+	AddOutput(o pvoutput.Output) error
+}
+
+// polledSource is a source with the state the daemon keeps for it
+type polledSource struct {
+	name   string
+	source source
+	fields fieldSet
+	// generated and consumed convert lifetime energy into energy today
+	generated pvoutput.Counter
+	consumed  pvoutput.Counter
+	// day and the energy generated and consumed on it, unset when unknown
+	day            string
+	generatedToday int
+	consumedToday  int
+}
+
+// newPolledSource returns a new polledSource for given source
+func newPolledSource(name string, src source, fields fieldSet) *polledSource {
+	return &polledSource{
+		name:           name,
+		source:         src,
+		fields:         fields,
+		generatedToday: pvoutput.UnsetInt,
+		consumedToday:  pvoutput.UnsetInt,
+	}
+}
+
+// observe records the energy values of given status, polled for the
+// interval reported at given time
+func (p *polledSource) observe(st pvoutput.Status, at time.Time) error {
+	if day := at.Format("20060102"); day != p.day {
+		p.day = day
+		p.generatedToday, p.consumedToday = pvoutput.UnsetInt, pvoutput.UnsetInt
+	}
+
+	if p.fields.has(fieldGenerated) && st.Generated >= 0 {
+		v := st.Generated
+		if st.Cumulative == pvoutput.StatusCumulativeAll || st.Cumulative == pvoutput.StatusCumulativeGenerating {
+			daily, err := p.generated.Observe(at, uint64(v))
+			if err != nil {
+				return err
+			}
+			v = int(daily)
+		}
+		p.generatedToday = v
+	}
+
+	if p.fields.has(fieldConsumed) && st.Consumed >= 0 {
+		v := st.Consumed
+		if st.Cumulative == pvoutput.StatusCumulativeAll || st.Cumulative == pvoutput.StatusCumulativeConsuming {
+			daily, err := p.consumed.Observe(at, uint64(v))
+			if err != nil {
+				return err
+			}
+			v = int(daily)
+		}
+		p.consumedToday = v
+	}
+
+	return nil
+}
+
+// reading accumulates a power value within an interval
+type reading struct {
+	sum   float64
+	count int
+}
+
+func (r *reading) add(v float64) {
+	r.sum += v
+	r.count++
+}
+
+// average returns the average value, or unset without any values
+func (r reading) average() int {
+	if r.count == 0 {
+		return pvoutput.UnsetInt
+	}
+
+	return int(math.Round(r.sum / float64(r.count)))
+}
+
+// interval holds the values polled within a single status interval
+type interval struct {
+	end         time.Time
+	polled      bool
+	generating  reading
+	consuming   reading
+	temperature float64
+	voltage     float64
+	extended    [6]float64
+}
+
+func newInterval(end time.Time) *interval {
+	return &interval{
+		end:         end,
+		temperature: pvoutput.UnsetFloat,
+		voltage:     pvoutput.UnsetFloat,
+		extended:    pvoutput.NewStatus().Extended,
+	}
+}
+
+// daemon polls its sources, uploads a Status for every interval and closes
+// each day with an Output
+type daemon struct {
+	api     uploader
+	sources []*polledSource
+	// interval is the system's status interval
+	interval time.Duration
+	location *time.Location
+	// located is set when latitude and longitude are known, in which case
+	// the day is closed outputDelay after sunset
+	located     bool
+	latitude    float64
+	longitude   float64
+	outputDelay time.Duration
+	log         *logger
+	health      *health
+
+	current *interval
+	queue   pvoutput.BatchStatus
+	// day holds the date of statuses, the statuses of that day so far and
+	// when its Output was last uploaded
+	day      string
+	statuses []pvoutput.Status
+	outputAt time.Time
+	// pending is the Output of the previous day when it failed to upload
+	pending *pvoutput.Output
+}
+
+// maxQueued returns the maximum number of statuses waiting for upload, a
+// day's worth. Older statuses are dropped
+func (d *daemon) maxQueued() int {
+	return int(24 * time.Hour / d.interval)
+}
+
+// tick polls the sources and uploads whatever is due at given time
+func (d *daemon) tick(now time.Time) {
+	now = now.In(d.location)
+
+	d.flush(now)
+	d.poll(now)
+	d.closeDay(now)
+}
+
+// poll polls all sources and records their values in the current interval
+func (d *daemon) poll(now time.Time) {
+	if d.current == nil {
+		d.current = newInterval(pvoutput.NewResampler(d.interval).Boundary(now))
+	}
+	cur := d.current
+	at := pvoutput.StatusTime(cur.end)
+
+	generating, consuming := pvoutput.UnsetInt, pvoutput.UnsetInt
+	sum := func(total *int, v int) {
+		if v < 0 {
+			return
+		}
+		if *total < 0 {
+			*total = 0
+		}
+		*total += v
+	}
+
+	polled := 0
+	for _, p := range d.sources {
+		st, err := p.source.Status()
+		if err != nil {
+			d.log.error("could not poll source", "source", p.name, "error", err)
+			d.health.failed(err)
+			continue
+		}
+		polled++
+
+		if err := p.observe(st, at); err != nil {
+			d.log.error("could not track energy", "source", p.name, "error", err)
+		}
+
+		if p.fields.has(fieldGenerating) {
+			sum(&generating, st.Generating)
+		}
+		if p.fields.has(fieldConsuming) {
+			sum(&consuming, st.Consuming)
+		}
+		if p.fields.has(fieldTemperature) && st.Temperature != pvoutput.UnsetFloat {
+			cur.temperature = st.Temperature
+		}
+		if p.fields.has(fieldVoltage) && st.Voltage != pvoutput.UnsetFloat {
+			cur.voltage = st.Voltage
+		}
+		if p.fields.has(fieldExtended) {
+			for i, v := range st.Extended {
+				if v != pvoutput.UnsetFloat {
+					cur.extended[i] = v
+				}
+			}
+		}
+	}
+
+	if polled == 0 {
+		return
+	}
+
+	cur.polled = true
+	if generating >= 0 {
+		cur.generating.add(float64(generating))
+	}
+	if consuming >= 0 {
+		cur.consuming.add(float64(consuming))
+	}
+	d.health.sampled(now)
+}
+
+// status returns the Status for given interval. Energy values are the sum
+// of the energy today of all sources that reported it
+func (d *daemon) status(cur *interval) pvoutput.Status {
+	s := pvoutput.NewStatus()
+	s.DateTime = pvoutput.StatusTime(cur.end)
+	s.Generating = cur.generating.average()
+	s.Consuming = cur.consuming.average()
+	s.Temperature = cur.temperature
+	s.Voltage = cur.voltage
+	s.Extended = cur.extended
+
+	day := s.DateTime.Format("20060102")
+	generated, consumed := pvoutput.UnsetInt, pvoutput.UnsetInt
+	for _, p := range d.sources {
+		if p.day != day {
+			continue
+		}
+		if p.generatedToday >= 0 {
+			generated = int(math.Max(0, float64(generated))) + p.generatedToday
+		}
+		if p.consumedToday >= 0 {
+			consumed = int(math.Max(0, float64(consumed))) + p.consumedToday
+		}
+	}
+	s.Generated = generated
+	s.Consumed = consumed
+
+	return s
+}
+
+// flush closes the current interval when given time is past its end, queues
+// its Status and uploads the queue
+func (d *daemon) flush(now time.Time) {
+	if d.current == nil || !now.After(d.current.end) {
+		return
+	}
+
+	cur := d.current
+	d.current = newInterval(pvoutput.NewResampler(d.interval).Boundary(now))
+
+	if cur.polled {
+		s := d.status(cur)
+
+		if day := s.DateTime.Format("20060102"); day != d.day {
+			d.finishDay()
+			d.day = day
+			d.statuses = nil
+			d.outputAt = time.Time{}
+		}
+
+		d.statuses = append(d.statuses, s)
+		d.queue = append(d.queue, s)
+		if len(d.queue) > d.maxQueued() {
+			d.log.error("dropping statuses that failed to upload", "count", len(d.queue)-d.maxQueued())
+			d.queue = d.queue[len(d.queue)-d.maxQueued():]
+		}
+	}
+
+	d.upload(now)
+}
+
+// upload uploads the queued statuses, oldest first, in batches
+func (d *daemon) upload(now time.Time) {
+	defer func() {
+		d.health.queued(d.queue)
+	}()
+
+	for len(d.queue) > 0 {
+		n := len(d.queue)
+		if n > pvoutput.BatchStatusMaxSize {
+			n = pvoutput.BatchStatusMaxSize
+		}
+		batch := d.queue[:n]
+
+		var err error
+		if n == 1 {
+			err = d.api.AddStatus(batch[0])
+		} else {
+			err = d.api.AddBatchStatus(batch)
+		}
+
+		if err != nil {
+			d.log.error("could not upload status", "count", n, "queued", len(d.queue), "error", err)
+			d.health.failed(err)
+			return
+		}
+
+		last := batch[n-1]
+		d.log.info("uploaded status", "count", n, "time", last.DateTime,
+			"generated_wh", last.Generated, "generating_w", last.Generating,
+			"consumed_wh", last.Consumed, "consuming_w", last.Consuming)
+		d.health.uploaded(now)
+		d.queue = d.queue[n:]
+	}
+}
+
+// closeDay uploads the Output of the current day once it is past sunset and
+// retries uploading the previous day's Output
+func (d *daemon) closeDay(now time.Time) {
+	if d.pending != nil {
+		if err := d.uploadOutput(*d.pending); err == nil {
+			d.pending = nil
+		}
+	}
+
+	if !d.located || !d.outputAt.IsZero() || len(d.statuses) == 0 {
+		return
+	}
+
+	set, ok := sunset(d.statuses[0].DateTime, d.latitude, d.longitude)
+	if !ok || now.Before(set.Add(d.outputDelay)) {
+		return
+	}
+
+	o, err := pvoutput.AggregateStatus(d.statuses)
+	if err != nil {
+		d.log.error("could not aggregate statuses", "error", err)
+		return
+	}
+
+	if err := d.uploadOutput(o); err == nil {
+		d.outputAt = now
+	}
+}
+
+// finishDay uploads the Output of the current day when it has statuses that
+// were not part of an uploaded Output yet, like consumption after sunset
+func (d *daemon) finishDay() {
+	if len(d.statuses) == 0 {
+		return
+	}
+	if !d.outputAt.IsZero() && !d.statuses[len(d.statuses)-1].DateTime.After(d.outputAt) {
+		return
+	}
+
+	o, err := pvoutput.AggregateStatus(d.statuses)
+	if err != nil {
+		d.log.error("could not aggregate statuses", "error", err)
+		return
+	}
+
+	if err := d.uploadOutput(o); err != nil {
+		d.pending = &o
+	}
+}
+
+// uploadOutput uploads given Output and logs the result
+func (d *daemon) uploadOutput(o pvoutput.Output) error {
+	if err := d.api.AddOutput(o); err != nil {
+		d.log.error("could not upload output", "date", o.Date.Format("2006-01-02"), "error", err)
+		d.health.failed(err)
+		return err
+	}
+
+	d.log.info("uploaded output", "date", o.Date.Format("2006-01-02"),
+		"generated_wh", o.Generated, "consumed_wh", o.Consumed, "exported_wh", o.Exported)
+
+	return nil
+}
+
+// run polls the sources every sampleInterval until given channel is closed
+func (d *daemon) run(sampleInterval time.Duration, stop <-chan struct{}) {
+	d.log.info("starting", "sources", len(d.sources), "interval", d.interval, "sample_interval", sampleInterval)
+
+	d.tick(time.Now())
+
+	ticker := time.NewTicker(sampleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			d.shutdown(time.Now())
+			return
+		case now := <-ticker.C:
+			d.tick(now)
+		}
+	}
+}
+
+// shutdown makes a last attempt to upload the queued statuses and closes
+// the sources. The current interval is discarded, since PVOutput doesn't
+// accept its status before it ends
+func (d *daemon) shutdown(now time.Time) {
+	d.log.info("shutting down")
+
+	if d.current != nil && d.current.polled {
+		d.log.info("discarding unfinished interval", "end", d.current.end)
+	}
+	d.upload(now)
+
+	if len(d.queue) > 0 {
+		d.log.error("statuses were not uploaded", "count", len(d.queue))
+	}
+
+	for _, p := range d.sources {
+		if c, ok := p.source.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/skoef/pvoutput"
+	"github.com/skoef/pvoutput/internal/pvtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testSource is a source returning the Status built by status for the
+// time of the poll, or err when set
+type testSource struct {
+	now    time.Time
+	status func(now time.Time) pvoutput.Status
+	err    error
+}
+
+func (s *testSource) Status() (pvoutput.Status, error) {
+	if s.err != nil {
+		return pvoutput.NewStatus(), s.err
+	}
+
+	return s.status(s.now), nil
+}
+
+func newTestDaemon(u uploader, sources ...*polledSource) (*daemon, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	d := &daemon{
+		api:         u,
+		sources:     sources,
+		interval:    5 * time.Minute,
+		location:    time.UTC,
+		outputDelay: 30 * time.Minute,
+		log:         newLogger(buf),
+		health:      newHealth(time.Minute, 5*time.Minute),
+	}
+
+	return d, buf
+}
+
+func TestDaemon(t *testing.T) {
+	// an inverter reporting lifetime energy and a meter reporting energy
+	// today
+	inverter := &testSource{status: func(now time.Time) pvoutput.Status {
+		s := pvoutput.NewStatus()
+		s.Generating = 1000 + now.Minute()*10
+		s.Generated = 500000 + now.Minute()*100
+		s.Cumulative = pvoutput.StatusCumulativeGenerating
+		s.Voltage = 230.1
+		s.Temperature = 40
+		return s
+	}}
+	meter := &testSource{status: func(now time.Time) pvoutput.Status {
+		s := pvoutput.NewStatus()
+		s.Consuming = 400
+		s.Consumed = 3000 + now.Minute()
+		s.Voltage = 229.5
+		s.Extended[0] = 1.5
+		return s
+	}}
+
+	u := &pvtest.Uploader{}
+	d, _ := newTestDaemon(u,
+		newPolledSource("inverter", inverter, fieldAll&^fieldVoltage),
+		newPolledSource("meter", meter, fieldAll&^fieldTemperature))
+
+	tick := func(t time.Time) {
+		inverter.now, meter.now = t, t
+		d.tick(t)
+	}
+
+	tick(time.Date(2020, 6, 21, 12, 1, 0, 0, time.UTC))
+	tick(time.Date(2020, 6, 21, 12, 3, 0, 0, time.UTC))
+	tick(time.Date(2020, 6, 21, 12, 5, 0, 0, time.UTC))
+	assert.Empty(t, u.Statuses)
+
+	// the first poll of the next interval closes the previous one
+	tick(time.Date(2020, 6, 21, 12, 6, 0, 0, time.UTC))
+	require.Len(t, u.Statuses, 1)
+
+	s := u.Statuses[0]
+	assert.Equal(t, time.Date(2020, 6, 21, 12, 5, 0, 0, time.UTC), s.DateTime)
+	assert.Equal(t, 1030, s.Generating) // (1010 + 1030 + 1050) / 3
+	assert.Equal(t, 400, s.Consuming)
+	// lifetime energy starts counting when the daemon starts
+	assert.Equal(t, 400, s.Generated)
+	assert.Equal(t, 3005, s.Consumed)
+	assert.Equal(t, 40.0, s.Temperature)
+	assert.Equal(t, 229.5, s.Voltage)
+	assert.Equal(t, 1.5, s.Extended[0])
+	assert.Equal(t, -1.0, s.Extended[1])
+	assert.Equal(t, pvoutput.StatusCumulative(-1), s.Cumulative)
+
+	// failed uploads are queued and retried in a batch
+	u.Err = errors.New("Bad request 400: Moon Powered")
+	tick(time.Date(2020, 6, 21, 12, 11, 0, 0, time.UTC))
+	meter.err = errors.New("timeout")
+	tick(time.Date(2020, 6, 21, 12, 16, 0, 0, time.UTC))
+	assert.Len(t, d.queue, 2)
+	assert.Equal(t, 2, d.health.report().Queued)
+
+	u.Err = nil
+	tick(time.Date(2020, 6, 21, 12, 21, 0, 0, time.UTC))
+	require.Len(t, u.StatusBatches, 1)
+	require.Len(t, u.StatusBatches[0], 3)
+	assert.Empty(t, d.queue)
+
+	b := u.StatusBatches[0]
+	assert.Equal(t, time.Date(2020, 6, 21, 12, 10, 0, 0, time.UTC), b[0].DateTime)
+	assert.Equal(t, 1060, b[0].Generating)
+	// sources that fail keep contributing their last energy value today
+	assert.Equal(t, time.Date(2020, 6, 21, 12, 20, 0, 0, time.UTC), b[2].DateTime)
+	assert.Equal(t, 1160, b[2].Generating)
+	assert.Equal(t, -1, b[2].Consuming)
+	assert.Equal(t, 3011, b[2].Consumed)
+	assert.Equal(t, 1500, b[2].Generated)
+
+	// no output before sunset
+	assert.Empty(t, u.Outputs)
+}
+
+func TestDaemonOutput(t *testing.T) {
+	power := 1000
+	src := &testSource{status: func(now time.Time) pvoutput.Status {
+		s := pvoutput.NewStatus()
+		s.Generating = power
+		s.Generated = now.Hour()*1000 + now.Minute()
+		return s
+	}}
+
+	u := &pvtest.Uploader{}
+	d, _ := newTestDaemon(u, newPolledSource("inverter", src, fieldAll))
+	d.located = true
+	d.latitude, d.longitude = 52.37, 4.90
+
+	tick := func(t time.Time) {
+		src.now = t
+		d.tick(t)
+	}
+
+	// sunset in Amsterdam is around 20:07 UTC
+	for ts := time.Date(2020, 6, 21, 20, 0, 0, 0, time.UTC); ts.Before(time.Date(2020, 6, 21, 20, 35, 0, 0, time.UTC)); ts = ts.Add(time.Minute) {
+		tick(ts)
+	}
+	assert.Empty(t, u.Outputs)
+
+	power = 0
+	tick(time.Date(2020, 6, 21, 20, 40, 0, 0, time.UTC))
+	require.Len(t, u.Outputs, 1)
+	assert.Equal(t, time.Date(2020, 6, 21, 0, 0, 0, 0, time.UTC), u.Outputs[0].Date)
+	assert.Equal(t, 20034, u.Outputs[0].Generated)
+
+	// only once per day
+	tick(time.Date(2020, 6, 21, 20, 41, 0, 0, time.UTC))
+	assert.Len(t, u.Outputs, 1)
+
+	// the status at midnight is reported at 23:59, and triggers an update
+	// of the day's output when the next day starts
+	tick(time.Date(2020, 6, 21, 23, 58, 0, 0, time.UTC))
+	tick(time.Date(2020, 6, 22, 0, 1, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2020, 6, 21, 23, 59, 0, 0, time.UTC), u.Statuses[len(u.Statuses)-1].DateTime)
+	assert.Len(t, u.Outputs, 1)
+
+	tick(time.Date(2020, 6, 22, 0, 6, 0, 0, time.UTC))
+	require.Len(t, u.Outputs, 2)
+	assert.Equal(t, time.Date(2020, 6, 21, 0, 0, 0, 0, time.UTC), u.Outputs[1].Date)
+	assert.Equal(t, 23058, u.Outputs[1].Generated)
+	assert.Equal(t, "20200622", d.day)
+	assert.Len(t, d.statuses, 1)
+}
+
+func TestDaemonOutputWithoutLocation(t *testing.T) {
+	src := &testSource{status: func(now time.Time) pvoutput.Status {
+		s := pvoutput.NewStatus()
+		s.Generating = 0
+		s.Consuming = 500
+		return s
+	}}
+
+	u := &pvtest.Uploader{}
+	d, _ := newTestDaemon(u, newPolledSource("meter", src, fieldAll))
+
+	tick := func(t time.Time) {
+		src.now = t
+		d.tick(t)
+	}
+
+	for ts := time.Date(2020, 6, 21, 22, 0, 0, 0, time.UTC); ts.Before(time.Date(2020, 6, 22, 0, 0, 0, 0, time.UTC)); ts = ts.Add(10 * time.Minute) {
+		tick(ts)
+	}
+	assert.Empty(t, u.Outputs)
+
+	// output is uploaded when the day ends, and retried when that fails
+	u.Err = errors.New("timeout")
+	tick(time.Date(2020, 6, 22, 0, 0, 30, 0, time.UTC))
+	tick(time.Date(2020, 6, 22, 0, 5, 30, 0, time.UTC))
+	assert.Empty(t, u.Outputs)
+	require.NotNil(t, d.pending)
+
+	u.Err = nil
+	tick(time.Date(2020, 6, 22, 0, 6, 0, 0, time.UTC))
+	require.Len(t, u.Outputs, 1)
+	assert.Equal(t, time.Date(2020, 6, 21, 0, 0, 0, 0, time.UTC), u.Outputs[0].Date)
+	// integrated from 22:00 to 23:50
+	assert.Equal(t, 917, u.Outputs[0].Consumed)
+	assert.Nil(t, d.pending)
+}
+
+func TestDaemonShutdown(t *testing.T) {
+	closed := false
+	src := &closingSource{
+		testSource: testSource{status: func(now time.Time) pvoutput.Status {
+			s := pvoutput.NewStatus()
+			s.Generating = 100
+			return s
+		}},
+		close: func() { closed = true },
+	}
+
+	u := &pvtest.Uploader{Err: errors.New("timeout")}
+	d, logs := newTestDaemon(u, newPolledSource("inverter", src, fieldAll))
+
+	d.tick(time.Date(2020, 6, 21, 12, 1, 0, 0, time.UTC))
+	d.tick(time.Date(2020, 6, 21, 12, 6, 0, 0, time.UTC))
+	assert.Len(t, d.queue, 1)
+
+	u.Err = nil
+	d.shutdown(time.Date(2020, 6, 21, 12, 7, 0, 0, time.UTC))
+	assert.Len(t, u.Statuses, 1)
+	assert.True(t, closed)
+	assert.Contains(t, logs.String(), `msg="discarding unfinished interval"`)
+}
+
+// closingSource is a testSource implementing io.Closer
+type closingSource struct {
+	testSource
+	close func()
+}
+
+func (s *closingSource) Close() error {
+	s.close()
+	return nil
+}
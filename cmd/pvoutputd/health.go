@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/skoef/pvoutput"
+)
+
+// health keeps track of the daemon's health, as reported by the health
+// endpoint. The daemon is unhealthy when none of its sources could be polled
+// for three sample intervals, or when statuses are waiting for upload for
+// longer than three status intervals
+type health struct {
+	sampleInterval time.Duration
+	interval       time.Duration
+	now            func() time.Time
+	mu             sync.Mutex
+	started        time.Time
+	lastSample     time.Time
+	lastUpload     time.Time
+	oldestQueued   time.Time
+	queueLength    int
+	lastError      string
+}
+
+// newHealth returns a new health for a daemon started now
+func newHealth(sampleInterval, interval time.Duration) *health {
+	return &health{
+		sampleInterval: sampleInterval,
+		interval:       interval,
+		now:            time.Now,
+		started:        time.Now(),
+	}
+}
+
+// sampled records a successful poll at given time
+func (h *health) sampled(t time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastSample = t
+}
+
+// uploaded records a successful upload at given time
+func (h *health) uploaded(t time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastUpload = t
+}
+
+// queued records the statuses waiting for upload
+func (h *health) queued(q pvoutput.BatchStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.queueLength = len(q)
+	h.oldestQueued = time.Time{}
+	if len(q) > 0 {
+		h.oldestQueued = q[0].DateTime
+	}
+}
+
+// failed records given error
+func (h *health) failed(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastError = err.Error()
+}
+
+// healthReport is the response of the health endpoint
+type healthReport struct {
+	Status     string     `json:"status"`
+	Problems   []string   `json:"problems,omitempty"`
+	LastSample *time.Time `json:"last_sample,omitempty"`
+	LastUpload *time.Time `json:"last_upload,omitempty"`
+	Queued     int        `json:"queued"`
+	LastError  string     `json:"last_error,omitempty"`
+}
+
+// report returns the current health
+func (h *health) report() healthReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.now()
+	r := healthReport{
+		Status:    "ok",
+		Queued:    h.queueLength,
+		LastError: h.lastError,
+	}
+
+	optTime := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+
+		return &t
+	}
+	r.LastSample = optTime(h.lastSample)
+	r.LastUpload = optTime(h.lastUpload)
+
+	since := h.lastSample
+	if since.IsZero() {
+		since = h.started
+	}
+	if now.Sub(since) > 3*h.sampleInterval {
+		r.Problems = append(r.Problems, "sources could not be polled")
+	}
+	if !h.oldestQueued.IsZero() && now.Sub(h.oldestQueued) > 3*h.interval {
+		r.Problems = append(r.Problems, "statuses could not be uploaded")
+	}
+
+	if len(r.Problems) > 0 {
+		r.Status = "unhealthy"
+	}
+
+	return r
+}
+
+// ServeHTTP implements http.Handler, responding with the health as JSON.
+// The status code is 503 Service Unavailable when unhealthy
+func (h *health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := h.report()
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(report.Problems) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	json.NewEncoder(w).Encode(report)
+}
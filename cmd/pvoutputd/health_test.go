@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/skoef/pvoutput"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealth(t *testing.T) {
+	now := time.Date(2020, 6, 21, 12, 0, 0, 0, time.UTC)
+	h := newHealth(time.Minute, 5*time.Minute)
+	h.started = now
+	h.now = func() time.Time { return now }
+
+	get := func() (int, healthReport) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+		r := healthReport{}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&r))
+
+		return rec.Code, r
+	}
+
+	// healthy while starting
+	code, r := get()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", r.Status)
+	assert.Nil(t, r.LastSample)
+
+	// sources failing
+	now = now.Add(4 * time.Minute)
+	h.failed(errors.New("connection refused"))
+	code, r = get()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "unhealthy", r.Status)
+	assert.Equal(t, []string{"sources could not be polled"}, r.Problems)
+	assert.Equal(t, "connection refused", r.LastError)
+
+	h.sampled(now)
+	code, r = get()
+	assert.Equal(t, http.StatusOK, code)
+	if assert.NotNil(t, r.LastSample) {
+		assert.True(t, now.Equal(*r.LastSample))
+	}
+
+	// uploads failing
+	s := pvoutput.NewStatus()
+	s.DateTime = now.Add(-16 * time.Minute)
+	h.queued(pvoutput.BatchStatus{s})
+	code, r = get()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, []string{"statuses could not be uploaded"}, r.Problems)
+	assert.Equal(t, 1, r.Queued)
+
+	h.queued(nil)
+	h.uploaded(now)
+	code, r = get()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 0, r.Queued)
+	assert.NotNil(t, r.LastUpload)
+}
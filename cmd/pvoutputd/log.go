@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logger writes structured logs in logfmt, one line of key=value pairs per
+// entry, e.g.
+//
+//	time=2020-08-18T12:35:00+02:00 level=info msg="uploaded status" queued=0
+type logger struct {
+	w   io.Writer
+	now func() time.Time
+	mu  sync.Mutex
+}
+
+// newLogger returns a new logger writing to w
+func newLogger(w io.Writer) *logger {
+	return &logger{w: w, now: time.Now}
+}
+
+// logValue formats given value, quoting it when needed
+func logValue(v interface{}) string {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case error:
+		s = v.Error()
+	case time.Time:
+		s = v.Format(time.RFC3339)
+	case time.Duration:
+		s = v.String()
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	if s == "" || strings.ContainsAny(s, " =\"\\\t\r\n") {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
+
+// log writes an entry with given level and message, followed by the given
+// alternating keys and values
+func (l *logger) log(level, msg string, kv ...interface{}) {
+	var sb strings.Builder
+	sb.WriteString("time=" + logValue(l.now()))
+	sb.WriteString(" level=" + level)
+	sb.WriteString(" msg=" + logValue(msg))
+
+	for i := 0; i < len(kv); i += 2 {
+		sb.WriteString(" " + fmt.Sprint(kv[i]) + "=")
+		if i+1 < len(kv) {
+			sb.WriteString(logValue(kv[i+1]))
+		} else {
+			sb.WriteString(logValue(""))
+		}
+	}
+	sb.WriteString("\n")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	io.WriteString(l.w, sb.String())
+}
+
+// info logs an informational entry
+func (l *logger) info(msg string, kv ...interface{}) {
+	l.log("info", msg, kv...)
+}
+
+// error logs an error
+func (l *logger) error(msg string, kv ...interface{}) {
+	l.log("error", msg, kv...)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := newLogger(buf)
+	l.now = func() time.Time { return time.Date(2020, 8, 18, 12, 35, 0, 0, time.UTC) }
+
+	l.info("uploaded status", "count", 2, "time", time.Date(2020, 8, 18, 12, 35, 0, 0, time.UTC), "interval", 5*time.Minute)
+	l.error("could not poll source", "source", "roof", "error", errors.New(`unexpected status "500 Internal Server Error"`), "empty", "", "odd")
+
+	assert.Equal(t, `time=2020-08-18T12:35:00Z level=info msg="uploaded status" count=2 time=2020-08-18T12:35:00Z interval=5m0s
+time=2020-08-18T12:35:00Z level=error msg="could not poll source" source=roof error="unexpected status \"500 Internal Server Error\"" empty="" odd=""
+`, buf.String())
+}
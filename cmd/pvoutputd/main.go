@@ -0,0 +1,168 @@
+// Command pvoutputd is a daemon that polls one or more data sources, like
+// inverters and smart meters, uploads a Status to PVOutput.org for every
+// status interval and closes each day with an Output after sunset
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/skoef/pvoutput"
+	"github.com/skoef/pvoutput/history"
+	"github.com/skoef/pvoutput/prometheus"
+)
+
+// defaultConfigPath is the config file used when none is given
+const defaultConfigPath = "/etc/pvoutputd.yaml"
+
+func main() {
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		close(stop)
+	}()
+
+	os.Exit(run(os.Args[1:], os.Stderr, stop))
+}
+
+// newDaemon returns a new daemon for given config, uploading to given
+// uploader
+func newDaemon(cfg config, api uploader, log *logger) (*daemon, error) {
+	loc, err := cfg.location()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &daemon{
+		api:         api,
+		interval:    cfg.Interval,
+		location:    loc,
+		outputDelay: cfg.OutputDelay,
+		log:         log,
+		health:      newHealth(cfg.SampleInterval, cfg.Interval),
+	}
+
+	if cfg.Latitude != nil && cfg.Longitude != nil {
+		d.located = true
+		d.latitude, d.longitude = *cfg.Latitude, *cfg.Longitude
+	}
+
+	for _, c := range cfg.Sources {
+		fields, err := parseFields(c.Fields)
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %s", c.Name, err)
+		}
+
+		src, err := openSource(c)
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %s", c.Name, err)
+		}
+
+		d.sources = append(d.sources, newPolledSource(c.Name, src, fields))
+	}
+
+	return d, nil
+}
+
+// run runs the daemon with given arguments until given channel is closed
+// and returns its exit code
+func run(args []string, stderr io.Writer, stop <-chan struct{}) int {
+	fs := flag.NewFlagSet("pvoutputd", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", defaultConfigPath, "path to the config file")
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(stderr, "pvoutputd: unexpected argument %s\n", fs.Arg(0))
+		return 2
+	}
+
+	log := newLogger(stderr)
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		log.error("could not load config", "path", *configPath, "error", err)
+		return 1
+	}
+
+	api := pvoutput.NewAPI(cfg.APIKey, cfg.SystemID, cfg.Donating)
+	if cfg.BaseURL != "" {
+		api = api.WithBaseURL(cfg.BaseURL)
+	}
+
+	// uploads are recorded in the history and go through the exporter, to
+	// mirror them in the metrics
+	var up uploader = api
+	var recorded history.Uploader = api
+	if cfg.HistoryDir != "" {
+		store, err := history.NewFileStore(cfg.HistoryDir)
+		if err != nil {
+			log.error("could not open history", "dir", cfg.HistoryDir, "error", err)
+			return 1
+		}
+
+		recorded = history.NewRecorder(api, store)
+		up = recorded
+	}
+
+	var exporter *prometheus.Exporter
+	if cfg.Metrics {
+		var src prometheus.Source
+		if cfg.MetricsPollInterval > 0 {
+			src = api
+		}
+
+		exporter = prometheus.NewExporter(src)
+		up = exporter.Mirror(recorded)
+	}
+
+	d, err := newDaemon(cfg, up, log)
+	if err != nil {
+		log.error("could not start", "error", err)
+		return 1
+	}
+	if exporter != nil {
+		exporter.Location = d.location
+	}
+
+	if cfg.HealthAddress != "" {
+		l, err := net.Listen("tcp", cfg.HealthAddress)
+		if err != nil {
+			log.error("could not start health endpoint", "error", err)
+			return 1
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle("/health", d.health)
+		if exporter != nil {
+			mux.Handle("/metrics", exporter)
+		}
+		srv := &http.Server{Handler: mux, ReadTimeout: 10 * time.Second, WriteTimeout: 10 * time.Second}
+		defer srv.Close()
+
+		go srv.Serve(l)
+		log.info("serving health endpoint", "address", l.Addr().String())
+	}
+
+	if exporter != nil && cfg.MetricsPollInterval > 0 {
+		go exporter.Run(cfg.MetricsPollInterval, stop)
+	}
+
+	d.run(cfg.SampleInterval, stop)
+
+	return 0
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	stderr := &bytes.Buffer{}
+	stop := make(chan struct{})
+	close(stop)
+
+	assert.Equal(t, 2, run([]string{"-foo"}, stderr, stop))
+	assert.Equal(t, 2, run([]string{"foo"}, stderr, stop))
+	assert.Equal(t, 1, run([]string{"-config", "testdata/missing.yaml"}, stderr, stop))
+
+	dir, err := ioutil.TempDir("", "pvoutputd")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`api_key: secret
+system_id: "12345"
+base_url: http://127.0.0.1:1
+health_address: 127.0.0.1:0
+metrics: true
+metrics_poll_interval: 5m
+history_dir: `+filepath.Join(dir, "history")+`
+sources:
+  - name: inverter
+    type: sunspec
+    address: 127.0.0.1:1
+`), 0600))
+
+	// stops right after polling once
+	stderr.Reset()
+	assert.Equal(t, 0, run([]string{"-config", path}, stderr, stop))
+	assert.Contains(t, stderr.String(), `level=info msg="serving health endpoint"`)
+	assert.Contains(t, stderr.String(), `level=info msg=starting sources=1 interval=5m0s sample_interval=30s`)
+	assert.Contains(t, stderr.String(), `level=error msg="could not poll source" source=inverter`)
+	assert.Contains(t, stderr.String(), `level=info msg="shutting down"`)
+	assert.DirExists(t, filepath.Join(dir, "history"))
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skoef/pvoutput"
+	"github.com/skoef/pvoutput/dsmr"
+	"github.com/skoef/pvoutput/enphase"
+	"github.com/skoef/pvoutput/fronius"
+	"github.com/skoef/pvoutput/sunspec"
+)
+
+// source is a data source polled by the daemon. Energy values in the Status
+// it returns are either energy so far today or lifetime energy, as flagged by
+// Cumulative. Its DateTime is ignored, the time of polling is used instead
+type source interface {
+	Status() (pvoutput.Status, error)
+}
+
+// sourceType validates the config of and opens sources of a single type
+type sourceType struct {
+	validate func(c sourceConfig) error
+	open     func(c sourceConfig) (source, error)
+}
+
+// sourceTypes holds the supported source types by name. Support for another
+// kind of device is added by registering its type here
+var sourceTypes = map[string]sourceType{
+	"fronius": {
+		validate: requireSetting("host", func(c sourceConfig) string { return c.Host }),
+		open: func(c sourceConfig) (source, error) {
+			return fronius.NewClient(c.Host), nil
+		},
+	},
+	"enphase": {
+		validate: func(c sourceConfig) error {
+			if c.Host == "" {
+				return errors.New("host is required")
+			}
+			if len(c.ExtendedInverters) > enphase.MaxExtendedInverters {
+				return fmt.Errorf("at most %d extended_inverters are supported", enphase.MaxExtendedInverters)
+			}
+
+			return nil
+		},
+		open: func(c sourceConfig) (source, error) {
+			client := enphase.NewClient(c.Host, c.Token)
+			client.ExtendedInverters = c.ExtendedInverters
+
+			return client, nil
+		},
+	},
+	"sunspec": {
+		validate: requireSetting("address", func(c sourceConfig) string { return c.Address }),
+		open: func(c sourceConfig) (source, error) {
+			unitID := c.UnitID
+			if unitID == 0 {
+				unitID = 1
+			}
+
+			return &sunspecSource{address: c.Address, unitID: unitID}, nil
+		},
+	},
+	"dsmr": {
+		validate: func(c sourceConfig) error {
+			if (c.Address == "") == (c.Device == "") {
+				return errors.New("either address or device is required")
+			}
+
+			return nil
+		},
+		open: func(c sourceConfig) (source, error) {
+			open := func() (io.ReadCloser, error) {
+				return os.Open(c.Device)
+			}
+			if c.Address != "" {
+				open = func() (io.ReadCloser, error) {
+					return net.DialTimeout("tcp", c.Address, 10*time.Second)
+				}
+			}
+
+			return newDSMRSource(open), nil
+		},
+	},
+}
+
+// requireSetting returns a validate function requiring the setting with
+// given name to be set
+func requireSetting(name string, value func(c sourceConfig) string) func(c sourceConfig) error {
+	return func(c sourceConfig) error {
+		if value(c) == "" {
+			return fmt.Errorf("%s is required", name)
+		}
+
+		return nil
+	}
+}
+
+// openSource opens the source for given config
+func openSource(c sourceConfig) (source, error) {
+	t, ok := sourceTypes[c.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown type %q", c.Type)
+	}
+
+	return t.open(c)
+}
+
+// fieldSet is a set of Status fields taken from a source
+type fieldSet int
+
+const (
+	fieldGenerating fieldSet = 1 << iota
+	fieldGenerated
+	fieldConsuming
+	fieldConsumed
+	fieldTemperature
+	fieldVoltage
+	fieldExtended
+	fieldAll = fieldGenerating | fieldGenerated | fieldConsuming | fieldConsumed | fieldTemperature | fieldVoltage | fieldExtended
+)
+
+var fieldNames = map[string]fieldSet{
+	"generating":  fieldGenerating,
+	"generated":   fieldGenerated,
+	"consuming":   fieldConsuming,
+	"consumed":    fieldConsumed,
+	"temperature": fieldTemperature,
+	"voltage":     fieldVoltage,
+	"extended":    fieldExtended,
+}
+
+// parseFields returns the set of given field names, all fields when none
+// are given
+func parseFields(names []string) (fieldSet, error) {
+	if len(names) == 0 {
+		return fieldAll, nil
+	}
+
+	var set fieldSet
+	for _, name := range names {
+		f, ok := fieldNames[strings.ToLower(name)]
+		if !ok {
+			return 0, fmt.Errorf("unknown field %q", name)
+		}
+		set |= f
+	}
+
+	return set, nil
+}
+
+// has returns true when the set contains given field
+func (s fieldSet) has(f fieldSet) bool {
+	return s&f != 0
+}
+
+// sunspecSource reads a SunSpec device, connecting on first use and
+// reconnecting after errors
+type sunspecSource struct {
+	address string
+	unitID  byte
+	client  *sunspec.Client
+	device  *sunspec.Device
+}
+
+func (s *sunspecSource) Status() (pvoutput.Status, error) {
+	if s.device == nil {
+		c, err := sunspec.Dial(s.address, s.unitID)
+		if err != nil {
+			return pvoutput.NewStatus(), err
+		}
+
+		d, err := sunspec.Discover(c)
+		if err != nil {
+			c.Close()
+			return pvoutput.NewStatus(), err
+		}
+
+		s.client, s.device = c, d
+	}
+
+	st, err := s.device.Status()
+	if err != nil {
+		s.Close()
+	}
+
+	return st, err
+}
+
+// Close closes the connection to the device, if any
+func (s *sunspecSource) Close() error {
+	if s.client == nil {
+		return nil
+	}
+
+	err := s.client.Close()
+	s.client, s.device = nil, nil
+
+	return err
+}
+
+const (
+	// dsmrMaxAge is how old the last telegram may be for a dsmr source to
+	// report it. Meters send a telegram every 1 to 10 seconds
+	dsmrMaxAge = time.Minute
+	// dsmrRetryDelay is how long a dsmr source waits before reconnecting
+	dsmrRetryDelay = 5 * time.Second
+)
+
+// dsmrSource reads the telegrams a smart meter sends continuously in the
+// background and reports the last one
+type dsmrSource struct {
+	open     func() (io.ReadCloser, error)
+	now      func() time.Time
+	mu       sync.Mutex
+	status   pvoutput.Status
+	received time.Time
+	err      error
+	conn     io.ReadCloser
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// newDSMRSource returns a new dsmrSource reading from the connections
+// returned by open, and starts reading
+func newDSMRSource(open func() (io.ReadCloser, error)) *dsmrSource {
+	s := &dsmrSource{
+		open: open,
+		now:  time.Now,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go s.run()
+
+	return s
+}
+
+// run reads telegrams until the source is closed, reconnecting when reading
+// fails
+func (s *dsmrSource) run() {
+	defer close(s.done)
+
+	for {
+		conn, err := s.open()
+		if err == nil {
+			s.mu.Lock()
+			select {
+			case <-s.stop:
+				// closed while connecting
+				s.mu.Unlock()
+				conn.Close()
+				return
+			default:
+			}
+			s.conn = conn
+			s.mu.Unlock()
+
+			err = s.read(conn)
+			conn.Close()
+		}
+
+		s.mu.Lock()
+		s.err = err
+		s.conn = nil
+		s.mu.Unlock()
+
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(dsmrRetryDelay):
+		}
+	}
+}
+
+// read reads telegrams from given connection until it fails. Telegrams that
+// fail to parse are skipped
+func (s *dsmrSource) read(conn io.Reader) error {
+	r := dsmr.NewReader(conn)
+	for {
+		raw, err := r.ReadRaw()
+		if err != nil {
+			return err
+		}
+
+		t, err := dsmr.Parse(raw)
+		s.mu.Lock()
+		if err != nil {
+			s.err = err
+		} else {
+			s.status = t.Status()
+			s.received = s.now()
+			s.err = nil
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *dsmrSource) Status() (pvoutput.Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.received.IsZero() || s.now().Sub(s.received) > dsmrMaxAge {
+		if s.err != nil {
+			return pvoutput.NewStatus(), fmt.Errorf("no recent telegram: %s", s.err)
+		}
+
+		return pvoutput.NewStatus(), errors.New("no recent telegram")
+	}
+
+	return s.status, nil
+}
+
+// Close stops reading telegrams
+func (s *dsmrSource) Close() error {
+	close(s.stop)
+
+	s.mu.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.mu.Unlock()
+
+	<-s.done
+
+	return nil
+}
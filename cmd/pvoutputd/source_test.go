@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/skoef/pvoutput/enphase"
+	"github.com/skoef/pvoutput/fronius"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFields(t *testing.T) {
+	set, err := parseFields(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, fieldAll, set)
+
+	set, err = parseFields([]string{"Generating", "consumed"})
+	assert.NoError(t, err)
+	assert.True(t, set.has(fieldGenerating))
+	assert.True(t, set.has(fieldConsumed))
+	assert.False(t, set.has(fieldGenerated))
+	assert.False(t, set.has(fieldExtended))
+
+	_, err = parseFields([]string{"generating", "power"})
+	assert.EqualError(t, err, `unknown field "power"`)
+}
+
+func TestOpenSource(t *testing.T) {
+	src, err := openSource(sourceConfig{Type: "fronius", Host: "192.168.1.20"})
+	require.NoError(t, err)
+	if assert.IsType(t, &fronius.Client{}, src) {
+		assert.Equal(t, "http://192.168.1.20", src.(*fronius.Client).BaseURL)
+	}
+
+	src, err = openSource(sourceConfig{Type: "enphase", Host: "envoy.local", Token: "jwt", ExtendedInverters: []string{"1", "2"}})
+	require.NoError(t, err)
+	if assert.IsType(t, &enphase.Client{}, src) {
+		assert.Equal(t, "https://envoy.local", src.(*enphase.Client).BaseURL)
+		assert.Equal(t, []string{"1", "2"}, src.(*enphase.Client).ExtendedInverters)
+	}
+
+	src, err = openSource(sourceConfig{Type: "sunspec", Address: "127.0.0.1:1"})
+	require.NoError(t, err)
+	if assert.IsType(t, &sunspecSource{}, src) {
+		assert.Equal(t, byte(1), src.(*sunspecSource).unitID)
+
+		// connection is made on first use
+		_, err = src.Status()
+		assert.Error(t, err)
+	}
+
+	_, err = openSource(sourceConfig{Type: "solaredge"})
+	assert.Error(t, err)
+}
+
+func TestDSMRSource(t *testing.T) {
+	telegram, err := ioutil.ReadFile("testdata/dsmr50")
+	require.NoError(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	// the meter sends a broken telegram followed by a valid one
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.Write(bytes.Replace(telegram, []byte("01.193*kW"), []byte("01.194*kW"), 1))
+		conn.Write(telegram)
+		time.Sleep(time.Minute)
+	}()
+
+	src, err := openSource(sourceConfig{Type: "dsmr", Address: l.Addr().String()})
+	require.NoError(t, err)
+	d := src.(*dsmrSource)
+	defer d.Close()
+
+	require.Eventually(t, func() bool {
+		_, err := d.Status()
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	st, err := d.Status()
+	require.NoError(t, err)
+	assert.Equal(t, 1193, st.Consuming)
+	assert.Equal(t, 246913578, st.Consumed)
+	assert.Equal(t, 220.1, st.Voltage)
+
+	// telegrams go stale
+	d.mu.Lock()
+	d.now = func() time.Time { return time.Now().Add(2 * dsmrMaxAge) }
+	d.mu.Unlock()
+	_, err = d.Status()
+	assert.EqualError(t, err, "no recent telegram")
+}
+
+func TestDSMRSourceNoTelegram(t *testing.T) {
+	src := newDSMRSource(func() (io.ReadCloser, error) {
+		return nil, errors.New("no such device")
+	})
+
+	require.Eventually(t, func() bool {
+		_, err := src.Status()
+		return err != nil && err.Error() == "no recent telegram: no such device"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, src.Close())
+}
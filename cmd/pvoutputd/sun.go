@@ -0,0 +1,44 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// julian2000 is the Julian date of 2000-01-01 12:00 UTC
+const julian2000 = 2451545.0
+
+// sunset returns the time of sunset on given day, in the day's location, at
+// given coordinates in degrees. It uses the sunrise equation, which is
+// accurate to within a few minutes. ok is false on days the sun doesn't set
+// or rise, near the poles
+func sunset(day time.Time, latitude, longitude float64) (t time.Time, ok bool) {
+	rad := math.Pi / 180
+
+	y, m, d := day.Date()
+	noon := time.Date(y, m, d, 12, 0, 0, 0, time.UTC)
+	n := math.Round(noon.Sub(time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)).Hours() / 24)
+
+	// mean solar noon, solar mean anomaly, equation of the center and
+	// ecliptic longitude
+	j := n - longitude/360
+	anomaly := math.Mod(357.5291+0.98560028*j, 360)
+	center := 1.9148*math.Sin(anomaly*rad) + 0.02*math.Sin(2*anomaly*rad) + 0.0003*math.Sin(3*anomaly*rad)
+	ecliptic := math.Mod(anomaly+center+180+102.9372, 360)
+
+	transit := julian2000 + j + 0.0053*math.Sin(anomaly*rad) - 0.0069*math.Sin(2*ecliptic*rad)
+
+	// declination of the sun and its hour angle at sunset, corrected for
+	// refraction and the sun's diameter
+	declination := math.Asin(math.Sin(ecliptic*rad) * math.Sin(23.4397*rad))
+	cosHour := (math.Sin(-0.833*rad) - math.Sin(latitude*rad)*math.Sin(declination)) /
+		(math.Cos(latitude*rad) * math.Cos(declination))
+	if cosHour < -1 || cosHour > 1 {
+		return time.Time{}, false
+	}
+
+	set := transit + math.Acos(cosHour)/rad/360
+	offset := time.Duration((set - julian2000) * 24 * float64(time.Hour))
+
+	return time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC).Add(offset).In(day.Location()).Truncate(time.Second), true
+}
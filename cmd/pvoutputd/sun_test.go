@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSunset(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	require.NoError(t, err)
+	sydney, err := time.LoadLocation("Australia/Sydney")
+	require.NoError(t, err)
+
+	tests := []struct {
+		day       time.Time
+		latitude  float64
+		longitude float64
+		expected  time.Time
+	}{
+		// summer and winter solstice in Amsterdam
+		{time.Date(2020, 6, 21, 0, 0, 0, 0, amsterdam), 52.37, 4.90, time.Date(2020, 6, 21, 22, 7, 0, 0, amsterdam)},
+		{time.Date(2020, 12, 21, 0, 0, 0, 0, amsterdam), 52.37, 4.90, time.Date(2020, 12, 21, 16, 29, 0, 0, amsterdam)},
+		// southern hemisphere
+		{time.Date(2020, 12, 21, 0, 0, 0, 0, sydney), -33.87, 151.21, time.Date(2020, 12, 21, 20, 5, 0, 0, sydney)},
+		// equator
+		{time.Date(2020, 3, 20, 0, 0, 0, 0, time.UTC), 0, 0, time.Date(2020, 3, 20, 18, 8, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range tests {
+		set, ok := sunset(tc.day, tc.latitude, tc.longitude)
+		if assert.True(t, ok) {
+			assert.WithinDuration(t, tc.expected, set, 3*time.Minute, tc.day.String())
+			assert.Equal(t, tc.day.Location(), set.Location())
+		}
+	}
+
+	// midnight sun and polar night
+	_, ok := sunset(time.Date(2020, 6, 21, 0, 0, 0, 0, time.UTC), 78.22, 15.65)
+	assert.False(t, ok)
+	_, ok = sunset(time.Date(2020, 12, 21, 0, 0, 0, 0, time.UTC), 78.22, 15.65)
+	assert.False(t, ok)
+}
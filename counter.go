@@ -0,0 +1,208 @@
+package pvoutput
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+const (
+	// CounterWrap16 is the wrap around value of a 16 bit counter
+	CounterWrap16 uint64 = 1 << 16
+	// CounterWrap32 is the wrap around value of a 32 bit counter
+	CounterWrap32 uint64 = 1 << 32
+)
+
+// CounterState is the state of a Counter, which can be persisted between
+// process restarts
+type CounterState struct {
+	Raw      uint64 `json:"raw"`       // last raw value
+	Offset   uint64 `json:"offset"`    // energy counted before resets and rollovers
+	Day      string `json:"day"`       // current day, formatted as 20060102
+	DayStart uint64 `json:"day_start"` // lifetime energy at the start of the day
+}
+
+// Counter tracks a lifetime energy counter in watt hours, as reported by
+// many meters and inverters. These counters may reset, e.g. at midnight or
+// when the device reboots, or wrap around at their maximum value. Counter
+// detects both and keeps track of the real lifetime and daily energy
+type Counter struct {
+	// Wrap is the value the raw counter wraps around at, e.g. CounterWrap32.
+	// When 0, the counter is assumed not to wrap around and every decrease
+	// is treated as a reset
+	Wrap  uint64
+	state CounterState
+	valid bool
+}
+
+// isRollover returns true when going from last to raw looks like the counter
+// wrapped around, rather than being reset
+func (c *Counter) isRollover(last, raw uint64) bool {
+	if c.Wrap == 0 {
+		return false
+	}
+
+	// near the maximum value before and near zero after
+	return last >= c.Wrap/4*3 && raw < c.Wrap/4
+}
+
+// Lifetime returns the lifetime energy in watt hours
+func (c *Counter) Lifetime() uint64 {
+	return c.state.Offset + c.state.Raw
+}
+
+// Observe records a raw counter value at given time and returns the energy
+// in watt hours since the start of that day
+func (c *Counter) Observe(t time.Time, raw uint64) (uint64, error) {
+	if c.Wrap > 0 && raw >= c.Wrap {
+		return 0, errors.New("raw value exceeds Wrap")
+	}
+
+	day := t.Format("20060102")
+
+	if !c.valid {
+		c.state = CounterState{Raw: raw, Day: day, DayStart: raw}
+		c.valid = true
+
+		return 0, nil
+	}
+
+	if day < c.state.Day {
+		return 0, errors.New("observation is older than current day")
+	}
+
+	previous := c.Lifetime()
+
+	if raw < c.state.Raw {
+		if c.isRollover(c.state.Raw, raw) {
+			c.state.Offset += c.Wrap
+		} else {
+			// counter restarted from zero
+			c.state.Offset += c.state.Raw
+		}
+	}
+	c.state.Raw = raw
+
+	if day != c.state.Day {
+		// energy between the last observation and this one is counted on
+		// the new day
+		c.state.Day = day
+		c.state.DayStart = previous
+	}
+
+	return c.Lifetime() - c.state.DayStart, nil
+}
+
+// State returns the current state of the Counter. The second return value
+// is false when nothing was observed yet
+func (c *Counter) State() (CounterState, bool) {
+	return c.state, c.valid
+}
+
+// Restore sets the state of the Counter to given state
+func (c *Counter) Restore(s CounterState) {
+	c.state = s
+	c.valid = true
+}
+
+// CounterTracker converts Status updates with lifetime energy values into
+// Status updates with energy values relative to the start of the day
+type CounterTracker struct {
+	Generated Counter
+	Consumed  Counter
+}
+
+// NewCounterTracker returns a new CounterTracker for counters wrapping
+// around at given value
+func NewCounterTracker(wrap uint64) *CounterTracker {
+	return &CounterTracker{
+		Generated: Counter{Wrap: wrap},
+		Consumed:  Counter{Wrap: wrap},
+	}
+}
+
+// Apply takes a Status with raw lifetime counter values in the fields its
+// Cumulative marks as lifetime values, and returns it with these values
+// converted to energy since the start of the day. Other energy values are
+// already daily values and are left alone. Statuses without lifetime values
+// are rejected
+func (t *CounterTracker) Apply(s Status) (Status, error) {
+	if s.DateTime.IsZero() {
+		return s, errors.New("DateTime is required on Status")
+	}
+
+	var generated, consumed bool
+	switch s.Cumulative {
+	case StatusCumulativeAll:
+		generated, consumed = true, true
+	case StatusCumulativeGenerating:
+		generated = true
+	case StatusCumulativeConsuming:
+		consumed = true
+	default:
+		return s, errors.New("Cumulative should mark lifetime values")
+	}
+
+	if generated && s.Generated != UnsetInt {
+		if s.Generated < 0 {
+			return s, errors.New("Generated can not be negative")
+		}
+		daily, err := t.Generated.Observe(s.DateTime, uint64(s.Generated))
+		if err != nil {
+			return s, err
+		}
+		s.Generated = int(daily)
+	}
+
+	if consumed && s.Consumed != UnsetInt {
+		if s.Consumed < 0 {
+			return s, errors.New("Consumed can not be negative")
+		}
+		daily, err := t.Consumed.Observe(s.DateTime, uint64(s.Consumed))
+		if err != nil {
+			return s, err
+		}
+		s.Consumed = int(daily)
+	}
+
+	s.Cumulative = StatusCumulativeUnset
+
+	return s, nil
+}
+
+// counterTrackerState is how a CounterTracker is persisted
+type counterTrackerState struct {
+	Generated *CounterState `json:"generated,omitempty"`
+	Consumed  *CounterState `json:"consumed,omitempty"`
+}
+
+// Save writes the state of the CounterTracker to given writer as JSON
+func (t *CounterTracker) Save(w io.Writer) error {
+	state := counterTrackerState{}
+	if s, ok := t.Generated.State(); ok {
+		state.Generated = &s
+	}
+	if s, ok := t.Consumed.State(); ok {
+		state.Consumed = &s
+	}
+
+	return json.NewEncoder(w).Encode(state)
+}
+
+// Load restores the state of the CounterTracker as written by Save
+func (t *CounterTracker) Load(r io.Reader) error {
+	state := counterTrackerState{}
+	if err := json.NewDecoder(r).Decode(&state); err != nil {
+		return err
+	}
+
+	if state.Generated != nil {
+		t.Generated.Restore(*state.Generated)
+	}
+	if state.Consumed != nil {
+		t.Consumed.Restore(*state.Consumed)
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package pvoutput
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCounter(t *testing.T) {
+	at := func(s string) time.Time {
+		tm, _ := time.Parse("20060102 15:04", s)
+		return tm
+	}
+
+	c := Counter{Wrap: CounterWrap16}
+	_, ok := c.State()
+	assert.False(t, ok)
+
+	daily, err := c.Observe(at("20200818 08:00"), 60000)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), daily)
+
+	daily, err = c.Observe(at("20200818 09:00"), 65000)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5000), daily)
+
+	// counter wraps around at 2^16
+	daily, err = c.Observe(at("20200818 10:00"), 1000)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(6536), daily)
+	assert.Equal(t, uint64(66536), c.Lifetime())
+
+	// counter resets, e.g. because the device rebooted
+	daily, err = c.Observe(at("20200818 11:00"), 200)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(6736), daily)
+
+	// next day starts counting from the last observation
+	daily, err = c.Observe(at("20200819 08:00"), 700)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(500), daily)
+
+	// counter reset at midnight
+	daily, err = c.Observe(at("20200820 00:01"), 10)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(10), daily)
+
+	// older days and values exceeding the wrap value are rejected
+	_, err = c.Observe(at("20200819 12:00"), 20)
+	assert.Error(t, err)
+	_, err = c.Observe(at("20200820 12:00"), CounterWrap16)
+	assert.Error(t, err)
+
+	// without a wrap value, every decrease is a reset
+	c = Counter{}
+	_, _ = c.Observe(at("20200818 08:00"), 60000)
+	daily, _ = c.Observe(at("20200818 09:00"), 100)
+	assert.Equal(t, uint64(100), daily)
+}
+
+func TestCounterTracker(t *testing.T) {
+	tr := NewCounterTracker(CounterWrap32)
+
+	newStatus := func(hhmm string, generated, consumed int) Status {
+		s := NewStatus()
+		s.DateTime, _ = time.Parse("200601021504", "20200818"+hhmm)
+		s.Generated = generated
+		s.Consumed = consumed
+		s.Cumulative = StatusCumulativeAll
+
+		return s
+	}
+
+	s, err := tr.Apply(newStatus("0800", 100000, 50000))
+	require.NoError(t, err)
+	assert.Equal(t, 0, s.Generated)
+	assert.Equal(t, 0, s.Consumed)
+	assert.Equal(t, StatusCumulativeUnset, s.Cumulative)
+
+	s, err = tr.Apply(newStatus("0900", 101000, 50400))
+	require.NoError(t, err)
+	assert.Equal(t, 1000, s.Generated)
+	assert.Equal(t, 400, s.Consumed)
+
+	// unset values are left alone
+	s, err = tr.Apply(newStatus("0905", 101100, UnsetInt))
+	require.NoError(t, err)
+	assert.Equal(t, 1100, s.Generated)
+	assert.Equal(t, UnsetInt, s.Consumed)
+
+	// persist state and continue in a new tracker
+	var buf bytes.Buffer
+	require.NoError(t, tr.Save(&buf))
+
+	restored := NewCounterTracker(CounterWrap32)
+	require.NoError(t, restored.Load(&buf))
+
+	s, err = restored.Apply(newStatus("1000", 102000, 50500))
+	require.NoError(t, err)
+	assert.Equal(t, 2000, s.Generated)
+	assert.Equal(t, 500, s.Consumed)
+
+	// only the values marked as lifetime values are converted
+	s = newStatus("1010", 102100, 1200)
+	s.Cumulative = StatusCumulativeGenerating
+	s, err = restored.Apply(s)
+	require.NoError(t, err)
+	assert.Equal(t, 2100, s.Generated)
+	assert.Equal(t, 1200, s.Consumed)
+	assert.Equal(t, StatusCumulativeUnset, s.Cumulative)
+
+	s = newStatus("1015", 2300, 50600)
+	s.Cumulative = StatusCumulativeConsuming
+	s, err = restored.Apply(s)
+	require.NoError(t, err)
+	assert.Equal(t, 2300, s.Generated)
+	assert.Equal(t, 600, s.Consumed)
+
+	// statuses without lifetime values are rejected
+	s = newStatus("1020", 102200, 50700)
+	s.Cumulative = StatusCumulativeUnset
+	_, err = restored.Apply(s)
+	assert.Error(t, err)
+	s.Cumulative = StatusCumulative(4)
+	_, err = restored.Apply(s)
+	assert.Error(t, err)
+
+	_, err = restored.Apply(NewStatus())
+	assert.Error(t, err)
+	_, err = restored.Apply(newStatus("1005", -5, UnsetInt))
+	assert.Error(t, err)
+	assert.Error(t, restored.Load(bytes.NewBufferString("{")))
+}
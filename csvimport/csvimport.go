@@ -0,0 +1,607 @@
+// Package csvimport reads historical statuses and outputs from CSV files,
+// like the exports of inverter portals, and uploads them to PVOutput within
+// its batch and back-fill limits
+package csvimport
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skoef/pvoutput"
+)
+
+// Field is a Status or Output field a column can be mapped onto
+type Field string
+
+// Fields shared by statuses and outputs
+const (
+	FieldDate        Field = "date"
+	FieldGenerated   Field = "generated"
+	FieldConsumed    Field = "consumed"
+	FieldTemperature Field = "temperature"
+)
+
+// Status fields
+const (
+	// FieldTime is the time of a status, when not part of FieldDate
+	FieldTime       Field = "time"
+	FieldGenerating Field = "generating"
+	FieldConsuming  Field = "consuming"
+	FieldVoltage    Field = "voltage"
+	FieldExtended7  Field = "v7"
+	FieldExtended8  Field = "v8"
+	FieldExtended9  Field = "v9"
+	FieldExtended10 Field = "v10"
+	FieldExtended11 Field = "v11"
+	FieldExtended12 Field = "v12"
+)
+
+// Output fields. FieldTemperature is not used for outputs, use
+// FieldMinTemperature and FieldMaxTemperature instead
+const (
+	FieldExported           Field = "exported"
+	FieldPeakPower          Field = "peak_power"
+	FieldPeakTime           Field = "peak_time"
+	FieldCondition          Field = "condition"
+	FieldMinTemperature     Field = "min_temperature"
+	FieldMaxTemperature     Field = "max_temperature"
+	FieldComments           Field = "comments"
+	FieldImportPeak         Field = "import_peak"
+	FieldImportOffPeak      Field = "import_off_peak"
+	FieldImportShoulder     Field = "import_shoulder"
+	FieldImportHighShoulder Field = "import_high_shoulder"
+)
+
+var (
+	statusFields = []Field{
+		FieldDate, FieldTime, FieldGenerated, FieldGenerating, FieldConsumed, FieldConsuming,
+		FieldTemperature, FieldVoltage, FieldExtended7, FieldExtended8, FieldExtended9,
+		FieldExtended10, FieldExtended11, FieldExtended12,
+	}
+	outputFields = []Field{
+		FieldDate, FieldGenerated, FieldExported, FieldConsumed, FieldPeakPower, FieldPeakTime,
+		FieldCondition, FieldMinTemperature, FieldMaxTemperature, FieldComments, FieldImportPeak,
+		FieldImportOffPeak, FieldImportShoulder, FieldImportHighShoulder,
+	}
+)
+
+// Unit is the unit of the power or energy values in a file
+type Unit string
+
+// Supported units
+const (
+	UnitW   Unit = "W"
+	UnitKW  Unit = "kW"
+	UnitMW  Unit = "MW"
+	UnitWh  Unit = "Wh"
+	UnitKWh Unit = "kWh"
+	UnitMWh Unit = "MWh"
+)
+
+// scale returns the factor converting values in this unit to W or Wh
+func (u Unit) scale(energy bool) (float64, error) {
+	units := map[Unit]float64{UnitW: 1, UnitKW: 1e3, UnitMW: 1e6}
+	if energy {
+		units = map[Unit]float64{UnitWh: 1, UnitKWh: 1e3, UnitMWh: 1e6}
+	}
+
+	if f, ok := units[u]; ok {
+		return f, nil
+	}
+
+	if energy {
+		return 0, fmt.Errorf("unsupported energy unit %q", u)
+	}
+
+	return 0, fmt.Errorf("unsupported power unit %q", u)
+}
+
+// DateFormatUnix is the date format for dates given as seconds since the
+// epoch
+const DateFormatUnix = "unix"
+
+// Mapping describes the layout of a CSV file and maps its columns onto
+// fields
+type Mapping struct {
+	// Columns maps fields onto columns, by their name in the header or, when
+	// NoHeader is set, by their 1-based number
+	Columns map[Field]string
+	// NoHeader is set when the file has no header row
+	NoHeader bool
+	// SkipLines is the number of lines before the header, or before the
+	// first row without header, like the preamble of some exports
+	SkipLines int
+	// Comma is the field delimiter
+	Comma rune
+	// DecimalComma is set when numbers use a comma as decimal separator.
+	// Periods are then taken as thousands separators
+	DecimalComma bool
+	// DateFormat is the layout of FieldDate, as taken by time.Parse, or
+	// DateFormatUnix. For statuses without FieldTime it includes the time
+	DateFormat string
+	// TimeFormat is the layout of FieldTime and FieldPeakTime
+	TimeFormat string
+	// Location is the time zone of dates without one
+	Location *time.Location
+	// PowerUnit and EnergyUnit are the units of the power and energy fields
+	PowerUnit  Unit
+	EnergyUnit Unit
+	// Cumulative is set on every Status, e.g. StatusCumulativeGenerating
+	// when generation is given as lifetime energy
+	Cumulative pvoutput.StatusCumulative
+}
+
+// NewMapping returns a new Mapping for a comma separated file with header,
+// ISO 8601 dates, 24-hour times, W and Wh in the local time zone
+func NewMapping(columns map[Field]string) Mapping {
+	return Mapping{
+		Columns:    columns,
+		Comma:      ',',
+		DateFormat: "2006-01-02",
+		TimeFormat: "15:04",
+		Location:   time.Local,
+		PowerUnit:  UnitW,
+		EnergyUnit: UnitWh,
+		Cumulative: pvoutput.StatusCumulativeUnset,
+	}
+}
+
+// Skipped is a row or record that was not imported
+type Skipped struct {
+	// Line is the line number of the row, 0 when skipped after reading
+	Line int
+	// Date is the date of the status or output, when known
+	Date   time.Time
+	Reason string
+}
+
+func (s Skipped) String() string {
+	if s.Line > 0 {
+		return fmt.Sprintf("line %d: %s", s.Line, s.Reason)
+	}
+
+	return fmt.Sprintf("%s: %s", s.Date.Format("2006-01-02 15:04"), s.Reason)
+}
+
+// Report summarises an import
+type Report struct {
+	// Rows is the number of rows read, excluding header and skipped lines
+	Rows int
+	// Imported is the number of statuses or outputs read from the rows
+	Imported int
+	// Uploaded is the number of statuses or outputs uploaded
+	Uploaded int
+	Skipped  []Skipped
+}
+
+// skip records a skipped row or record
+func (r *Report) skip(line int, date time.Time, reason string) {
+	r.Skipped = append(r.Skipped, Skipped{Line: line, Date: date, Reason: reason})
+}
+
+// row is a row of a file with its values by field, or the error parsing it
+type row struct {
+	line   int
+	values map[Field]string
+	err    error
+}
+
+// rows reads the rows of given file and maps their values onto the mapped
+// fields, which should be in given list of supported fields
+func (m Mapping) rows(r io.Reader, supported []Field) ([]row, error) {
+	if len(m.Columns) == 0 {
+		return nil, errors.New("no columns mapped")
+	}
+	for f := range m.Columns {
+		found := false
+		for _, s := range supported {
+			found = found || s == f
+		}
+		if !found {
+			return nil, fmt.Errorf("field %s is not supported", f)
+		}
+	}
+	if _, ok := m.Columns[FieldDate]; !ok {
+		return nil, errors.New("date column is required")
+	}
+
+	lines := bufio.NewScanner(r)
+	lines.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+
+	// next returns the next line, the preamble is skipped before the first
+	next := func() (string, bool) {
+		for lines.Scan() {
+			line++
+			if line > m.SkipLines {
+				return lines.Text(), true
+			}
+		}
+
+		return "", false
+	}
+
+	parse := func(text string) ([]string, error) {
+		cr := csv.NewReader(strings.NewReader(text))
+		cr.Comma = m.Comma
+		cr.FieldsPerRecord = -1
+		cr.LazyQuotes = true
+
+		return cr.Read()
+	}
+
+	indices := map[Field]int{}
+	if m.NoHeader {
+		for _, f := range supported {
+			col, ok := m.Columns[f]
+			if !ok {
+				continue
+			}
+
+			n, err := strconv.Atoi(col)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("column %q of %s should be a number when there is no header", col, f)
+			}
+			indices[f] = n - 1
+		}
+	} else {
+		text, ok := next()
+		if !ok {
+			if err := lines.Err(); err != nil {
+				return nil, err
+			}
+
+			return nil, errors.New("header is missing")
+		}
+
+		header, err := parse(strings.TrimPrefix(text, "\ufeff"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid header: %s", err)
+		}
+
+		for _, f := range supported {
+			col, ok := m.Columns[f]
+			if !ok {
+				continue
+			}
+
+			indices[f] = -1
+			for i, name := range header {
+				if strings.EqualFold(strings.TrimSpace(name), strings.TrimSpace(col)) {
+					indices[f] = i
+					break
+				}
+			}
+			if indices[f] < 0 {
+				return nil, fmt.Errorf("column %q of %s not found in header", col, f)
+			}
+		}
+	}
+
+	rows := []row{}
+	for {
+		text, ok := next()
+		if !ok {
+			break
+		}
+
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		record, err := parse(text)
+		if err != nil {
+			rows = append(rows, row{line: line, err: err})
+			continue
+		}
+
+		// skip rows without any values, like ";;;"
+		empty := true
+		for _, v := range record {
+			empty = empty && strings.TrimSpace(v) == ""
+		}
+		if empty {
+			continue
+		}
+
+		values := map[Field]string{}
+		for f, i := range indices {
+			if i < len(record) {
+				values[f] = strings.TrimSpace(record[i])
+			}
+		}
+		rows = append(rows, row{line: line, values: values})
+	}
+
+	return rows, lines.Err()
+}
+
+// parseNumber parses given value, which is empty when unset
+func (m Mapping) parseNumber(v string) (float64, bool, error) {
+	if v == "" {
+		return 0, false, nil
+	}
+
+	n := v
+	if m.DecimalComma {
+		n = strings.Replace(strings.Replace(n, ".", "", -1), ",", ".", 1)
+	}
+
+	f, err := strconv.ParseFloat(n, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false, fmt.Errorf("invalid number %q", v)
+	}
+
+	return f, true, nil
+}
+
+// parseDateTime parses given date and optional time
+func (m Mapping) parseDateTime(date, clock string) (time.Time, error) {
+	if date == "" {
+		return time.Time{}, errors.New("date is missing")
+	}
+
+	if m.DateFormat == DateFormatUnix {
+		secs, err := strconv.ParseInt(date, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date %q", date)
+		}
+
+		return time.Unix(secs, 0).In(m.Location), nil
+	}
+
+	layout, value := m.DateFormat, date
+	if clock != "" {
+		layout, value = m.DateFormat+" "+m.TimeFormat, date+" "+clock
+	}
+
+	t, err := time.ParseInLocation(layout, value, m.Location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+
+	return t, nil
+}
+
+// values converts the values of a row, reporting the first error
+type values struct {
+	m   Mapping
+	row row
+	err error
+}
+
+// float returns the value of given field multiplied by scale, or unset
+func (v *values) float(f Field, scale float64) float64 {
+	n, ok, err := v.m.parseNumber(v.row.values[f])
+	if err != nil {
+		if v.err == nil {
+			v.err = fmt.Errorf("%s: %s", f, err)
+		}
+		return pvoutput.UnsetFloat
+	}
+	if !ok {
+		return pvoutput.UnsetFloat
+	}
+
+	return n * scale
+}
+
+// power returns the value of given power field in W, or unset. Negative
+// values, like the standby consumption of inverters at night, are taken as
+// zero
+func (v *values) power(f Field, scale float64) int {
+	p := v.float(f, scale)
+	if p == pvoutput.UnsetFloat {
+		return pvoutput.UnsetInt
+	}
+
+	return int(math.Round(math.Max(0, p)))
+}
+
+// energy returns the value of given energy field in Wh, or unset
+func (v *values) energy(f Field, scale float64) int {
+	e := v.float(f, scale)
+	if e == pvoutput.UnsetFloat {
+		return pvoutput.UnsetInt
+	}
+	if e < 0 {
+		if v.err == nil {
+			v.err = fmt.Errorf("%s: negative energy", f)
+		}
+		return pvoutput.UnsetInt
+	}
+
+	return int(math.Round(e))
+}
+
+// scales returns the factors converting power and energy values
+func (m Mapping) scales() (float64, float64, error) {
+	power, err := m.PowerUnit.scale(false)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	energy, err := m.EnergyUnit.scale(true)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return power, energy, nil
+}
+
+// ReadStatuses reads the statuses from given file, sorted by time. Rows that
+// can't be read, have no values or duplicate the time of an earlier row are
+// skipped and listed in the returned Report
+func (m Mapping) ReadStatuses(r io.Reader) (pvoutput.BatchStatus, *Report, error) {
+	power, energy, err := m.scales()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := m.rows(r, statusFields)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report := &Report{Rows: len(rows)}
+	statuses := pvoutput.BatchStatus{}
+	seen := map[time.Time]bool{}
+
+	for _, row := range rows {
+		if row.err != nil {
+			report.skip(row.line, time.Time{}, row.err.Error())
+			continue
+		}
+
+		if _, ok := m.Columns[FieldTime]; ok && row.values[FieldTime] == "" {
+			report.skip(row.line, time.Time{}, "time is missing")
+			continue
+		}
+
+		dt, err := m.parseDateTime(row.values[FieldDate], row.values[FieldTime])
+		if err != nil {
+			report.skip(row.line, time.Time{}, err.Error())
+			continue
+		}
+
+		v := &values{m: m, row: row}
+		s := pvoutput.NewStatus()
+		s.DateTime = dt
+		s.Cumulative = m.Cumulative
+		s.Generated = v.energy(FieldGenerated, energy)
+		s.Generating = v.power(FieldGenerating, power)
+		s.Consumed = v.energy(FieldConsumed, energy)
+		s.Consuming = v.power(FieldConsuming, power)
+		s.Temperature = v.float(FieldTemperature, 1)
+		s.Voltage = v.float(FieldVoltage, 1)
+		for i, f := range []Field{FieldExtended7, FieldExtended8, FieldExtended9, FieldExtended10, FieldExtended11, FieldExtended12} {
+			s.Extended[i] = v.float(f, 1)
+		}
+
+		if v.err != nil {
+			report.skip(row.line, dt, v.err.Error())
+			continue
+		}
+
+		// PVOutput requires at least one of these
+		if s.Generated == pvoutput.UnsetInt && s.Generating == pvoutput.UnsetInt && s.Consumed == pvoutput.UnsetInt && s.Consuming == pvoutput.UnsetInt {
+			report.skip(row.line, dt, "no energy or power values")
+			continue
+		}
+
+		// statuses are kept by the minute
+		key := dt.Truncate(time.Minute)
+		if seen[key] {
+			report.skip(row.line, dt, "duplicate time")
+			continue
+		}
+		seen[key] = true
+
+		statuses = append(statuses, s)
+	}
+
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return statuses[i].DateTime.Before(statuses[j].DateTime)
+	})
+	report.Imported = len(statuses)
+
+	return statuses, report, nil
+}
+
+// ReadOutputs reads the outputs from given file, sorted by date. Rows that
+// can't be read, have no values or duplicate the date of an earlier row are
+// skipped and listed in the returned Report
+func (m Mapping) ReadOutputs(r io.Reader) (pvoutput.BatchOutput, *Report, error) {
+	power, energy, err := m.scales()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := m.rows(r, outputFields)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report := &Report{Rows: len(rows)}
+	outputs := pvoutput.BatchOutput{}
+	seen := map[string]bool{}
+
+	for _, row := range rows {
+		if row.err != nil {
+			report.skip(row.line, time.Time{}, row.err.Error())
+			continue
+		}
+
+		dt, err := m.parseDateTime(row.values[FieldDate], "")
+		if err != nil {
+			report.skip(row.line, time.Time{}, err.Error())
+			continue
+		}
+		y, mo, d := dt.Date()
+		date := time.Date(y, mo, d, 0, 0, 0, 0, dt.Location())
+
+		v := &values{m: m, row: row}
+		o := pvoutput.NewOutput()
+		o.Date = date
+		o.Generated = v.energy(FieldGenerated, energy)
+		o.Exported = v.energy(FieldExported, energy)
+		o.Consumed = v.energy(FieldConsumed, energy)
+		o.PeakPower = v.power(FieldPeakPower, power)
+		o.MinTemp = v.float(FieldMinTemperature, 1)
+		o.MaxTemp = v.float(FieldMaxTemperature, 1)
+		o.ImportPeak = v.energy(FieldImportPeak, energy)
+		o.ImportOffPeak = v.energy(FieldImportOffPeak, energy)
+		o.ImportShoulder = v.energy(FieldImportShoulder, energy)
+		o.ImportHighShoulder = v.energy(FieldImportHighShoulder, energy)
+
+		if c := row.values[FieldCondition]; c != "" {
+			o.Condition = c
+		}
+		if c := row.values[FieldComments]; c != "" {
+			o.Comments = c
+		}
+
+		if pt := row.values[FieldPeakTime]; pt != "" {
+			t, err := time.ParseInLocation(m.TimeFormat, pt, m.Location)
+			if err != nil {
+				report.skip(row.line, date, fmt.Sprintf("%s: invalid time %q", FieldPeakTime, pt))
+				continue
+			}
+			o.PeakTime = time.Date(y, mo, d, t.Hour(), t.Minute(), 0, 0, date.Location())
+		}
+
+		if v.err != nil {
+			report.skip(row.line, date, v.err.Error())
+			continue
+		}
+
+		if o.Generated == pvoutput.UnsetInt && o.Consumed == pvoutput.UnsetInt && o.Exported == pvoutput.UnsetInt {
+			report.skip(row.line, date, "no energy values")
+			continue
+		}
+
+		key := date.Format("20060102")
+		if seen[key] {
+			report.skip(row.line, date, "duplicate date")
+			continue
+		}
+		seen[key] = true
+
+		outputs = append(outputs, o)
+	}
+
+	sort.SliceStable(outputs, func(i, j int) bool {
+		return outputs[i].Date.Before(outputs[j].Date)
+	})
+	report.Imported = len(outputs)
+
+	return outputs, report, nil
+}
@@ -0,0 +1,190 @@
+package csvimport
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skoef/pvoutput"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadStatuses(t *testing.T) {
+	f, err := os.Open("testdata/sunnyportal.csv")
+	require.NoError(t, err)
+	defer f.Close()
+
+	loc, err := time.LoadLocation("Europe/Amsterdam")
+	require.NoError(t, err)
+
+	m := NewMapping(map[Field]string{
+		FieldDate:        "",
+		FieldGenerated:   "Total yield [kWh]",
+		FieldGenerating:  "Power [kW]",
+		FieldTemperature: "temperature",
+	})
+	m.SkipLines = 2
+	m.Comma = ';'
+	m.DecimalComma = true
+	m.DateFormat = "02.01.2006 15:04"
+	m.Location = loc
+	m.PowerUnit = UnitKW
+	m.EnergyUnit = UnitKWh
+	m.Cumulative = pvoutput.StatusCumulativeGenerating
+
+	statuses, report, err := m.ReadStatuses(f)
+	require.NoError(t, err)
+	require.Len(t, statuses, 4)
+
+	assert.Equal(t, time.Date(2020, 8, 18, 12, 0, 0, 0, loc), statuses[0].DateTime)
+	assert.Equal(t, 12345100, statuses[0].Generated)
+	assert.Equal(t, 2510, statuses[0].Generating)
+	assert.Equal(t, 24.5, statuses[0].Temperature)
+	assert.Equal(t, pvoutput.UnsetInt, statuses[0].Consumed)
+	assert.Equal(t, -1.0, statuses[0].Voltage)
+	assert.Equal(t, pvoutput.StatusCumulativeGenerating, statuses[0].Cumulative)
+
+	// negative power is taken as zero, empty values are unset
+	assert.Equal(t, 0, statuses[2].Generating)
+	assert.Equal(t, -1.0, statuses[2].Temperature)
+	assert.Equal(t, time.Date(2020, 8, 18, 12, 40, 0, 0, loc), statuses[3].DateTime)
+
+	assert.Equal(t, 10, report.Rows)
+	assert.Equal(t, 4, report.Imported)
+
+	skipped := []string{}
+	for _, s := range report.Skipped {
+		skipped = append(skipped, s.String())
+	}
+	assert.Equal(t, []string{
+		`line 7: generating: invalid number "broken"`,
+		"line 8: duplicate time",
+		"line 9: no energy or power values",
+		`line 10: invalid date "32.08.2020 12:25"`,
+		"line 11: generated: negative energy",
+		"line 12: generated: invalid number \"12.346,100;2,200;25,0\"",
+	}, skipped)
+}
+
+func TestReadStatusesNoHeader(t *testing.T) {
+	f, err := os.Open("testdata/noheader.csv")
+	require.NoError(t, err)
+	defer f.Close()
+
+	m := NewMapping(map[Field]string{
+		FieldDate:       "1",
+		FieldGenerating: "2",
+		FieldVoltage:    "3",
+	})
+	m.NoHeader = true
+	m.Comma = '\t'
+	m.DateFormat = DateFormatUnix
+	m.Location = time.UTC
+
+	statuses, report, err := m.ReadStatuses(f)
+	require.NoError(t, err)
+	require.Len(t, statuses, 3)
+	assert.Empty(t, report.Skipped)
+
+	assert.Equal(t, time.Date(2020, 8, 18, 10, 0, 0, 0, time.UTC), statuses[0].DateTime)
+	assert.Equal(t, 1500, statuses[0].Generating)
+	assert.Equal(t, 230.1, statuses[0].Voltage)
+
+	// columns should be numbers
+	m.Columns[FieldVoltage] = "voltage"
+	_, _, err = m.ReadStatuses(strings.NewReader(""))
+	assert.EqualError(t, err, `column "voltage" of voltage should be a number when there is no header`)
+}
+
+func TestReadStatusesSeparateTime(t *testing.T) {
+	m := NewMapping(map[Field]string{
+		FieldDate:      "day",
+		FieldTime:      "time",
+		FieldConsuming: "load",
+	})
+	m.DateFormat = "01/02/2006"
+	m.TimeFormat = "3:04 PM"
+	m.Location = time.UTC
+
+	statuses, report, err := m.ReadStatuses(strings.NewReader("day,time,load\n08/18/2020,1:05 PM,450\n08/18/2020,,460\n"))
+	require.NoError(t, err)
+	require.Len(t, statuses, 1)
+	assert.Equal(t, time.Date(2020, 8, 18, 13, 5, 0, 0, time.UTC), statuses[0].DateTime)
+	assert.Equal(t, 450, statuses[0].Consuming)
+	require.Len(t, report.Skipped, 1)
+	assert.Equal(t, "line 3: time is missing", report.Skipped[0].String())
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		mapping  Mapping
+		input    string
+		expected string
+	}{
+		{NewMapping(nil), "", "no columns mapped"},
+		{NewMapping(map[Field]string{FieldGenerated: "g"}), "", "date column is required"},
+		{NewMapping(map[Field]string{FieldDate: "d", FieldPeakPower: "p"}), "", "field peak_power is not supported"},
+		{NewMapping(map[Field]string{FieldDate: "d"}), "", "header is missing"},
+		{NewMapping(map[Field]string{FieldDate: "d", FieldGenerated: "g"}), "date,generated\n", `column "d" of date not found in header`},
+		{Mapping{Columns: map[Field]string{FieldDate: "d"}, PowerUnit: "kWh", EnergyUnit: UnitKWh}, "", `unsupported power unit "kWh"`},
+		{Mapping{Columns: map[Field]string{FieldDate: "d"}, PowerUnit: UnitW, EnergyUnit: "J"}, "", `unsupported energy unit "J"`},
+	}
+
+	for _, tc := range tests {
+		_, _, err := tc.mapping.ReadStatuses(strings.NewReader(tc.input))
+		assert.EqualError(t, err, tc.expected)
+	}
+}
+
+func TestReadOutputs(t *testing.T) {
+	f, err := os.Open("testdata/outputs.csv")
+	require.NoError(t, err)
+	defer f.Close()
+
+	m := NewMapping(map[Field]string{
+		FieldDate:      "Date",
+		FieldGenerated: "Generated (kWh)",
+		FieldExported:  "Exported (kWh)",
+		FieldConsumed:  "Consumed (kWh)",
+		FieldPeakPower: "Peak (W)",
+		FieldPeakTime:  "Peak time",
+		FieldCondition: "Weather",
+		FieldComments:  "Notes",
+	})
+	m.EnergyUnit = UnitKWh
+	m.Location = time.UTC
+
+	outputs, report, err := m.ReadOutputs(f)
+	require.NoError(t, err)
+	require.Len(t, outputs, 4)
+
+	// sorted by date
+	o := outputs[0]
+	assert.Equal(t, time.Date(2020, 8, 1, 0, 0, 0, 0, time.UTC), o.Date)
+	assert.Equal(t, 18250, o.Generated)
+	assert.Equal(t, 11000, o.Exported)
+	assert.Equal(t, 8800, o.Consumed)
+	assert.Equal(t, 3720, o.PeakPower)
+	assert.Equal(t, time.Date(2020, 8, 1, 12, 50, 0, 0, time.UTC), o.PeakTime)
+	assert.Equal(t, "Partly Cloudy", o.Condition)
+	assert.Equal(t, "first day", o.Comments)
+
+	assert.Equal(t, pvoutput.UnsetString, outputs[1].Comments)
+	assert.Equal(t, pvoutput.UnsetInt, outputs[2].PeakPower)
+	assert.True(t, outputs[2].PeakTime.IsZero())
+	assert.Equal(t, pvoutput.UnsetInt, outputs[3].Exported)
+	assert.Equal(t, pvoutput.UnsetString, outputs[3].Condition)
+
+	assert.Equal(t, 7, report.Rows)
+	skipped := []string{}
+	for _, s := range report.Skipped {
+		skipped = append(skipped, s.String())
+	}
+	assert.Equal(t, []string{
+		"line 4: no energy values",
+		`line 5: peak_time: invalid time "noon"`,
+		"line 7: duplicate date",
+	}, skipped)
+}
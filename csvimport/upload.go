@@ -0,0 +1,114 @@
+package csvimport
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/skoef/pvoutput"
+)
+
+// Uploader uploads statuses and outputs, it is implemented by pvoutput.API
+type Uploader interface {
+	AddBatchStatus(b pvoutput.BatchStatus) error
+	AddOutput(o pvoutput.Output) error
+	AddBatchOutput(b pvoutput.BatchOutput) error
+}
+
+// Importer uploads imported statuses and outputs in batches, skipping those
+// PVOutput doesn't accept because of their date
+type Importer struct {
+	Uploader Uploader
+	// Donating allows larger output batches and statuses further back
+	Donating bool
+	// Progress, when set, is called after every batch with the number of
+	// statuses or outputs uploaded so far and the total
+	Progress func(done, total int)
+	now      func() time.Time
+}
+
+// NewImporter returns a new Importer uploading to given Uploader
+func NewImporter(u Uploader, donating bool) *Importer {
+	return &Importer{
+		Uploader: u,
+		Donating: donating,
+		now:      time.Now,
+	}
+}
+
+// UploadStatuses uploads given statuses, which should be sorted by time, in
+// batches of pvoutput.BatchStatusMaxSize. Statuses older than PVOutput
+// accepts or in the future are skipped and recorded in given Report. When an
+// upload fails, the error is returned and Report.Uploaded tells how many
+// statuses made it
+func (i *Importer) UploadStatuses(statuses pvoutput.BatchStatus, report *Report) error {
+	now := i.now()
+	y, m, d := now.Date()
+	days := pvoutput.StatusMaxAgeDays
+	if i.Donating {
+		days = pvoutput.StatusMaxAgeDaysDonating
+	}
+	oldest := time.Date(y, m, d-days, 0, 0, 0, 0, now.Location())
+
+	accepted := pvoutput.BatchStatus{}
+	for _, s := range statuses {
+		switch {
+		case s.DateTime.Before(oldest):
+			report.skip(0, s.DateTime, fmt.Sprintf("older than %d days", days))
+		case s.DateTime.After(now):
+			report.skip(0, s.DateTime, "in the future")
+		default:
+			accepted = append(accepted, s)
+		}
+	}
+
+	for start := 0; start < len(accepted); start += pvoutput.BatchStatusMaxSize {
+		end := start + pvoutput.BatchStatusMaxSize
+		if end > len(accepted) {
+			end = len(accepted)
+		}
+
+		batch := accepted[start:end]
+		if err := i.Uploader.AddBatchStatus(batch); err != nil {
+			return fmt.Errorf("could not upload statuses from %s: %s", batch[0].DateTime.Format("2006-01-02 15:04"), err)
+		}
+
+		report.Uploaded += len(batch)
+		if i.Progress != nil {
+			i.Progress(end, len(accepted))
+		}
+	}
+
+	return nil
+}
+
+// UploadOutputs uploads given outputs, which should be sorted by date, in
+// batches of pvoutput.BatchOutputMaxSizeDonating when donating and one by one
+// otherwise. Outputs in the future are skipped and recorded in given Report.
+// When an upload fails, the error is returned and Report.Uploaded tells how
+// many outputs made it
+func (i *Importer) UploadOutputs(outputs pvoutput.BatchOutput, report *Report) error {
+	now := i.now()
+
+	accepted := pvoutput.BatchOutput{}
+	for _, o := range outputs {
+		if o.Date.After(now) {
+			report.skip(0, o.Date, "in the future")
+			continue
+		}
+		accepted = append(accepted, o)
+	}
+
+	done := 0
+	err := pvoutput.UploadOutputs(i.Uploader, accepted, i.Donating, func(b pvoutput.BatchOutput) {
+		done += len(b)
+		report.Uploaded += len(b)
+		if i.Progress != nil {
+			i.Progress(done, len(accepted))
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("could not upload outputs from %s: %s", accepted[done].Date.Format("2006-01-02"), err)
+	}
+
+	return nil
+}
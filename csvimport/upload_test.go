@@ -0,0 +1,110 @@
+package csvimport
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/skoef/pvoutput"
+	"github.com/skoef/pvoutput/internal/pvtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadStatuses(t *testing.T) {
+	now := time.Date(2020, 8, 18, 12, 0, 0, 0, time.UTC)
+	u := &pvtest.Uploader{}
+	i := NewImporter(u, false)
+	i.now = func() time.Time { return now }
+
+	progress := []int{}
+	i.Progress = func(done, total int) {
+		progress = append(progress, done)
+		assert.Equal(t, 65, total)
+	}
+
+	// one status too old, 65 within the last 14 days and one in the future
+	statuses := pvtest.Statuses(time.Date(2020, 8, 3, 23, 55, 0, 0, time.UTC), 5*time.Minute, 1)
+	statuses = append(statuses, pvtest.Statuses(time.Date(2020, 8, 4, 0, 0, 0, 0, time.UTC), 5*time.Minute, 65)...)
+	statuses = append(statuses, pvtest.Statuses(now.Add(time.Minute), 5*time.Minute, 1)...)
+
+	report := &Report{}
+	require.NoError(t, i.UploadStatuses(statuses, report))
+
+	require.Len(t, u.StatusBatches, 3)
+	assert.Len(t, u.StatusBatches[0], 30)
+	assert.Len(t, u.StatusBatches[1], 30)
+	assert.Len(t, u.StatusBatches[2], 5)
+	assert.Equal(t, time.Date(2020, 8, 4, 0, 0, 0, 0, time.UTC), u.StatusBatches[0][0].DateTime)
+	assert.Equal(t, []int{30, 60, 65}, progress)
+
+	assert.Equal(t, 65, report.Uploaded)
+	require.Len(t, report.Skipped, 2)
+	assert.Equal(t, "2020-08-03 23:55: older than 14 days", report.Skipped[0].String())
+	assert.Equal(t, "2020-08-18 12:01: in the future", report.Skipped[1].String())
+
+	// donating accounts go back 90 days
+	u = &pvtest.Uploader{}
+	i = NewImporter(u, true)
+	i.now = func() time.Time { return now }
+	report = &Report{}
+	require.NoError(t, i.UploadStatuses(pvtest.Statuses(time.Date(2020, 5, 20, 12, 0, 0, 0, time.UTC), 5*time.Minute, 2), report))
+	assert.Equal(t, 2, report.Uploaded)
+	assert.Empty(t, report.Skipped)
+}
+
+func TestUploadStatusesError(t *testing.T) {
+	now := time.Date(2020, 8, 18, 12, 0, 0, 0, time.UTC)
+	u := &pvtest.Uploader{FailAfter: 1, Err: errors.New("Bad request 400: Moon Powered")}
+	i := NewImporter(u, false)
+	i.now = func() time.Time { return now }
+
+	report := &Report{}
+	err := i.UploadStatuses(pvtest.Statuses(time.Date(2020, 8, 17, 0, 0, 0, 0, time.UTC), 5*time.Minute, 40), report)
+	assert.EqualError(t, err, "could not upload statuses from 2020-08-17 02:30: Bad request 400: Moon Powered")
+	assert.Equal(t, 30, report.Uploaded)
+}
+
+func TestUploadRateLimit(t *testing.T) {
+	now := time.Date(2020, 8, 18, 12, 0, 0, 0, time.UTC)
+	u := &pvtest.Uploader{
+		FailAfter: 1,
+		Err:       pvoutput.ErrRateLimitExceeded,
+	}
+	i := NewImporter(u, false)
+	i.now = func() time.Time { return now }
+
+	// the import stops, waiting for the rate limit is up to the uploader
+	report := &Report{}
+	err := i.UploadStatuses(pvtest.Statuses(time.Date(2020, 8, 17, 0, 0, 0, 0, time.UTC), 5*time.Minute, 40), report)
+	assert.EqualError(t, err, "could not upload statuses from 2020-08-17 02:30: rate limit exceeded")
+	assert.Equal(t, 30, report.Uploaded)
+}
+
+func TestUploadOutputs(t *testing.T) {
+	now := time.Date(2020, 8, 18, 12, 0, 0, 0, time.UTC)
+	outputs := pvtest.Outputs(time.Date(2020, 3, 31, 0, 0, 0, 0, time.UTC), 150)
+
+	// not donating, one by one
+	u := &pvtest.Uploader{}
+	i := NewImporter(u, false)
+	i.now = func() time.Time { return now }
+	report := &Report{}
+	require.NoError(t, i.UploadOutputs(outputs[:3], report))
+	assert.Len(t, u.Outputs, 3)
+	assert.Empty(t, u.OutputBatches)
+	assert.Equal(t, 3, report.Uploaded)
+
+	// donating, in batches of 100, skipping dates in the future
+	u = &pvtest.Uploader{}
+	i = NewImporter(u, true)
+	i.now = func() time.Time { return now }
+	report = &Report{}
+	require.NoError(t, i.UploadOutputs(outputs, report))
+	require.Len(t, u.OutputBatches, 2)
+	assert.Len(t, u.OutputBatches[0], 100)
+	assert.Len(t, u.OutputBatches[1], 41)
+	assert.Equal(t, 141, report.Uploaded)
+	require.Len(t, report.Skipped, 9)
+	assert.Equal(t, "2020-08-19 00:00: in the future", report.Skipped[0].String())
+}
@@ -0,0 +1,57 @@
+package dsmr
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Reader reads telegrams from an io.Reader, like a serial port or a
+// TCP-to-serial bridge
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader returns a new Reader reading from r
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// ReadRaw returns the next raw telegram, skipping any data before its start
+func (r *Reader) ReadRaw() (string, error) {
+	// skip to the start of the next telegram
+	if _, err := r.r.ReadString(telegramStart); err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteByte(telegramStart)
+
+	for {
+		line, err := r.r.ReadString('\n')
+		sb.WriteString(line)
+		if strings.HasPrefix(line, string(telegramEnd)) {
+			return sb.String(), nil
+		}
+
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+
+			return "", err
+		}
+	}
+}
+
+// Read returns the next telegram. Telegrams that fail to parse, e.g. due to a
+// checksum mismatch, are returned as error; the next call to Read continues
+// with the following telegram
+func (r *Reader) Read() (*Telegram, error) {
+	raw, err := r.ReadRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(raw)
+}
@@ -0,0 +1,43 @@
+package dsmr
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReader(t *testing.T) {
+	f, err := os.Open("testdata/stream")
+	require.NoError(t, err)
+	defer f.Close()
+
+	r := NewReader(f)
+
+	// first telegram is preceded by garbage
+	tg, err := r.Read()
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1193, tg.PowerImported)
+	}
+
+	// second telegram has a broken checksum
+	_, err = r.Read()
+	assert.Error(t, err)
+
+	// reader recovers with the next telegram
+	tg, err = r.Read()
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2793, tg.PowerImported)
+	}
+
+	_, err = r.Read()
+	assert.Equal(t, io.EOF, err)
+
+	// telegram cut off halfway
+	r = NewReader(strings.NewReader("/test\r\n1-0:1.8.1(000306.946*kWh)\r\n"))
+	_, err = r.Read()
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
@@ -0,0 +1,387 @@
+// Package dsmr reads telegrams from the P1 port of Dutch and Belgian smart
+// meters (DSMR 2.2 up to 5.0) and maps them onto PVOutput's data structures
+package dsmr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skoef/pvoutput"
+)
+
+// OBIS codes of the readings used from a telegram
+const (
+	OBISTimestamp       = "0-0:1.0.0"
+	OBISEquipmentID     = "0-0:96.1.1"
+	OBISImportedTariff1 = "1-0:1.8.1"
+	OBISImportedTariff2 = "1-0:1.8.2"
+	OBISExportedTariff1 = "1-0:2.8.1"
+	OBISExportedTariff2 = "1-0:2.8.2"
+	OBISTariffIndicator = "0-0:96.14.0"
+	OBISPowerImported   = "1-0:1.7.0"
+	OBISPowerExported   = "1-0:2.7.0"
+	OBISVoltageL1       = "1-0:32.7.0"
+)
+
+const (
+	timestampLayout = "060102150405"
+	telegramStart   = '/'
+	telegramEnd     = '!'
+)
+
+var (
+	// a COSEM object, e.g. 1-0:1.8.1(001234.567*kWh)
+	lineRegexp = regexp.MustCompile(`^(\d+-\d+:\d+\.\d+\.\d+)((?:\([^)]*\))+)$`)
+	// values are wrapped in parentheses
+	valueRegexp = regexp.MustCompile(`\(([^)]*)\)`)
+	// the time zone of meters, nil when the time zone data isn't available
+	location = loadLocation("Europe/Amsterdam")
+)
+
+// loadLocation returns the location with given name, or nil when it can't be
+// loaded, like on hosts without time zone data
+func loadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil
+	}
+
+	return loc
+}
+
+// Telegram represents a single telegram read from the P1 port. Energy values
+// are lifetime values in watt hours, power values are in watts
+type Telegram struct {
+	Header      string
+	Timestamp   time.Time
+	EquipmentID string
+	// Imported holds imported energy per tariff (1 and 2)
+	Imported [2]int
+	// Exported holds exported energy per tariff (1 and 2)
+	Exported [2]int
+	// Tariff is the currently active tariff (1 or 2), 0 when unknown
+	Tariff        int
+	PowerImported int
+	PowerExported int
+	Voltage       float64 // volts, phase L1. 0 when unknown
+	// Objects holds all raw values by OBIS code
+	Objects map[string][]string
+}
+
+// Tariffs maps the meter's tariffs onto PVOutput's peak and off-peak fields
+type Tariffs struct {
+	Peak    int // tariff number counted as peak
+	OffPeak int // tariff number counted as off-peak
+}
+
+var (
+	// TariffsNL is the tariff mapping used in the Netherlands, where tariff 1
+	// is the low (off-peak) tariff
+	TariffsNL = Tariffs{Peak: 2, OffPeak: 1}
+	// TariffsBE is the tariff mapping used in Belgium, where tariff 1 is the
+	// day (peak) tariff
+	TariffsBE = Tariffs{Peak: 1, OffPeak: 2}
+)
+
+// checksum calculates the CRC16 (polynomial 0xA001) DSMR 4 and up append to
+// the telegram
+func checksum(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = (crc >> 1) ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+
+	return crc
+}
+
+// parseUnitValue parses values like 001234.567*kWh into given unit
+func parseUnitValue(value string) (float64, string, error) {
+	parts := strings.SplitN(value, "*", 2)
+	f, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0, "", err
+	}
+
+	unit := ""
+	if len(parts) == 2 {
+		unit = parts[1]
+	}
+
+	return f, unit, nil
+}
+
+// parseEnergy parses an energy value into watt hours
+func parseEnergy(value string) (int, error) {
+	f, unit, err := parseUnitValue(value)
+	if err != nil {
+		return 0, err
+	}
+
+	switch unit {
+	case "kWh", "":
+		return int(math.Round(f * 1000)), nil
+	case "Wh":
+		return int(math.Round(f)), nil
+	}
+
+	return 0, fmt.Errorf("unexpected energy unit %s", unit)
+}
+
+// parsePower parses a power value into watts
+func parsePower(value string) (int, error) {
+	f, unit, err := parseUnitValue(value)
+	if err != nil {
+		return 0, err
+	}
+
+	switch unit {
+	case "kW", "":
+		return int(math.Round(f * 1000)), nil
+	case "W":
+		return int(math.Round(f)), nil
+	}
+
+	return 0, fmt.Errorf("unexpected power unit %s", unit)
+}
+
+// parseTimestamp parses a DSMR timestamp like 101209113020W in given time
+// zone. Timestamps have a suffix: S for summer, W for winter time. Without
+// time zone, the suffix sets the offset to that of CEST or CET
+func parseTimestamp(value string, loc *time.Location) (time.Time, error) {
+	if len(value) != len(timestampLayout)+1 {
+		return time.Time{}, fmt.Errorf("invalid timestamp %s", value)
+	}
+
+	if loc == nil {
+		loc = time.FixedZone("CET", 3600)
+		if value[len(value)-1] == 'S' {
+			loc = time.FixedZone("CEST", 7200)
+		}
+	}
+
+	t, err := time.ParseInLocation(timestampLayout, value[:len(timestampLayout)], loc)
+	if err != nil {
+		return t, err
+	}
+
+	// during the hour that occurs twice when switching back to winter time,
+	// the suffix tells which one is meant
+	_, offset := t.Zone()
+	switch value[len(value)-1] {
+	case 'S':
+		if alt := t.Add(-time.Hour); alt.Format(timestampLayout) == value[:len(timestampLayout)] {
+			if _, o := alt.Zone(); o > offset {
+				t = alt
+			}
+		}
+	case 'W':
+		if alt := t.Add(time.Hour); alt.Format(timestampLayout) == value[:len(timestampLayout)] {
+			if _, o := alt.Zone(); o < offset {
+				t = alt
+			}
+		}
+	}
+
+	return t, nil
+}
+
+// Parse parses given raw telegram, starting with / and ending with ! and
+// (from DSMR 4 onwards) its checksum
+func Parse(raw string) (*Telegram, error) {
+	start := strings.IndexByte(raw, telegramStart)
+	end := strings.IndexByte(raw, telegramEnd)
+	if start < 0 || end < start {
+		return nil, errors.New("incomplete telegram")
+	}
+
+	crc := strings.TrimSpace(raw[end+1:])
+	if crc != "" {
+		expected, err := strconv.ParseUint(crc, 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid checksum %s", crc)
+		}
+		if actual := checksum([]byte(raw[start : end+1])); uint16(expected) != actual {
+			return nil, fmt.Errorf("checksum mismatch: expected %04X, got %04X", expected, actual)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(raw[start:end]), "\n")
+	t := &Telegram{
+		Header:  strings.TrimSpace(strings.TrimPrefix(lines[0], "/")),
+		Objects: map[string][]string{},
+	}
+
+	for _, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		match := lineRegexp.FindStringSubmatch(line)
+		if match == nil {
+			// DSMR 2.2 gas readings continue on the next line, skip those
+			continue
+		}
+
+		values := []string{}
+		for _, v := range valueRegexp.FindAllStringSubmatch(match[2], -1) {
+			values = append(values, v[1])
+		}
+		t.Objects[match[1]] = values
+	}
+
+	if err := t.decode(); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func (t *Telegram) decode() error {
+	var err error
+
+	get := func(obis string) (string, bool) {
+		values, ok := t.Objects[obis]
+		if !ok || len(values) == 0 {
+			return "", false
+		}
+
+		return values[len(values)-1], true
+	}
+
+	if v, ok := get(OBISTimestamp); ok {
+		if t.Timestamp, err = parseTimestamp(v, location); err != nil {
+			return err
+		}
+	}
+
+	if v, ok := get(OBISEquipmentID); ok {
+		t.EquipmentID = v
+	}
+
+	for obis, dst := range map[string]*int{
+		OBISImportedTariff1: &t.Imported[0],
+		OBISImportedTariff2: &t.Imported[1],
+		OBISExportedTariff1: &t.Exported[0],
+		OBISExportedTariff2: &t.Exported[1],
+	} {
+		if v, ok := get(obis); ok {
+			if *dst, err = parseEnergy(v); err != nil {
+				return fmt.Errorf("%s: %s", obis, err)
+			}
+		}
+	}
+
+	for obis, dst := range map[string]*int{
+		OBISPowerImported: &t.PowerImported,
+		OBISPowerExported: &t.PowerExported,
+	} {
+		if v, ok := get(obis); ok {
+			if *dst, err = parsePower(v); err != nil {
+				return fmt.Errorf("%s: %s", obis, err)
+			}
+		}
+	}
+
+	if v, ok := get(OBISTariffIndicator); ok {
+		if t.Tariff, err = strconv.Atoi(v); err != nil {
+			return fmt.Errorf("%s: %s", OBISTariffIndicator, err)
+		}
+	}
+
+	if v, ok := get(OBISVoltageL1); ok {
+		if t.Voltage, _, err = parseUnitValue(v); err != nil {
+			return fmt.Errorf("%s: %s", OBISVoltageL1, err)
+		}
+	}
+
+	return nil
+}
+
+// TotalImported returns the imported energy over all tariffs
+func (t *Telegram) TotalImported() int {
+	return t.Imported[0] + t.Imported[1]
+}
+
+// TotalExported returns the exported energy over all tariffs
+func (t *Telegram) TotalExported() int {
+	return t.Exported[0] + t.Exported[1]
+}
+
+// Status returns a Status for this telegram. Consumed is the lifetime energy
+// imported from the grid, so Cumulative is set to StatusCumulativeConsuming.
+// Consuming is the net power imported from the grid. Since the meter doesn't
+// know what is generated behind it, these values only represent actual
+// consumption for systems without (or with separately metered) generation.
+// DSMR 2.2 telegrams carry no timestamp, so DateTime should be set by the
+// caller for these
+func (t *Telegram) Status() pvoutput.Status {
+	s := pvoutput.NewStatus()
+	s.DateTime = t.Timestamp
+	s.Consumed = t.TotalImported()
+	s.Consuming = t.PowerImported - t.PowerExported
+	if s.Consuming < 0 {
+		s.Consuming = 0
+	}
+	s.Cumulative = pvoutput.StatusCumulativeConsuming
+	if t.Voltage > 0 {
+		s.Voltage = t.Voltage
+	}
+
+	return s
+}
+
+// Output returns an Output with the energy imported and exported per tariff
+// since given telegram, which is typically the first telegram of the day.
+// There is no Output without such a telegram, e.g. on the first day
+func (t *Telegram) Output(since *Telegram, tariffs Tariffs) (pvoutput.Output, error) {
+	o := pvoutput.NewOutput()
+	if since == nil {
+		return o, errors.New("telegram to compare with is required")
+	}
+	if tariffs.Peak < 1 || tariffs.Peak > 2 || tariffs.OffPeak < 1 || tariffs.OffPeak > 2 {
+		return o, errors.New("tariffs should be either 1 or 2")
+	}
+
+	diff := func(now, then int) (int, error) {
+		if now < then {
+			return 0, errors.New("meter readings decreased since given telegram")
+		}
+
+		return now - then, nil
+	}
+
+	var err error
+	if o.ImportPeak, err = diff(t.Imported[tariffs.Peak-1], since.Imported[tariffs.Peak-1]); err != nil {
+		return o, err
+	}
+	if o.ImportOffPeak, err = diff(t.Imported[tariffs.OffPeak-1], since.Imported[tariffs.OffPeak-1]); err != nil {
+		return o, err
+	}
+	if o.ExportPeak, err = diff(t.Exported[tariffs.Peak-1], since.Exported[tariffs.Peak-1]); err != nil {
+		return o, err
+	}
+	if o.ExportOffPeak, err = diff(t.Exported[tariffs.OffPeak-1], since.Exported[tariffs.OffPeak-1]); err != nil {
+		return o, err
+	}
+
+	o.Date = t.Timestamp
+	if !o.Date.IsZero() {
+		y, m, d := o.Date.Date()
+		o.Date = time.Date(y, m, d, 0, 0, 0, 0, o.Date.Location())
+	}
+
+	return o, nil
+}
@@ -0,0 +1,141 @@
+package dsmr
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skoef/pvoutput"
+)
+
+func readTelegram(t *testing.T, name string) *Telegram {
+	data, err := ioutil.ReadFile("testdata/" + name)
+	require.NoError(t, err)
+
+	tg, err := Parse(string(data))
+	require.NoError(t, err)
+
+	return tg
+}
+
+func TestChecksum(t *testing.T) {
+	assert.Equal(t, uint16(0xBB3D), checksum([]byte("123456789")))
+}
+
+func TestParse(t *testing.T) {
+	// DSMR 5.0
+	tg := readTelegram(t, "dsmr50")
+	assert.Equal(t, `ISk5\2MT382-1000`, tg.Header)
+	assert.Equal(t, "4B384547303034303436333935353037", tg.EquipmentID)
+	assert.Equal(t, time.Date(2010, 12, 9, 11, 30, 20, 0, location), tg.Timestamp)
+	assert.Equal(t, [2]int{123456789, 123456789}, tg.Imported)
+	assert.Equal(t, [2]int{123456789, 123456789}, tg.Exported)
+	assert.Equal(t, 2, tg.Tariff)
+	assert.Equal(t, 1193, tg.PowerImported)
+	assert.Equal(t, 0, tg.PowerExported)
+	assert.Equal(t, 220.1, tg.Voltage)
+	assert.Equal(t, []string{"101209112500W", "12785.123*m3"}, tg.Objects["0-1:24.2.1"])
+
+	// DSMR 4.2
+	tg = readTelegram(t, "dsmr42")
+	assert.Equal(t, [2]int{306946, 210088}, tg.Imported)
+	assert.Equal(t, 517034, tg.TotalImported())
+	assert.Equal(t, 0, tg.TotalExported())
+	assert.Equal(t, 2793, tg.PowerImported)
+	assert.Equal(t, 1, tg.Tariff)
+
+	// DSMR 2.2 has no timestamp or checksum
+	tg = readTelegram(t, "dsmr22")
+	assert.True(t, tg.Timestamp.IsZero())
+	assert.Equal(t, [2]int{185000, 84000}, tg.Imported)
+	assert.Equal(t, [2]int{13000, 19000}, tg.Exported)
+	assert.Equal(t, 980, tg.PowerImported)
+	assert.Equal(t, 0.0, tg.Voltage)
+
+	// broken telegrams
+	data, err := ioutil.ReadFile("testdata/dsmr42")
+	require.NoError(t, err)
+	_, err = Parse(strings.Replace(string(data), "02.793", "02.794", 1))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "checksum mismatch")
+	}
+	_, err = Parse(strings.Split(string(data), "!")[0])
+	assert.Error(t, err)
+	_, err = Parse("/test\r\n1-0:1.8.1(abc*kWh)\r\n!\r\n")
+	assert.Error(t, err)
+	_, err = Parse("/test\r\n1-0:1.7.0(1.0*MW)\r\n!\r\n")
+	assert.Error(t, err)
+}
+
+func TestParseTimestamp(t *testing.T) {
+	// 02:30 occurs twice when switching back to winter time
+	summer, err := parseTimestamp("201025023000S", location)
+	require.NoError(t, err)
+	winter, err := parseTimestamp("201025023000W", location)
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, winter.Sub(summer))
+
+	// without time zone data, the suffix tells the offset
+	t1, err := parseTimestamp("200701120000S", nil)
+	require.NoError(t, err)
+	assert.True(t, t1.Equal(time.Date(2020, 7, 1, 10, 0, 0, 0, time.UTC)))
+	t2, err := parseTimestamp("201225120000W", nil)
+	require.NoError(t, err)
+	assert.True(t, t2.Equal(time.Date(2020, 12, 25, 11, 0, 0, 0, time.UTC)))
+	t3, err := parseTimestamp("201025023000S", nil)
+	require.NoError(t, err)
+	assert.True(t, t3.Equal(summer))
+
+	_, err = parseTimestamp("2010250230", location)
+	assert.Error(t, err)
+}
+
+func TestTelegramStatus(t *testing.T) {
+	tg := readTelegram(t, "dsmr42")
+	s := tg.Status()
+	assert.Equal(t, tg.Timestamp, s.DateTime)
+	assert.Equal(t, 517034, s.Consumed)
+	assert.Equal(t, 2793, s.Consuming)
+	assert.Equal(t, 229.0, s.Voltage)
+	assert.Equal(t, pvoutput.StatusCumulativeConsuming, s.Cumulative)
+
+	// net export results in zero consumption from the grid
+	tg.PowerImported = 0
+	tg.PowerExported = 1500
+	assert.Equal(t, 0, tg.Status().Consuming)
+}
+
+func TestTelegramOutput(t *testing.T) {
+	since := readTelegram(t, "dsmr42")
+	now := readTelegram(t, "dsmr42")
+	now.Imported[0] += 1500
+	now.Imported[1] += 4000
+	now.Exported[0] += 200
+	now.Exported[1] += 3000
+
+	o, err := now.Output(since, TariffsNL)
+	if assert.NoError(t, err) {
+		assert.Equal(t, time.Date(2017, 1, 24, 0, 0, 0, 0, location), o.Date)
+		assert.Equal(t, 4000, o.ImportPeak)
+		assert.Equal(t, 1500, o.ImportOffPeak)
+		assert.Equal(t, 3000, o.ExportPeak)
+		assert.Equal(t, 200, o.ExportOffPeak)
+	}
+
+	o, err = now.Output(since, TariffsBE)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1500, o.ImportPeak)
+		assert.Equal(t, 4000, o.ImportOffPeak)
+	}
+
+	_, err = now.Output(since, Tariffs{})
+	assert.Error(t, err)
+	_, err = now.Output(nil, TariffsNL)
+	assert.Error(t, err)
+	_, err = since.Output(now, TariffsNL)
+	assert.Error(t, err)
+}
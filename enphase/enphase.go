@@ -0,0 +1,217 @@
+// Package enphase reads Enphase Envoy gateways through their local API and
+// maps their readings onto PVOutput's data structures
+package enphase
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/skoef/pvoutput"
+)
+
+const (
+	apiProduction = "/production.json"
+	apiInverters  = "/api/v1/production/inverters"
+	// DefaultTimeout is the default timeout for requests to the Envoy
+	DefaultTimeout = 10 * time.Second
+	// MaxExtendedInverters is the number of microinverters that can be
+	// mapped onto the extended data fields v7 to v12
+	MaxExtendedInverters = 6
+)
+
+// Client polls an Envoy
+type Client struct {
+	BaseURL string
+	// Token is the JWT needed by firmware D7 and up, leave empty for older
+	// firmware
+	Token string
+	// ExtendedInverters lists the serial numbers of up to 6 microinverters
+	// of which the power is mapped onto extended data fields v7 to v12
+	ExtendedInverters []string
+	client            *http.Client
+}
+
+// NewClient returns a new Client for the Envoy on given host. When a token
+// is given, the Envoy is accessed over HTTPS. Since Envoys use a self-signed
+// certificate, it is not verified
+func NewClient(host, token string) *Client {
+	c := &Client{
+		BaseURL: fmt.Sprintf("http://%s", host),
+		Token:   token,
+		client:  &http.Client{Timeout: DefaultTimeout},
+	}
+
+	if token != "" {
+		c.BaseURL = fmt.Sprintf("https://%s", host)
+		c.client.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+
+	return c
+}
+
+// Measurement is a single production or consumption measurement
+type Measurement struct {
+	Type            string  `json:"type"`
+	ActiveCount     int     `json:"activeCount"`
+	MeasurementType string  `json:"measurementType"`
+	ReadingTime     int64   `json:"readingTime"`
+	WattsNow        float64 `json:"wNow"`
+	WattHoursLife   float64 `json:"whLifetime"`
+	WattHoursToday  float64 `json:"whToday"`
+	RMSVoltage      float64 `json:"rmsVoltage"`
+}
+
+// Production is the response of /production.json
+type Production struct {
+	Production  []Measurement `json:"production"`
+	Consumption []Measurement `json:"consumption"`
+}
+
+// Inverter is a single microinverter as reported by
+// /api/v1/production/inverters
+type Inverter struct {
+	SerialNumber    string `json:"serialNumber"`
+	LastReportDate  int64  `json:"lastReportDate"`
+	DevType         int    `json:"devType"`
+	LastReportWatts int    `json:"lastReportWatts"`
+	MaxReportWatts  int    `json:"maxReportWatts"`
+}
+
+// get requests given path and decodes its response into v
+func (c *Client) get(path string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(c.BaseURL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+
+	if c.Token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.Token))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return errors.New("unauthorized, a valid token is required")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Production requests /production.json
+func (c *Client) Production() (Production, error) {
+	p := Production{}
+	err := c.get(apiProduction, &p)
+
+	return p, err
+}
+
+// Inverters requests /api/v1/production/inverters
+func (c *Client) Inverters() ([]Inverter, error) {
+	inverters := []Inverter{}
+	err := c.get(apiInverters, &inverters)
+
+	return inverters, err
+}
+
+// find returns the first active measurement of given type
+func find(measurements []Measurement, typ, measurementType string) (Measurement, bool) {
+	for _, m := range measurements {
+		if m.Type == typ && m.MeasurementType == measurementType && m.ActiveCount > 0 {
+			return m, true
+		}
+	}
+
+	return Measurement{}, false
+}
+
+// Status maps given production data onto a Status. When the Envoy has
+// production CTs installed, their values are used and Generated is the
+// energy generated today. Otherwise, the microinverters' totals are used,
+// Generated is the lifetime energy and Cumulative is set accordingly.
+// Consumption is only set when consumption CTs are installed
+func (p Production) Status() (pvoutput.Status, error) {
+	s := pvoutput.NewStatus()
+
+	if eim, ok := find(p.Production, "eim", "production"); ok {
+		s.DateTime = time.Unix(eim.ReadingTime, 0)
+		s.Generating = int(math.Round(math.Max(0, eim.WattsNow)))
+		s.Generated = int(math.Round(eim.WattHoursToday))
+		if eim.RMSVoltage > 0 {
+			s.Voltage = eim.RMSVoltage
+		}
+
+		if cons, ok := find(p.Consumption, "eim", "total-consumption"); ok {
+			s.Consuming = int(math.Round(math.Max(0, cons.WattsNow)))
+			s.Consumed = int(math.Round(cons.WattHoursToday))
+		}
+
+		return s, nil
+	}
+
+	if inv, ok := find(p.Production, "inverters", ""); ok {
+		s.DateTime = time.Unix(inv.ReadingTime, 0)
+		s.Generating = int(math.Round(math.Max(0, inv.WattsNow)))
+		s.Generated = int(math.Round(inv.WattHoursLife))
+		s.Cumulative = pvoutput.StatusCumulativeGenerating
+
+		return s, nil
+	}
+
+	return s, errors.New("no active production measurements")
+}
+
+// Status polls the Envoy and returns a Status. When ExtendedInverters is
+// set, the last reported power of these microinverters is mapped onto
+// extended data fields v7 to v12, in the given order
+func (c *Client) Status() (pvoutput.Status, error) {
+	if len(c.ExtendedInverters) > MaxExtendedInverters {
+		return pvoutput.NewStatus(), fmt.Errorf("at most %d inverters can be mapped onto extended data", MaxExtendedInverters)
+	}
+
+	p, err := c.Production()
+	if err != nil {
+		return pvoutput.NewStatus(), err
+	}
+
+	s, err := p.Status()
+	if err != nil {
+		return s, err
+	}
+
+	if len(c.ExtendedInverters) == 0 {
+		return s, nil
+	}
+
+	inverters, err := c.Inverters()
+	if err != nil {
+		return s, err
+	}
+
+	bySerial := map[string]Inverter{}
+	for _, inv := range inverters {
+		bySerial[inv.SerialNumber] = inv
+	}
+
+	for i, serial := range c.ExtendedInverters {
+		if inv, ok := bySerial[serial]; ok {
+			s.Extended[i] = float64(inv.LastReportWatts)
+		}
+	}
+
+	return s, nil
+}
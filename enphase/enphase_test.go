@@ -0,0 +1,117 @@
+package enphase
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skoef/pvoutput"
+)
+
+// newTestServer returns a stand-in for an Envoy running given firmware,
+// requiring given token when not empty
+func newTestServer(t *testing.T, firmware, token string) *Client {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case apiProduction:
+			http.ServeFile(w, r, "testdata/"+firmware+"/production.json")
+		case apiInverters:
+			http.ServeFile(w, r, "testdata/"+firmware+"/inverters.json")
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	var srv *httptest.Server
+	if token != "" {
+		srv = httptest.NewTLSServer(handler)
+	} else {
+		srv = httptest.NewServer(handler)
+	}
+	t.Cleanup(srv.Close)
+
+	host := strings.TrimPrefix(strings.TrimPrefix(srv.URL, "https://"), "http://")
+
+	return NewClient(host, token)
+}
+
+func TestStatusLegacyFirmware(t *testing.T) {
+	c := newTestServer(t, "r3", "")
+
+	s, err := c.Status()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1560346262), s.DateTime.Unix())
+	assert.Equal(t, 1873, s.Generating)
+	assert.Equal(t, 15234567, s.Generated)
+	assert.Equal(t, pvoutput.StatusCumulativeGenerating, s.Cumulative)
+	assert.Equal(t, -1, s.Consuming)
+}
+
+func TestStatusWithoutCTs(t *testing.T) {
+	// eim measurements without CTs installed are ignored
+	c := newTestServer(t, "d5", "")
+
+	s, err := c.Status()
+	require.NoError(t, err)
+	assert.Equal(t, 3021, s.Generating)
+	assert.Equal(t, 8123456, s.Generated)
+	assert.Equal(t, pvoutput.StatusCumulativeGenerating, s.Cumulative)
+	assert.Equal(t, -1, s.Consuming)
+	assert.Equal(t, -1.0, s.Voltage)
+}
+
+func TestStatusTokenFirmware(t *testing.T) {
+	c := newTestServer(t, "d7", "secret")
+	c.ExtendedInverters = []string{"202212345602", "unknown", "202212345601"}
+
+	s, err := c.Status()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1672575064), s.DateTime.Unix())
+	assert.Equal(t, 2135, s.Generating)
+	assert.Equal(t, 8250, s.Generated)
+	assert.Equal(t, 812, s.Consuming)
+	assert.Equal(t, 12001, s.Consumed)
+	assert.Equal(t, 241.612, s.Voltage)
+	assert.Equal(t, pvoutput.StatusCumulative(-1), s.Cumulative)
+	assert.Equal(t, [6]float64{91, -1, 88, -1, -1, -1}, s.Extended)
+
+	// wrong token
+	c.Token = "wrong"
+	_, err = c.Status()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unauthorized")
+	}
+
+	// too many inverters for the extended data fields
+	c.Token = "secret"
+	c.ExtendedInverters = make([]string, MaxExtendedInverters+1)
+	_, err = c.Status()
+	assert.Error(t, err)
+}
+
+func TestInverters(t *testing.T) {
+	c := newTestServer(t, "d7", "secret")
+
+	inverters, err := c.Inverters()
+	require.NoError(t, err)
+	if assert.Len(t, inverters, 3) {
+		assert.Equal(t, "202212345601", inverters[0].SerialNumber)
+		assert.Equal(t, 88, inverters[0].LastReportWatts)
+		assert.Equal(t, 297, inverters[0].MaxReportWatts)
+		assert.Equal(t, int64(1672574917), inverters[0].LastReportDate)
+	}
+}
+
+func TestProductionStatusNoMeasurements(t *testing.T) {
+	_, err := Production{}.Status()
+	assert.Error(t, err)
+}
@@ -0,0 +1,165 @@
+// Package export downloads the status history and daily outputs of a system
+// from PVOutput and archives them in local files. Exports are resumable:
+// exporting to an existing file continues after its last row
+package export
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/skoef/pvoutput"
+	"github.com/skoef/pvoutput/internal/record"
+)
+
+var (
+	statusColumns = record.Status(pvoutput.NewStatus()).Names()
+	outputColumns = record.Output(pvoutput.NewOutput()).Names()
+)
+
+// Source downloads statuses and outputs, it is implemented by pvoutput.API
+type Source interface {
+	GetStatusHistory(o pvoutput.StatusHistoryOptions) ([]pvoutput.Status, error)
+	GetOutput(from, to time.Time) ([]pvoutput.Output, error)
+}
+
+// Exporter downloads statuses and outputs and appends them to a file
+type Exporter struct {
+	Source Source
+	Format Format
+	// Progress, when set, is called after every downloaded day of statuses
+	// or page of outputs with the last date downloaded and the number of
+	// rows exported so far
+	Progress func(date time.Time, exported int)
+	now      func() time.Time
+}
+
+// NewExporter returns a new Exporter downloading from given Source and
+// writing files in given Format
+func NewExporter(s Source, f Format) *Exporter {
+	return &Exporter{
+		Source: s,
+		Format: f,
+		now:    time.Now,
+	}
+}
+
+// dates returns the first and last day to export, given the requested range
+// and the last exported row. The last day defaults to and is capped at today
+func (e *Exporter) dates(from, to, last time.Time) (time.Time, time.Time, error) {
+	if from.IsZero() && last.IsZero() {
+		return from, to, errors.New("start date is required for a new export")
+	}
+
+	today := pvoutput.DateOf(e.now())
+	if to.IsZero() || pvoutput.DateOf(to).After(today) {
+		to = today
+	}
+
+	return pvoutput.DateOf(from), pvoutput.DateOf(to), nil
+}
+
+// ExportStatuses downloads the statuses of the days from from to to, both
+// inclusive, and appends them to the file at given path. When the file
+// already holds statuses, the export continues after the last one. A zero
+// from is only allowed then, a zero to exports up to today. The number of
+// exported statuses is returned, also when an error occurs halfway
+func (e *Exporter) ExportStatuses(path string, from, to time.Time) (int, error) {
+	f, err := openFile(path, e.Format, statusColumns)
+	if err != nil {
+		return 0, fmt.Errorf("could not open %s: %s", path, err)
+	}
+	defer f.Close()
+
+	last := f.last()
+	start, end, err := e.dates(from, to, last)
+	if err != nil {
+		return 0, err
+	}
+	if !last.IsZero() && pvoutput.DateOf(last).After(start) {
+		start = pvoutput.DateOf(last)
+	}
+
+	exported := 0
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		statuses, err := pvoutput.StatusesOfDay(e.Source, d, last)
+		if err != nil {
+			return exported, fmt.Errorf("could not download statuses of %s: %s", d.Format("2006-01-02"), err)
+		}
+
+		records := []record.Record{}
+		for _, s := range statuses {
+			records = append(records, record.Status(s))
+		}
+		if err := f.append(records); err != nil {
+			return exported, fmt.Errorf("could not write %s: %s", path, err)
+		}
+
+		exported += len(records)
+		if e.Progress != nil {
+			e.Progress(d, exported)
+		}
+	}
+
+	return exported, nil
+}
+
+// ExportOutputs downloads the outputs of the days from from to to, both
+// inclusive, in pages of pvoutput.OutputPageDays and appends them to the
+// file at given path. When the file already holds outputs, the export
+// continues after the last one. A zero from is only allowed then, a zero to
+// exports up to today. The number of exported outputs is returned, also when
+// an error occurs halfway
+func (e *Exporter) ExportOutputs(path string, from, to time.Time) (int, error) {
+	f, err := openFile(path, e.Format, outputColumns)
+	if err != nil {
+		return 0, fmt.Errorf("could not open %s: %s", path, err)
+	}
+	defer f.Close()
+
+	last := f.last()
+	start, end, err := e.dates(from, to, last)
+	if err != nil {
+		return 0, err
+	}
+	if !last.IsZero() && !start.After(last) {
+		start = pvoutput.DateOf(last).AddDate(0, 0, 1)
+	}
+
+	exported := 0
+	for !start.After(end) {
+		pageEnd := start.AddDate(0, 0, pvoutput.OutputPageDays-1)
+		if pageEnd.After(end) {
+			pageEnd = end
+		}
+
+		outputs, err := e.Source.GetOutput(start, pageEnd)
+		if err != nil && !errors.Is(err, pvoutput.ErrNoData) {
+			return exported, fmt.Errorf("could not download outputs from %s: %s", start.Format("2006-01-02"), err)
+		}
+
+		// PVOutput returns the most recent output first
+		sort.Slice(outputs, func(i, j int) bool { return outputs[i].Date.Before(outputs[j].Date) })
+
+		records := []record.Record{}
+		for _, o := range outputs {
+			if o.Date.Before(start) || o.Date.After(pageEnd) {
+				continue
+			}
+			records = append(records, record.Output(o))
+		}
+		if err := f.append(records); err != nil {
+			return exported, fmt.Errorf("could not write %s: %s", path, err)
+		}
+
+		exported += len(records)
+		if e.Progress != nil {
+			e.Progress(pageEnd, exported)
+		}
+
+		start = pageEnd.AddDate(0, 0, 1)
+	}
+
+	return exported, nil
+}
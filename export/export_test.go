@@ -0,0 +1,216 @@
+package export
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/skoef/pvoutput"
+	"github.com/skoef/pvoutput/internal/pvtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSource serves statuses and outputs like PVOutput does, failing with
+// err after failAfter requests, when set
+type fakeSource struct {
+	statuses  []pvoutput.Status
+	outputs   []pvoutput.Output
+	requests  []string
+	failAfter int
+	err       error
+}
+
+func (s *fakeSource) request(r string) error {
+	if s.failAfter > 0 && len(s.requests) >= s.failAfter {
+		return s.err
+	}
+	s.requests = append(s.requests, r)
+
+	return nil
+}
+
+func (s *fakeSource) GetStatusHistory(o pvoutput.StatusHistoryOptions) ([]pvoutput.Status, error) {
+	if err := s.request("status " + o.Date.Format("2006-01-02") + " " + o.From.Format("15:04")); err != nil {
+		return nil, err
+	}
+
+	page := []pvoutput.Status{}
+	for _, st := range s.statuses {
+		if pvoutput.DateOf(st.DateTime) != o.Date || st.DateTime.Before(o.From) && !o.From.IsZero() {
+			continue
+		}
+		if len(page) == o.Limit {
+			break
+		}
+		page = append(page, st)
+	}
+
+	if len(page) == 0 {
+		return nil, pvoutput.ErrNoData
+	}
+
+	return page, nil
+}
+
+func (s *fakeSource) GetOutput(from, to time.Time) ([]pvoutput.Output, error) {
+	if err := s.request("output " + from.Format("2006-01-02") + " " + to.Format("2006-01-02")); err != nil {
+		return nil, err
+	}
+
+	outputs := []pvoutput.Output{}
+	for i := len(s.outputs) - 1; i >= 0; i-- {
+		if o := s.outputs[i]; !o.Date.Before(from) && !o.Date.After(to) {
+			outputs = append(outputs, o)
+		}
+	}
+
+	return outputs, nil
+}
+
+func tempPath(t *testing.T, name string) string {
+	dir, err := ioutil.TempDir("", "export")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	return filepath.Join(dir, name)
+}
+
+func newTestExporter(s Source, f Format, now time.Time) *Exporter {
+	e := NewExporter(s, f)
+	e.now = func() time.Time { return now }
+
+	return e
+}
+
+func TestExportStatuses(t *testing.T) {
+	day1 := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	source := &fakeSource{
+		// a full day of statuses every minute needs multiple pages
+		statuses: append(pvtest.Statuses(day1, time.Minute, 1440), pvtest.Statuses(day1.AddDate(0, 0, 2).Add(12*time.Hour), 5*time.Minute, 3)...),
+	}
+	path := tempPath(t, "statuses.csv")
+
+	progress := []int{}
+	e := newTestExporter(source, FormatCSV, day1.AddDate(0, 0, 10))
+	e.Progress = func(d time.Time, n int) { progress = append(progress, n) }
+
+	n, err := e.ExportStatuses(path, day1, day1.AddDate(0, 0, 2))
+	require.NoError(t, err)
+	assert.Equal(t, 1443, n)
+	assert.Equal(t, []int{1440, 1440, 1443}, progress)
+	assert.Equal(t, []string{
+		"status 2026-03-01 00:00",
+		"status 2026-03-01 04:48",
+		"status 2026-03-01 09:36",
+		"status 2026-03-01 14:24",
+		"status 2026-03-01 19:12",
+		"status 2026-03-02 00:00",
+		"status 2026-03-03 00:00",
+	}, source.requests)
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	lines := splitLines(string(data))
+	require.Len(t, lines, 1444)
+	assert.Equal(t, "date,time,generated_wh,generating_w,consumed_wh,consuming_w,normalised_output_kw_per_kw,temperature_c,voltage_v", lines[0])
+	assert.Equal(t, "2026-03-01,00:00,0,100,,,,,", lines[1])
+	assert.Equal(t, "2026-03-03,12:10,20,102,,,,,", lines[1443])
+}
+
+func TestExportStatusesResume(t *testing.T) {
+	day1 := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	source := &fakeSource{statuses: pvtest.Statuses(day1.Add(10*time.Hour), 5*time.Minute, 10)}
+
+	for _, format := range []Format{FormatCSV, FormatJSONLines} {
+		t.Run(string(format), func(t *testing.T) {
+			source.requests = nil
+			path := tempPath(t, "statuses")
+
+			// the first export only sees the first statuses
+			full := source.statuses
+			source.statuses = full[:4]
+			e := newTestExporter(source, format, day1.Add(10*time.Hour+20*time.Minute))
+			n, err := e.ExportStatuses(path, day1, time.Time{})
+			require.NoError(t, err)
+			assert.Equal(t, 4, n)
+
+			// the second export continues after the last one, from the day
+			// of the last status
+			source.statuses = full
+			source.requests = nil
+			e.now = func() time.Time { return day1.AddDate(0, 0, 1).Add(time.Hour) }
+			n, err = e.ExportStatuses(path, time.Time{}, time.Time{})
+			require.NoError(t, err)
+			assert.Equal(t, 6, n)
+			assert.Equal(t, []string{"status 2026-03-01 10:16", "status 2026-03-02 00:00"}, source.requests)
+
+			f, err := openFile(path, format, statusColumns)
+			require.NoError(t, err)
+			defer f.Close()
+			assert.Equal(t, full[9].DateTime, f.last())
+		})
+	}
+}
+
+func TestExportStatusesErrors(t *testing.T) {
+	day1 := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	now := day1.AddDate(0, 0, 5)
+
+	// a new export requires a start date
+	e := newTestExporter(&fakeSource{}, FormatCSV, now)
+	_, err := e.ExportStatuses(tempPath(t, "statuses.csv"), time.Time{}, time.Time{})
+	assert.EqualError(t, err, "start date is required for a new export")
+
+	// unsupported format
+	e = newTestExporter(&fakeSource{}, Format("parquet"), now)
+	_, err = e.ExportStatuses(tempPath(t, "statuses.parquet"), day1, time.Time{})
+	assert.Contains(t, err.Error(), "unsupported format parquet")
+
+	// a failing download stops the export, keeping the days before it
+	source := &fakeSource{
+		statuses:  pvtest.Statuses(day1.Add(12*time.Hour), 24*time.Hour, 3),
+		failAfter: 2,
+		err:       errors.New("Unauthorized 401: Invalid API Key"),
+	}
+	path := tempPath(t, "statuses.csv")
+	e = newTestExporter(source, FormatCSV, now)
+	n, err := e.ExportStatuses(path, day1, time.Time{})
+	assert.EqualError(t, err, "could not download statuses of 2026-03-03: Unauthorized 401: Invalid API Key")
+	assert.Equal(t, 2, n)
+
+	f, err := openFile(path, FormatCSV, statusColumns)
+	require.NoError(t, err)
+	defer f.Close()
+	assert.Equal(t, day1.AddDate(0, 0, 1).Add(12*time.Hour), f.last())
+}
+
+func TestExportOutputs(t *testing.T) {
+	day1 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := &fakeSource{outputs: pvtest.Outputs(day1, 45)}
+	path := tempPath(t, "outputs.jsonl")
+
+	e := newTestExporter(source, FormatJSONLines, day1.AddDate(0, 0, 40).Add(time.Hour))
+	n, err := e.ExportOutputs(path, day1, time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, 41, n)
+	assert.Equal(t, []string{"output 2026-01-01 2026-01-30", "output 2026-01-31 2026-02-10"}, source.requests)
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	lines := splitLines(string(data))
+	require.Len(t, lines, 41)
+	assert.Equal(t, `{"date":"2026-01-01","generated_wh":1000}`, lines[0])
+	assert.Equal(t, `{"date":"2026-02-10","generated_wh":1040}`, lines[40])
+
+	// resuming only downloads the days after the last output
+	source.requests = nil
+	e.now = func() time.Time { return day1.AddDate(0, 0, 50) }
+	n, err = e.ExportOutputs(path, day1, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, []string{"output 2026-02-11 2026-02-20"}, source.requests)
+}
@@ -0,0 +1,253 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/skoef/pvoutput/internal/record"
+)
+
+// Format is the file format of an export
+type Format string
+
+const (
+	// FormatCSV writes a header row followed by a row per status or output,
+	// leaving unset values empty
+	FormatCSV Format = "csv"
+	// FormatJSONLines writes a JSON object per status or output per line,
+	// leaving out unset values
+	FormatJSONLines Format = "jsonl"
+)
+
+// file is an export file new rows are appended to
+type file interface {
+	// last returns the date and time of the last row in the file, zero when
+	// it has no rows
+	last() time.Time
+	// append writes given records to the file
+	append(records []record.Record) error
+	Close() error
+}
+
+// openFile opens or creates the export file at given path
+func openFile(path string, format Format, columns []string) (file, error) {
+	switch format {
+	case FormatCSV:
+		return openCSVFile(path, columns)
+	case FormatJSONLines:
+		return openJSONLinesFile(path, columns)
+	}
+
+	return nil, fmt.Errorf("unsupported format %s", format)
+}
+
+// parseKey parses the date and, for statuses, time of a row as written
+func parseKey(date, clock string) (time.Time, error) {
+	if clock == "" {
+		return time.Parse("2006-01-02", date)
+	}
+
+	return time.Parse("2006-01-02 15:04", date+" "+clock)
+}
+
+// readLines opens given file for appending and returns its complete lines.
+// An incomplete last line, left by an interrupted export, is removed
+func readLines(path string) (*os.File, []string, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	complete := bytes.LastIndexByte(data, '\n') + 1
+	if complete < len(data) {
+		if err := f.Truncate(int64(complete)); err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		data = data[:complete]
+	}
+
+	if _, err := f.Seek(int64(complete), io.SeekStart); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	lines := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) != "" {
+			lines = append(lines, scanner.Text())
+		}
+	}
+
+	return f, lines, scanner.Err()
+}
+
+// csvFile appends rows to a CSV file
+type csvFile struct {
+	*os.File
+	columns []string
+	lastKey time.Time
+	header  bool
+}
+
+func openCSVFile(path string, columns []string) (*csvFile, error) {
+	f, lines, err := readLines(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &csvFile{File: f, columns: columns}
+	if len(lines) == 0 {
+		return c, nil
+	}
+	c.header = true
+
+	header, err := csv.NewReader(strings.NewReader(lines[0])).Read()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("could not read header: %s", err)
+	}
+	if strings.Join(header, ",") != strings.Join(columns, ",") {
+		f.Close()
+		return nil, errors.New("header doesn't match the exported columns")
+	}
+
+	if len(lines) > 1 {
+		values, err := csv.NewReader(strings.NewReader(lines[len(lines)-1])).Read()
+		if err != nil || len(values) != len(columns) {
+			f.Close()
+			return nil, errors.New("could not read last row")
+		}
+
+		if c.lastKey, err = keyOf(columns, func(i int) string { return values[i] }); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("could not read last row: %s", err)
+		}
+	}
+
+	return c, nil
+}
+
+func (c *csvFile) last() time.Time {
+	return c.lastKey
+}
+
+func (c *csvFile) append(records []record.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	buf := bytes.Buffer{}
+	w := csv.NewWriter(&buf)
+	if !c.header {
+		w.Write(c.columns)
+	}
+	for _, r := range records {
+		values := []string{}
+		for _, f := range r {
+			values = append(values, f.Text())
+		}
+		w.Write(values)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	// write all records at once, so an interruption leaves at most one
+	// incomplete line
+	if _, err := c.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	c.header = true
+
+	return nil
+}
+
+// jsonLinesFile appends rows to a JSON Lines file
+type jsonLinesFile struct {
+	*os.File
+	lastKey time.Time
+}
+
+func openJSONLinesFile(path string, columns []string) (*jsonLinesFile, error) {
+	f, lines, err := readLines(path)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &jsonLinesFile{File: f}
+	if len(lines) == 0 {
+		return j, nil
+	}
+
+	values := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &values); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("could not read last row: %s", err)
+	}
+
+	j.lastKey, err = keyOf(columns, func(i int) string {
+		s, _ := values[columns[i]].(string)
+		return s
+	})
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("could not read last row: %s", err)
+	}
+
+	return j, nil
+}
+
+func (j *jsonLinesFile) last() time.Time {
+	return j.lastKey
+}
+
+func (j *jsonLinesFile) append(records []record.Record) error {
+	buf := bytes.Buffer{}
+	for _, r := range records {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	_, err := j.Write(buf.Bytes())
+
+	return err
+}
+
+// keyOf returns the date and time of a row, using value to get the value of
+// the column at given index
+func keyOf(columns []string, value func(i int) string) (time.Time, error) {
+	var date, clock string
+	for i, name := range columns {
+		switch name {
+		case "date":
+			date = value(i)
+		case "time":
+			clock = value(i)
+		}
+	}
+
+	return parseKey(date, clock)
+}
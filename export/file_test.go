@@ -0,0 +1,94 @@
+package export
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skoef/pvoutput"
+	"github.com/skoef/pvoutput/internal/record"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// splitLines returns the non-empty lines of given text
+func splitLines(s string) []string {
+	lines := []string{}
+	for _, l := range strings.Split(s, "\n") {
+		if l != "" {
+			lines = append(lines, l)
+		}
+	}
+
+	return lines
+}
+
+// testStatus returns the record of a status at given time of 2026-03-01
+func testStatus(hour, min int, set func(s *pvoutput.Status)) record.Record {
+	s := pvoutput.NewStatus()
+	s.DateTime = time.Date(2026, 3, 1, hour, min, 0, 0, time.UTC)
+	set(&s)
+
+	return record.Status(s)
+}
+
+var testRecords = []record.Record{
+	testStatus(10, 0, func(s *pvoutput.Status) {
+		s.Generated, s.Generating, s.Output, s.Temperature = 0, 100, 0.5, 12.5
+	}),
+	testStatus(10, 5, func(s *pvoutput.Status) {
+		s.Generated, s.Voltage = 10, 230.1
+	}),
+}
+
+func TestCSVFile(t *testing.T) {
+	path := tempPath(t, "statuses.csv")
+
+	f, err := openFile(path, FormatCSV, statusColumns)
+	require.NoError(t, err)
+	assert.True(t, f.last().IsZero())
+	require.NoError(t, f.append(testRecords))
+	require.NoError(t, f.Close())
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "date,time,generated_wh,generating_w,consumed_wh,consuming_w,normalised_output_kw_per_kw,temperature_c,voltage_v\n"+
+		"2026-03-01,10:00,0,100,,,0.5,12.5,\n"+
+		"2026-03-01,10:05,10,,,,,,230.1\n", string(data))
+
+	// an incomplete line is removed when reopening
+	require.NoError(t, ioutil.WriteFile(path, append(data, "2026-03-01,10:1"...), 0644))
+	f, err = openFile(path, FormatCSV, statusColumns)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 3, 1, 10, 5, 0, 0, time.UTC), f.last())
+	require.NoError(t, f.append([]record.Record{testStatus(10, 10, func(s *pvoutput.Status) { s.Generated = 20 })}))
+	require.NoError(t, f.Close())
+
+	data, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(data), "230.1\n2026-03-01,10:10,20,,,,,,\n"))
+
+	// a file of other columns is not appended to
+	_, err = openFile(path, FormatCSV, outputColumns)
+	assert.EqualError(t, err, "header doesn't match the exported columns")
+}
+
+func TestJSONLinesFile(t *testing.T) {
+	path := tempPath(t, "statuses.jsonl")
+
+	f, err := openFile(path, FormatJSONLines, statusColumns)
+	require.NoError(t, err)
+	require.NoError(t, f.append(testRecords))
+	require.NoError(t, f.Close())
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `{"date":"2026-03-01","time":"10:00","generated_wh":0,"generating_w":100,"normalised_output_kw_per_kw":0.5,"temperature_c":12.5}`+"\n"+
+		`{"date":"2026-03-01","time":"10:05","generated_wh":10,"voltage_v":230.1}`+"\n", string(data))
+
+	f, err = openFile(path, FormatJSONLines, statusColumns)
+	require.NoError(t, err)
+	defer f.Close()
+	assert.Equal(t, time.Date(2026, 3, 1, 10, 5, 0, 0, time.UTC), f.last())
+}
@@ -0,0 +1,259 @@
+// Package fronius reads Fronius inverters through their local Solar API v1
+// and maps their readings onto PVOutput's data structures
+package fronius
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/skoef/pvoutput"
+)
+
+const (
+	apiInverterRealtimeData  = "/solar_api/v1/GetInverterRealtimeData.cgi"
+	apiPowerFlowRealtimeData = "/solar_api/v1/GetPowerFlowRealtimeData.fcgi"
+	// DefaultTimeout is the default timeout for requests to the inverter
+	DefaultTimeout = 10 * time.Second
+)
+
+// Client polls a Fronius inverter or Datamanager
+type Client struct {
+	BaseURL  string
+	DeviceID int
+	client   *http.Client
+}
+
+// NewClient returns a new Client for the inverter on given host
+func NewClient(host string) *Client {
+	return &Client{
+		BaseURL:  fmt.Sprintf("http://%s", host),
+		DeviceID: 1,
+		client:   &http.Client{Timeout: DefaultTimeout},
+	}
+}
+
+// value is a reading with its unit, as used by the Solar API
+type value struct {
+	Unit  string   `json:"Unit"`
+	Value *float64 `json:"Value"`
+}
+
+// head is the header of every Solar API response
+type head struct {
+	Status struct {
+		Code   int    `json:"Code"`
+		Reason string `json:"Reason"`
+	} `json:"Status"`
+	Timestamp string `json:"Timestamp"`
+}
+
+// InverterData holds the CommonInverterData of an inverter. Values the
+// inverter doesn't report, e.g. power values at night, are NaN
+type InverterData struct {
+	Timestamp   time.Time
+	Power       float64 // AC watts
+	ACVoltage   float64 // volts
+	DCVoltage   float64 // volts
+	DayEnergy   float64 // watt hours
+	YearEnergy  float64 // watt hours
+	TotalEnergy float64 // watt hours
+}
+
+// PowerFlow holds the power flow of the site. Values that are not available,
+// e.g. grid and load when no Smart Meter is installed, are NaN
+type PowerFlow struct {
+	Timestamp   time.Time
+	Mode        string
+	PV          float64 // watts generated
+	Grid        float64 // watts, positive when importing from the grid
+	Load        float64 // watts consumed
+	DayEnergy   float64 // watt hours generated
+	TotalEnergy float64 // watt hours generated
+}
+
+// get requests given path and decodes its response into v
+func (c *Client) get(path string, params url.Values, v interface{}) error {
+	u := strings.TrimRight(c.BaseURL, "/") + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+
+	resp, err := c.client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// checkHead returns an error if the response header reports an error and
+// parses its timestamp otherwise
+func checkHead(h head) (time.Time, error) {
+	if h.Status.Code != 0 {
+		return time.Time{}, fmt.Errorf("solar api error %d: %s", h.Status.Code, h.Status.Reason)
+	}
+
+	return time.Parse(time.RFC3339, h.Timestamp)
+}
+
+// floatOrNaN returns the value of given pointer or NaN when nil
+func floatOrNaN(f *float64) float64 {
+	if f == nil {
+		return math.NaN()
+	}
+
+	return *f
+}
+
+// InverterRealtimeData implements the GetInverterRealtimeData request for
+// the CommonInverterData of the Client's DeviceID
+func (c *Client) InverterRealtimeData() (InverterData, error) {
+	var resp struct {
+		Body struct {
+			Data map[string]value `json:"Data"`
+		} `json:"Body"`
+		Head head `json:"Head"`
+	}
+
+	params := url.Values{}
+	params.Set("Scope", "Device")
+	params.Set("DeviceId", fmt.Sprintf("%d", c.DeviceID))
+	params.Set("DataCollection", "CommonInverterData")
+
+	if err := c.get(apiInverterRealtimeData, params, &resp); err != nil {
+		return InverterData{}, err
+	}
+
+	ts, err := checkHead(resp.Head)
+	if err != nil {
+		return InverterData{}, err
+	}
+
+	get := func(key string) float64 {
+		return floatOrNaN(resp.Body.Data[key].Value)
+	}
+
+	return InverterData{
+		Timestamp:   ts,
+		Power:       get("PAC"),
+		ACVoltage:   get("UAC"),
+		DCVoltage:   get("UDC"),
+		DayEnergy:   get("DAY_ENERGY"),
+		YearEnergy:  get("YEAR_ENERGY"),
+		TotalEnergy: get("TOTAL_ENERGY"),
+	}, nil
+}
+
+// PowerFlowRealtimeData implements the GetPowerFlowRealtimeData request
+func (c *Client) PowerFlowRealtimeData() (PowerFlow, error) {
+	var resp struct {
+		Body struct {
+			Data struct {
+				Site struct {
+					Mode   string   `json:"Mode"`
+					PV     *float64 `json:"P_PV"`
+					Grid   *float64 `json:"P_Grid"`
+					Load   *float64 `json:"P_Load"`
+					EDay   *float64 `json:"E_Day"`
+					ETotal *float64 `json:"E_Total"`
+				} `json:"Site"`
+			} `json:"Data"`
+		} `json:"Body"`
+		Head head `json:"Head"`
+	}
+
+	if err := c.get(apiPowerFlowRealtimeData, nil, &resp); err != nil {
+		return PowerFlow{}, err
+	}
+
+	ts, err := checkHead(resp.Head)
+	if err != nil {
+		return PowerFlow{}, err
+	}
+
+	site := resp.Body.Data.Site
+
+	// the Solar API reports load as negative value when consuming
+	load := floatOrNaN(site.Load)
+	if !math.IsNaN(load) {
+		load = -load
+	}
+
+	return PowerFlow{
+		Timestamp:   ts,
+		Mode:        site.Mode,
+		PV:          floatOrNaN(site.PV),
+		Grid:        floatOrNaN(site.Grid),
+		Load:        load,
+		DayEnergy:   floatOrNaN(site.EDay),
+		TotalEnergy: floatOrNaN(site.ETotal),
+	}, nil
+}
+
+// Status polls both the inverter and the power flow and returns a Status.
+// Generated is the energy generated today. Consumption is only set when a
+// Smart Meter is installed. The Solar API doesn't report the inverter's
+// temperature, so Temperature is never set
+func (c *Client) Status() (pvoutput.Status, error) {
+	s := pvoutput.NewStatus()
+
+	inv, err := c.InverterRealtimeData()
+	if err != nil {
+		return s, err
+	}
+
+	flow, err := c.PowerFlowRealtimeData()
+	if err != nil {
+		return s, err
+	}
+
+	s.DateTime = inv.Timestamp
+	if !math.IsNaN(inv.DayEnergy) {
+		s.Generated = int(math.Round(inv.DayEnergy))
+	}
+
+	// the inverter doesn't report power at night
+	s.Generating = 0
+	if !math.IsNaN(inv.Power) {
+		s.Generating = int(math.Round(inv.Power))
+	}
+
+	if !math.IsNaN(inv.ACVoltage) {
+		s.Voltage = inv.ACVoltage
+	}
+
+	if !math.IsNaN(flow.Load) {
+		s.Consuming = int(math.Round(math.Max(0, flow.Load)))
+	}
+
+	return s, nil
+}
+
+// Output polls the inverter and returns an Output for today with the energy
+// generated so far
+func (c *Client) Output() (pvoutput.Output, error) {
+	o := pvoutput.NewOutput()
+
+	inv, err := c.InverterRealtimeData()
+	if err != nil {
+		return o, err
+	}
+
+	y, m, d := inv.Timestamp.Date()
+	o.Date = time.Date(y, m, d, 0, 0, 0, 0, inv.Timestamp.Location())
+	if !math.IsNaN(inv.DayEnergy) {
+		o.Generated = int(math.Round(inv.DayEnergy))
+	}
+
+	return o, nil
+}
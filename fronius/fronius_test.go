@@ -0,0 +1,130 @@
+package fronius
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer returns a stand-in for the Solar API, serving given fixtures
+// for the inverter and power flow requests
+func newTestServer(t *testing.T, inverter, powerflow string) (*Client, *[]*http.Request) {
+	requests := []*http.Request{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		switch r.URL.Path {
+		case apiInverterRealtimeData:
+			http.ServeFile(w, r, "testdata/"+inverter)
+		case apiPowerFlowRealtimeData:
+			http.ServeFile(w, r, "testdata/"+powerflow)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	c := NewClient(strings.TrimPrefix(srv.URL, "http://"))
+
+	return c, &requests
+}
+
+func TestInverterRealtimeData(t *testing.T) {
+	c, requests := newTestServer(t, "inverter_day.json", "powerflow.json")
+	c.DeviceID = 2
+
+	inv, err := c.InverterRealtimeData()
+	require.NoError(t, err)
+
+	assert.Equal(t, "Device", (*requests)[0].URL.Query().Get("Scope"))
+	assert.Equal(t, "2", (*requests)[0].URL.Query().Get("DeviceId"))
+	assert.Equal(t, "CommonInverterData", (*requests)[0].URL.Query().Get("DataCollection"))
+
+	ts, _ := time.Parse(time.RFC3339, "2019-06-12T15:31:02+02:00")
+	assert.True(t, ts.Equal(inv.Timestamp))
+	assert.Equal(t, 1532.0, inv.Power)
+	assert.InDelta(t, 231.4, inv.ACVoltage, 0.001)
+	assert.InDelta(t, 387.6, inv.DCVoltage, 0.001)
+	assert.InDelta(t, 8127.3, inv.DayEnergy, 0.001)
+	assert.Equal(t, 2345678.0, inv.YearEnergy)
+	assert.Equal(t, 12345678.0, inv.TotalEnergy)
+
+	// no power values at night
+	c, _ = newTestServer(t, "inverter_night.json", "powerflow.json")
+	inv, err = c.InverterRealtimeData()
+	require.NoError(t, err)
+	assert.True(t, math.IsNaN(inv.Power))
+	assert.Equal(t, 21034.0, inv.DayEnergy)
+
+	// errors reported by the Solar API
+	c, _ = newTestServer(t, "inverter_error.json", "powerflow.json")
+	_, err = c.InverterRealtimeData()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Transfer timeout")
+	}
+}
+
+func TestPowerFlowRealtimeData(t *testing.T) {
+	c, _ := newTestServer(t, "inverter_day.json", "powerflow.json")
+
+	flow, err := c.PowerFlowRealtimeData()
+	require.NoError(t, err)
+	assert.Equal(t, "meter", flow.Mode)
+	assert.Equal(t, 1532.0, flow.PV)
+	assert.InDelta(t, -732.1, flow.Grid, 0.001)
+	assert.InDelta(t, 799.9, flow.Load, 0.001)
+
+	c, _ = newTestServer(t, "inverter_day.json", "powerflow_nometer.json")
+	flow, err = c.PowerFlowRealtimeData()
+	require.NoError(t, err)
+	assert.True(t, math.IsNaN(flow.Grid))
+	assert.True(t, math.IsNaN(flow.Load))
+}
+
+func TestStatus(t *testing.T) {
+	c, _ := newTestServer(t, "inverter_day.json", "powerflow.json")
+
+	s, err := c.Status()
+	require.NoError(t, err)
+
+	ts, _ := time.Parse(time.RFC3339, "2019-06-12T15:31:02+02:00")
+	assert.True(t, ts.Equal(s.DateTime))
+	assert.Equal(t, 8127, s.Generated)
+	assert.Equal(t, 1532, s.Generating)
+	assert.Equal(t, 800, s.Consuming)
+	assert.InDelta(t, 231.4, s.Voltage, 0.001)
+	assert.Equal(t, -1.0, s.Temperature)
+
+	// without Smart Meter and at night
+	c, _ = newTestServer(t, "inverter_night.json", "powerflow_nometer.json")
+	s, err = c.Status()
+	require.NoError(t, err)
+	assert.Equal(t, 21034, s.Generated)
+	assert.Equal(t, 0, s.Generating)
+	assert.Equal(t, -1, s.Consuming)
+	assert.Equal(t, -1.0, s.Voltage)
+
+	// unreachable inverter
+	c, _ = newTestServer(t, "missing.json", "powerflow.json")
+	_, err = c.Status()
+	assert.Error(t, err)
+}
+
+func TestOutput(t *testing.T) {
+	c, _ := newTestServer(t, "inverter_night.json", "powerflow.json")
+
+	o, err := c.Output()
+	require.NoError(t, err)
+	assert.Equal(t, "20190612", o.Date.Format("20060102"))
+	assert.Equal(t, 21034, o.Generated)
+
+	enc, err := o.Encode()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "d=20190612&g=21034", enc)
+	}
+}
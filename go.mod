@@ -2,4 +2,7 @@ module github.com/skoef/pvoutput
 
 go 1.14
 
-require github.com/stretchr/testify v1.7.0
+require (
+	github.com/stretchr/testify v1.7.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,210 @@
+package history
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/skoef/pvoutput"
+)
+
+// DifferenceKind tells how a recorded status or output differs from
+// PVOutput's
+type DifferenceKind string
+
+// Kinds of differences
+const (
+	// MissingRemotely is a status or output that was recorded, but that
+	// PVOutput doesn't have
+	MissingRemotely DifferenceKind = "missing remotely"
+	// MissingLocally is a status or output PVOutput has, but that wasn't
+	// recorded
+	MissingLocally DifferenceKind = "missing locally"
+	// Mismatch is a field with a different value on PVOutput than recorded,
+	// or one that PVOutput doesn't have
+	Mismatch DifferenceKind = "mismatch"
+)
+
+// Difference is a difference between a recorded status or output and
+// PVOutput's
+type Difference struct {
+	Kind DifferenceKind
+	// Time is the date and time of the status, or the date of the output
+	Time time.Time
+	// Field is the field that differs, named like in the JSON representation
+	// of statuses and outputs, only set on mismatches
+	Field string
+	// Local and Remote are the recorded and PVOutput's value of the field,
+	// nil when unset
+	Local  interface{}
+	Remote interface{}
+}
+
+// EqualFunc tells if the recorded and PVOutput's value of given field are
+// equal. Values are float64, string or nil when unset, as they are decoded
+// from the JSON representation of statuses and outputs
+type EqualFunc func(field string, local, remote interface{}) bool
+
+// exactly is the EqualFunc of values that are exactly equal
+func exactly(field string, local, remote interface{}) bool {
+	return local == remote
+}
+
+var (
+	// unreportedStatusFields are not returned by GetStatus and
+	// GetStatusHistory, so they can't be compared
+	unreportedStatusFields = []string{"date_time", "cumulative", "v7", "v8", "v9", "v10", "v11", "v12"}
+	// unreportedOutputFields are not returned by GetOutput
+	unreportedOutputFields = []string{"date", "comments"}
+)
+
+// fieldsOf returns the set fields of given status or output by the keys of
+// its JSON representation, leaving out given fields
+func fieldsOf(v json.Marshaler, skip []string) (map[string]interface{}, error) {
+	data, err := v.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for _, k := range skip {
+		delete(fields, k)
+	}
+
+	return fields, nil
+}
+
+// diffFields returns the mismatches between the fields of a recorded and
+// PVOutput's status or output at given time. Only recorded fields are
+// compared, since PVOutput derives fields that weren't uploaded
+func diffFields(t time.Time, local, remote map[string]interface{}, equal EqualFunc) []Difference {
+	keys := []string{}
+	for k := range local {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	diffs := []Difference{}
+	for _, k := range keys {
+		if !equal(k, local[k], remote[k]) {
+			diffs = append(diffs, Difference{Kind: Mismatch, Time: t, Field: k, Local: local[k], Remote: remote[k]})
+		}
+	}
+
+	return diffs
+}
+
+// statusSkip returns the fields of given status that can't be compared.
+// Lifetime energy values are converted to energy of the day by PVOutput
+func statusSkip(s pvoutput.Status) []string {
+	switch s.Cumulative {
+	case pvoutput.StatusCumulativeAll:
+		return append(unreportedStatusFields, "generated_wh", "consumed_wh")
+	case pvoutput.StatusCumulativeGenerating:
+		return append(unreportedStatusFields, "generated_wh")
+	case pvoutput.StatusCumulativeConsuming:
+		return append(unreportedStatusFields, "consumed_wh")
+	}
+
+	return unreportedStatusFields
+}
+
+// DiffStatuses compares recorded statuses with the statuses returned by
+// GetStatus or GetStatusHistory, matching them by the wall clock of their
+// DateTime. Differences are returned in order of time
+func DiffStatuses(local []StatusRecord, remote []pvoutput.Status) ([]Difference, error) {
+	return DiffStatusesFunc(local, remote, exactly)
+}
+
+// DiffStatusesFunc is DiffStatuses comparing fields with given EqualFunc
+func DiffStatusesFunc(local []StatusRecord, remote []pvoutput.Status, equal EqualFunc) ([]Difference, error) {
+	remoteByKey := map[string]pvoutput.Status{}
+	for _, s := range remote {
+		remoteByKey[statusKey(s.DateTime)] = s
+	}
+
+	diffs := []Difference{}
+	seen := map[string]bool{}
+	for _, r := range local {
+		key := statusKey(r.Status.DateTime)
+		seen[key] = true
+
+		rs, ok := remoteByKey[key]
+		if !ok {
+			diffs = append(diffs, Difference{Kind: MissingRemotely, Time: r.Status.DateTime})
+			continue
+		}
+
+		skip := statusSkip(r.Status)
+		localFields, err := fieldsOf(r.Status, skip)
+		if err != nil {
+			return nil, err
+		}
+		remoteFields, err := fieldsOf(rs, skip)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, diffFields(r.Status.DateTime, localFields, remoteFields, equal)...)
+	}
+
+	for _, s := range remote {
+		if !seen[statusKey(s.DateTime)] {
+			diffs = append(diffs, Difference{Kind: MissingLocally, Time: s.DateTime})
+		}
+	}
+
+	sort.SliceStable(diffs, func(i, j int) bool { return statusKey(diffs[i].Time) < statusKey(diffs[j].Time) })
+
+	return diffs, nil
+}
+
+// DiffOutputs compares recorded outputs with the outputs returned by
+// GetOutput, matching them by date. Differences are returned in order of
+// date
+func DiffOutputs(local []OutputRecord, remote []pvoutput.Output) ([]Difference, error) {
+	return DiffOutputsFunc(local, remote, exactly)
+}
+
+// DiffOutputsFunc is DiffOutputs comparing fields with given EqualFunc
+func DiffOutputsFunc(local []OutputRecord, remote []pvoutput.Output, equal EqualFunc) ([]Difference, error) {
+	remoteByKey := map[string]pvoutput.Output{}
+	for _, o := range remote {
+		remoteByKey[outputKey(o.Date)] = o
+	}
+
+	diffs := []Difference{}
+	seen := map[string]bool{}
+	for _, r := range local {
+		key := outputKey(r.Output.Date)
+		seen[key] = true
+
+		ro, ok := remoteByKey[key]
+		if !ok {
+			diffs = append(diffs, Difference{Kind: MissingRemotely, Time: r.Output.Date})
+			continue
+		}
+
+		localFields, err := fieldsOf(r.Output, unreportedOutputFields)
+		if err != nil {
+			return nil, err
+		}
+		remoteFields, err := fieldsOf(ro, unreportedOutputFields)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, diffFields(r.Output.Date, localFields, remoteFields, equal)...)
+	}
+
+	for _, o := range remote {
+		if !seen[outputKey(o.Date)] {
+			diffs = append(diffs, Difference{Kind: MissingLocally, Time: o.Date})
+		}
+	}
+
+	sort.SliceStable(diffs, func(i, j int) bool { return outputKey(diffs[i].Time) < outputKey(diffs[j].Time) })
+
+	return diffs, nil
+}
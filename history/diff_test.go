@@ -0,0 +1,104 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skoef/pvoutput"
+	"github.com/skoef/pvoutput/internal/pvtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffStatuses(t *testing.T) {
+	// recorded in local time, returned by PVOutput as naive UTC
+	loc := time.FixedZone("CET", 3600)
+	at := func(l *time.Location, hour, min int) time.Time {
+		return time.Date(2026, 3, 1, hour, min, 0, 0, l)
+	}
+
+	lifetime := pvtest.StatusAt(at(loc, 12, 10), 1700)
+	lifetime.Generated = 5000000
+	lifetime.Cumulative = pvoutput.StatusCumulativeGenerating
+	lifetime.Extended[0] = 3.3
+
+	local := []StatusRecord{
+		{Status: pvtest.StatusAt(at(loc, 12, 0), 1500)},
+		{Status: pvtest.StatusAt(at(loc, 12, 5), 1600)},
+		{Status: lifetime},
+		{Status: pvtest.StatusAt(at(loc, 12, 15), 1800)},
+	}
+	local[1].Status.Temperature = 12.5
+
+	remote := []pvoutput.Status{
+		pvtest.StatusAt(at(time.UTC, 11, 55), 1400),
+		pvtest.StatusAt(at(time.UTC, 12, 0), 1500),
+		pvtest.StatusAt(at(time.UTC, 12, 5), 1650),
+		pvtest.StatusAt(at(time.UTC, 12, 10), 1700),
+	}
+	// derived by PVOutput
+	remote[1].Generated = 125
+	remote[3].Generated = 260
+
+	diffs, err := DiffStatuses(local, remote)
+	require.NoError(t, err)
+	assert.Equal(t, []Difference{
+		{Kind: MissingLocally, Time: at(time.UTC, 11, 55)},
+		{Kind: Mismatch, Time: at(loc, 12, 5), Field: "generating_w", Local: 1600.0, Remote: 1650.0},
+		{Kind: Mismatch, Time: at(loc, 12, 5), Field: "temperature_c", Local: 12.5, Remote: nil},
+		{Kind: MissingRemotely, Time: at(loc, 12, 15)},
+	}, diffs)
+
+	diffs, err = DiffStatuses(local[:1], remote[1:2])
+	require.NoError(t, err)
+	assert.Empty(t, diffs)
+}
+
+func TestDiffOutputs(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 0, 0, 0, 0, time.UTC) }
+
+	commented := pvtest.OutputOn(day(1), 14000)
+	commented.Comments = "new panels"
+	commented.Condition = "Fine"
+
+	local := []OutputRecord{
+		{Output: commented},
+		{Output: pvtest.OutputOn(day(2), 12000)},
+		{Output: pvtest.OutputOn(day(4), 9000)},
+	}
+
+	remote := []pvoutput.Output{
+		pvtest.OutputOn(day(1), 14000),
+		pvtest.OutputOn(day(2), 11000),
+		pvtest.OutputOn(day(3), 10000),
+	}
+	remote[0].Condition = "Fine"
+	remote[0].Efficiency = 3.5
+
+	diffs, err := DiffOutputs(local, remote)
+	require.NoError(t, err)
+	assert.Equal(t, []Difference{
+		{Kind: Mismatch, Time: day(2), Field: "generated_wh", Local: 12000.0, Remote: 11000.0},
+		{Kind: MissingLocally, Time: day(3)},
+		{Kind: MissingRemotely, Time: day(4)},
+	}, diffs)
+}
+
+func TestDiffOutputsFunc(t *testing.T) {
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	local := pvtest.OutputOn(day, 12000)
+	local.Condition = "Fine"
+	remote := pvtest.OutputOn(day, 11990)
+	remote.Condition = "Cloudy"
+
+	fields := []string{}
+	diffs, err := DiffOutputsFunc([]OutputRecord{{Output: local}}, []pvoutput.Output{remote}, func(field string, l, r interface{}) bool {
+		fields = append(fields, field)
+		return field == "generated_wh"
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"condition", "generated_wh"}, fields)
+	assert.Equal(t, []Difference{
+		{Kind: Mismatch, Time: day, Field: "condition", Local: "Fine", Remote: "Cloudy"},
+	}, diffs)
+}
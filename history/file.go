@@ -0,0 +1,298 @@
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skoef/pvoutput"
+)
+
+// kinds of records, prefixing the names of the files holding them
+const (
+	kindStatuses = "statuses"
+	kindOutputs  = "outputs"
+)
+
+// recordJSON is a line in a FileStore's files
+type recordJSON struct {
+	Status     *pvoutput.Status `json:"status,omitempty"`
+	Output     *pvoutput.Output `json:"output,omitempty"`
+	UploadedAt time.Time        `json:"uploaded_at"`
+	Uploaded   bool             `json:"uploaded"`
+	Response   string           `json:"response,omitempty"`
+}
+
+func (r recordJSON) upload() Upload {
+	return Upload{Time: r.UploadedAt, Uploaded: r.Uploaded, Response: r.Response}
+}
+
+// statusKey returns the wall clock date and time of given status, which
+// sorts in order
+func statusKey(t time.Time) string {
+	return t.Format("2006-01-02 15:04")
+}
+
+// outputKey returns the wall clock date of given output, which sorts in
+// order
+func outputKey(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// FileStore is a Store keeping its records in a directory of JSON lines
+// files, one per month of statuses or outputs, like statuses-2026-03.jsonl.
+// Records are only ever appended, so the files can be inspected and backed
+// up with regular tools
+type FileStore struct {
+	Dir string
+	mu  sync.Mutex
+}
+
+// NewFileStore returns a new FileStore in given directory, which is created
+// when it doesn't exist
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &FileStore{Dir: dir}, nil
+}
+
+// fileName returns the name of the file holding records of given kind and
+// date
+func fileName(kind string, date time.Time) string {
+	return fmt.Sprintf("%s-%s.jsonl", kind, date.Format("2006-01"))
+}
+
+// AddStatuses implements Store
+func (s *FileStore) AddStatuses(records []StatusRecord) error {
+	lines := map[string][]recordJSON{}
+	for i := range records {
+		r := records[i]
+		if r.Status.DateTime.IsZero() {
+			return fmt.Errorf("status %d has no DateTime", i)
+		}
+
+		name := fileName(kindStatuses, r.Status.DateTime)
+		lines[name] = append(lines[name], recordJSON{
+			Status:     &r.Status,
+			UploadedAt: r.Upload.Time,
+			Uploaded:   r.Upload.Uploaded,
+			Response:   r.Upload.Response,
+		})
+	}
+
+	return s.append(lines)
+}
+
+// AddOutputs implements Store
+func (s *FileStore) AddOutputs(records []OutputRecord) error {
+	lines := map[string][]recordJSON{}
+	for i := range records {
+		r := records[i]
+		if r.Output.Date.IsZero() {
+			return fmt.Errorf("output %d has no date", i)
+		}
+
+		name := fileName(kindOutputs, r.Output.Date)
+		lines[name] = append(lines[name], recordJSON{
+			Output:     &r.Output,
+			UploadedAt: r.Upload.Time,
+			Uploaded:   r.Upload.Uploaded,
+			Response:   r.Upload.Response,
+		})
+	}
+
+	return s.append(lines)
+}
+
+// append appends records to the files they belong in
+func (s *FileStore) append(lines map[string][]recordJSON) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := []string{}
+	for name := range lines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		data := []byte{}
+		for _, r := range lines[name] {
+			line, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			data = append(append(data, line...), '\n')
+		}
+
+		if err := appendFile(filepath.Join(s.Dir, name), data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// appendFile appends data to given file, dropping an incomplete last line
+// left by an interrupted write first
+func appendFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	if end > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, end-1); err != nil {
+			return err
+		}
+
+		if last[0] != '\n' {
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			existing, err := ioutil.ReadAll(f)
+			if err != nil {
+				return err
+			}
+			end = int64(bytes.LastIndexByte(existing, '\n') + 1)
+			if err := f.Truncate(end); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := f.WriteAt(data, end); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+// read returns the records of given kind in the files of the months between
+// given dates, in the order they were added
+func (s *FileStore) read(kind string, from, to time.Time) ([]recordJSON, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	infos, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []recordJSON{}
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasPrefix(name, kind+"-") || !strings.HasSuffix(name, ".jsonl") {
+			continue
+		}
+
+		month := strings.TrimSuffix(strings.TrimPrefix(name, kind+"-"), ".jsonl")
+		if (!from.IsZero() && month < from.Format("2006-01")) || (!to.IsZero() && month > to.Format("2006-01")) {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(s.Dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		// an incomplete last line is left by an interrupted write
+		data = data[:bytes.LastIndexByte(data, '\n')+1]
+		for i, line := range strings.Split(string(data), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+
+			r := recordJSON{}
+			if err := json.Unmarshal([]byte(line), &r); err != nil {
+				return nil, fmt.Errorf("%s line %d: %s", name, i+1, err)
+			}
+			records = append(records, r)
+		}
+	}
+
+	return records, nil
+}
+
+// inRange tells if given date is between the from and to dates, both
+// inclusive, compared by wall clock
+func inRange(date, from, to time.Time) bool {
+	d := outputKey(date)
+
+	return (from.IsZero() || d >= outputKey(from)) && (to.IsZero() || d <= outputKey(to))
+}
+
+// Statuses implements Store
+func (s *FileStore) Statuses(from, to time.Time) ([]StatusRecord, error) {
+	lines, err := s.read(kindStatuses, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := map[string]StatusRecord{}
+	for _, r := range lines {
+		if r.Status == nil || !inRange(r.Status.DateTime, from, to) {
+			continue
+		}
+		latest[statusKey(r.Status.DateTime)] = StatusRecord{Status: *r.Status, Upload: r.upload()}
+	}
+
+	keys := []string{}
+	for k := range latest {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	records := []StatusRecord{}
+	for _, k := range keys {
+		records = append(records, latest[k])
+	}
+
+	return records, nil
+}
+
+// Outputs implements Store
+func (s *FileStore) Outputs(from, to time.Time) ([]OutputRecord, error) {
+	lines, err := s.read(kindOutputs, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := map[string]OutputRecord{}
+	for _, r := range lines {
+		if r.Output == nil || !inRange(r.Output.Date, from, to) {
+			continue
+		}
+		latest[outputKey(r.Output.Date)] = OutputRecord{Output: *r.Output, Upload: r.upload()}
+	}
+
+	keys := []string{}
+	for k := range latest {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	records := []OutputRecord{}
+	for _, k := range keys {
+		records = append(records, latest[k])
+	}
+
+	return records, nil
+}
@@ -0,0 +1,118 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/skoef/pvoutput"
+	"github.com/skoef/pvoutput/internal/pvtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tempStore(t *testing.T) *FileStore {
+	dir, err := ioutil.TempDir("", "history")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	s, err := NewFileStore(filepath.Join(dir, "store"))
+	require.NoError(t, err)
+
+	return s
+}
+
+var uploadedAt = time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+
+func TestFileStoreStatuses(t *testing.T) {
+	s := tempStore(t)
+	loc := time.FixedZone("CET", 3600)
+
+	ok := Upload{Time: uploadedAt, Uploaded: true}
+	failed := Upload{Time: uploadedAt, Response: "Bad request 400: Moon Powered"}
+	require.NoError(t, s.AddStatuses([]StatusRecord{
+		{pvtest.StatusAt(time.Date(2026, 2, 28, 23, 55, 0, 0, loc), 0), ok},
+		{pvtest.StatusAt(time.Date(2026, 3, 1, 12, 0, 0, 0, loc), 1500), failed},
+		{pvtest.StatusAt(time.Date(2026, 3, 1, 12, 5, 0, 0, loc), 1600), ok},
+	}))
+	// a later record replaces the earlier one
+	require.NoError(t, s.AddStatuses([]StatusRecord{
+		{pvtest.StatusAt(time.Date(2026, 3, 1, 12, 0, 0, 0, loc), 1550), ok},
+	}))
+
+	files, err := filepath.Glob(filepath.Join(s.Dir, "*"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(s.Dir, "statuses-2026-02.jsonl"), filepath.Join(s.Dir, "statuses-2026-03.jsonl")}, files)
+
+	records, err := s.Statuses(time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.True(t, records[0].Status.DateTime.Equal(time.Date(2026, 2, 28, 23, 55, 0, 0, loc)))
+	assert.Equal(t, 1550, records[1].Status.Generating)
+	assert.True(t, records[1].Upload.Uploaded)
+	assert.True(t, records[1].Upload.Time.Equal(uploadedAt))
+	assert.Equal(t, 1600, records[2].Status.Generating)
+	assert.Equal(t, pvoutput.UnsetInt, records[2].Status.Consuming)
+
+	// dates are compared by wall clock, not in UTC
+	records, err = s.Statuses(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	records, err = s.Statuses(time.Time{}, time.Date(2026, 2, 28, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	records, err = s.Statuses(time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC), time.Time{})
+	require.NoError(t, err)
+	assert.Empty(t, records)
+
+	err = s.AddStatuses([]StatusRecord{{Status: pvoutput.NewStatus()}})
+	assert.EqualError(t, err, "status 0 has no DateTime")
+}
+
+func TestFileStoreOutputs(t *testing.T) {
+	s := tempStore(t)
+
+	failed := Upload{Time: uploadedAt, Response: "Unauthorized 401: Invalid API Key"}
+	require.NoError(t, s.AddOutputs([]OutputRecord{
+		{pvtest.OutputOn(time.Date(2026, 3, 2, 0, 0, 0, 0, time.Local), 12000), failed},
+		{pvtest.OutputOn(time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local), 14000), failed},
+	}))
+
+	records, err := s.Outputs(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "2026-03-01", records[0].Output.Date.Format("2006-01-02"))
+	assert.Equal(t, 14000, records[0].Output.Generated)
+	assert.False(t, records[0].Upload.Uploaded)
+	assert.Equal(t, "Unauthorized 401: Invalid API Key", records[0].Upload.Response)
+
+	// an interrupted write leaves an incomplete line, which is ignored and
+	// dropped on the next write
+	path := filepath.Join(s.Dir, "outputs-2026-03.jsonl")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"output":{"date":"2026-03-03","gen`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	records, err = s.Outputs(time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	require.NoError(t, s.AddOutputs([]OutputRecord{
+		{pvtest.OutputOn(time.Date(2026, 3, 3, 0, 0, 0, 0, time.Local), 9000), Upload{Time: uploadedAt, Uploaded: true}},
+	}))
+	records, err = s.Outputs(time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, 9000, records[2].Output.Generated)
+
+	// other invalid lines are errors
+	require.NoError(t, ioutil.WriteFile(path, []byte("garbage\n"), 0644))
+	_, err = s.Outputs(time.Time{}, time.Time{})
+	assert.EqualError(t, err, "outputs-2026-03.jsonl line 1: invalid character 'g' looking for beginning of value")
+}
@@ -0,0 +1,149 @@
+// Package history keeps a local record of the statuses and outputs uploaded
+// to PVOutput, together with the outcome of their upload, and compares them
+// with what PVOutput reports
+package history
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/skoef/pvoutput"
+)
+
+// Upload is the outcome of uploading a status or output
+type Upload struct {
+	// Time is when the upload was attempted
+	Time     time.Time
+	Uploaded bool
+	// Response is PVOutput's response to a failed upload, or the error that
+	// prevented it. pvoutput.API doesn't return responses to successful
+	// uploads, so it is empty when uploaded
+	Response string
+}
+
+// uploadOf returns the outcome of an upload at given time failing with err
+func uploadOf(t time.Time, err error) Upload {
+	u := Upload{Time: t, Uploaded: err == nil}
+	if err != nil {
+		u.Response = err.Error()
+	}
+
+	return u
+}
+
+// StatusRecord is a status and the outcome of its upload
+type StatusRecord struct {
+	Status pvoutput.Status
+	Upload Upload
+}
+
+// OutputRecord is an output and the outcome of its upload
+type OutputRecord struct {
+	Output pvoutput.Output
+	Upload Upload
+}
+
+// Store records statuses and outputs. A record replaces earlier records of
+// the status at the same date and time or the output of the same date. Dates
+// and times are compared by their wall clock, like PVOutput does
+type Store interface {
+	AddStatuses(records []StatusRecord) error
+	AddOutputs(records []OutputRecord) error
+	// Statuses returns the statuses recorded between the from and to dates,
+	// both inclusive, in order. Zero dates leave the range open
+	Statuses(from, to time.Time) ([]StatusRecord, error)
+	// Outputs returns the outputs recorded between the from and to dates,
+	// both inclusive, in order. Zero dates leave the range open
+	Outputs(from, to time.Time) ([]OutputRecord, error)
+}
+
+// Uploader uploads statuses and outputs, it is implemented by pvoutput.API
+type Uploader interface {
+	AddStatus(s pvoutput.Status) error
+	AddBatchStatus(b pvoutput.BatchStatus) error
+	AddOutput(o pvoutput.Output) error
+	AddBatchOutput(b pvoutput.BatchOutput) error
+}
+
+// Recorder is an Uploader passing uploads on to another Uploader and
+// recording every status and output in a Store, whether uploading them
+// succeeds or not
+type Recorder struct {
+	Uploader Uploader
+	Store    Store
+	now      func() time.Time
+}
+
+// NewRecorder returns a new Recorder uploading to given Uploader and
+// recording in given Store
+func NewRecorder(u Uploader, s Store) *Recorder {
+	return &Recorder{
+		Uploader: u,
+		Store:    s,
+		now:      time.Now,
+	}
+}
+
+// RateLimit returns the rate limit of the Uploader, when it knows it
+func (r *Recorder) RateLimit() (pvoutput.RateLimit, bool) {
+	if rl, ok := r.Uploader.(pvoutput.RateLimited); ok {
+		return rl.RateLimit()
+	}
+
+	return pvoutput.RateLimit{}, false
+}
+
+// recorded returns the error of an upload, or the error recording it when
+// the upload succeeded
+func recorded(uploadErr, recordErr error) error {
+	if uploadErr != nil {
+		return uploadErr
+	}
+	if recordErr != nil {
+		return fmt.Errorf("could not record upload: %s", recordErr)
+	}
+
+	return nil
+}
+
+// recordStatuses records given statuses along with the error uploading them
+func (r *Recorder) recordStatuses(b pvoutput.BatchStatus, err error) error {
+	u := uploadOf(r.now(), err)
+	records := []StatusRecord{}
+	for _, s := range b {
+		records = append(records, StatusRecord{Status: s, Upload: u})
+	}
+
+	return recorded(err, r.Store.AddStatuses(records))
+}
+
+// recordOutputs records given outputs along with the error uploading them
+func (r *Recorder) recordOutputs(b pvoutput.BatchOutput, err error) error {
+	u := uploadOf(r.now(), err)
+	records := []OutputRecord{}
+	for _, o := range b {
+		records = append(records, OutputRecord{Output: o, Upload: u})
+	}
+
+	return recorded(err, r.Store.AddOutputs(records))
+}
+
+// AddStatus implements Uploader
+func (r *Recorder) AddStatus(s pvoutput.Status) error {
+	return r.recordStatuses(pvoutput.BatchStatus{s}, r.Uploader.AddStatus(s))
+}
+
+// AddBatchStatus implements Uploader
+func (r *Recorder) AddBatchStatus(b pvoutput.BatchStatus) error {
+	return r.recordStatuses(b, r.Uploader.AddBatchStatus(b))
+}
+
+// AddOutput implements Uploader
+func (r *Recorder) AddOutput(o pvoutput.Output) error {
+	return r.recordOutputs(pvoutput.BatchOutput{o}, r.Uploader.AddOutput(o))
+}
+
+// AddBatchOutput implements Uploader
+func (r *Recorder) AddBatchOutput(b pvoutput.BatchOutput) error {
+	return r.recordOutputs(b, r.Uploader.AddBatchOutput(b))
+}
@@ -0,0 +1,77 @@
+package history
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/skoef/pvoutput"
+	"github.com/skoef/pvoutput/internal/pvtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingStore fails to record anything
+type failingStore struct{}
+
+func (failingStore) AddStatuses(records []StatusRecord) error { return errors.New("disk full") }
+func (failingStore) AddOutputs(records []OutputRecord) error  { return errors.New("disk full") }
+func (failingStore) Statuses(from, to time.Time) ([]StatusRecord, error) {
+	return nil, nil
+}
+func (failingStore) Outputs(from, to time.Time) ([]OutputRecord, error) {
+	return nil, nil
+}
+
+func TestRecorder(t *testing.T) {
+	u := &pvtest.Uploader{}
+	s := tempStore(t)
+	r := NewRecorder(u, s)
+	r.now = func() time.Time { return uploadedAt }
+
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, r.AddStatus(pvtest.StatusAt(day.Add(12*time.Hour), 1500)))
+	require.NoError(t, r.AddBatchStatus(pvoutput.BatchStatus{
+		pvtest.StatusAt(day.Add(12*time.Hour+5*time.Minute), 1600),
+		pvtest.StatusAt(day.Add(12*time.Hour+10*time.Minute), 1700),
+	}))
+	require.NoError(t, r.AddOutput(pvtest.OutputOn(day, 14000)))
+
+	u.Err = errors.New("Bad request 400: Date is in the future")
+	err := r.AddBatchOutput(pvoutput.BatchOutput{pvtest.OutputOn(day.AddDate(0, 0, 1), 1), pvtest.OutputOn(day.AddDate(0, 0, 2), 2)})
+	assert.Equal(t, u.Err, err)
+
+	assert.Len(t, u.Statuses, 3)
+	assert.Len(t, u.StatusBatches, 1)
+	assert.Len(t, u.Outputs, 1)
+	assert.Empty(t, u.OutputBatches)
+
+	statuses, err := s.Statuses(time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, statuses, 3)
+	assert.Equal(t, 1700, statuses[2].Status.Generating)
+	assert.Equal(t, Upload{Time: uploadedAt, Uploaded: true}, statuses[2].Upload)
+
+	// failed uploads are recorded with PVOutput's response
+	outputs, err := s.Outputs(time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, outputs, 3)
+	assert.True(t, outputs[0].Upload.Uploaded)
+	assert.False(t, outputs[2].Upload.Uploaded)
+	assert.Equal(t, "Bad request 400: Date is in the future", outputs[2].Upload.Response)
+
+	// the rate limit of the uploader is passed on
+	_, known := r.RateLimit()
+	assert.False(t, known)
+	u.Limit = pvoutput.RateLimit{Reset: uploadedAt}
+	limit, known := r.RateLimit()
+	assert.True(t, known)
+	assert.Equal(t, uploadedAt, limit.Reset)
+
+	// errors recording are returned when the upload succeeded
+	u.Err = nil
+	r.Store = failingStore{}
+	assert.EqualError(t, r.AddStatus(pvtest.StatusAt(day, 0)), "could not record upload: disk full")
+	u.Err = errors.New("Unauthorized 401: Invalid API Key")
+	assert.EqualError(t, r.AddStatus(pvtest.StatusAt(day, 0)), "Unauthorized 401: Invalid API Key")
+}
@@ -0,0 +1,481 @@
+package homeassistant
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/skoef/pvoutput"
+)
+
+// Entities maps Home Assistant entities onto PVOutput fields. Leave an entity
+// empty when there is none for a field
+type Entities struct {
+	// Generating and Consuming are power sensors, in W, kW or MW
+	Generating string
+	Consuming  string
+	// Generated, Consumed and Exported are energy sensors with state_class
+	// total_increasing, in Wh, kWh or MWh
+	Generated string
+	Consumed  string
+	Exported  string
+	// Temperature is a temperature sensor in °C, Voltage a voltage sensor
+	Temperature string
+	Voltage     string
+}
+
+// all returns the IDs of all configured entities
+func (e Entities) all() []string {
+	ids := []string{}
+	for _, id := range []string{e.Generating, e.Consuming, e.Generated, e.Consumed, e.Exported, e.Temperature, e.Voltage} {
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+// energy returns the IDs of the configured energy entities
+func (e Entities) energy() []string {
+	ids := []string{}
+	for _, id := range []string{e.Generated, e.Consumed, e.Exported} {
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+// powerScale returns the factor to convert given power unit to watts
+func powerScale(unit string) (float64, error) {
+	switch unit {
+	case "W":
+		return 1, nil
+	case "kW":
+		return 1e3, nil
+	case "MW":
+		return 1e6, nil
+	}
+
+	return 0, fmt.Errorf("unsupported power unit %q", unit)
+}
+
+// energyScale returns the factor to convert given energy unit to watt hours
+func energyScale(unit string) (float64, error) {
+	switch unit {
+	case "Wh":
+		return 1, nil
+	case "kWh":
+		return 1e3, nil
+	case "MWh":
+		return 1e6, nil
+	}
+
+	return 0, fmt.Errorf("unsupported energy unit %q", unit)
+}
+
+// point is a numeric state at some moment
+type point struct {
+	Time  time.Time
+	Value float64
+}
+
+// points converts given states into numeric values, multiplied by the factor
+// returned for their unit. Unavailable and unknown states are skipped. Only
+// the first state is guaranteed to carry attributes, so its unit is used
+func points(states []State, scale func(string) (float64, error)) ([]point, error) {
+	if len(states) == 0 {
+		return nil, nil
+	}
+
+	factor := 1.0
+	if scale != nil {
+		var err error
+		if factor, err = scale(states[0].Unit()); err != nil {
+			return nil, fmt.Errorf("%s: %s", states[0].EntityID, err)
+		}
+	}
+
+	pts := []point{}
+	for _, s := range states {
+		v, err := s.Float()
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		pts = append(pts, point{Time: s.LastChanged, Value: v * factor})
+	}
+
+	return pts, nil
+}
+
+// OutputUploader uploads Output updates, it is implemented by pvoutput.API
+type OutputUploader interface {
+	AddOutput(o pvoutput.Output) error
+	AddBatchOutput(b pvoutput.BatchOutput) error
+}
+
+// MissingUploader lists the days without an Output and uploads Output
+// updates, it is implemented by pvoutput.API
+type MissingUploader interface {
+	OutputUploader
+	GetMissing(from, to time.Time) ([]time.Time, error)
+}
+
+// Adapter builds Status and Output updates from Home Assistant entities
+type Adapter struct {
+	Client   *Client
+	Entities Entities
+	// Interval is the system's status interval
+	Interval time.Duration
+	// Location determines the start and end of days, time.Local by default
+	Location *time.Location
+	// now returns the current time, it is overridden in tests
+	now func() time.Time
+}
+
+// NewAdapter returns a new Adapter reading given entities with given client
+func NewAdapter(c *Client, entities Entities, interval time.Duration) *Adapter {
+	return &Adapter{
+		Client:   c,
+		Entities: entities,
+		Interval: interval,
+		Location: time.Local,
+		now:      time.Now,
+	}
+}
+
+// day returns the start and end of the day given time falls in
+func (a *Adapter) day(t time.Time) (time.Time, time.Time) {
+	y, m, d := t.In(a.Location).Date()
+	start := time.Date(y, m, d, 0, 0, 0, 0, a.Location)
+
+	return start, start.AddDate(0, 0, 1)
+}
+
+// next returns the first interval boundary after given time, aligned to the
+// wall clock like the boundaries of pvoutput.Resampler
+func (a *Adapter) next(t time.Time) time.Time {
+	start, _ := a.day(t)
+	n := t.Sub(start)/a.Interval + 1
+
+	return start.Add(n * a.Interval)
+}
+
+// clamp moves points before start, like the state an entity had at start,
+// to start
+func clamp(pts []point, start time.Time) []point {
+	for i := range pts {
+		if pts[i].Time.Before(start) {
+			pts[i].Time = start
+		}
+	}
+
+	return pts
+}
+
+// Statuses returns the Status updates for the day given time falls in, built
+// from the entities' history. Power values are averaged per interval, energy
+// values are relative to the start of the day. Resets of the energy sensors,
+// which Home Assistant allows for total_increasing sensors, are accounted for
+func (a *Adapter) Statuses(day time.Time) ([]pvoutput.Status, error) {
+	ids := a.Entities.all()
+	if len(ids) == 0 {
+		return nil, errors.New("no entities configured")
+	}
+
+	start, end := a.day(day)
+	if now := a.now(); now.Before(end) {
+		end = now
+	}
+	if !end.After(start) {
+		return nil, errors.New("day is in the future")
+	}
+
+	history, err := a.Client.History(ids, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := []pvoutput.Sample{}
+	resampler := pvoutput.NewResampler(a.Interval)
+
+	// Home Assistant only records changes, so power values are repeated on
+	// every interval they stay valid for
+	power := func(id string, set func(*pvoutput.Sample, float64)) error {
+		pts, err := points(history[id], powerScale)
+		if err != nil {
+			return err
+		}
+		pts = clamp(pts, start)
+
+		for i, p := range pts {
+			until := end
+			if i+1 < len(pts) {
+				until = pts[i+1].Time
+			}
+
+			for t := p.Time; t.Before(until); t = a.next(t) {
+				s := pvoutput.NewSample()
+				s.Time = t.In(a.Location)
+				set(&s, p.Value)
+				samples = append(samples, s)
+			}
+		}
+
+		return nil
+	}
+
+	energy := func(id string, set func(*pvoutput.Sample, float64)) error {
+		pts, err := points(history[id], energyScale)
+		if err != nil {
+			return err
+		}
+		pts = clamp(pts, start)
+
+		counter := pvoutput.Counter{}
+		for _, p := range pts {
+			if _, err := counter.Observe(p.Time, uint64(math.Round(math.Max(0, p.Value)))); err != nil {
+				return err
+			}
+
+			s := pvoutput.NewSample()
+			s.Time = p.Time.In(a.Location)
+			set(&s, float64(counter.Lifetime()))
+			samples = append(samples, s)
+		}
+
+		return nil
+	}
+
+	if a.Entities.Generating != "" {
+		if err := power(a.Entities.Generating, func(s *pvoutput.Sample, v float64) { s.Generating = v }); err != nil {
+			return nil, err
+		}
+	}
+	if a.Entities.Consuming != "" {
+		if err := power(a.Entities.Consuming, func(s *pvoutput.Sample, v float64) { s.Consuming = v }); err != nil {
+			return nil, err
+		}
+	}
+	if a.Entities.Generated != "" {
+		if err := energy(a.Entities.Generated, func(s *pvoutput.Sample, v float64) { s.Generated = v }); err != nil {
+			return nil, err
+		}
+	}
+	if a.Entities.Consumed != "" {
+		if err := energy(a.Entities.Consumed, func(s *pvoutput.Sample, v float64) { s.Consumed = v }); err != nil {
+			return nil, err
+		}
+	}
+
+	resampled, err := resampler.Resample(samples)
+	if err != nil {
+		return nil, err
+	}
+
+	temperature, err := points(history[a.Entities.Temperature], nil)
+	if err != nil {
+		return nil, err
+	}
+	voltage, err := points(history[a.Entities.Voltage], nil)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []pvoutput.Status{}
+	for _, s := range resampled {
+		// the interval ending at the start of the day closes the previous
+		// day, the one ending at its end is reported at 23:59
+		if s.DateTime.Before(start) {
+			continue
+		}
+
+		if v, ok := valueAt(temperature, s.DateTime); ok {
+			s.Temperature = v
+		}
+		if v, ok := valueAt(voltage, s.DateTime); ok {
+			s.Voltage = v
+		}
+
+		statuses = append(statuses, s)
+	}
+
+	return statuses, nil
+}
+
+// valueAt returns the value of the last point at or before given time
+func valueAt(pts []point, t time.Time) (float64, bool) {
+	i := sort.Search(len(pts), func(i int) bool {
+		return pts[i].Time.After(t)
+	})
+	if i == 0 {
+		return 0, false
+	}
+
+	return pts[i-1].Value, true
+}
+
+// Output returns the Output for the day given time falls in. Energy values
+// are taken from the daily long-term statistics of the energy entities, which
+// Home Assistant keeps indefinitely. The temperature range is taken from the
+// statistics too, the peak power from the history of the power entity
+func (a *Adapter) Output(day time.Time) (pvoutput.Output, error) {
+	o := pvoutput.NewOutput()
+	start, end := a.day(day)
+	o.Date = start
+
+	ids := a.Entities.energy()
+	if a.Entities.Temperature != "" {
+		ids = append(ids, a.Entities.Temperature)
+	}
+	if len(ids) == 0 && a.Entities.Generating == "" {
+		return o, errors.New("no entities configured")
+	}
+
+	if len(ids) > 0 {
+		stats, err := a.Client.Statistics(ids, start, end, PeriodDay)
+		if err != nil {
+			return o, err
+		}
+
+		units := map[string]float64{}
+		for _, id := range a.Entities.energy() {
+			state, err := a.Client.State(id)
+			if err != nil {
+				return o, fmt.Errorf("%s: %s", id, err)
+			}
+			if units[id], err = energyScale(state.Unit()); err != nil {
+				return o, fmt.Errorf("%s: %s", id, err)
+			}
+		}
+
+		change := func(id string) int {
+			if id == "" {
+				return pvoutput.UnsetInt
+			}
+
+			total, found := 0.0, false
+			for _, st := range stats[id] {
+				if st.Change != nil {
+					total += *st.Change
+					found = true
+				}
+			}
+			if !found {
+				return pvoutput.UnsetInt
+			}
+
+			return int(math.Round(math.Max(0, total*units[id])))
+		}
+
+		o.Generated = change(a.Entities.Generated)
+		o.Consumed = change(a.Entities.Consumed)
+		o.Exported = change(a.Entities.Exported)
+
+		for _, st := range stats[a.Entities.Temperature] {
+			if st.Min != nil {
+				o.MinTemp = *st.Min
+			}
+			if st.Max != nil {
+				o.MaxTemp = *st.Max
+			}
+		}
+	}
+
+	if a.Entities.Generating != "" {
+		history, err := a.Client.History([]string{a.Entities.Generating}, start, end)
+		if err != nil {
+			return o, err
+		}
+
+		pts, err := points(history[a.Entities.Generating], powerScale)
+		if err != nil {
+			return o, err
+		}
+
+		peak := -1.0
+		for _, p := range pts {
+			if p.Value > peak && !p.Time.Before(start) {
+				peak = p.Value
+				o.PeakPower = int(math.Round(p.Value))
+				o.PeakTime = p.Time.In(a.Location)
+			}
+		}
+	}
+
+	return o, nil
+}
+
+// Backfill builds the Output for each of given days and uploads them in
+// batches of given size, which is typically pvoutput.BatchOutputMaxSize or
+// pvoutput.BatchOutputMaxSizeDonating
+func (a *Adapter) Backfill(u OutputUploader, days []time.Time, batchSize int) error {
+	if batchSize < 1 {
+		return errors.New("batch size should be at least 1")
+	}
+
+	batch := pvoutput.BatchOutput{}
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		var err error
+		if len(batch) == 1 {
+			err = u.AddOutput(batch[0])
+		} else {
+			err = u.AddBatchOutput(batch)
+		}
+		batch = pvoutput.BatchOutput{}
+
+		return err
+	}
+
+	for _, day := range days {
+		o, err := a.Output(day)
+		if err != nil {
+			return fmt.Errorf("%s: %s", day.Format("20060102"), err)
+		}
+
+		batch = append(batch, o)
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return flush()
+}
+
+// BackfillMissing asks PVOutput which days between from and to have no
+// Output, and backfills those like Backfill. Days that are not over yet are
+// left out. It returns the days that were backfilled
+func (a *Adapter) BackfillMissing(u MissingUploader, from, to time.Time, batchSize int) ([]time.Time, error) {
+	missing, err := u.GetMissing(from, to)
+	if err != nil {
+		return nil, fmt.Errorf("could not list missing days: %s", err)
+	}
+
+	// PVOutput returns dates without time zone, which are days in the
+	// system's location
+	days := []time.Time{}
+	for _, m := range missing {
+		y, mm, d := m.Date()
+		day := time.Date(y, mm, d, 0, 0, 0, 0, a.Location)
+		if _, end := a.day(day); end.After(a.now()) {
+			continue
+		}
+		days = append(days, day)
+	}
+
+	if err := a.Backfill(u, days, batchSize); err != nil {
+		return nil, err
+	}
+
+	return days, nil
+}
@@ -0,0 +1,146 @@
+package homeassistant
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skoef/pvoutput"
+	"github.com/skoef/pvoutput/internal/pvtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testUploader records uploaded outputs and lists the missing days
+type testUploader struct {
+	pvtest.Uploader
+	missing []time.Time
+}
+
+func (u *testUploader) GetMissing(from, to time.Time) ([]time.Time, error) {
+	return u.missing, nil
+}
+
+func newTestAdapter(t *testing.T) *Adapter {
+	ha := newFakeHA(t)
+
+	a := NewAdapter(NewClient(ha.URL, testToken), Entities{
+		Generating:  "sensor.solar_power",
+		Generated:   "sensor.solar_energy",
+		Temperature: "sensor.outdoor_temperature",
+	}, time.Hour)
+	a.Location = time.UTC
+	a.now = func() time.Time {
+		return time.Date(2020, 8, 20, 12, 0, 0, 0, time.UTC)
+	}
+
+	return a
+}
+
+func TestAdapterStatuses(t *testing.T) {
+	a := newTestAdapter(t)
+	at := func(hour, min int) time.Time {
+		return time.Date(2020, 8, 18, hour, min, 0, 0, time.UTC)
+	}
+
+	statuses, err := a.Statuses(at(12, 0))
+	require.NoError(t, err)
+	require.Len(t, statuses, 24)
+
+	byTime := map[time.Time]pvoutput.Status{}
+	for _, s := range statuses {
+		byTime[s.DateTime] = s
+	}
+
+	tests := []struct {
+		time        time.Time
+		generating  int
+		generated   int
+		temperature float64
+	}{
+		{at(1, 0), 0, 0, 15.0},
+		{at(7, 0), 1000, 500, 15.0},
+		{at(8, 0), 1917, 500, 15.0},
+		{at(12, 0), 2000, 5000, 25.5},
+		// the energy sensor was reset at 13:00
+		{at(13, 0), 2000, 5200, 25.5},
+		{at(18, 0), 2000, 7000, 25.5},
+		{at(19, 0), 0, 7000, 25.5},
+		// the interval ending at midnight closes the day
+		{at(23, 59), 0, 7100, 25.5},
+	}
+
+	for _, tc := range tests {
+		s, ok := byTime[tc.time]
+		if !assert.True(t, ok, "status at %s", tc.time) {
+			continue
+		}
+
+		assert.Equal(t, tc.generating, s.Generating, "generating at %s", tc.time)
+		assert.Equal(t, tc.generated, s.Generated, "generated at %s", tc.time)
+		assert.Equal(t, tc.temperature, s.Temperature, "temperature at %s", tc.time)
+		assert.Equal(t, -1, s.Consuming)
+		assert.Equal(t, -1.0, s.Voltage)
+	}
+
+	_, err = a.Statuses(time.Date(2020, 8, 21, 0, 0, 0, 0, time.UTC))
+	assert.Error(t, err)
+
+	a.Entities = Entities{}
+	_, err = a.Statuses(at(12, 0))
+	assert.Error(t, err)
+}
+
+func TestAdapterOutput(t *testing.T) {
+	a := newTestAdapter(t)
+
+	o, err := a.Output(time.Date(2020, 8, 18, 12, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+
+	assert.Equal(t, time.Date(2020, 8, 18, 0, 0, 0, 0, time.UTC), o.Date)
+	assert.Equal(t, 7000, o.Generated)
+	assert.Equal(t, -1, o.Consumed)
+	assert.Equal(t, -1, o.Exported)
+	assert.Equal(t, 2000, o.PeakPower)
+	assert.Equal(t, time.Date(2020, 8, 18, 7, 10, 0, 0, time.UTC), o.PeakTime)
+	assert.Equal(t, 14.2, o.MinTemp)
+	assert.Equal(t, 26.1, o.MaxTemp)
+}
+
+func TestAdapterBackfill(t *testing.T) {
+	a := newTestAdapter(t)
+	days := []time.Time{
+		time.Date(2020, 8, 17, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, 8, 18, 0, 0, 0, 0, time.UTC),
+	}
+
+	u := &testUploader{}
+	require.NoError(t, a.Backfill(u, days, pvoutput.BatchOutputMaxSize))
+	assert.Len(t, u.Outputs, 2)
+	assert.Empty(t, u.OutputBatches)
+
+	u = &testUploader{}
+	require.NoError(t, a.Backfill(u, days, pvoutput.BatchOutputMaxSizeDonating))
+	assert.Len(t, u.Outputs, 2)
+	if assert.Len(t, u.OutputBatches, 1) && assert.Len(t, u.OutputBatches[0], 2) {
+		assert.Equal(t, days[1], u.OutputBatches[0][1].Date)
+	}
+
+	assert.Error(t, a.Backfill(u, days, 0))
+}
+
+func TestAdapterBackfillMissing(t *testing.T) {
+	a := newTestAdapter(t)
+	a.Location = time.FixedZone("UTC+2", 2*60*60)
+
+	// today isn't over yet
+	u := &testUploader{missing: []time.Time{
+		time.Date(2020, 8, 18, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, 8, 20, 0, 0, 0, 0, time.UTC),
+	}}
+	days, err := a.BackfillMissing(u, time.Date(2020, 8, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 8, 20, 0, 0, 0, 0, time.UTC), pvoutput.BatchOutputMaxSize)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{time.Date(2020, 8, 18, 0, 0, 0, 0, a.Location)}, days)
+	if assert.Len(t, u.Outputs, 1) {
+		assert.Equal(t, days[0], u.Outputs[0].Date)
+	}
+}
@@ -0,0 +1,356 @@
+// Package homeassistant sources PVOutput data from Home Assistant entities,
+// reading their history and long-term statistics through Home Assistant's
+// REST and WebSocket APIs
+package homeassistant
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	apiStates  = "/api/states/"
+	apiHistory = "/api/history/period/"
+	// DefaultTimeout is the default timeout for requests to Home Assistant
+	DefaultTimeout = 30 * time.Second
+)
+
+// Statistics periods supported by Home Assistant
+const (
+	Period5Minute = "5minute"
+	PeriodHour    = "hour"
+	PeriodDay     = "day"
+)
+
+// Client talks to a Home Assistant instance, authenticating with a long-lived
+// access token
+type Client struct {
+	BaseURL string
+	Token   string
+	// TLSConfig is used for HTTPS and WSS connections, when set
+	TLSConfig *tls.Config
+	client    *http.Client
+}
+
+// NewClient returns a new Client for the Home Assistant instance on given
+// base URL, e.g. http://homeassistant.local:8123
+func NewClient(baseURL, token string) *Client {
+	return &Client{
+		BaseURL: baseURL,
+		Token:   token,
+		client:  &http.Client{Timeout: DefaultTimeout},
+	}
+}
+
+// State is the state of an entity at some moment
+type State struct {
+	EntityID    string                 `json:"entity_id"`
+	State       string                 `json:"state"`
+	Attributes  map[string]interface{} `json:"attributes"`
+	LastChanged time.Time              `json:"last_changed"`
+}
+
+// Float returns the state as number. Unavailable and unknown states return an
+// error
+func (s State) Float() (float64, error) {
+	return strconv.ParseFloat(s.State, 64)
+}
+
+// attribute returns the string attribute with given name
+func (s State) attribute(name string) string {
+	v, _ := s.Attributes[name].(string)
+
+	return v
+}
+
+// Unit returns the unit_of_measurement attribute
+func (s State) Unit() string {
+	return s.attribute("unit_of_measurement")
+}
+
+// StateClass returns the state_class attribute, e.g. total_increasing
+func (s State) StateClass() string {
+	return s.attribute("state_class")
+}
+
+// get requests given path and decodes its response into v
+func (c *Client) get(path string, params url.Values, v interface{}) error {
+	u := strings.TrimRight(c.BaseURL, "/") + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.Token))
+	req.Header.Set("Content-Type", "application/json")
+
+	client := c.client
+	if c.TLSConfig != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = c.TLSConfig
+		client = &http.Client{Timeout: c.client.Timeout, Transport: transport}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return errors.New("unauthorized, a valid access token is required")
+	case http.StatusNotFound:
+		return errors.New("not found")
+	default:
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// State returns the current state of given entity
+func (c *Client) State(entityID string) (State, error) {
+	s := State{}
+	err := c.get(apiStates+url.PathEscape(entityID), nil, &s)
+
+	return s, err
+}
+
+// History returns the state changes of given entities between start and
+// end, by entity ID. The first state of each entity is the state it had at
+// start
+func (c *Client) History(entityIDs []string, start, end time.Time) (map[string][]State, error) {
+	if len(entityIDs) == 0 {
+		return nil, errors.New("no entities requested")
+	}
+
+	params := url.Values{}
+	params.Set("filter_entity_id", strings.Join(entityIDs, ","))
+	params.Set("end_time", end.UTC().Format(time.RFC3339))
+	params.Set("significant_changes_only", "0")
+
+	var resp [][]State
+	if err := c.get(apiHistory+url.PathEscape(start.UTC().Format(time.RFC3339)), params, &resp); err != nil {
+		return nil, err
+	}
+
+	history := map[string][]State{}
+	for _, states := range resp {
+		if len(states) == 0 {
+			continue
+		}
+
+		// with minimal responses only the first state has an entity ID
+		id := states[0].EntityID
+		for i := range states {
+			states[i].EntityID = id
+		}
+		history[id] = states
+	}
+
+	return history, nil
+}
+
+// Statistic is a row of Home Assistant's long-term statistics. Depending on
+// the kind of statistic, either Mean, Min and Max or State, Sum and Change
+// are set
+type Statistic struct {
+	Start  time.Time
+	End    time.Time
+	Mean   *float64
+	Min    *float64
+	Max    *float64
+	State  *float64
+	Sum    *float64
+	Change *float64
+}
+
+// statisticTime decodes timestamps in statistics, which are milliseconds
+// since the epoch in recent versions of Home Assistant and RFC 3339 strings
+// in older versions
+type statisticTime time.Time
+
+func (t *statisticTime) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+
+		parsed, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return err
+		}
+		*t = statisticTime(parsed)
+
+		return nil
+	}
+
+	ms, err := strconv.ParseFloat(string(data), 64)
+	if err != nil {
+		return err
+	}
+	*t = statisticTime(time.Unix(0, int64(ms*float64(time.Millisecond))))
+
+	return nil
+}
+
+func (s *Statistic) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Start  statisticTime `json:"start"`
+		End    statisticTime `json:"end"`
+		Mean   *float64      `json:"mean"`
+		Min    *float64      `json:"min"`
+		Max    *float64      `json:"max"`
+		State  *float64      `json:"state"`
+		Sum    *float64      `json:"sum"`
+		Change *float64      `json:"change"`
+	}
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*s = Statistic{
+		Start:  time.Time(raw.Start),
+		End:    time.Time(raw.End),
+		Mean:   raw.Mean,
+		Min:    raw.Min,
+		Max:    raw.Max,
+		State:  raw.State,
+		Sum:    raw.Sum,
+		Change: raw.Change,
+	}
+
+	return nil
+}
+
+// wsMessage is a message of the WebSocket API
+type wsMessage struct {
+	ID      int             `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Success bool            `json:"success,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Statistics returns the long-term statistics of given statistic IDs, which
+// for sensors are their entity IDs, between start and end, aggregated per
+// given period, by statistic ID
+func (c *Client) Statistics(statisticIDs []string, start, end time.Time, period string) (map[string][]Statistic, error) {
+	if len(statisticIDs) == 0 {
+		return nil, errors.New("no statistics requested")
+	}
+
+	switch period {
+	case Period5Minute, PeriodHour, PeriodDay:
+	default:
+		return nil, fmt.Errorf("unsupported period %s", period)
+	}
+
+	conn, err := dialWebsocket(websocketURL(c.BaseURL), c.TLSConfig, c.client.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	conn.conn.SetDeadline(time.Now().Add(c.client.Timeout))
+
+	read := func() (wsMessage, error) {
+		msg := wsMessage{}
+		data, err := conn.ReadMessage()
+		if err != nil {
+			return msg, err
+		}
+
+		return msg, json.Unmarshal(data, &msg)
+	}
+
+	write := func(v interface{}) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		return conn.WriteMessage(data)
+	}
+
+	// authenticate
+	msg, err := read()
+	if err != nil {
+		return nil, err
+	}
+	if msg.Type != "auth_required" {
+		return nil, fmt.Errorf("unexpected message %s", msg.Type)
+	}
+
+	if err := write(map[string]string{"type": "auth", "access_token": c.Token}); err != nil {
+		return nil, err
+	}
+
+	if msg, err = read(); err != nil {
+		return nil, err
+	}
+	switch msg.Type {
+	case "auth_ok":
+	case "auth_invalid":
+		return nil, fmt.Errorf("authentication failed: %s", msg.Message)
+	default:
+		return nil, fmt.Errorf("unexpected message %s", msg.Type)
+	}
+
+	const id = 1
+	err = write(map[string]interface{}{
+		"id":            id,
+		"type":          "recorder/statistics_during_period",
+		"start_time":    start.UTC().Format(time.RFC3339),
+		"end_time":      end.UTC().Format(time.RFC3339),
+		"statistic_ids": statisticIDs,
+		"period":        period,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if msg, err = read(); err != nil {
+			return nil, err
+		}
+
+		if msg.ID != id || msg.Type != "result" {
+			continue
+		}
+
+		if !msg.Success {
+			if msg.Error != nil {
+				return nil, fmt.Errorf("statistics failed: %s: %s", msg.Error.Code, msg.Error.Message)
+			}
+
+			return nil, errors.New("statistics failed")
+		}
+
+		stats := map[string][]Statistic{}
+		if err := json.NewDecoder(bytes.NewReader(msg.Result)).Decode(&stats); err != nil {
+			return nil, err
+		}
+
+		return stats, nil
+	}
+}
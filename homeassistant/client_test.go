@@ -0,0 +1,101 @@
+package homeassistant
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientHistory(t *testing.T) {
+	ha := newFakeHA(t)
+	c := NewClient(ha.URL, testToken)
+
+	start := time.Date(2020, 8, 18, 0, 0, 0, 0, time.UTC)
+	history, err := c.History([]string{"sensor.solar_power", "sensor.solar_energy"}, start, start.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+
+	states := history["sensor.solar_energy"]
+	if assert.Len(t, states, 6) {
+		assert.Equal(t, "kWh", states[0].Unit())
+		assert.Equal(t, "total_increasing", states[0].StateClass())
+		v, err := states[1].Float()
+		assert.NoError(t, err)
+		assert.Equal(t, 1000.5, v)
+		assert.Equal(t, time.Date(2020, 8, 18, 7, 0, 0, 0, time.UTC), states[1].LastChanged.UTC())
+	}
+
+	_, err = history["sensor.solar_power"][3].Float()
+	assert.Error(t, err)
+
+	_, err = c.History(nil, start, start)
+	assert.Error(t, err)
+
+	c.Token = "invalid"
+	_, err = c.History([]string{"sensor.solar_power"}, start, start.AddDate(0, 0, 1))
+	assert.Error(t, err)
+}
+
+func TestClientState(t *testing.T) {
+	ha := newFakeHA(t)
+	c := NewClient(ha.URL, testToken)
+
+	s, err := c.State("sensor.solar_energy")
+	require.NoError(t, err)
+	assert.Equal(t, "kWh", s.Unit())
+
+	_, err = c.State("sensor.foobar")
+	assert.Error(t, err)
+}
+
+func TestClientStatistics(t *testing.T) {
+	ha := newFakeHA(t)
+	c := NewClient(ha.URL, testToken)
+
+	start := time.Date(2020, 8, 18, 0, 0, 0, 0, time.UTC)
+	stats, err := c.Statistics([]string{"sensor.solar_energy", "sensor.outdoor_temperature"}, start, start.AddDate(0, 0, 1), PeriodDay)
+	require.NoError(t, err)
+
+	if assert.Len(t, stats["sensor.solar_energy"], 1) {
+		st := stats["sensor.solar_energy"][0]
+		assert.Equal(t, start, st.Start.UTC())
+		assert.Equal(t, start.AddDate(0, 0, 1), st.End.UTC())
+		if assert.NotNil(t, st.Change) {
+			assert.Equal(t, 7.0, *st.Change)
+		}
+		assert.Nil(t, st.Mean)
+	}
+
+	if assert.Len(t, stats["sensor.outdoor_temperature"], 1) {
+		st := stats["sensor.outdoor_temperature"][0]
+		if assert.NotNil(t, st.Max) {
+			assert.Equal(t, 26.1, *st.Max)
+		}
+		assert.Nil(t, st.Change)
+	}
+
+	_, err = c.Statistics([]string{"sensor.solar_energy"}, start, start, "week")
+	assert.Error(t, err)
+
+	c.Token = "invalid"
+	_, err = c.Statistics([]string{"sensor.solar_energy"}, start, start.AddDate(0, 0, 1), PeriodDay)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "authentication failed")
+	}
+}
+
+func TestStatisticTime(t *testing.T) {
+	var st Statistic
+	require.NoError(t, st.UnmarshalJSON([]byte(`{"start":"2020-08-18T00:00:00+00:00","end":"2020-08-18T01:00:00+00:00","mean":1.5}`)))
+	assert.Equal(t, time.Date(2020, 8, 18, 0, 0, 0, 0, time.UTC), st.Start.UTC())
+	assert.Equal(t, 1.5, *st.Mean)
+
+	assert.Error(t, st.UnmarshalJSON([]byte(`{"start":"yesterday"}`)))
+}
+
+func TestWebsocketURL(t *testing.T) {
+	assert.Equal(t, "ws://homeassistant.local:8123/api/websocket", websocketURL("http://homeassistant.local:8123/"))
+	assert.Equal(t, "wss://example.org/api/websocket", websocketURL("https://example.org"))
+}
@@ -0,0 +1,132 @@
+package homeassistant
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testToken = "secret-token"
+
+// fakeHA is a fake Home Assistant serving the fixtures in testdata through
+// its REST and WebSocket APIs
+type fakeHA struct {
+	*httptest.Server
+	t        *testing.T
+	requests []string
+}
+
+func newFakeHA(t *testing.T) *fakeHA {
+	f := &fakeHA{t: t}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+func (f *fakeHA) fixture(name string) []byte {
+	data, err := ioutil.ReadFile("testdata/" + name)
+	require.NoError(f.t, err)
+
+	return data
+}
+
+func (f *fakeHA) serve(w http.ResponseWriter, r *http.Request) {
+	f.requests = append(f.requests, r.URL.Path)
+
+	if r.URL.Path == "/api/websocket" {
+		f.serveWebsocket(w, r)
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer "+testToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, apiHistory):
+		var history [][]State
+		require.NoError(f.t, json.Unmarshal(f.fixture("history.json"), &history))
+
+		filtered := [][]State{}
+		for _, states := range history {
+			for _, id := range strings.Split(r.URL.Query().Get("filter_entity_id"), ",") {
+				if states[0].EntityID == id {
+					filtered = append(filtered, states)
+				}
+			}
+		}
+		json.NewEncoder(w).Encode(filtered)
+	case r.URL.Path == apiStates+"sensor.solar_energy":
+		w.Write(f.fixture("state.json"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeHA) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	conn, rw, err := w.(http.Hijacker).Hijack()
+	require.NoError(f.t, err)
+	defer conn.Close()
+
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	rw.WriteString("Upgrade: websocket\r\nConnection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + websocketAccept(r.Header.Get("Sec-Websocket-Key")) + "\r\n\r\n")
+	rw.Flush()
+
+	ws := &wsConn{conn: conn, r: rw.Reader}
+	send := func(v interface{}) {
+		data, err := json.Marshal(v)
+		require.NoError(f.t, err)
+		require.NoError(f.t, ws.WriteMessage(data))
+	}
+
+	send(map[string]string{"type": "auth_required", "ha_version": "2023.3.0"})
+
+	data, err := ws.ReadMessage()
+	require.NoError(f.t, err)
+
+	var auth map[string]string
+	require.NoError(f.t, json.Unmarshal(data, &auth))
+	if auth["access_token"] != testToken {
+		send(map[string]string{"type": "auth_invalid", "message": "Invalid access token or password"})
+		return
+	}
+	send(map[string]string{"type": "auth_ok"})
+
+	// ping the client before answering, to test that pings are answered
+	require.NoError(f.t, ws.writeFrame(opPing, []byte("ping")))
+
+	data, err = ws.ReadMessage()
+	require.NoError(f.t, err)
+
+	var cmd struct {
+		ID           int      `json:"id"`
+		Type         string   `json:"type"`
+		StatisticIDs []string `json:"statistic_ids"`
+		Period       string   `json:"period"`
+	}
+	require.NoError(f.t, json.Unmarshal(data, &cmd))
+
+	var all map[string]json.RawMessage
+	require.NoError(f.t, json.Unmarshal(f.fixture("statistics.json"), &all))
+
+	result := map[string]json.RawMessage{}
+	for _, id := range cmd.StatisticIDs {
+		if stats, ok := all[id]; ok {
+			result[id] = stats
+		}
+	}
+
+	// an unrelated event, which should be ignored
+	send(map[string]interface{}{"id": 99, "type": "event"})
+	send(map[string]interface{}{"id": cmd.ID, "type": "result", "success": true, "result": result})
+
+	ws.ReadMessage()
+}
@@ -0,0 +1,289 @@
+package homeassistant
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// websocket opcodes
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+const (
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	// maxMessageSize limits the size of messages read, statistics for many
+	// entities over a long period can be large
+	maxMessageSize = 64 << 20
+)
+
+// wsConn is a minimal RFC 6455 websocket connection, supporting just what is
+// needed to talk to Home Assistant's WebSocket API: text messages, pings and
+// closing
+type wsConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	// mask is true for client connections, which must mask their frames
+	mask bool
+}
+
+// websocketAccept returns the Sec-WebSocket-Accept value for given key
+func websocketAccept(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + websocketGUID))
+
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// dialWebsocket opens a websocket connection to given ws:// or wss:// URL
+func dialWebsocket(rawURL string, tlsConfig *tls.Config, timeout time.Duration) (*wsConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		switch u.Scheme {
+		case "wss":
+			host = net.JoinHostPort(u.Hostname(), "443")
+		default:
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "ws":
+		conn, err = dialer.Dial("tcp", host)
+	case "wss":
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, tlsConfig)
+	default:
+		return nil, fmt.Errorf("unsupported scheme %s", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Host:       u.Host,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-Websocket-Key":     {base64.StdEncoding.EncodeToString(key)},
+			"Sec-Websocket-Version": {"13"},
+		},
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, fmt.Errorf("websocket handshake failed: %s", resp.Status)
+	}
+	if resp.Header.Get("Sec-Websocket-Accept") != websocketAccept(req.Header.Get("Sec-Websocket-Key")) {
+		conn.Close()
+		return nil, errors.New("websocket handshake failed: invalid accept key")
+	}
+
+	return &wsConn{conn: conn, r: r, mask: true}, nil
+}
+
+// writeFrame writes a single, final frame
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	hdr := []byte{0x80 | opcode, 0}
+
+	length := len(payload)
+	switch {
+	case length < 126:
+		hdr[1] = byte(length)
+	case length <= 0xffff:
+		hdr[1] = 126
+		hdr = append(hdr, byte(length>>8), byte(length))
+	default:
+		hdr[1] = 127
+		ext := make([]byte, 8)
+		binary.BigEndian.PutUint64(ext, uint64(length))
+		hdr = append(hdr, ext...)
+	}
+
+	data := payload
+	if c.mask {
+		hdr[1] |= 0x80
+		key := make([]byte, 4)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		hdr = append(hdr, key...)
+
+		data = make([]byte, length)
+		for i, b := range payload {
+			data[i] = b ^ key[i%4]
+		}
+	}
+
+	_, err := c.conn.Write(append(hdr, data...))
+
+	return err
+}
+
+// readFrame reads a single frame
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	hdr := make([]byte, 2)
+	if _, err = io.ReadFull(c.r, hdr); err != nil {
+		return
+	}
+
+	fin = hdr[0]&0x80 != 0
+	opcode = hdr[0] & 0x0f
+	masked := hdr[1]&0x80 != 0
+
+	length := uint64(hdr[1] & 0x7f)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err = io.ReadFull(c.r, ext); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err = io.ReadFull(c.r, ext); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext)
+	}
+
+	if length > maxMessageSize {
+		err = errors.New("websocket frame too large")
+		return
+	}
+
+	var key []byte
+	if masked {
+		key = make([]byte, 4)
+		if _, err = io.ReadFull(c.r, key); err != nil {
+			return
+		}
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.r, payload); err != nil {
+		return
+	}
+
+	if masked {
+		for i := range payload {
+			payload[i] ^= key[i%4]
+		}
+	}
+
+	return
+}
+
+// WriteMessage writes given text message
+func (c *wsConn) WriteMessage(data []byte) error {
+	return c.writeFrame(opText, data)
+}
+
+// ReadMessage returns the next text or binary message, answering pings
+// along the way. It returns io.EOF when the peer closes the connection
+func (c *wsConn) ReadMessage() ([]byte, error) {
+	var message []byte
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			c.writeFrame(opClose, payload)
+			return nil, io.EOF
+		case opText, opBinary, opContinuation:
+			message = append(message, payload...)
+			if len(message) > maxMessageSize {
+				return nil, errors.New("websocket message too large")
+			}
+		default:
+			return nil, fmt.Errorf("unexpected websocket opcode %d", opcode)
+		}
+
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+// Close closes the connection, after telling the peer
+func (c *wsConn) Close() error {
+	c.writeFrame(opClose, []byte{0x03, 0xe8})
+
+	return c.conn.Close()
+}
+
+// websocketURL returns the URL of the WebSocket API for given base URL
+func websocketURL(baseURL string) string {
+	u := strings.TrimRight(baseURL, "/") + "/api/websocket"
+	switch {
+	case strings.HasPrefix(u, "https://"):
+		return "wss://" + strings.TrimPrefix(u, "https://")
+	case strings.HasPrefix(u, "http://"):
+		return "ws://" + strings.TrimPrefix(u, "http://")
+	}
+
+	return u
+}
@@ -0,0 +1,340 @@
+package influx
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skoef/pvoutput"
+)
+
+// Uploader uploads statuses and outputs, it is implemented by pvoutput.API
+type Uploader interface {
+	AddBatchStatus(b pvoutput.BatchStatus) error
+	AddOutput(o pvoutput.Output) error
+	AddBatchOutput(b pvoutput.BatchOutput) error
+}
+
+// DefaultFlushInterval is how long Forward keeps a status after its last
+// point by default
+const DefaultFlushInterval = time.Minute
+
+// Forwarder reads points in line protocol and uploads the statuses and
+// outputs among them. Points of the same measurement and time are merged
+// into a single status or output, other points are ignored
+type Forwarder struct {
+	Schema   Schema
+	Uploader Uploader
+	// Donating allows larger output batches
+	Donating bool
+	// FlushInterval is how long Forward keeps a status after its last point
+	// before uploading it, so later points of the same time are merged into
+	// it rather than uploaded separately
+	FlushInterval time.Duration
+	now           func() time.Time
+	ticker        func(d time.Duration) (<-chan time.Time, func())
+	// mu serialises uploads of concurrent writes
+	mu sync.Mutex
+}
+
+// NewForwarder returns a new Forwarder uploading to given Uploader
+func NewForwarder(u Uploader, s Schema, donating bool) *Forwarder {
+	return &Forwarder{
+		Schema:        s,
+		Uploader:      u,
+		Donating:      donating,
+		FlushInterval: DefaultFlushInterval,
+		now:           time.Now,
+		ticker: func(d time.Duration) (<-chan time.Time, func()) {
+			t := time.NewTicker(d)
+			return t.C, t.Stop
+		},
+	}
+}
+
+// batch collects the statuses and outputs to upload, merging those at the
+// same time
+type batch struct {
+	statuses map[time.Time]*pvoutput.Status
+	outputs  map[time.Time]*pvoutput.Output
+	// updated holds when a point was last added to each status
+	updated map[time.Time]time.Time
+}
+
+func newBatch() *batch {
+	return &batch{
+		statuses: map[time.Time]*pvoutput.Status{},
+		outputs:  map[time.Time]*pvoutput.Output{},
+		updated:  map[time.Time]time.Time{},
+	}
+}
+
+// add adds given point to the batch, when it is a status or output. Points
+// without time are taken to be at given time
+func (b *batch) add(s Schema, p Point, now time.Time) error {
+	if p.Time.IsZero() {
+		p.Time = now
+	}
+
+	switch {
+	case s.IsStatus(p):
+		st, err := s.Status(p)
+		if err != nil {
+			return err
+		}
+		b.updated[st.DateTime] = now
+		if existing, ok := b.statuses[st.DateTime]; ok {
+			_, err = applyStatus(p, existing)
+			return err
+		}
+		b.statuses[st.DateTime] = &st
+	case s.IsOutput(p):
+		o, err := s.Output(p)
+		if err != nil {
+			return err
+		}
+		if existing, ok := b.outputs[o.Date]; ok {
+			_, err = applyOutput(p, existing)
+			return err
+		}
+		b.outputs[o.Date] = &o
+	}
+
+	return nil
+}
+
+// size returns the number of statuses and outputs in the batch
+func (b *batch) size() int {
+	return len(b.statuses) + len(b.outputs)
+}
+
+// take removes the outputs and the statuses last updated before given time
+// from the batch and returns them in order. A zero time takes all statuses
+func (b *batch) take(before time.Time) (pvoutput.BatchStatus, pvoutput.BatchOutput) {
+	statuses := pvoutput.BatchStatus{}
+	for t, s := range b.statuses {
+		if !before.IsZero() && !b.updated[t].Before(before) {
+			continue
+		}
+		statuses = append(statuses, *s)
+		delete(b.statuses, t)
+		delete(b.updated, t)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].DateTime.Before(statuses[j].DateTime) })
+
+	outputs := pvoutput.BatchOutput{}
+	for _, o := range b.outputs {
+		outputs = append(outputs, *o)
+	}
+	sort.Slice(outputs, func(i, j int) bool { return outputs[i].Date.Before(outputs[j].Date) })
+	b.outputs = map[time.Time]*pvoutput.Output{}
+
+	return statuses, outputs
+}
+
+// upload uploads given statuses and outputs in batches as large as allowed
+func (f *Forwarder) upload(statuses pvoutput.BatchStatus, outputs pvoutput.BatchOutput) error {
+	for start := 0; start < len(statuses); start += pvoutput.BatchStatusMaxSize {
+		end := start + pvoutput.BatchStatusMaxSize
+		if end > len(statuses) {
+			end = len(statuses)
+		}
+
+		if err := f.Uploader.AddBatchStatus(statuses[start:end]); err != nil {
+			return err
+		}
+	}
+
+	return pvoutput.UploadOutputs(f.Uploader, outputs, f.Donating, nil)
+}
+
+// line is a line read by Forward, along with the error reading it
+type line struct {
+	text string
+	err  error
+}
+
+// readLines sends the lines read from given reader until it fails or stop
+// is closed. The last line is sent with the error ending the input
+func readLines(r io.Reader, lines chan<- line, stop <-chan struct{}) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	for {
+		text, err := br.ReadString('\n')
+		select {
+		case lines <- line{text: text, err: err}:
+		case <-stop:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Forward reads line protocol with timestamps of given precision from r
+// until EOF, so both files and slow streams like stdin can be forwarded.
+// Statuses are uploaded once no points were added to them for the
+// FlushInterval, or when a full batch is collected. An invalid line stops
+// the forwarding, after uploading what was read before it
+func (f *Forwarder) Forward(r io.Reader, precision Precision) error {
+	if _, err := precision.duration(); err != nil {
+		return err
+	}
+
+	interval := f.FlushInterval
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+	ticks, stopTicker := f.ticker(interval)
+	defer stopTicker()
+
+	lines := make(chan line)
+	stop := make(chan struct{})
+	defer close(stop)
+	go readLines(r, lines, stop)
+
+	b := newBatch()
+	lineNo := 0
+	for {
+		select {
+		case now := <-ticks:
+			if err := f.flush(b, now.Add(-interval)); err != nil {
+				return fmt.Errorf("could not upload: %s", err)
+			}
+		case l := <-lines:
+			if l.err != nil && l.err != io.EOF {
+				return l.err
+			}
+
+			lineNo++
+			if err := f.addLine(b, l.text, precision); err != nil {
+				if uploadErr := f.flush(b, time.Time{}); uploadErr != nil {
+					return fmt.Errorf("could not upload: %s", uploadErr)
+				}
+
+				return fmt.Errorf("line %d: %s", lineNo, err)
+			}
+
+			if l.err == io.EOF || b.size() >= pvoutput.BatchStatusMaxSize {
+				if err := f.flush(b, time.Time{}); err != nil {
+					return fmt.Errorf("could not upload: %s", err)
+				}
+			}
+
+			if l.err == io.EOF {
+				return nil
+			}
+		}
+	}
+}
+
+// addLine adds the point on given line to the batch, skipping empty lines
+// and comments
+func (f *Forwarder) addLine(b *batch, line string, precision Precision) error {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' {
+		return nil
+	}
+
+	p, err := ParseLine(line, precision)
+	if err != nil {
+		return err
+	}
+
+	return b.add(f.Schema, p, f.now())
+}
+
+// flush uploads the outputs and the statuses last updated before given time
+// in the batch, a zero time uploads all statuses
+func (f *Forwarder) flush(b *batch, before time.Time) error {
+	statuses, outputs := b.take(before)
+	if len(statuses) == 0 && len(outputs) == 0 {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.upload(statuses, outputs)
+}
+
+// writeError writes an error response like InfluxDB does
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"code": code, "message": message})
+}
+
+// ServeHTTP implements http.Handler, accepting writes like InfluxDB's
+// /api/v2/write endpoint does, including gzip compressed bodies and the
+// precision parameter. The org and bucket parameters are ignored. All lines
+// are parsed before anything is uploaded, so a write is either rejected as
+// a whole or uploaded
+func (f *Forwarder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed", "only POST is allowed")
+		return
+	}
+
+	precision := Precision(r.URL.Query().Get("precision"))
+	if _, err := precision.duration(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	body := io.Reader(r.Body)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid", "invalid gzip body")
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	b := newBatch()
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		if err := f.addLine(b, scanner.Text(), precision); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid", fmt.Sprintf("line %d: %s", lineNo, err))
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	if err := f.flush(b, time.Time{}); err != nil {
+		if errors.Is(err, pvoutput.ErrRateLimitExceeded) {
+			if rl, ok := f.Uploader.(pvoutput.RateLimited); ok {
+				if limit, known := rl.RateLimit(); known {
+					if wait := limit.Reset.Sub(f.now()); wait > 0 {
+						w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+					}
+				}
+			}
+			writeError(w, http.StatusTooManyRequests, "too many requests", "PVOutput's rate limit is exceeded")
+			return
+		}
+
+		writeError(w, http.StatusBadGateway, "internal error", fmt.Sprintf("could not upload: %s", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
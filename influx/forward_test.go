@@ -0,0 +1,230 @@
+package influx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skoef/pvoutput"
+	"github.com/skoef/pvoutput/internal/pvtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var forwardNow = time.Date(2026, 3, 1, 12, 32, 10, 0, time.UTC)
+
+func testForwarder(u *pvtest.Uploader, donating bool) *Forwarder {
+	s := NewSchema()
+	s.Location = time.UTC
+	f := NewForwarder(u, s, donating)
+	f.now = func() time.Time { return forwardNow }
+
+	return f
+}
+
+func TestForward(t *testing.T) {
+	u := &pvtest.Uploader{}
+	f := testForwarder(u, false)
+
+	input := strings.Join([]string{
+		"# written by a meter",
+		"pvoutput_status generating_w=1500i 1772368200",
+		"pvoutput_status temperature_c=12.5 1772368200",
+		"",
+		"pvoutput_status consuming_w=400i",
+		"cpu usage_idle=99.5 1772368200",
+		`pvoutput_output generated_wh=14000i,condition="Fine" 1772323200`,
+		"pvoutput_output peak_power_w=3100i 1772355600",
+	}, "\n")
+	require.NoError(t, f.Forward(strings.NewReader(input), PrecisionSeconds))
+
+	// points of the same time are merged, points without time are taken to
+	// be at the current time
+	require.Len(t, u.StatusBatches, 1)
+	require.Len(t, u.StatusBatches[0], 2)
+	assert.Equal(t, time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC), u.StatusBatches[0][0].DateTime)
+	assert.Equal(t, 1500, u.StatusBatches[0][0].Generating)
+	assert.Equal(t, 12.5, u.StatusBatches[0][0].Temperature)
+	assert.Equal(t, time.Date(2026, 3, 1, 12, 32, 0, 0, time.UTC), u.StatusBatches[0][1].DateTime)
+	assert.Equal(t, 400, u.StatusBatches[0][1].Consuming)
+
+	// outputs are uploaded one by one unless donating
+	require.Len(t, u.Outputs, 1)
+	assert.Empty(t, u.OutputBatches)
+	assert.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), u.Outputs[0].Date)
+	assert.Equal(t, 14000, u.Outputs[0].Generated)
+	assert.Equal(t, 3100, u.Outputs[0].PeakPower)
+	assert.Equal(t, "Fine", u.Outputs[0].Condition)
+}
+
+func TestForwardBatches(t *testing.T) {
+	u := &pvtest.Uploader{}
+	f := testForwarder(u, true)
+
+	b := strings.Builder{}
+	for i := 0; i < 65; i++ {
+		fmt.Fprintf(&b, "pvoutput_status generating_w=%di %d\n", i, 1772323200+i*300)
+	}
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&b, "pvoutput_output generated_wh=%di %d\n", i, 1772323200+i*86400)
+	}
+	require.NoError(t, f.Forward(strings.NewReader(b.String()), PrecisionSeconds))
+
+	sizes := []int{}
+	for _, batch := range u.StatusBatches {
+		sizes = append(sizes, len(batch))
+	}
+	assert.Equal(t, []int{30, 30, 5}, sizes)
+	assert.Equal(t, 64, u.StatusBatches[2][4].Generating)
+
+	require.Len(t, u.OutputBatches, 1)
+	assert.Len(t, u.OutputBatches[0], 3)
+	assert.Len(t, u.Outputs, 3)
+}
+
+// notifyingUploader passes uploaded status batches on over a channel
+type notifyingUploader struct {
+	pvtest.Uploader
+	batches chan pvoutput.BatchStatus
+}
+
+func (u *notifyingUploader) AddBatchStatus(b pvoutput.BatchStatus) error {
+	u.batches <- b
+
+	return nil
+}
+
+func TestForwardFlushInterval(t *testing.T) {
+	u := &notifyingUploader{batches: make(chan pvoutput.BatchStatus, 10)}
+	s := NewSchema()
+	s.Location = time.UTC
+	f := NewForwarder(u, s, false)
+	f.now = func() time.Time { return forwardNow }
+	ticks := make(chan time.Time)
+	f.ticker = func(time.Duration) (<-chan time.Time, func()) { return ticks, func() {} }
+
+	r, w := io.Pipe()
+	done := make(chan error)
+	go func() { done <- f.Forward(r, PrecisionSeconds) }()
+
+	// writing a line returns once the line before it is passed on, so
+	// ticks sent after it are received once that line is added
+	write := func(line string) {
+		_, err := io.WriteString(w, line+"\n")
+		require.NoError(t, err)
+	}
+	received := func() pvoutput.BatchStatus {
+		select {
+		case b := <-u.batches:
+			return b
+		case <-time.After(time.Second):
+			t.Fatal("no statuses uploaded")
+		}
+		return nil
+	}
+
+	// points of the same status written apart are kept until the flush
+	// interval passed without points
+	write("pvoutput_status generating_w=1500i 1772368200")
+	write("pvoutput_status temperature_c=12.5 1772368230")
+	write("# sync")
+	ticks <- forwardNow.Add(30 * time.Second)
+	ticks <- forwardNow.Add(30 * time.Second)
+	assert.Empty(t, u.batches)
+
+	ticks <- forwardNow.Add(90 * time.Second)
+	b := received()
+	if assert.Len(t, b, 1) {
+		assert.Equal(t, 1500, b[0].Generating)
+		assert.Equal(t, 12.5, b[0].Temperature)
+	}
+
+	// what is left is uploaded at the end of the input
+	write("pvoutput_status generating_w=1600i 1772368500")
+	require.NoError(t, w.Close())
+	require.NoError(t, <-done)
+	b = received()
+	if assert.Len(t, b, 1) {
+		assert.Equal(t, 1600, b[0].Generating)
+	}
+}
+
+func TestForwardErrors(t *testing.T) {
+	u := &pvtest.Uploader{}
+	f := testForwarder(u, false)
+
+	// what was read before an invalid line is uploaded
+	err := f.Forward(strings.NewReader("pvoutput_status generating_w=1500i 1772368200\npvoutput_status generating_w=\"high\" 1772368500\n"), PrecisionSeconds)
+	assert.EqualError(t, err, "line 2: field generating_w should be a number")
+	require.Len(t, u.StatusBatches, 1)
+	assert.Len(t, u.StatusBatches[0], 1)
+
+	u.Err = errors.New("Unauthorized 401: Invalid API Key")
+	err = f.Forward(strings.NewReader("pvoutput_status generating_w=1500i 1772368200\n"), PrecisionSeconds)
+	assert.EqualError(t, err, "could not upload: Unauthorized 401: Invalid API Key")
+
+	err = f.Forward(strings.NewReader(""), Precision("h"))
+	assert.EqualError(t, err, "unsupported precision h")
+}
+
+func TestServeHTTP(t *testing.T) {
+	u := &pvtest.Uploader{}
+	f := testForwarder(u, false)
+
+	write := func(method, query string, body []byte, gzipped bool) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/api/v2/write?org=home&bucket=solar"+query, bytes.NewReader(body))
+		if gzipped {
+			r.Header.Set("Content-Encoding", "gzip")
+		}
+		w := httptest.NewRecorder()
+		f.ServeHTTP(w, r)
+
+		return w
+	}
+
+	w := write(http.MethodGet, "", nil, false)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, http.MethodPost, w.Header().Get("Allow"))
+
+	// a write with an invalid line is rejected as a whole
+	w = write(http.MethodPost, "&precision=s", []byte("pvoutput_status generating_w=1500i 1772368200\npvoutput_status,broken generating_w=1i\n"), false)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"code":"invalid","message":"line 2: invalid tag broken"}`, w.Body.String())
+	assert.Empty(t, u.StatusBatches)
+
+	w = write(http.MethodPost, "&precision=h", nil, false)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"code":"invalid","message":"unsupported precision h"}`, w.Body.String())
+
+	w = write(http.MethodPost, "", []byte("not gzip"), true)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	gzipped := bytes.Buffer{}
+	gz := gzip.NewWriter(&gzipped)
+	_, err := gz.Write([]byte("pvoutput_status generating_w=1500i 1772368200000\n"))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	w = write(http.MethodPost, "&precision=ms", gzipped.Bytes(), true)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	require.Len(t, u.StatusBatches, 1)
+	assert.Equal(t, 1500, u.StatusBatches[0][0].Generating)
+
+	u.Err = pvoutput.ErrRateLimitExceeded
+	u.Limit = pvoutput.RateLimit{Reset: forwardNow.Add(90 * time.Second)}
+	w = write(http.MethodPost, "&precision=s", []byte("pvoutput_status generating_w=1500i 1772368200\n"), false)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "91", w.Header().Get("Retry-After"))
+
+	u.Err = errors.New("Bad request 400: Date is older than 14 days")
+	w = write(http.MethodPost, "&precision=s", []byte("pvoutput_status generating_w=1500i 1772368200\n"), false)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.JSONEq(t, `{"code":"internal error","message":"could not upload: Bad request 400: Date is older than 14 days"}`, w.Body.String())
+}
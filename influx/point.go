@@ -0,0 +1,241 @@
+// Package influx converts statuses and outputs to and from InfluxDB's line
+// protocol, as described on
+// https://docs.influxdata.com/influxdb/v2/reference/syntax/line-protocol/,
+// and forwards points written in line protocol to PVOutput
+package influx
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Precision is the unit of the timestamps in line protocol
+type Precision string
+
+// Supported precisions, the short forms of InfluxDB 1.x are accepted too
+const (
+	PrecisionNanoseconds  Precision = "ns"
+	PrecisionMicroseconds Precision = "us"
+	PrecisionMilliseconds Precision = "ms"
+	PrecisionSeconds      Precision = "s"
+)
+
+// duration returns the duration of a single timestamp unit
+func (p Precision) duration() (time.Duration, error) {
+	switch p {
+	case PrecisionNanoseconds, "n", "":
+		return time.Nanosecond, nil
+	case PrecisionMicroseconds, "u":
+		return time.Microsecond, nil
+	case PrecisionMilliseconds:
+		return time.Millisecond, nil
+	case PrecisionSeconds:
+		return time.Second, nil
+	}
+
+	return 0, fmt.Errorf("unsupported precision %s", p)
+}
+
+// Point is a single point in line protocol. Field values are int64,
+// float64, string or bool
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]interface{}
+	// Time is zero when the point has no timestamp
+	Time time.Time
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `)
+	keyEscaper         = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `)
+	stringEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+// sortedKeys returns the keys of given map in order
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Encode returns the point as line in line protocol, without newline.
+// Tags and fields are sorted by key and the timestamp is written with given
+// precision
+func (p Point) Encode(precision Precision) (string, error) {
+	if p.Measurement == "" {
+		return "", errors.New("measurement is required")
+	}
+	if len(p.Fields) == 0 {
+		return "", errors.New("at least one field is required")
+	}
+
+	unit, err := precision.duration()
+	if err != nil {
+		return "", err
+	}
+
+	b := strings.Builder{}
+	b.WriteString(measurementEscaper.Replace(p.Measurement))
+	for _, k := range sortedKeys(p.Tags) {
+		fmt.Fprintf(&b, ",%s=%s", keyEscaper.Replace(k), keyEscaper.Replace(p.Tags[k]))
+	}
+
+	fieldKeys := []string{}
+	for k := range p.Fields {
+		fieldKeys = append(fieldKeys, k)
+	}
+	sort.Strings(fieldKeys)
+
+	for i, k := range fieldKeys {
+		sep := ","
+		if i == 0 {
+			sep = " "
+		}
+
+		var value string
+		switch v := p.Fields[k].(type) {
+		case int64:
+			value = strconv.FormatInt(v, 10) + "i"
+		case int:
+			value = strconv.Itoa(v) + "i"
+		case float64:
+			value = strconv.FormatFloat(v, 'f', -1, 64)
+		case string:
+			value = `"` + stringEscaper.Replace(v) + `"`
+		case bool:
+			value = strconv.FormatBool(v)
+		default:
+			return "", fmt.Errorf("unsupported value of field %s", k)
+		}
+
+		fmt.Fprintf(&b, "%s%s=%s", sep, keyEscaper.Replace(k), value)
+	}
+
+	if !p.Time.IsZero() {
+		fmt.Fprintf(&b, " %d", p.Time.UnixNano()/int64(unit))
+	}
+
+	return b.String(), nil
+}
+
+// split splits s at every unescaped occurrence of sep, outside double quotes
+// when quoted is set. Escapes are kept
+func split(s string, sep byte, quoted bool) []string {
+	parts := []string{}
+	inQuotes := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '"' && quoted:
+			inQuotes = !inQuotes
+		case s[i] == sep && !inQuotes:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+// unescape removes the backslashes escaping given characters
+func unescape(s, chars string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(chars, s[i+1]) >= 0 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
+
+// parseValue parses a field value
+func parseValue(s string) (interface{}, error) {
+	switch {
+	case len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"':
+		return unescape(s[1:len(s)-1], `"\`), nil
+	case strings.HasSuffix(s, "i"):
+		return strconv.ParseInt(strings.TrimSuffix(s, "i"), 10, 64)
+	case strings.HasSuffix(s, "u"):
+		v, err := strconv.ParseUint(strings.TrimSuffix(s, "u"), 10, 63)
+		return int64(v), err
+	}
+
+	switch s {
+	case "t", "T", "true", "True", "TRUE":
+		return true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return false, nil
+	}
+
+	return strconv.ParseFloat(s, 64)
+}
+
+// ParseLine parses a single line of line protocol with timestamps of given
+// precision
+func ParseLine(line string, precision Precision) (Point, error) {
+	p := Point{Tags: map[string]string{}, Fields: map[string]interface{}{}}
+
+	unit, err := precision.duration()
+	if err != nil {
+		return p, err
+	}
+
+	parts := split(strings.TrimSpace(line), ' ', true)
+	if len(parts) < 2 || len(parts) > 3 {
+		return p, errors.New("expected measurement, fields and optional timestamp")
+	}
+
+	series := split(parts[0], ',', false)
+	p.Measurement = unescape(series[0], `, `)
+	if p.Measurement == "" {
+		return p, errors.New("missing measurement")
+	}
+	for _, tag := range series[1:] {
+		kv := split(tag, '=', false)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return p, fmt.Errorf("invalid tag %s", tag)
+		}
+		p.Tags[unescape(kv[0], `,= `)] = unescape(kv[1], `,= `)
+	}
+
+	for _, field := range split(parts[1], ',', true) {
+		kv := split(field, '=', true)
+		if len(kv) != 2 || kv[0] == "" {
+			return p, fmt.Errorf("invalid field %s", field)
+		}
+
+		key := unescape(kv[0], `,= `)
+		v, err := parseValue(kv[1])
+		if err != nil {
+			return p, fmt.Errorf("invalid value of field %s", key)
+		}
+		p.Fields[key] = v
+	}
+
+	if len(parts) == 3 {
+		ts, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil {
+			return p, fmt.Errorf("invalid timestamp %s", parts[2])
+		}
+		p.Time = time.Unix(0, ts*int64(unit))
+	}
+
+	return p, nil
+}
@@ -0,0 +1,92 @@
+package influx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPointEncode(t *testing.T) {
+	p := Point{
+		Measurement: "solar power",
+		Tags:        map[string]string{"site": "roof,east", "system": "1234"},
+		Fields: map[string]interface{}{
+			"generating_w": int64(1500),
+			"voltage_v":    230.1,
+			"condition":    `partly "cloudy"`,
+			"online":       true,
+		},
+		Time: time.Unix(1600000000, 0),
+	}
+
+	line, err := p.Encode(PrecisionSeconds)
+	require.NoError(t, err)
+	assert.Equal(t, `solar\ power,site=roof\,east,system=1234 condition="partly \"cloudy\"",generating_w=1500i,online=true,voltage_v=230.1 1600000000`, line)
+
+	line, err = p.Encode(PrecisionNanoseconds)
+	require.NoError(t, err)
+	assert.Contains(t, line, " 1600000000000000000")
+
+	// the timestamp is left out when not set
+	p.Time = time.Time{}
+	line, err = p.Encode(PrecisionSeconds)
+	require.NoError(t, err)
+	assert.Equal(t, `solar\ power,site=roof\,east,system=1234 condition="partly \"cloudy\"",generating_w=1500i,online=true,voltage_v=230.1`, line)
+
+	_, err = Point{Fields: p.Fields}.Encode(PrecisionSeconds)
+	assert.EqualError(t, err, "measurement is required")
+	_, err = Point{Measurement: "m"}.Encode(PrecisionSeconds)
+	assert.EqualError(t, err, "at least one field is required")
+	_, err = p.Encode(Precision("h"))
+	assert.EqualError(t, err, "unsupported precision h")
+	_, err = Point{Measurement: "m", Fields: map[string]interface{}{"f": []int{1}}}.Encode(PrecisionSeconds)
+	assert.EqualError(t, err, "unsupported value of field f")
+}
+
+func TestParseLine(t *testing.T) {
+	p, err := ParseLine(`solar\ power,site=roof\,east,system=1234 condition="partly \"cloudy\", windy",generating_w=1500i,online=t,voltage_v=230.1,count=3u 1600000000000`, PrecisionMilliseconds)
+	require.NoError(t, err)
+	assert.Equal(t, Point{
+		Measurement: "solar power",
+		Tags:        map[string]string{"site": "roof,east", "system": "1234"},
+		Fields: map[string]interface{}{
+			"generating_w": int64(1500),
+			"voltage_v":    230.1,
+			"condition":    `partly "cloudy", windy`,
+			"online":       true,
+			"count":        int64(3),
+		},
+		Time: time.Unix(1600000000, 0),
+	}, p)
+
+	// encoding and parsing round trip
+	line, err := p.Encode(PrecisionNanoseconds)
+	require.NoError(t, err)
+	parsed, err := ParseLine(line, "")
+	require.NoError(t, err)
+	assert.Equal(t, p, parsed)
+
+	p, err = ParseLine("m f=1", PrecisionSeconds)
+	require.NoError(t, err)
+	assert.True(t, p.Time.IsZero())
+	assert.Equal(t, 1.0, p.Fields["f"])
+
+	for line, msg := range map[string]string{
+		"m":             "expected measurement, fields and optional timestamp",
+		"m f=1 1 2":     "expected measurement, fields and optional timestamp",
+		",t=1 f=1":      "missing measurement",
+		"m,t f=1":       "invalid tag t",
+		"m f":           "invalid field f",
+		"m f=abc":       "invalid value of field f",
+		"m f=1 yes":     "invalid timestamp yes",
+		`m f="unclosed`: "invalid value of field f",
+	} {
+		_, err := ParseLine(line, PrecisionSeconds)
+		assert.EqualError(t, err, msg, line)
+	}
+
+	_, err = ParseLine("m f=1", Precision("h"))
+	assert.EqualError(t, err, "unsupported precision h")
+}
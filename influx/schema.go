@@ -0,0 +1,337 @@
+package influx
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/skoef/pvoutput"
+)
+
+// Default measurements of statuses and outputs
+const (
+	DefaultStatusMeasurement = "pvoutput_status"
+	DefaultOutputMeasurement = "pvoutput_output"
+)
+
+// Schema determines how statuses and outputs are written as points and
+// which points are read as statuses and outputs. Field names are the keys
+// of their JSON representation, like generated_wh
+type Schema struct {
+	StatusMeasurement string
+	OutputMeasurement string
+	// Tags are added to every point written, points read should have them
+	// as well to be taken into account
+	Tags map[string]string
+	// Location is the time zone the dates of outputs are in, the local time
+	// zone by default
+	Location *time.Location
+}
+
+// NewSchema returns a new Schema with default measurements and no tags
+func NewSchema() Schema {
+	return Schema{
+		StatusMeasurement: DefaultStatusMeasurement,
+		OutputMeasurement: DefaultOutputMeasurement,
+		Tags:              map[string]string{},
+		Location:          time.Local,
+	}
+}
+
+// statusInts returns the integer fields of given status by name
+func statusInts(s *pvoutput.Status) map[string]*int {
+	return map[string]*int{
+		"generated_wh": &s.Generated,
+		"generating_w": &s.Generating,
+		"consumed_wh":  &s.Consumed,
+		"consuming_w":  &s.Consuming,
+	}
+}
+
+// statusFloats returns the float fields of given status by name
+func statusFloats(s *pvoutput.Status) map[string]*float64 {
+	return map[string]*float64{
+		"normalised_output_kw_per_kw": &s.Output,
+		"temperature_c":               &s.Temperature,
+		"voltage_v":                   &s.Voltage,
+		"v7":                          &s.Extended[0],
+		"v8":                          &s.Extended[1],
+		"v9":                          &s.Extended[2],
+		"v10":                         &s.Extended[3],
+		"v11":                         &s.Extended[4],
+		"v12":                         &s.Extended[5],
+	}
+}
+
+// outputInts returns the integer fields of given output by name
+func outputInts(o *pvoutput.Output) map[string]*int {
+	return map[string]*int{
+		"generated_wh":            &o.Generated,
+		"exported_wh":             &o.Exported,
+		"peak_power_w":            &o.PeakPower,
+		"import_peak_wh":          &o.ImportPeak,
+		"import_off_peak_wh":      &o.ImportOffPeak,
+		"import_shoulder_wh":      &o.ImportShoulder,
+		"import_high_shoulder_wh": &o.ImportHighShoulder,
+		"consumed_wh":             &o.Consumed,
+		"export_peak_wh":          &o.ExportPeak,
+		"export_off_peak_wh":      &o.ExportOffPeak,
+		"export_shoulder_wh":      &o.ExportShoulder,
+		"export_high_shoulder_wh": &o.ExportHighShoulder,
+		"insolation_wh":           &o.Insolation,
+	}
+}
+
+// outputFloats returns the float fields of given output by name
+func outputFloats(o *pvoutput.Output) map[string]*float64 {
+	return map[string]*float64{
+		"efficiency_kwh_per_kw": &o.Efficiency,
+		"min_temperature_c":     &o.MinTemp,
+		"max_temperature_c":     &o.MaxTemp,
+	}
+}
+
+// outputStrings returns the string fields of given output by name
+func outputStrings(o *pvoutput.Output) map[string]*string {
+	return map[string]*string{
+		"condition": &o.Condition,
+		"comments":  &o.Comments,
+	}
+}
+
+// point returns a new point of given measurement with the schema's tags
+func (s Schema) point(measurement string, t time.Time) Point {
+	p := Point{
+		Measurement: measurement,
+		Tags:        map[string]string{},
+		Fields:      map[string]interface{}{},
+		Time:        t,
+	}
+	for k, v := range s.Tags {
+		p.Tags[k] = v
+	}
+
+	return p
+}
+
+// matches tells if given point has given measurement and the schema's tags
+func (s Schema) matches(p Point, measurement string) bool {
+	if p.Measurement != measurement {
+		return false
+	}
+	for k, v := range s.Tags {
+		if p.Tags[k] != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// addFields adds the set integer and float fields to given point
+func addFields(p Point, ints map[string]*int, floats map[string]*float64) {
+	for name, v := range ints {
+		if *v != pvoutput.UnsetInt {
+			p.Fields[name] = int64(*v)
+		}
+	}
+	for name, v := range floats {
+		if *v != pvoutput.UnsetFloat {
+			p.Fields[name] = *v
+		}
+	}
+}
+
+// readFields sets the integer and float fields found in given point. Number
+// fields are accepted for both, integer fields are rounded
+func readFields(p Point, ints map[string]*int, floats map[string]*float64) (int, error) {
+	found := 0
+	for name, dst := range ints {
+		v, ok := p.Fields[name]
+		if !ok {
+			continue
+		}
+
+		switch v := v.(type) {
+		case int64:
+			*dst = int(v)
+		case float64:
+			*dst = int(math.Round(v))
+		default:
+			return found, fmt.Errorf("field %s should be a number", name)
+		}
+		found++
+	}
+
+	for name, dst := range floats {
+		v, ok := p.Fields[name]
+		if !ok {
+			continue
+		}
+
+		switch v := v.(type) {
+		case int64:
+			*dst = float64(v)
+		case float64:
+			*dst = v
+		default:
+			return found, fmt.Errorf("field %s should be a number", name)
+		}
+		found++
+	}
+
+	return found, nil
+}
+
+// StatusPoint returns the point of given status. Unset fields are left
+// out, Cumulative is written as integer field cumulative
+func (s Schema) StatusPoint(st pvoutput.Status) (Point, error) {
+	if st.DateTime.IsZero() {
+		return Point{}, errors.New("DateTime is required on Status")
+	}
+
+	p := s.point(s.StatusMeasurement, st.DateTime)
+	addFields(p, statusInts(&st), statusFloats(&st))
+	if st.Cumulative != pvoutput.StatusCumulativeUnset {
+		p.Fields["cumulative"] = int64(st.Cumulative)
+	}
+
+	return p, nil
+}
+
+// IsStatus tells if given point is a status according to the schema
+func (s Schema) IsStatus(p Point) bool {
+	return s.matches(p, s.StatusMeasurement)
+}
+
+// applyStatus sets the fields found in given point on given status
+func applyStatus(p Point, st *pvoutput.Status) (int, error) {
+	found, err := readFields(p, statusInts(st), statusFloats(st))
+	if err != nil {
+		return found, err
+	}
+
+	if v, ok := p.Fields["cumulative"]; ok {
+		c, isInt := v.(int64)
+		if !isInt {
+			return found, errors.New("field cumulative should be an integer")
+		}
+		st.Cumulative = pvoutput.StatusCumulative(c)
+	}
+
+	return found, nil
+}
+
+// Status returns the status of given point, whose time should be set.
+// Fields that are not part of a status are ignored, but at least one
+// should be
+func (s Schema) Status(p Point) (pvoutput.Status, error) {
+	st := pvoutput.NewStatus()
+	if p.Time.IsZero() {
+		return st, errors.New("time is required")
+	}
+	st.DateTime = p.Time.In(s.location()).Truncate(time.Minute)
+
+	found, err := applyStatus(p, &st)
+	if err != nil {
+		return st, err
+	}
+	if found == 0 {
+		return st, errors.New("no status fields")
+	}
+
+	return st, nil
+}
+
+// OutputPoint returns the point of given output, at the start of its date.
+// Unset fields are left out, PeakTime is written as string field peak_time
+// formatted as 15:04
+func (s Schema) OutputPoint(o pvoutput.Output) (Point, error) {
+	if o.Date.IsZero() {
+		return Point{}, errors.New("date is required on Output")
+	}
+
+	y, m, d := o.Date.Date()
+	p := s.point(s.OutputMeasurement, time.Date(y, m, d, 0, 0, 0, 0, s.location()))
+	addFields(p, outputInts(&o), outputFloats(&o))
+	for name, v := range outputStrings(&o) {
+		if *v != "" && *v != pvoutput.UnsetString {
+			p.Fields[name] = *v
+		}
+	}
+	if !o.PeakTime.IsZero() {
+		p.Fields["peak_time"] = o.PeakTime.Format("15:04")
+	}
+
+	return p, nil
+}
+
+// IsOutput tells if given point is an output according to the schema
+func (s Schema) IsOutput(p Point) bool {
+	return s.matches(p, s.OutputMeasurement)
+}
+
+// applyOutput sets the fields found in given point on given output
+func applyOutput(p Point, o *pvoutput.Output) (int, error) {
+	found, err := readFields(p, outputInts(o), outputFloats(o))
+	if err != nil {
+		return found, err
+	}
+
+	for name, dst := range outputStrings(o) {
+		if v, ok := p.Fields[name]; ok {
+			str, isString := v.(string)
+			if !isString {
+				return found, fmt.Errorf("field %s should be a string", name)
+			}
+			*dst = str
+			found++
+		}
+	}
+
+	if v, ok := p.Fields["peak_time"]; ok {
+		str, _ := v.(string)
+		t, err := time.Parse("15:04", str)
+		if err != nil {
+			return found, errors.New("field peak_time should be formatted as 15:04")
+		}
+		o.PeakTime = t
+		found++
+	}
+
+	return found, nil
+}
+
+// Output returns the output of given point, whose time should be set. The
+// output's date is the date of the point's time in the schema's location.
+// Fields that are not part of an output are ignored, but at least one
+// should be
+func (s Schema) Output(p Point) (pvoutput.Output, error) {
+	o := pvoutput.NewOutput()
+	if p.Time.IsZero() {
+		return o, errors.New("time is required")
+	}
+
+	y, m, d := p.Time.In(s.location()).Date()
+	o.Date = time.Date(y, m, d, 0, 0, 0, 0, s.location())
+
+	found, err := applyOutput(p, &o)
+	if err != nil {
+		return o, err
+	}
+	if found == 0 {
+		return o, errors.New("no output fields")
+	}
+
+	return o, nil
+}
+
+// location returns the schema's location, defaulting to the local time zone
+func (s Schema) location() *time.Location {
+	if s.Location == nil {
+		return time.Local
+	}
+
+	return s.Location
+}
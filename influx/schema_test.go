@@ -0,0 +1,127 @@
+package influx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skoef/pvoutput"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var amsterdam = time.FixedZone("CET", 3600)
+
+func testSchema() Schema {
+	s := NewSchema()
+	s.Tags["system"] = "1234"
+	s.Location = amsterdam
+
+	return s
+}
+
+func TestStatusPoint(t *testing.T) {
+	s := testSchema()
+
+	st := pvoutput.NewStatus()
+	st.DateTime = time.Date(2026, 3, 1, 12, 30, 0, 0, amsterdam)
+	st.Generated = 10000
+	st.Generating = 1500
+	st.Temperature = 12.5
+	st.Cumulative = pvoutput.StatusCumulativeGenerating
+	st.Extended[0] = 3.25
+
+	p, err := s.StatusPoint(st)
+	require.NoError(t, err)
+	line, err := p.Encode(PrecisionSeconds)
+	require.NoError(t, err)
+	assert.Equal(t, "pvoutput_status,system=1234 cumulative=2i,generated_wh=10000i,generating_w=1500i,temperature_c=12.5,v7=3.25 1772364600", line)
+
+	assert.True(t, s.IsStatus(p))
+	assert.False(t, s.IsOutput(p))
+
+	decoded, err := s.Status(p)
+	require.NoError(t, err)
+	assert.Equal(t, st, decoded)
+
+	_, err = s.StatusPoint(pvoutput.NewStatus())
+	assert.EqualError(t, err, "DateTime is required on Status")
+}
+
+func TestStatus(t *testing.T) {
+	s := testSchema()
+
+	// floats are accepted for integer fields, unknown fields are ignored and
+	// the time is truncated to the minute
+	p, err := ParseLine("pvoutput_status,system=1234 generating_w=1499.6,consuming_w=300i,rssi=-60 1772364615", PrecisionSeconds)
+	require.NoError(t, err)
+	st, err := s.Status(p)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 3, 1, 12, 30, 0, 0, amsterdam), st.DateTime)
+	assert.Equal(t, 1500, st.Generating)
+	assert.Equal(t, 300, st.Consuming)
+	assert.Equal(t, -1, st.Generated)
+
+	// only points with the schema's measurement and tags are statuses
+	p.Tags["system"] = "5678"
+	assert.False(t, s.IsStatus(p))
+
+	for line, msg := range map[string]string{
+		"pvoutput_status generating_w=1500i":                    "time is required",
+		"pvoutput_status rssi=-60 1772364615":                   "no status fields",
+		`pvoutput_status generating_w="high" 1772364615`:        "field generating_w should be a number",
+		"pvoutput_status cumulative=1.5,v7=1 1772364615":        "field cumulative should be an integer",
+		`pvoutput_status temperature_c=true 1772364615`:         "field temperature_c should be a number",
+		`pvoutput_status generating_w=1,voltage_v=t 1772364615`: "field voltage_v should be a number",
+	} {
+		p, err := ParseLine(line, PrecisionSeconds)
+		require.NoError(t, err, line)
+		_, err = s.Status(p)
+		assert.EqualError(t, err, msg, line)
+	}
+}
+
+func TestOutputPoint(t *testing.T) {
+	s := testSchema()
+	s.OutputMeasurement = "daily"
+
+	o := pvoutput.NewOutput()
+	o.Date = time.Date(2026, 3, 1, 0, 0, 0, 0, amsterdam)
+	o.Generated = 14000
+	o.PeakPower = 3100
+	o.PeakTime = time.Date(0, 1, 1, 12, 5, 0, 0, time.UTC)
+	o.Condition = "Fine"
+	o.MaxTemp = 14.5
+
+	p, err := s.OutputPoint(o)
+	require.NoError(t, err)
+	line, err := p.Encode(PrecisionSeconds)
+	require.NoError(t, err)
+	assert.Equal(t, `daily,system=1234 condition="Fine",generated_wh=14000i,max_temperature_c=14.5,peak_power_w=3100i,peak_time="12:05" 1772319600`, line)
+
+	assert.True(t, s.IsOutput(p))
+	decoded, err := s.Output(p)
+	require.NoError(t, err)
+	assert.Equal(t, o, decoded)
+
+	// any time on the day gives its output
+	p.Time = p.Time.Add(23 * time.Hour)
+	decoded, err = s.Output(p)
+	require.NoError(t, err)
+	assert.Equal(t, o.Date, decoded.Date)
+
+	_, err = s.OutputPoint(pvoutput.NewOutput())
+	assert.EqualError(t, err, "date is required on Output")
+
+	for line, msg := range map[string]string{
+		"daily generated_wh=1i":                  "time is required",
+		"daily other=1i 1772319600":              "no output fields",
+		"daily condition=1i 1772319600":          "field condition should be a string",
+		`daily peak_time="noon" 1772319600`:      "field peak_time should be formatted as 15:04",
+		`daily min_temperature_c="1" 1772319600`: "field min_temperature_c should be a number",
+	} {
+		p, err := ParseLine(line, PrecisionSeconds)
+		require.NoError(t, err, line)
+		_, err = s.Output(p)
+		assert.EqualError(t, err, msg, line)
+	}
+}
@@ -0,0 +1,138 @@
+// Package pvtest holds the fake uploader and the statuses and outputs shared
+// by the tests of the packages in this module
+package pvtest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/skoef/pvoutput"
+)
+
+// Uploader records uploads. When Err is set, it fails every upload after
+// the first FailAfter
+type Uploader struct {
+	// Statuses holds every uploaded status, including those in batches
+	Statuses      []pvoutput.Status
+	StatusBatches []pvoutput.BatchStatus
+	// Outputs holds every uploaded output, including those in batches
+	Outputs       []pvoutput.Output
+	OutputBatches []pvoutput.BatchOutput
+	Err           error
+	FailAfter     int
+	// Limit is returned by RateLimit, known once its Reset is set
+	Limit   pvoutput.RateLimit
+	uploads int
+	mu      sync.Mutex
+}
+
+// upload counts an upload, or returns Err when it should fail
+func (u *Uploader) upload() error {
+	if u.Err != nil && u.uploads >= u.FailAfter {
+		return u.Err
+	}
+	u.uploads++
+
+	return nil
+}
+
+// AddStatus records given status
+func (u *Uploader) AddStatus(s pvoutput.Status) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if err := u.upload(); err != nil {
+		return err
+	}
+	u.Statuses = append(u.Statuses, s)
+
+	return nil
+}
+
+// AddBatchStatus records given batch and its statuses
+func (u *Uploader) AddBatchStatus(b pvoutput.BatchStatus) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if err := u.upload(); err != nil {
+		return err
+	}
+	u.StatusBatches = append(u.StatusBatches, b)
+	u.Statuses = append(u.Statuses, b...)
+
+	return nil
+}
+
+// AddOutput records given output
+func (u *Uploader) AddOutput(o pvoutput.Output) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if err := u.upload(); err != nil {
+		return err
+	}
+	u.Outputs = append(u.Outputs, o)
+
+	return nil
+}
+
+// AddBatchOutput records given batch and its outputs
+func (u *Uploader) AddBatchOutput(b pvoutput.BatchOutput) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if err := u.upload(); err != nil {
+		return err
+	}
+	u.OutputBatches = append(u.OutputBatches, b)
+	u.Outputs = append(u.Outputs, b...)
+
+	return nil
+}
+
+// RateLimit returns Limit, which is known once its Reset is set
+func (u *Uploader) RateLimit() (pvoutput.RateLimit, bool) {
+	return u.Limit, !u.Limit.Reset.IsZero()
+}
+
+// StatusAt returns a status at given time, generating given power
+func StatusAt(t time.Time, generating int) pvoutput.Status {
+	s := pvoutput.NewStatus()
+	s.DateTime = t
+	s.Generating = generating
+
+	return s
+}
+
+// OutputOn returns an output of given date, with given energy generated
+func OutputOn(date time.Time, generated int) pvoutput.Output {
+	o := pvoutput.NewOutput()
+	o.Date = date
+	o.Generated = generated
+
+	return o
+}
+
+// Statuses returns count statuses interval apart from given time. The i-th
+// status has generated 10*i Wh and is generating 100+i W
+func Statuses(start time.Time, interval time.Duration, count int) pvoutput.BatchStatus {
+	b := pvoutput.BatchStatus{}
+	for i := 0; i < count; i++ {
+		s := StatusAt(start.Add(time.Duration(i)*interval), 100+i)
+		s.Generated = 10 * i
+		b = append(b, s)
+	}
+
+	return b
+}
+
+// Outputs returns count daily outputs from given date. The i-th output has
+// generated 1000+i Wh
+func Outputs(start time.Time, count int) pvoutput.BatchOutput {
+	b := pvoutput.BatchOutput{}
+	for i := 0; i < count; i++ {
+		b = append(b, OutputOn(start.AddDate(0, 0, i), 1000+i))
+	}
+
+	return b
+}
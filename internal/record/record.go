@@ -0,0 +1,224 @@
+// Package record holds the records the pvoutput command prints and exports:
+// the fields of statuses, outputs and other data of PVOutput in a fixed
+// order. Fields of statuses and outputs are named like in their JSON encoding
+package record
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/skoef/pvoutput"
+)
+
+// Field is a single named value of a record. A nil value is not set
+type Field struct {
+	Name  string
+	Value interface{}
+}
+
+// Text returns the value of the field as printed in tables and CSV, unset
+// values are empty
+func (f Field) Text() string {
+	switch v := f.Value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+
+	return fmt.Sprintf("%v", f.Value)
+}
+
+// Record is a row of fields, in the order they are printed
+type Record []Field
+
+// Names returns the names of the fields of the record
+func (r Record) Names() []string {
+	names := []string{}
+	for _, f := range r {
+		names = append(names, f.Name)
+	}
+
+	return names
+}
+
+// MarshalJSON encodes the record as object, keeping the order of its fields
+// and leaving out fields that are not set
+func (r Record) MarshalJSON() ([]byte, error) {
+	buf := bytes.Buffer{}
+	buf.WriteByte('{')
+
+	first := true
+	for _, f := range r {
+		if f.Value == nil {
+			continue
+		}
+
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+
+		key, err := json.Marshal(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(f.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// optInt returns given value, or nil when it is unset
+func optInt(v int) interface{} {
+	if v == pvoutput.UnsetInt {
+		return nil
+	}
+
+	return v
+}
+
+// optFloat returns given value, or nil when it is unset
+func optFloat(v float64) interface{} {
+	if v == pvoutput.UnsetFloat {
+		return nil
+	}
+
+	return v
+}
+
+// optString returns given value, or nil when it is unset or empty
+func optString(v string) interface{} {
+	if v == "" || v == pvoutput.UnsetString {
+		return nil
+	}
+
+	return v
+}
+
+// optDate returns given date formatted as 2006-01-02, or nil when zero
+func optDate(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+
+	return t.Format("2006-01-02")
+}
+
+// optClock returns given time of day formatted as 15:04, or nil when zero
+func optClock(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+
+	return t.Format("15:04")
+}
+
+// Status returns the record of given status
+func Status(s pvoutput.Status) Record {
+	return Record{
+		{"date", optDate(s.DateTime)},
+		{"time", optClock(s.DateTime)},
+		{"generated_wh", optInt(s.Generated)},
+		{"generating_w", optInt(s.Generating)},
+		{"consumed_wh", optInt(s.Consumed)},
+		{"consuming_w", optInt(s.Consuming)},
+		{"normalised_output_kw_per_kw", optFloat(s.Output)},
+		{"temperature_c", optFloat(s.Temperature)},
+		{"voltage_v", optFloat(s.Voltage)},
+	}
+}
+
+// Output returns the record of given output
+func Output(o pvoutput.Output) Record {
+	return Record{
+		{"date", optDate(o.Date)},
+		{"generated_wh", optInt(o.Generated)},
+		{"efficiency_kwh_per_kw", optFloat(o.Efficiency)},
+		{"exported_wh", optInt(o.Exported)},
+		{"consumed_wh", optInt(o.Consumed)},
+		{"peak_power_w", optInt(o.PeakPower)},
+		{"peak_time", optClock(o.PeakTime)},
+		{"condition", optString(o.Condition)},
+		{"min_temperature_c", optFloat(o.MinTemp)},
+		{"max_temperature_c", optFloat(o.MaxTemp)},
+		{"import_peak_wh", optInt(o.ImportPeak)},
+		{"import_off_peak_wh", optInt(o.ImportOffPeak)},
+		{"import_shoulder_wh", optInt(o.ImportShoulder)},
+		{"import_high_shoulder_wh", optInt(o.ImportHighShoulder)},
+		{"export_peak_wh", optInt(o.ExportPeak)},
+		{"export_off_peak_wh", optInt(o.ExportOffPeak)},
+		{"export_shoulder_wh", optInt(o.ExportShoulder)},
+		{"export_high_shoulder_wh", optInt(o.ExportHighShoulder)},
+	}
+}
+
+// Statistic returns the record of given statistic
+func Statistic(st pvoutput.Statistic) Record {
+	return Record{
+		{"generated_wh", optInt(st.Generated)},
+		{"exported_wh", optInt(st.Exported)},
+		{"average_generation_wh", optInt(st.AverageGeneration)},
+		{"minimum_generation_wh", optInt(st.MinimumGeneration)},
+		{"maximum_generation_wh", optInt(st.MaximumGeneration)},
+		{"average_efficiency", optFloat(st.AverageEfficiency)},
+		{"outputs", optInt(st.Outputs)},
+		{"date_from", optDate(st.DateFrom)},
+		{"date_to", optDate(st.DateTo)},
+		{"record_efficiency", optFloat(st.RecordEfficiency)},
+		{"record_date", optDate(st.RecordDate)},
+		{"consumed_wh", optInt(st.Consumed)},
+		{"import_peak_wh", optInt(st.ImportPeak)},
+		{"import_off_peak_wh", optInt(st.ImportOffPeak)},
+		{"import_shoulder_wh", optInt(st.ImportShoulder)},
+		{"import_high_shoulder_wh", optInt(st.ImportHighShoulder)},
+		{"average_consumption_wh", optInt(st.AverageConsumption)},
+		{"minimum_consumption_wh", optInt(st.MinimumConsumption)},
+		{"maximum_consumption_wh", optInt(st.MaximumConsumption)},
+	}
+}
+
+// System returns the record of given system
+func System(s pvoutput.System) Record {
+	return Record{
+		{"name", optString(s.Name)},
+		{"size_w", optInt(s.Size)},
+		{"postcode", optString(s.Postcode)},
+		{"panels", optInt(s.Panels)},
+		{"panel_power_w", optInt(s.PanelPower)},
+		{"panel_brand", optString(s.PanelBrand)},
+		{"inverters", optInt(s.Inverters)},
+		{"inverter_power_w", optInt(s.InverterPower)},
+		{"inverter_brand", optString(s.InverterBrand)},
+		{"orientation", optString(s.Orientation)},
+		{"array_tilt", optFloat(s.ArrayTilt)},
+		{"shade", optString(s.Shade)},
+		{"install_date", optDate(s.InstallDate)},
+		{"latitude", optFloat(s.Latitude)},
+		{"longitude", optFloat(s.Longitude)},
+		{"status_interval_min", optInt(s.StatusInterval)},
+	}
+}
+
+// Date returns the record of given date
+func Date(d time.Time) Record {
+	return Record{{"date", optDate(d)}}
+}
@@ -0,0 +1,122 @@
+package pvoutput
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// LadderOptions filters the entries returned by GetLadder. Zero values are
+// not used as filter
+type LadderOptions struct {
+	Country string // country code, e.g. AU or NL
+	MinSize int    // watts
+	MaxSize int    // watts
+	TeamID  string
+	Limit   int
+}
+
+func (o LadderOptions) values() (url.Values, error) {
+	params := url.Values{}
+	if o.Country != "" {
+		params.Set("c", o.Country)
+	}
+
+	if o.MinSize < 0 || o.MaxSize < 0 {
+		return nil, errors.New("size band can not be negative")
+	}
+	if o.MaxSize > 0 && o.MinSize > o.MaxSize {
+		return nil, errors.New("MinSize exceeds MaxSize")
+	}
+	if o.MinSize > 0 {
+		params.Set("sf", fmt.Sprintf("%d", o.MinSize))
+	}
+	if o.MaxSize > 0 {
+		params.Set("st", fmt.Sprintf("%d", o.MaxSize))
+	}
+
+	if o.TeamID != "" {
+		params.Set("tid", o.TeamID)
+	}
+
+	if o.Limit < 0 {
+		return nil, errors.New("Limit can not be negative")
+	}
+	if o.Limit > 0 {
+		params.Set("limit", fmt.Sprintf("%d", o.Limit))
+	}
+
+	return params, nil
+}
+
+// LadderEntry represents a single system's position in PVOutput's ladder
+type LadderEntry struct {
+	Rank       int
+	SystemID   string
+	SystemName string
+	Size       int     // watts
+	Output     int     // watt hours
+	Efficiency float64 // kWh/kW
+	Postcode   string
+}
+
+func decodeLadderEntry(input string) (e LadderEntry, err error) {
+	fields := strings.Split(strings.TrimSpace(input), ",")
+	if len(fields) < 7 {
+		err = errors.New("not enough fields in ladder entry")
+		return
+	}
+
+	// parse Rank field from fields[0]
+	e.Rank, err = strconv.Atoi(fields[0])
+	if err != nil {
+		return
+	}
+
+	// get SystemID and SystemName fields from fields[1] and fields[2]
+	e.SystemID = fields[1]
+	e.SystemName = fields[2]
+
+	// parse Size field from fields[3]
+	e.Size, err = strconv.Atoi(fields[3])
+	if err != nil {
+		return
+	}
+
+	// parse Output field from fields[4]
+	e.Output, err = strconv.Atoi(fields[4])
+	if err != nil {
+		return
+	}
+
+	// parse Efficiency field from fields[5]
+	e.Efficiency, err = strconv.ParseFloat(fields[5], 64)
+	if err != nil {
+		return
+	}
+
+	// get Postcode field from fields[6]
+	e.Postcode = fields[6]
+
+	return
+}
+
+func decodeLadder(input string) ([]LadderEntry, error) {
+	entries := []LadderEntry{}
+	for _, line := range strings.Split(strings.TrimSpace(input), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		e, err := decodeLadderEntry(line)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,50 @@
+package pvoutput
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLadderOptions(t *testing.T) {
+	params, err := LadderOptions{}.values()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "", params.Encode())
+	}
+
+	params, err = LadderOptions{Country: "NL", MinSize: 3000, MaxSize: 5000, TeamID: "42", Limit: 10}.values()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "c=NL&limit=10&sf=3000&st=5000&tid=42", params.Encode())
+	}
+
+	_, err = LadderOptions{MinSize: 5000, MaxSize: 3000}.values()
+	assert.Error(t, err)
+	_, err = LadderOptions{MinSize: -1}.values()
+	assert.Error(t, err)
+	_, err = LadderOptions{Limit: -1}.values()
+	assert.Error(t, err)
+}
+
+func TestDecodeLadder(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/ladder/normal")
+	require.NoError(t, err)
+
+	entries, err := decodeLadder(string(data))
+	if assert.NoError(t, err) && assert.Len(t, entries, 3) {
+		assert.Equal(t, 1, entries[0].Rank)
+		assert.Equal(t, "21473", entries[0].SystemID)
+		assert.Equal(t, "Sunny Side Up", entries[0].SystemName)
+		assert.Equal(t, 4500, entries[0].Size)
+		assert.Equal(t, 25230, entries[0].Output)
+		assert.Equal(t, 5.607, entries[0].Efficiency)
+		assert.Equal(t, "3000", entries[0].Postcode)
+		assert.Equal(t, 3, entries[2].Rank)
+	}
+
+	_, err = decodeLadder("1,21473,Sunny Side Up")
+	assert.Error(t, err)
+	_, err = decodeLadder("first,21473,Sunny Side Up,4500,25230,5.607,3000")
+	assert.Error(t, err)
+}
@@ -0,0 +1,122 @@
+package pvoutput
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultManagerParallelism is the number of concurrent requests a
+	// Manager makes when fanning out calls over multiple systems
+	DefaultManagerParallelism = 4
+)
+
+// Manager manages multiple systems owned by the same API key. All API
+// objects it hands out share a single HTTP client and rate limit budget
+type Manager struct {
+	Key         string
+	Parallelism int
+	client      *http.Client
+	donating    bool
+	baseURL     string
+	limiter     *rateLimiter
+}
+
+// NewManager returns a new Manager for given API key
+func NewManager(key string, donating bool) *Manager {
+	return &Manager{
+		Key:         key,
+		Parallelism: DefaultManagerParallelism,
+		client:      &http.Client{},
+		donating:    donating,
+		baseURL:     apiBaseURL,
+		limiter:     &rateLimiter{},
+	}
+}
+
+// System returns an API object for given systemID, sharing the Manager's
+// HTTP client and rate limit budget
+func (m *Manager) System(systemID string) API {
+	return API{
+		Key:      m.Key,
+		SystemID: systemID,
+		client:   m.client,
+		donating: m.donating,
+		baseURL:  m.baseURL,
+		limiter:  m.limiter,
+		now:      time.Now,
+		sleep:    time.Sleep,
+	}
+}
+
+// RateLimit returns the rate limit as reported by PVOutput on the last
+// request of any of the managed systems
+func (m *Manager) RateLimit() (RateLimit, bool) {
+	return m.limiter.get()
+}
+
+// Each calls fn for the API of each of given systemIDs, running at most
+// Parallelism calls concurrently. When any of the calls fail, a SystemErrors
+// is returned holding the error per system
+func (m *Manager) Each(systemIDs []string, fn func(API) error) error {
+	parallelism := m.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs = SystemErrors{}
+		sem  = make(chan struct{}, parallelism)
+	)
+
+	for _, id := range systemIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(id string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := fn(m.System(id)); err != nil {
+				mu.Lock()
+				errs[id] = err
+				mu.Unlock()
+			}
+		}(id)
+	}
+
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// SystemErrors holds errors per system ID as returned by Manager.Each
+type SystemErrors map[string]error
+
+// Error implements the error interface
+func (e SystemErrors) Error() string {
+	ids := make([]string, 0, len(e))
+	for id := range e {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	msgs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		msgs = append(msgs, fmt.Sprintf("system %s: %s", id, e[id]))
+	}
+
+	return strings.Join(msgs, "; ")
+}
@@ -0,0 +1,118 @@
+package pvoutput
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManagerSystem(t *testing.T) {
+	m := NewManager("foo", true)
+	a := m.System("1")
+	b := m.System("2")
+
+	assert.Equal(t, "foo", a.Key)
+	assert.Equal(t, "1", a.SystemID)
+	assert.Equal(t, "2", b.SystemID)
+	assert.True(t, a.donating)
+
+	// client and rate limit budget are shared
+	assert.True(t, a.client == b.client)
+	assert.True(t, a.limiter == b.limiter)
+}
+
+func TestManagerEach(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		seen    = map[string]int{}
+		running int
+		maxSeen int
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen[r.Header.Get("X-Pvoutput-SystemId")]++
+		running++
+		if running > maxSeen {
+			maxSeen = running
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+
+		w.Header().Set("X-Rate-Limit-Limit", "300")
+		w.Header().Set("X-Rate-Limit-Remaining", "250")
+		w.Header().Set("X-Rate-Limit-Reset", fmt.Sprintf("%d", time.Now().Add(time.Hour).Unix()))
+		if r.Header.Get("X-Pvoutput-SystemId") == "3" {
+			http.Error(w, "Bad request 400: Invalid System ID", http.StatusBadRequest)
+			return
+		}
+		http.ServeFile(w, r, "testdata/supply/normal")
+	}))
+	defer srv.Close()
+
+	m := NewManager("foo", false)
+	m.baseURL = srv.URL
+	m.Parallelism = 2
+
+	ids := []string{"1", "2", "3", "4", "5", "6"}
+	err := m.Each(ids, func(a API) error {
+		_, err := a.GetSupply("", "")
+		return err
+	})
+
+	if assert.Error(t, err) {
+		var errs SystemErrors
+		if assert.True(t, errors.As(err, &errs)) {
+			assert.Len(t, errs, 1)
+			assert.Contains(t, errs["3"].Error(), "Invalid System ID")
+		}
+		assert.Contains(t, err.Error(), "system 3:")
+	}
+
+	for _, id := range ids {
+		assert.Equal(t, 1, seen[id], id)
+	}
+	assert.LessOrEqual(t, maxSeen, 2)
+
+	rl, ok := m.RateLimit()
+	if assert.True(t, ok) {
+		assert.Equal(t, 300, rl.Limit)
+	}
+}
+
+func TestManagerRateLimit(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("X-Rate-Limit-Limit", "60")
+		w.Header().Set("X-Rate-Limit-Remaining", "0")
+		w.Header().Set("X-Rate-Limit-Reset", fmt.Sprintf("%d", time.Now().Add(time.Hour).Unix()))
+	}))
+	defer srv.Close()
+
+	m := NewManager("foo", false)
+	m.baseURL = srv.URL
+
+	// first request uses up the budget for all systems
+	_, err := m.System("1").GetSupply("", "")
+	assert.NoError(t, err)
+	_, err = m.System("2").GetSupply("", "")
+	assert.Equal(t, ErrRateLimitExceeded, err)
+	assert.Equal(t, 1, requests)
+
+	rl, ok := m.System("2").RateLimit()
+	if assert.True(t, ok) {
+		assert.Equal(t, 0, rl.Remaining)
+	}
+}
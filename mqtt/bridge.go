@@ -0,0 +1,428 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skoef/pvoutput"
+)
+
+// Field is a Status field a topic can be mapped onto
+type Field int
+
+const (
+	// FieldGenerating maps onto Generating, averaged over the interval
+	FieldGenerating Field = iota + 1
+	// FieldGenerated maps onto Generated, last value in the interval
+	FieldGenerated
+	// FieldConsuming maps onto Consuming, averaged over the interval
+	FieldConsuming
+	// FieldConsumed maps onto Consumed, last value in the interval
+	FieldConsumed
+	// FieldTemperature maps onto Temperature, last value in the interval
+	FieldTemperature
+	// FieldVoltage maps onto Voltage, last value in the interval
+	FieldVoltage
+	// FieldExtended7 up to FieldExtended12 map onto the extended data fields
+	// v7 to v12, last value in the interval
+	FieldExtended7
+	FieldExtended8
+	FieldExtended9
+	FieldExtended10
+	FieldExtended11
+	FieldExtended12
+)
+
+var fieldNames = map[Field]string{
+	FieldGenerating:  "generating",
+	FieldGenerated:   "generated",
+	FieldConsuming:   "consuming",
+	FieldConsumed:    "consumed",
+	FieldTemperature: "temperature",
+	FieldVoltage:     "voltage",
+	FieldExtended7:   "v7",
+	FieldExtended8:   "v8",
+	FieldExtended9:   "v9",
+	FieldExtended10:  "v10",
+	FieldExtended11:  "v11",
+	FieldExtended12:  "v12",
+}
+
+func (f Field) String() string {
+	if name, ok := fieldNames[f]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Field(%d)", int(f))
+}
+
+// ParseField returns the Field with given name, e.g. generating or v7
+func ParseField(name string) (Field, error) {
+	for f, n := range fieldNames {
+		if strings.EqualFold(n, name) {
+			return f, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown field %s", name)
+}
+
+// Mapping maps the messages on a topic onto a Status field
+type Mapping struct {
+	// Topic is the topic filter, which may contain wildcards
+	Topic string
+	Field Field
+	// Path is the dot separated path to the value in a JSON payload, e.g.
+	// ENERGY.Power for Tasmota's SENSOR messages. Array elements are
+	// addressed by their index. When empty, the raw payload is used
+	Path string
+	// Scale multiplies the value, e.g. 1000 for kW or kWh. 0 means 1
+	Scale float64
+}
+
+// value extracts the value from given payload
+func (m Mapping) value(payload []byte) (float64, error) {
+	var v float64
+	if m.Path == "" {
+		f, err := strconv.ParseFloat(strings.TrimSpace(string(payload)), 64)
+		if err != nil {
+			return 0, err
+		}
+		v = f
+	} else {
+		dec := json.NewDecoder(bytes.NewReader(payload))
+		dec.UseNumber()
+
+		var doc interface{}
+		if err := dec.Decode(&doc); err != nil {
+			return 0, err
+		}
+
+		f, err := lookup(doc, m.Path)
+		if err != nil {
+			return 0, err
+		}
+		v = f
+	}
+
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, errors.New("value is not a finite number")
+	}
+
+	if m.Scale != 0 {
+		v *= m.Scale
+	}
+
+	return v, nil
+}
+
+// lookup returns the number at given path in a decoded JSON document
+func lookup(doc interface{}, path string) (float64, error) {
+	for _, key := range strings.Split(path, ".") {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			v, ok := node[key]
+			if !ok {
+				return 0, fmt.Errorf("path %s not found", path)
+			}
+			doc = v
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return 0, fmt.Errorf("path %s not found", path)
+			}
+			doc = node[i]
+		default:
+			return 0, fmt.Errorf("path %s not found", path)
+		}
+	}
+
+	switch v := doc.(type) {
+	case json.Number:
+		return v.Float64()
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	}
+
+	return 0, fmt.Errorf("value at %s is not a number", path)
+}
+
+// Uploader uploads Status updates, it is implemented by pvoutput.API
+type Uploader interface {
+	AddStatus(s pvoutput.Status) error
+	AddBatchStatus(b pvoutput.BatchStatus) error
+}
+
+// reading accumulates the values of a single field within an interval
+type reading struct {
+	sum   float64
+	count int
+	last  float64
+}
+
+// Bridge assembles the messages of the mapped topics into a Status per
+// interval and uploads it. Power fields are averaged over the messages
+// received within the interval, other fields take the last value received.
+// Statuses that fail to upload are queued and retried as a batch with the
+// next one
+type Bridge struct {
+	Mappings []Mapping
+	Interval time.Duration
+	// Cumulative is set on every Status, e.g. StatusCumulativeAll when the
+	// energy topics carry lifetime meter readings
+	Cumulative pvoutput.StatusCumulative
+	// OnError, when set, is called with errors that don't stop the bridge,
+	// like malformed payloads or failed uploads
+	OnError  func(error)
+	uploader Uploader
+	// uploading serialises uploads of the queue, so concurrent flushes don't
+	// upload the same statuses twice
+	uploading sync.Mutex
+	mu        sync.Mutex
+	end       time.Time // end of the current interval
+	readings  map[Field]*reading
+	queue     pvoutput.BatchStatus
+}
+
+// NewBridge returns a new Bridge uploading to given Uploader at given
+// interval, which should match the system's status interval
+func NewBridge(u Uploader, interval time.Duration, mappings []Mapping) *Bridge {
+	return &Bridge{
+		Mappings:   mappings,
+		Interval:   interval,
+		Cumulative: pvoutput.StatusCumulativeUnset,
+		uploader:   u,
+		readings:   map[Field]*reading{},
+	}
+}
+
+// Topics returns the distinct topic filters of all mappings
+func (b *Bridge) Topics() []string {
+	topics := []string{}
+	seen := map[string]bool{}
+	for _, m := range b.Mappings {
+		if !seen[m.Topic] {
+			seen[m.Topic] = true
+			topics = append(topics, m.Topic)
+		}
+	}
+
+	return topics
+}
+
+// Handle processes given message, received at given time. When the message
+// starts a new interval, the previous interval is uploaded first. The message
+// is processed even when that upload fails
+func (b *Bridge) Handle(msg Message, t time.Time) error {
+	if b.Interval <= 0 {
+		return errors.New("Interval should be positive")
+	}
+
+	errs := []string{}
+	if err := b.Flush(t); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// intervals are aligned to the wall clock like those of
+	// pvoutput.Resampler
+	if b.end.IsZero() {
+		b.end = pvoutput.NewResampler(b.Interval).Boundary(t)
+	}
+
+	for _, m := range b.Mappings {
+		if !Match(m.Topic, msg.Topic) {
+			continue
+		}
+
+		v, err := m.value(msg.Payload)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s on %s: %s", m.Field, msg.Topic, err))
+			continue
+		}
+
+		r, ok := b.readings[m.Field]
+		if !ok {
+			r = &reading{}
+			b.readings[m.Field] = r
+		}
+		r.sum += v
+		r.count++
+		r.last = v
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
+// status returns the Status for the current interval. The interval ending
+// at midnight is reported at 23:59, so its energy counts towards the day it
+// closes
+func (b *Bridge) status() pvoutput.Status {
+	s := pvoutput.NewStatus()
+	s.DateTime = pvoutput.StatusTime(b.end)
+	s.Cumulative = b.Cumulative
+
+	for f, r := range b.readings {
+		if r.count == 0 {
+			continue
+		}
+
+		avg := r.sum / float64(r.count)
+		switch f {
+		case FieldGenerating:
+			s.Generating = int(math.Round(math.Max(0, avg)))
+		case FieldConsuming:
+			s.Consuming = int(math.Round(math.Max(0, avg)))
+		case FieldGenerated:
+			s.Generated = int(math.Round(r.last))
+		case FieldConsumed:
+			s.Consumed = int(math.Round(r.last))
+		case FieldTemperature:
+			s.Temperature = r.last
+		case FieldVoltage:
+			s.Voltage = r.last
+		default:
+			if f >= FieldExtended7 && f <= FieldExtended12 {
+				s.Extended[f-FieldExtended7] = r.last
+			}
+		}
+	}
+
+	return s
+}
+
+// Flush uploads the current interval when given time is past its end. It is
+// called by Handle, and should be called periodically to upload intervals
+// after which no messages arrive
+func (b *Bridge) Flush(now time.Time) error {
+	b.mu.Lock()
+
+	if b.end.IsZero() || now.Before(b.end) || now.Equal(b.end) {
+		b.mu.Unlock()
+		return nil
+	}
+
+	if len(b.readings) > 0 {
+		b.queue = append(b.queue, b.status())
+		if len(b.queue) > pvoutput.BatchStatusMaxSize {
+			// keep the most recent statuses
+			b.queue = b.queue[len(b.queue)-pvoutput.BatchStatusMaxSize:]
+		}
+	}
+
+	b.readings = map[Field]*reading{}
+	b.end = pvoutput.NewResampler(b.Interval).Boundary(now)
+	b.mu.Unlock()
+
+	b.uploading.Lock()
+	defer b.uploading.Unlock()
+
+	b.mu.Lock()
+	queue := b.queue
+	b.mu.Unlock()
+
+	if len(queue) == 0 {
+		return nil
+	}
+
+	var err error
+	if len(queue) == 1 {
+		err = b.uploader.AddStatus(queue[0])
+	} else {
+		err = b.uploader.AddBatchStatus(queue)
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not upload %d status(es): %s", len(queue), err)
+	}
+
+	// only drop what was uploaded, statuses may have been queued or dropped
+	// in the meantime
+	b.mu.Lock()
+	last := queue[len(queue)-1].DateTime
+	for len(b.queue) > 0 && !b.queue[0].DateTime.After(last) {
+		b.queue = b.queue[1:]
+	}
+	b.mu.Unlock()
+
+	return nil
+}
+
+// Queued returns the number of statuses waiting to be uploaded
+func (b *Bridge) Queued() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.queue)
+}
+
+// Run subscribes to the mapped topics and processes messages until the
+// connection fails or given channel is closed. Intervals are flushed every
+// second, so statuses are uploaded even when no messages arrive. The client
+// is closed when Run returns
+func (b *Bridge) Run(c *Client, stop <-chan struct{}) error {
+	defer c.Close()
+
+	if err := c.Subscribe(b.Topics()...); err != nil {
+		return err
+	}
+
+	report := func(err error) {
+		if err != nil && b.OnError != nil {
+			b.OnError(err)
+		}
+	}
+
+	messages := make(chan Message)
+	errc := make(chan error, 1)
+	reading := make(chan struct{})
+	go func() {
+		defer close(reading)
+		for {
+			msg, err := c.ReadMessage()
+			if err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case messages <- msg:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	// closing the client ends the reading
+	defer func() {
+		c.Close()
+		<-reading
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case err := <-errc:
+			return err
+		case msg := <-messages:
+			report(b.Handle(msg, time.Now()))
+		case now := <-ticker.C:
+			report(b.Flush(now))
+		}
+	}
+}
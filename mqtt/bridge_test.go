@@ -0,0 +1,246 @@
+package mqtt
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/skoef/pvoutput"
+	"github.com/skoef/pvoutput/internal/pvtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseField(t *testing.T) {
+	f, err := ParseField("Generating")
+	assert.NoError(t, err)
+	assert.Equal(t, FieldGenerating, f)
+
+	f, err = ParseField("v9")
+	assert.NoError(t, err)
+	assert.Equal(t, FieldExtended9, f)
+	assert.Equal(t, "v9", f.String())
+
+	_, err = ParseField("foobar")
+	assert.Error(t, err)
+}
+
+func TestMappingValue(t *testing.T) {
+	tasmota := []byte(`{"Time":"2020-08-18T12:34:56","ENERGY":{"Total":1234.567,"Power":[512,"128"]}}`)
+
+	tests := []struct {
+		mapping Mapping
+		payload []byte
+		value   float64
+		err     bool
+	}{
+		{Mapping{}, []byte(" 1234.5\n"), 1234.5, false},
+		{Mapping{Scale: 1000}, []byte("1.2345"), 1234.5, false},
+		{Mapping{}, []byte("on"), 0, true},
+		{Mapping{}, []byte("NaN"), 0, true},
+		{Mapping{Path: "ENERGY.Total", Scale: 1000}, tasmota, 1234567, false},
+		{Mapping{Path: "ENERGY.Power.0"}, tasmota, 512, false},
+		{Mapping{Path: "ENERGY.Power.1"}, tasmota, 128, false},
+		{Mapping{Path: "ENERGY.Power.2"}, tasmota, 0, true},
+		{Mapping{Path: "ENERGY.Voltage"}, tasmota, 0, true},
+		{Mapping{Path: "Time"}, tasmota, 0, true},
+		{Mapping{Path: "ENERGY"}, tasmota, 0, true},
+		{Mapping{Path: "ENERGY.Total"}, []byte("1234"), 0, true},
+	}
+
+	for _, tc := range tests {
+		v, err := tc.mapping.value(tc.payload)
+		if tc.err {
+			assert.Error(t, err, "%+v", tc.mapping)
+			continue
+		}
+		if assert.NoError(t, err, "%+v", tc.mapping) {
+			assert.InDelta(t, tc.value, v, 1e-6)
+		}
+	}
+}
+
+func TestBridge(t *testing.T) {
+	u := &pvtest.Uploader{}
+	b := NewBridge(u, 5*time.Minute, []Mapping{
+		{Topic: "tele/inverter/SENSOR", Field: FieldGenerating, Path: "ENERGY.Power"},
+		{Topic: "tele/inverter/SENSOR", Field: FieldGenerated, Path: "ENERGY.Today", Scale: 1000},
+		{Topic: "home/+/temperature", Field: FieldTemperature},
+		{Topic: "meter/power", Field: FieldConsuming},
+		{Topic: "meter/power", Field: FieldExtended7},
+	})
+	assert.Equal(t, []string{"tele/inverter/SENSOR", "home/+/temperature", "meter/power"}, b.Topics())
+
+	at := func(min, sec int) time.Time {
+		return time.Date(2020, 8, 18, 12, min, sec, 0, time.UTC)
+	}
+
+	require.NoError(t, b.Handle(Message{Topic: "tele/inverter/SENSOR", Payload: []byte(`{"ENERGY":{"Power":1000,"Today":1.5}}`)}, at(1, 0)))
+	require.NoError(t, b.Handle(Message{Topic: "tele/inverter/SENSOR", Payload: []byte(`{"ENERGY":{"Power":2000,"Today":1.6}}`)}, at(3, 0)))
+	require.NoError(t, b.Handle(Message{Topic: "home/roof/temperature", Payload: []byte("31.5")}, at(3, 30)))
+	require.NoError(t, b.Handle(Message{Topic: "meter/power", Payload: []byte("300")}, at(4, 0)))
+	require.NoError(t, b.Handle(Message{Topic: "other/topic", Payload: []byte("foo")}, at(4, 30)))
+	assert.Error(t, b.Handle(Message{Topic: "meter/power", Payload: []byte("foo")}, at(4, 45)))
+
+	// nothing is uploaded until the interval has passed
+	require.NoError(t, b.Flush(at(5, 0)))
+	assert.Empty(t, u.Statuses)
+
+	require.NoError(t, b.Flush(at(5, 1)))
+	if assert.Len(t, u.Statuses, 1) {
+		s := u.Statuses[0]
+		assert.Equal(t, at(5, 0), s.DateTime)
+		assert.Equal(t, 1500, s.Generating)
+		assert.Equal(t, 1600, s.Generated)
+		assert.Equal(t, 300, s.Consuming)
+		assert.Equal(t, 31.5, s.Temperature)
+		assert.Equal(t, 300.0, s.Extended[0])
+		assert.Equal(t, pvoutput.UnsetInt, s.Consumed)
+		assert.Equal(t, -1.0, s.Voltage)
+		assert.Equal(t, pvoutput.StatusCumulative(-1), s.Cumulative)
+	}
+
+	// intervals without messages are skipped
+	require.NoError(t, b.Flush(at(12, 0)))
+	assert.Len(t, u.Statuses, 1)
+
+	// failed uploads are queued and retried in a batch
+	u.Err = errors.New("service unavailable")
+	require.NoError(t, b.Handle(Message{Topic: "meter/power", Payload: []byte("400")}, at(14, 0)))
+	assert.Error(t, b.Flush(at(16, 0)))
+	assert.Equal(t, 1, b.Queued())
+	// the retry on the next message fails too, the message is kept though
+	assert.Error(t, b.Handle(Message{Topic: "meter/power", Payload: []byte("500")}, at(22, 0)))
+	assert.Equal(t, 1, b.Queued())
+
+	u.Err = nil
+	require.NoError(t, b.Flush(at(26, 0)))
+	assert.Equal(t, 0, b.Queued())
+	if assert.Len(t, u.StatusBatches, 1) && assert.Len(t, u.StatusBatches[0], 2) {
+		assert.Equal(t, at(15, 0), u.StatusBatches[0][0].DateTime)
+		assert.Equal(t, 400, u.StatusBatches[0][0].Consuming)
+		assert.Equal(t, at(25, 0), u.StatusBatches[0][1].DateTime)
+		assert.Equal(t, 500, u.StatusBatches[0][1].Consuming)
+	}
+}
+
+// blockingUploader blocks the first upload until release is closed
+type blockingUploader struct {
+	pvtest.Uploader
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (u *blockingUploader) AddStatus(s pvoutput.Status) error {
+	u.once.Do(func() {
+		close(u.started)
+		<-u.release
+	})
+
+	return u.Uploader.AddStatus(s)
+}
+
+func TestBridgeConcurrentFlush(t *testing.T) {
+	u := &blockingUploader{started: make(chan struct{}), release: make(chan struct{})}
+	b := NewBridge(u, time.Minute, []Mapping{{Topic: "meter/power", Field: FieldConsuming}})
+
+	at := func(min, sec int) time.Time {
+		return time.Date(2020, 8, 18, 12, min, sec, 0, time.UTC)
+	}
+
+	require.NoError(t, b.Handle(Message{Topic: "meter/power", Payload: []byte("300")}, at(0, 30)))
+	first := make(chan error)
+	go func() { first <- b.Flush(at(1, 10)) }()
+	<-u.started
+
+	// the next interval is flushed while the previous one is uploading
+	require.NoError(t, b.Handle(Message{Topic: "meter/power", Payload: []byte("400")}, at(1, 20)))
+	second := make(chan error)
+	go func() { second <- b.Flush(at(2, 10)) }()
+	require.Eventually(t, func() bool { return b.Queued() == 2 }, time.Second, time.Millisecond)
+
+	close(u.release)
+	require.NoError(t, <-first)
+	require.NoError(t, <-second)
+
+	// every status is uploaded once
+	assert.Equal(t, 0, b.Queued())
+	if assert.Len(t, u.Statuses, 2) {
+		assert.Equal(t, at(1, 0), u.Statuses[0].DateTime)
+		assert.Equal(t, at(2, 0), u.Statuses[1].DateTime)
+	}
+}
+
+func TestBridgeMidnight(t *testing.T) {
+	u := &pvtest.Uploader{}
+	b := NewBridge(u, 5*time.Minute, []Mapping{
+		{Topic: "tele/inverter/SENSOR", Field: FieldGenerated, Path: "ENERGY.Today", Scale: 1000},
+	})
+
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2020, 8, day, hour, min, 0, 0, time.UTC)
+	}
+
+	// the last interval of the day is reported at 23:59 of that day
+	require.NoError(t, b.Handle(Message{Topic: "tele/inverter/SENSOR", Payload: []byte(`{"ENERGY":{"Today":21.3}}`)}, at(18, 23, 57)))
+	require.NoError(t, b.Flush(at(19, 0, 1)))
+	if assert.Len(t, u.Statuses, 1) {
+		assert.Equal(t, at(18, 23, 59), u.Statuses[0].DateTime)
+		assert.Equal(t, 21300, u.Statuses[0].Generated)
+	}
+
+	require.NoError(t, b.Handle(Message{Topic: "tele/inverter/SENSOR", Payload: []byte(`{"ENERGY":{"Today":0}}`)}, at(19, 0, 3)))
+	require.NoError(t, b.Flush(at(19, 0, 6)))
+	if assert.Len(t, u.Statuses, 2) {
+		assert.Equal(t, at(19, 0, 5), u.Statuses[1].DateTime)
+	}
+}
+
+func TestBridgeRun(t *testing.T) {
+	broker := newTestBroker(t)
+
+	u := &pvtest.Uploader{}
+	b := NewBridge(u, time.Minute, []Mapping{
+		{Topic: "meter/power", Field: FieldConsuming},
+	})
+	b.Cumulative = pvoutput.StatusCumulativeAll
+
+	sub, err := Dial(broker.Addr(), Options{})
+	require.NoError(t, err)
+	defer sub.Close()
+
+	pub, err := Dial(broker.Addr(), Options{})
+	require.NoError(t, err)
+	defer pub.Close()
+
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- b.Run(sub, stop)
+	}()
+
+	// publish until the bridge has subscribed and processed a message
+	require.Eventually(t, func() bool {
+		pub.Publish(Message{Topic: "meter/power", Payload: []byte("250")})
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return len(b.readings) > 0
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// flush the interval as if it has passed
+	require.NoError(t, b.Flush(b.end.Add(time.Second)))
+	if assert.Len(t, u.Statuses, 1) {
+		assert.Equal(t, 250, u.Statuses[0].Consuming)
+		assert.Equal(t, pvoutput.StatusCumulativeAll, u.Statuses[0].Cumulative)
+	}
+
+	close(stop)
+	assert.NoError(t, <-done)
+
+	// the client is closed along with the bridge
+	_, err = sub.ReadMessage()
+	assert.Error(t, err)
+}
@@ -0,0 +1,151 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testBroker is an embedded MQTT broker supporting just enough of MQTT 3.1.1
+// to test the client against: connect, subscribe, publish with QoS 0,
+// retained messages and ping
+type testBroker struct {
+	listener net.Listener
+	mu       sync.Mutex
+	subs     map[net.Conn][]string
+	retained map[string]Message
+	// reject, when set, is returned as CONNACK return code
+	reject byte
+}
+
+func newTestBroker(t *testing.T) *testBroker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	b := &testBroker{
+		listener: l,
+		subs:     map[net.Conn][]string{},
+		retained: map[string]Message{},
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+
+	return b
+}
+
+func (b *testBroker) Addr() string {
+	return b.listener.Addr().String()
+}
+
+func (b *testBroker) serve(conn net.Conn) {
+	defer func() {
+		b.mu.Lock()
+		delete(b.subs, conn)
+		b.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	for {
+		p, err := readPacket(r)
+		if err != nil {
+			return
+		}
+
+		switch p.Type {
+		case packetConnect:
+			conn.Write(packet{Type: packetConnAck, Body: []byte{0, b.reject}}.bytes())
+			if b.reject != 0 {
+				return
+			}
+		case packetSubscribe:
+			id := p.Body[:2]
+			rest := p.Body[2:]
+			codes := []byte{}
+			filters := []string{}
+			for len(rest) > 0 {
+				var f string
+				f, rest, err = readString(rest)
+				if err != nil {
+					return
+				}
+				rest = rest[1:]
+				filters = append(filters, f)
+				codes = append(codes, 0)
+			}
+
+			b.mu.Lock()
+			b.subs[conn] = append(b.subs[conn], filters...)
+			retained := []Message{}
+			for _, msg := range b.retained {
+				for _, f := range filters {
+					if Match(f, msg.Topic) {
+						retained = append(retained, msg)
+						break
+					}
+				}
+			}
+			b.mu.Unlock()
+
+			// deliver retained messages before acknowledging, with QoS 1
+			for i, msg := range retained {
+				pub := encodePublish(msg)
+				pub.Flags |= 0x02
+				topicLen := 2 + len(msg.Topic)
+				body := append([]byte{}, pub.Body[:topicLen]...)
+				body = append(body, 0, byte(i+1))
+				pub.Body = append(body, pub.Body[topicLen:]...)
+				conn.Write(pub.bytes())
+			}
+
+			conn.Write(packet{Type: packetSubAck, Body: append(id, codes...)}.bytes())
+		case packetPublish:
+			msg, _, _, err := decodePublish(p)
+			if err != nil {
+				return
+			}
+			b.publish(msg)
+		case packetPingReq:
+			conn.Write(packet{Type: packetPingResp}.bytes())
+		case packetPubAck:
+			if len(p.Body) != 2 || binary.BigEndian.Uint16(p.Body) == 0 {
+				return
+			}
+		case packetDisconnect:
+			return
+		}
+	}
+}
+
+// publish delivers given message to all matching subscribers
+func (b *testBroker) publish(msg Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if msg.Retained {
+		b.retained[msg.Topic] = msg
+	}
+
+	msg.Retained = false
+	for conn, filters := range b.subs {
+		for _, f := range filters {
+			if Match(f, msg.Topic) {
+				conn.Write(encodePublish(msg).bytes())
+				break
+			}
+		}
+	}
+}
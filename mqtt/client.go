@@ -0,0 +1,313 @@
+// Package mqtt subscribes to sensor topics on an MQTT broker, like Mosquitto,
+// and assembles the readings published there into Status updates for
+// PVOutput
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultKeepAlive is the default keep alive interval
+	DefaultKeepAlive = 60 * time.Second
+	// DefaultTimeout is the default timeout for connecting to the broker
+	DefaultTimeout = 10 * time.Second
+)
+
+// Options holds the options used when connecting to the broker
+type Options struct {
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration
+}
+
+// Message is a message received from the broker
+type Message struct {
+	Topic    string
+	Payload  []byte
+	Retained bool
+}
+
+// Client is a minimal MQTT 3.1.1 client, supporting just what is needed to
+// subscribe to sensor topics: messages are received with QoS 0 or 1
+type Client struct {
+	conn      net.Conn
+	r         *bufio.Reader
+	keepAlive time.Duration
+	mu        sync.Mutex // guards writes to conn and nextID
+	nextID    uint16
+	pending   []Message
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Dial connects to the broker on given address, e.g. localhost:1883
+func Dial(addr string, opts Options) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, DefaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := NewClient(conn, opts)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// NewClient sets up an MQTT session on given connection. A password can only
+// be given along with a username
+func NewClient(conn net.Conn, opts Options) (*Client, error) {
+	if opts.Password != "" && opts.Username == "" {
+		return nil, errors.New("password without username")
+	}
+	if opts.KeepAlive == 0 {
+		opts.KeepAlive = DefaultKeepAlive
+	}
+	if opts.ClientID == "" {
+		opts.ClientID = fmt.Sprintf("pvoutput-%d", time.Now().UnixNano()%1e6)
+	}
+
+	c := &Client{
+		conn:      conn,
+		r:         bufio.NewReader(conn),
+		keepAlive: opts.KeepAlive,
+		done:      make(chan struct{}),
+	}
+
+	// connect with a clean session
+	flags := byte(0x02)
+	if opts.Username != "" {
+		flags |= 0x80
+	}
+	if opts.Password != "" {
+		flags |= 0x40
+	}
+
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags)
+	body = append(body, byte(opts.KeepAlive/time.Second>>8), byte(opts.KeepAlive/time.Second))
+	body = appendString(body, opts.ClientID)
+	if opts.Username != "" {
+		body = appendString(body, opts.Username)
+	}
+	if opts.Password != "" {
+		body = appendString(body, opts.Password)
+	}
+
+	conn.SetDeadline(time.Now().Add(DefaultTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if err := c.write(packet{Type: packetConnect, Body: body}); err != nil {
+		return nil, err
+	}
+
+	p, err := readPacket(c.r)
+	if err != nil {
+		return nil, err
+	}
+	if p.Type != packetConnAck || len(p.Body) != 2 {
+		return nil, errors.New("expected CONNACK")
+	}
+	if p.Body[1] != 0 {
+		return nil, fmt.Errorf("connection refused: %s", connAckReason(p.Body[1]))
+	}
+
+	go c.ping()
+
+	return c, nil
+}
+
+// connAckReason returns the reason for given CONNACK return code
+func connAckReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	}
+
+	return fmt.Sprintf("return code %d", code)
+}
+
+// write writes given packet to the broker
+func (c *Client) write(p packet) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := c.conn.Write(p.bytes())
+
+	return err
+}
+
+// ping keeps the session alive until the client is closed
+func (c *Client) ping() {
+	ticker := time.NewTicker(c.keepAlive / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.write(packet{Type: packetPingReq}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Subscribe subscribes to given topic filters, which may contain the + and #
+// wildcards. Messages received while waiting for the broker's
+// acknowledgement are returned by subsequent calls to ReadMessage
+func (c *Client) Subscribe(filters ...string) error {
+	if len(filters) == 0 {
+		return errors.New("no topics to subscribe to")
+	}
+
+	c.mu.Lock()
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID++
+	}
+	id := c.nextID
+	c.mu.Unlock()
+
+	body := []byte{byte(id >> 8), byte(id)}
+	for _, f := range filters {
+		body = appendString(body, f)
+		body = append(body, 1)
+	}
+
+	// SUBSCRIBE has fixed header flags 0010
+	if err := c.write(packet{Type: packetSubscribe, Flags: 0x02, Body: body}); err != nil {
+		return err
+	}
+
+	for {
+		p, err := c.read()
+		if err != nil {
+			return err
+		}
+
+		switch p.Type {
+		case packetSubAck:
+			if len(p.Body) < 2 || binary.BigEndian.Uint16(p.Body) != id {
+				return errors.New("unexpected SUBACK")
+			}
+
+			for i, code := range p.Body[2:] {
+				if code == 0x80 && i < len(filters) {
+					return fmt.Errorf("subscription to %s refused", filters[i])
+				}
+			}
+
+			return nil
+		case packetPublish:
+			msg, err := c.handlePublish(p)
+			if err != nil {
+				return err
+			}
+			c.pending = append(c.pending, msg)
+		}
+	}
+}
+
+// Publish publishes given message with QoS 0
+func (c *Client) Publish(msg Message) error {
+	return c.write(encodePublish(msg))
+}
+
+// read reads the next packet, failing when the broker stays silent for
+// longer than the keep alive interval allows
+func (c *Client) read() (packet, error) {
+	c.conn.SetReadDeadline(time.Now().Add(c.keepAlive * 3 / 2))
+
+	return readPacket(c.r)
+}
+
+// handlePublish decodes given PUBLISH packet and acknowledges it if needed
+func (c *Client) handlePublish(p packet) (Message, error) {
+	msg, qos, id, err := decodePublish(p)
+	if err != nil {
+		return msg, err
+	}
+
+	switch qos {
+	case 1:
+		err = c.write(packet{Type: packetPubAck, Body: []byte{byte(id >> 8), byte(id)}})
+	case 2:
+		err = errors.New("QoS 2 is not supported")
+	}
+
+	return msg, err
+}
+
+// ReadMessage blocks until the next message is received
+func (c *Client) ReadMessage() (Message, error) {
+	if len(c.pending) > 0 {
+		msg := c.pending[0]
+		c.pending = c.pending[1:]
+		return msg, nil
+	}
+
+	for {
+		p, err := c.read()
+		if err != nil {
+			return Message{}, err
+		}
+
+		if p.Type == packetPublish {
+			return c.handlePublish(p)
+		}
+	}
+}
+
+// Close disconnects from the broker
+func (c *Client) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.write(packet{Type: packetDisconnect})
+		err = c.conn.Close()
+	})
+
+	return err
+}
+
+// Match reports whether given topic matches given topic filter, which may
+// contain the + (single level) and # (multi level) wildcards
+func Match(filter, topic string) bool {
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+
+	for i, level := range f {
+		if level == "#" {
+			return i == len(f)-1
+		}
+		if i >= len(t) {
+			return false
+		}
+		if level != "+" && level != t[i] {
+			return false
+		}
+	}
+
+	return len(f) == len(t)
+}
@@ -0,0 +1,114 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		match  bool
+	}{
+		{"tele/inverter/SENSOR", "tele/inverter/SENSOR", true},
+		{"tele/inverter/SENSOR", "tele/meter/SENSOR", false},
+		{"tele/+/SENSOR", "tele/meter/SENSOR", true},
+		{"tele/+/SENSOR", "tele/meter/STATE", false},
+		{"tele/+", "tele/meter/SENSOR", false},
+		{"tele/#", "tele/meter/SENSOR", true},
+		{"tele/#", "tele", true},
+		{"#", "tele/meter/SENSOR", true},
+		{"tele/meter", "tele/meter/SENSOR", false},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.match, Match(tc.filter, tc.topic), "%s ~ %s", tc.filter, tc.topic)
+	}
+}
+
+func TestPacket(t *testing.T) {
+	// remaining length spanning multiple bytes
+	payload := bytes.Repeat([]byte{'x'}, 321)
+	p := encodePublish(Message{Topic: "a/b", Payload: payload, Retained: true})
+
+	out, err := readPacket(bufio.NewReader(bytes.NewReader(p.bytes())))
+	require.NoError(t, err)
+	assert.Equal(t, packetPublish, out.Type)
+
+	msg, qos, _, err := decodePublish(out)
+	require.NoError(t, err)
+	assert.Equal(t, byte(0), qos)
+	assert.Equal(t, "a/b", msg.Topic)
+	assert.Equal(t, payload, msg.Payload)
+	assert.True(t, msg.Retained)
+
+	// truncated packet
+	_, err = readPacket(bufio.NewReader(bytes.NewReader(p.bytes()[:100])))
+	assert.Error(t, err)
+
+	// malformed remaining length
+	_, err = readPacket(bufio.NewReader(bytes.NewReader([]byte{0x30, 0xff, 0xff, 0xff, 0xff, 0x01})))
+	assert.Error(t, err)
+}
+
+func TestClient(t *testing.T) {
+	broker := newTestBroker(t)
+
+	pub, err := Dial(broker.Addr(), Options{ClientID: "publisher"})
+	require.NoError(t, err)
+	defer pub.Close()
+
+	// retained message published before subscribing
+	require.NoError(t, pub.Publish(Message{Topic: "meter/power", Payload: []byte("1234"), Retained: true}))
+
+	sub, err := Dial(broker.Addr(), Options{ClientID: "subscriber"})
+	require.NoError(t, err)
+	defer sub.Close()
+
+	// wait for the broker to have processed the retained message
+	require.Eventually(t, func() bool {
+		broker.mu.Lock()
+		defer broker.mu.Unlock()
+		return len(broker.retained) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, sub.Subscribe("meter/+"))
+
+	msg, err := sub.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, "meter/power", msg.Topic)
+	assert.Equal(t, "1234", string(msg.Payload))
+
+	require.NoError(t, pub.Publish(Message{Topic: "inverter/power", Payload: []byte("1")}))
+	require.NoError(t, pub.Publish(Message{Topic: "meter/energy", Payload: []byte("5678")}))
+
+	msg, err = sub.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, "meter/energy", msg.Topic)
+	assert.False(t, msg.Retained)
+
+	assert.Error(t, sub.Subscribe())
+}
+
+func TestClientRefused(t *testing.T) {
+	broker := newTestBroker(t)
+	broker.reject = 5
+
+	_, err := Dial(broker.Addr(), Options{Username: "foo", Password: "bar"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "not authorized")
+	}
+}
+
+func TestClientPasswordWithoutUsername(t *testing.T) {
+	broker := newTestBroker(t)
+
+	_, err := Dial(broker.Addr(), Options{Password: "bar"})
+	assert.EqualError(t, err, "password without username")
+}
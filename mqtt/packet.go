@@ -0,0 +1,148 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MQTT 3.1.1 control packet types
+const (
+	packetConnect     byte = 1
+	packetConnAck     byte = 2
+	packetPublish     byte = 3
+	packetPubAck      byte = 4
+	packetSubscribe   byte = 8
+	packetSubAck      byte = 9
+	packetPingReq     byte = 12
+	packetPingResp    byte = 13
+	packetDisconnect  byte = 14
+	maxRemainingBytes      = 4
+)
+
+// packet is a raw MQTT control packet
+type packet struct {
+	Type  byte
+	Flags byte
+	Body  []byte
+}
+
+// readPacket reads a single control packet from r
+func readPacket(r *bufio.Reader) (packet, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+
+	p := packet{Type: b >> 4, Flags: b & 0x0f}
+
+	length, shift := 0, uint(0)
+	for i := 0; ; i++ {
+		if i == maxRemainingBytes {
+			return p, errors.New("malformed remaining length")
+		}
+
+		b, err := r.ReadByte()
+		if err != nil {
+			return p, err
+		}
+
+		length |= int(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			break
+		}
+	}
+
+	p.Body = make([]byte, length)
+	if _, err := io.ReadFull(r, p.Body); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return p, err
+	}
+
+	return p, nil
+}
+
+// bytes returns the packet in its wire format
+func (p packet) bytes() []byte {
+	out := []byte{p.Type<<4 | p.Flags}
+
+	length := len(p.Body)
+	for {
+		b := byte(length & 0x7f)
+		length >>= 7
+		if length > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if length == 0 {
+			break
+		}
+	}
+
+	return append(out, p.Body...)
+}
+
+// appendString appends a length prefixed UTF-8 string
+func appendString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+
+	return append(b, s...)
+}
+
+// readString reads a length prefixed string from b and returns the rest
+func readString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errors.New("malformed string")
+	}
+
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, errors.New("malformed string")
+	}
+
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
+
+// decodePublish decodes the body of a PUBLISH packet
+func decodePublish(p packet) (msg Message, qos byte, id uint16, err error) {
+	qos = (p.Flags >> 1) & 0x03
+	if qos > 2 {
+		return msg, qos, id, fmt.Errorf("invalid QoS %d", qos)
+	}
+
+	msg.Retained = p.Flags&0x01 != 0
+
+	rest := p.Body
+	if msg.Topic, rest, err = readString(rest); err != nil {
+		return
+	}
+
+	if qos > 0 {
+		if len(rest) < 2 {
+			return msg, qos, id, errors.New("malformed publish")
+		}
+		id = binary.BigEndian.Uint16(rest)
+		rest = rest[2:]
+	}
+
+	msg.Payload = rest
+
+	return
+}
+
+// encodePublish returns a PUBLISH packet for given message with QoS 0
+func encodePublish(msg Message) packet {
+	p := packet{Type: packetPublish, Body: appendString(nil, msg.Topic)}
+	if msg.Retained {
+		p.Flags |= 0x01
+	}
+	p.Body = append(p.Body, msg.Payload...)
+
+	return p
+}
@@ -0,0 +1,120 @@
+package pvoutput
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	// NotificationAppIDMaxLength is the maximum length of the application ID
+	// used to (de)register notifications
+	NotificationAppIDMaxLength = 100
+	// NotificationURLMaxLength is the maximum length of the callback URL
+	NotificationURLMaxLength = 150
+)
+
+// AlertType is the type of event PVOutput sends a notification for
+// as described on https://pvoutput.org/help.html#api-registernotification
+type AlertType int
+
+const (
+	// AlertAll registers or deregisters all alert types at once
+	AlertAll AlertType = 0
+	// AlertPrivateMessage is sent when receiving a private message
+	AlertPrivateMessage AlertType = 1
+	// AlertJoinedTeam is sent when a system joined your team
+	AlertJoinedTeam AlertType = 3
+	// AlertAddedFavourite is sent when a system added yours as favourite
+	AlertAddedFavourite AlertType = 4
+	// AlertHighConsumption is sent when consumption exceeds the configured level
+	AlertHighConsumption AlertType = 5
+	// AlertSystemIdle is sent when no status updates were received for a while
+	AlertSystemIdle AlertType = 6
+	// AlertTeamInvitation is sent when your system is invited to a team
+	AlertTeamInvitation AlertType = 8
+	// AlertLowGeneration is sent when generation is below the configured level
+	AlertLowGeneration AlertType = 11
+	// AlertPerformance is sent when performance is below the configured level
+	AlertPerformance AlertType = 14
+	// AlertStandbyCost is sent when standby cost exceeds the configured level
+	AlertStandbyCost AlertType = 16
+	// AlertExtendedV7 is sent when extended data v7 triggers its alert
+	AlertExtendedV7 AlertType = 17
+	// AlertExtendedV8 is sent when extended data v8 triggers its alert
+	AlertExtendedV8 AlertType = 18
+	// AlertExtendedV9 is sent when extended data v9 triggers its alert
+	AlertExtendedV9 AlertType = 19
+	// AlertExtendedV10 is sent when extended data v10 triggers its alert
+	AlertExtendedV10 AlertType = 20
+	// AlertExtendedV11 is sent when extended data v11 triggers its alert
+	AlertExtendedV11 AlertType = 21
+	// AlertExtendedV12 is sent when extended data v12 triggers its alert
+	AlertExtendedV12 AlertType = 22
+	// AlertHighNetPower is sent when net power exceeds the configured level
+	AlertHighNetPower AlertType = 23
+	// AlertLowNetPower is sent when net power is below the configured level
+	AlertLowNetPower AlertType = 24
+)
+
+func validateAppID(appID string) error {
+	if appID == "" {
+		return errors.New("appid is required")
+	}
+	if len(appID) > NotificationAppIDMaxLength {
+		return fmt.Errorf("appid exceeds %d characters", NotificationAppIDMaxLength)
+	}
+
+	return nil
+}
+
+// Notification represents a notification callback PVOutput sends to the URL
+// registered with RegisterNotification
+type Notification struct {
+	AppID    string
+	SystemID string
+	Type     AlertType
+	Message  string
+}
+
+func decodeNotification(r *http.Request) (n Notification, err error) {
+	if err = r.ParseForm(); err != nil {
+		return
+	}
+
+	n.AppID = r.Form.Get("appid")
+	n.SystemID = r.Form.Get("sid")
+	n.Message = r.Form.Get("msg")
+
+	if n.AppID == "" || n.SystemID == "" {
+		err = errors.New("appid and sid are required in notification")
+		return
+	}
+
+	// parse Type field from type
+	var t int
+	t, err = strconv.Atoi(r.Form.Get("type"))
+	if err != nil {
+		return
+	}
+	n.Type = AlertType(t)
+
+	return
+}
+
+// NotificationHandler returns an http.Handler that decodes PVOutput's
+// notification callbacks and passes them to given function. Callbacks that
+// can't be decoded are answered with 400 Bad Request
+func NotificationHandler(fn func(Notification)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, err := decodeNotification(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		fn(n)
+		w.WriteHeader(http.StatusOK)
+	})
+}
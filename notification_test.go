@@ -0,0 +1,42 @@
+package pvoutput
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotificationHandler(t *testing.T) {
+	var received []Notification
+	h := NotificationHandler(func(n Notification) {
+		received = append(received, n)
+	})
+
+	// valid callback
+	req := httptest.NewRequest(http.MethodGet, "/callback?appid=example.app&sid=12345&type=6&msg=System+idle", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	if assert.Len(t, received, 1) {
+		assert.Equal(t, "example.app", received[0].AppID)
+		assert.Equal(t, "12345", received[0].SystemID)
+		assert.Equal(t, AlertSystemIdle, received[0].Type)
+		assert.Equal(t, "System idle", received[0].Message)
+	}
+
+	// missing system ID
+	req = httptest.NewRequest(http.MethodGet, "/callback?appid=example.app&type=6", nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// invalid type
+	req = httptest.NewRequest(http.MethodGet, "/callback?appid=example.app&sid=12345&type=idle", nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	assert.Len(t, received, 1)
+}
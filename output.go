@@ -1,18 +1,26 @@
 package pvoutput
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/url"
-	"strconv"
 	"strings"
 	"time"
 )
 
+// values marking fields of Status, Output and Statistic as unset, see
+// NewStatus and NewOutput
+const (
+	// UnsetInt marks an integer field as unset
+	UnsetInt = -1
+	// UnsetFloat marks a float field as unset
+	UnsetFloat = -1.0
+	// UnsetString marks a string field as unset
+	UnsetString = "__unset__"
+)
+
 var (
-	outputUnsetInt    = -1
-	outputUnsetFloat  = -1.0
-	outputUnsetString = "__unset__"
 	// order of keys in batch output
 	// as described on https://pvoutput.org/help.html#api-addbatchoutput
 	outputBatchKeys = []string{
@@ -39,6 +47,9 @@ const (
 	// BatchOutputMaxSizeDonating determines the maximum batch size when in
 	// donating mode. This is 100 according to PVOutput's docs
 	BatchOutputMaxSizeDonating = 100
+	// OutputPageDays is the number of days of outputs requested at once when
+	// paging through a date range with GetOutput
+	OutputPageDays = 30
 )
 
 // Output represents the data structure for a PV Output as described
@@ -75,22 +86,24 @@ type Output struct {
 // body
 func NewOutput() Output {
 	return Output{
-		Generated:          outputUnsetInt,
-		Exported:           outputUnsetInt,
-		PeakPower:          outputUnsetInt,
-		Condition:          outputUnsetString,
-		MinTemp:            outputUnsetFloat,
-		MaxTemp:            outputUnsetFloat,
-		Comments:           outputUnsetString,
-		ImportPeak:         outputUnsetInt,
-		ImportOffPeak:      outputUnsetInt,
-		ImportShoulder:     outputUnsetInt,
-		ImportHighShoulder: outputUnsetInt,
-		Consumed:           outputUnsetInt,
-		ExportPeak:         outputUnsetInt,
-		ExportOffPeak:      outputUnsetInt,
-		ExportShoulder:     outputUnsetInt,
-		ExportHighShoulder: outputUnsetInt,
+		Generated:          UnsetInt,
+		Efficiency:         UnsetFloat,
+		Exported:           UnsetInt,
+		PeakPower:          UnsetInt,
+		Condition:          UnsetString,
+		MinTemp:            UnsetFloat,
+		MaxTemp:            UnsetFloat,
+		Comments:           UnsetString,
+		ImportPeak:         UnsetInt,
+		ImportOffPeak:      UnsetInt,
+		ImportShoulder:     UnsetInt,
+		ImportHighShoulder: UnsetInt,
+		Consumed:           UnsetInt,
+		ExportPeak:         UnsetInt,
+		ExportOffPeak:      UnsetInt,
+		ExportShoulder:     UnsetInt,
+		ExportHighShoulder: UnsetInt,
+		Insolation:         UnsetInt,
 	}
 }
 
@@ -101,55 +114,55 @@ func (o Output) encode() (url.Values, error) {
 	}
 
 	data.Set("d", o.Date.Format("20060102"))
-	if o.Generated != outputUnsetInt {
+	if o.Generated != UnsetInt {
 		data.Set("g", fmt.Sprintf("%d", o.Generated))
 	}
-	if o.Exported != outputUnsetInt {
+	if o.Exported != UnsetInt {
 		data.Set("e", fmt.Sprintf("%d", o.Exported))
 	}
-	if o.PeakPower != outputUnsetInt {
+	if o.PeakPower != UnsetInt {
 		data.Set("pp", fmt.Sprintf("%d", o.PeakPower))
 	}
 	if !o.PeakTime.IsZero() {
 		data.Set("pt", o.PeakTime.Format("15:04"))
 	}
-	if o.Condition != outputUnsetString {
+	if o.Condition != UnsetString {
 		data.Set("cd", o.Condition)
 	}
-	if o.MinTemp != outputUnsetFloat {
+	if o.MinTemp != UnsetFloat {
 		data.Set("tm", fmt.Sprintf("%0.1f", o.MinTemp))
 	}
-	if o.MaxTemp != outputUnsetFloat {
+	if o.MaxTemp != UnsetFloat {
 		data.Set("tx", fmt.Sprintf("%0.1f", o.MaxTemp))
 	}
-	if o.Comments != outputUnsetString {
+	if o.Comments != UnsetString {
 		data.Set("cm", o.Comments)
 	}
-	if o.ImportPeak != outputUnsetInt {
+	if o.ImportPeak != UnsetInt {
 		data.Set("ip", fmt.Sprintf("%d", o.ImportPeak))
 	}
-	if o.ImportOffPeak != outputUnsetInt {
+	if o.ImportOffPeak != UnsetInt {
 		data.Set("io", fmt.Sprintf("%d", o.ImportOffPeak))
 	}
-	if o.ImportShoulder != outputUnsetInt {
+	if o.ImportShoulder != UnsetInt {
 		data.Set("is", fmt.Sprintf("%d", o.ImportShoulder))
 	}
-	if o.ImportHighShoulder != outputUnsetInt {
+	if o.ImportHighShoulder != UnsetInt {
 		data.Set("ih", fmt.Sprintf("%d", o.ImportHighShoulder))
 	}
-	if o.Consumed != outputUnsetInt {
+	if o.Consumed != UnsetInt {
 		data.Set("c", fmt.Sprintf("%d", o.Consumed))
 	}
-	if o.ExportPeak != outputUnsetInt {
+	if o.ExportPeak != UnsetInt {
 		data.Set("ep", fmt.Sprintf("%d", o.ExportPeak))
 	}
-	if o.ExportOffPeak != outputUnsetInt {
+	if o.ExportOffPeak != UnsetInt {
 		data.Set("eo", fmt.Sprintf("%d", o.ExportOffPeak))
 	}
-	if o.ExportShoulder != outputUnsetInt {
+	if o.ExportShoulder != UnsetInt {
 		data.Set("es", fmt.Sprintf("%d", o.ExportShoulder))
 	}
-	if o.ExportHighShoulder != outputUnsetInt {
+	if o.ExportHighShoulder != UnsetInt {
 		data.Set("eh", fmt.Sprintf("%d", o.ExportHighShoulder))
 	}
 
@@ -166,83 +179,284 @@ func (o Output) Encode() (string, error) {
 	return data.Encode(), nil
 }
 
+// outputJSON is the JSON representation of an Output, unset fields are nil
+type outputJSON struct {
+	Date               *string  `json:"date,omitempty"`
+	Generated          *int     `json:"generated_wh,omitempty"`
+	Efficiency         *float64 `json:"efficiency_kwh_per_kw,omitempty"`
+	Exported           *int     `json:"exported_wh,omitempty"`
+	PeakPower          *int     `json:"peak_power_w,omitempty"`
+	PeakTime           *string  `json:"peak_time,omitempty"`
+	Condition          *string  `json:"condition,omitempty"`
+	MinTemp            *float64 `json:"min_temperature_c,omitempty"`
+	MaxTemp            *float64 `json:"max_temperature_c,omitempty"`
+	Comments           *string  `json:"comments,omitempty"`
+	ImportPeak         *int     `json:"import_peak_wh,omitempty"`
+	ImportOffPeak      *int     `json:"import_off_peak_wh,omitempty"`
+	ImportShoulder     *int     `json:"import_shoulder_wh,omitempty"`
+	ImportHighShoulder *int     `json:"import_high_shoulder_wh,omitempty"`
+	Consumed           *int     `json:"consumed_wh,omitempty"`
+	ExportPeak         *int     `json:"export_peak_wh,omitempty"`
+	ExportOffPeak      *int     `json:"export_off_peak_wh,omitempty"`
+	ExportShoulder     *int     `json:"export_shoulder_wh,omitempty"`
+	ExportHighShoulder *int     `json:"export_high_shoulder_wh,omitempty"`
+	Insolation         *int     `json:"insolation_wh,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler. Unset fields are left out, the Date
+// is encoded as RFC 3339 full-date (2006-01-02) and PeakTime as 15:04
+func (o Output) MarshalJSON() ([]byte, error) {
+	return json.Marshal(outputJSON{
+		Date:               jsonLayout(o.Date, "2006-01-02"),
+		Generated:          jsonInt(o.Generated),
+		Efficiency:         jsonFloat(o.Efficiency),
+		Exported:           jsonInt(o.Exported),
+		PeakPower:          jsonInt(o.PeakPower),
+		PeakTime:           jsonLayout(o.PeakTime, "15:04"),
+		Condition:          jsonString(o.Condition),
+		MinTemp:            jsonFloat(o.MinTemp),
+		MaxTemp:            jsonFloat(o.MaxTemp),
+		Comments:           jsonString(o.Comments),
+		ImportPeak:         jsonInt(o.ImportPeak),
+		ImportOffPeak:      jsonInt(o.ImportOffPeak),
+		ImportShoulder:     jsonInt(o.ImportShoulder),
+		ImportHighShoulder: jsonInt(o.ImportHighShoulder),
+		Consumed:           jsonInt(o.Consumed),
+		ExportPeak:         jsonInt(o.ExportPeak),
+		ExportOffPeak:      jsonInt(o.ExportOffPeak),
+		ExportShoulder:     jsonInt(o.ExportShoulder),
+		ExportHighShoulder: jsonInt(o.ExportHighShoulder),
+		Insolation:         jsonInt(o.Insolation),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Fields missing from the JSON
+// object are unset, like they are in NewOutput. Besides a full-date, the
+// Date can be a RFC 3339 timestamp
+func (o *Output) UnmarshalJSON(data []byte) error {
+	j := outputJSON{}
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	op := NewOutput()
+	if j.Date != nil {
+		var err error
+		if op.Date, err = time.Parse("2006-01-02", *j.Date); err != nil {
+			if op.Date, err = time.Parse(time.RFC3339, *j.Date); err != nil {
+				return fmt.Errorf("invalid date %q", *j.Date)
+			}
+		}
+	}
+	if j.PeakTime != nil {
+		var err error
+		if op.PeakTime, err = time.Parse("15:04", *j.PeakTime); err != nil {
+			return fmt.Errorf("invalid peak time %q", *j.PeakTime)
+		}
+	}
+
+	for _, f := range []struct {
+		src *int
+		dst *int
+	}{
+		{j.Generated, &op.Generated},
+		{j.Exported, &op.Exported},
+		{j.PeakPower, &op.PeakPower},
+		{j.ImportPeak, &op.ImportPeak},
+		{j.ImportOffPeak, &op.ImportOffPeak},
+		{j.ImportShoulder, &op.ImportShoulder},
+		{j.ImportHighShoulder, &op.ImportHighShoulder},
+		{j.Consumed, &op.Consumed},
+		{j.ExportPeak, &op.ExportPeak},
+		{j.ExportOffPeak, &op.ExportOffPeak},
+		{j.ExportShoulder, &op.ExportShoulder},
+		{j.ExportHighShoulder, &op.ExportHighShoulder},
+		{j.Insolation, &op.Insolation},
+	} {
+		if f.src != nil {
+			*f.dst = *f.src
+		}
+	}
+	for _, f := range []struct {
+		src *float64
+		dst *float64
+	}{
+		{j.Efficiency, &op.Efficiency},
+		{j.MinTemp, &op.MinTemp},
+		{j.MaxTemp, &op.MaxTemp},
+	} {
+		if f.src != nil {
+			*f.dst = *f.src
+		}
+	}
+	if j.Condition != nil {
+		op.Condition = *j.Condition
+	}
+	if j.Comments != nil {
+		op.Comments = *j.Comments
+	}
+
+	*o = op
+
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler, encoding the output as a
+// line of PVOutput's batch output format. Only the fields of this format
+// are included, the Condition and Comments can't hold commas or semicolons
+func (o Output) MarshalText() ([]byte, error) {
+	data, err := o.encode()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range []string{"cd", "cm"} {
+		if strings.ContainsAny(data.Get(key), ",;") {
+			return nil, fmt.Errorf("%s can't hold commas or semicolons", key)
+		}
+	}
+
+	return textLine(data, outputBatchKeys), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, decoding a line of
+// PVOutput's batch output format as written by MarshalText. Empty fields are
+// unset
+func (o *Output) UnmarshalText(text []byte) error {
+	values, err := textFields(text, outputBatchKeys)
+	if err != nil {
+		return err
+	}
+
+	op := NewOutput()
+	if op.Date, err = time.Parse("20060102", values["d"]); err != nil {
+		return errors.New("invalid date")
+	}
+	if pt, ok := values["pt"]; ok {
+		if op.PeakTime, err = time.Parse("15:04", pt); err != nil {
+			return fmt.Errorf("invalid pt %q", pt)
+		}
+	}
+	if cd, ok := values["cd"]; ok {
+		op.Condition = cd
+	}
+	if cm, ok := values["cm"]; ok {
+		op.Comments = cm
+	}
+
+	for _, f := range []struct {
+		key string
+		dst *int
+	}{
+		{"g", &op.Generated},
+		{"e", &op.Exported},
+		{"c", &op.Consumed},
+		{"pp", &op.PeakPower},
+		{"ip", &op.ImportPeak},
+		{"io", &op.ImportOffPeak},
+		{"is", &op.ImportShoulder},
+	} {
+		if err := textInt(values, f.key, f.dst); err != nil {
+			return err
+		}
+	}
+	if err := textFloat(values, "tm", &op.MinTemp); err != nil {
+		return err
+	}
+	if err := textFloat(values, "tx", &op.MaxTemp); err != nil {
+		return err
+	}
+
+	*o = op
+
+	return nil
+}
+
+// decodeOutput decodes a single output. Fields PVOutput returns as NaN, or
+// leaves out of older responses, are unset like they are in NewOutput
 func decodeOutput(input string) (op Output, err error) {
+	op = NewOutput()
+
 	fields := strings.Split(strings.TrimSpace(input), ",")
 	if len(fields) < 14 {
+		err = errors.New("not enough fields in output")
 		return
 	}
+
 	// parse Date field from fields[0]
 	op.Date, err = time.Parse("20060102", fields[0])
 	if err != nil {
 		return
 	}
 	// parse Generated field from fields[1]
-	op.Generated, err = strconv.Atoi(fields[1])
+	op.Generated, err = decodeInt(fields[1])
 	if err != nil {
 		return
 	}
 
 	// parse Efficiency field from fields[8]
-	op.Efficiency, err = strconv.ParseFloat(fields[2], 64)
+	op.Efficiency, err = decodeFloat(fields[2])
 	if err != nil {
 		return
 	}
 
 	// parse Exported field from fields[3]
-	op.Exported, err = strconv.Atoi(fields[3])
+	op.Exported, err = decodeInt(fields[3])
 	if err != nil {
 		return
 	}
 
 	// parse Consumed field from fields[4]
-	op.Consumed, err = strconv.Atoi(fields[4])
+	op.Consumed, err = decodeInt(fields[4])
 	if err != nil {
 		return
 	}
 
 	// parse PeakPower field from fields[5]
-	op.PeakPower, err = strconv.Atoi(fields[5])
+	op.PeakPower, err = decodeInt(fields[5])
 	if err != nil {
 		return
 	}
 
-	// parse PeakTime field from fields[6]
-	op.PeakTime, err = time.Parse("15:04", fields[6])
-	if err != nil {
-		return
+	// parse PeakTime field from fields[6], which is empty or NaN when unset
+	if fields[6] != "" && fields[6] != "NaN" {
+		op.PeakTime, err = time.Parse("15:04", fields[6])
+		if err != nil {
+			return
+		}
 	}
 	// get Condition field from fields[7]
 	op.Condition = fields[7]
 	// parse MinTemp field from fields[8]
-	op.MinTemp, err = strconv.ParseFloat(fields[8], 64)
+	op.MinTemp, err = decodeFloat(fields[8])
 	if err != nil {
 		return
 	}
 	// parse MaxTemp field from fields[9]
-	op.MaxTemp, err = strconv.ParseFloat(fields[9], 64)
+	op.MaxTemp, err = decodeFloat(fields[9])
 	if err != nil {
 		return
 	}
 	// parse ImportPeak field from fields[10]
-	op.ImportPeak, err = strconv.Atoi(fields[10])
+	op.ImportPeak, err = decodeInt(fields[10])
 	if err != nil {
 		return
 	}
 
 	// parse ImportOffPeak field from fields[11]
-	op.ImportOffPeak, err = strconv.Atoi(fields[11])
+	op.ImportOffPeak, err = decodeInt(fields[11])
 	if err != nil {
 		return
 	}
 
 	// parse ImportShoulder field from fields[12]
-	op.ImportShoulder, err = strconv.Atoi(fields[12])
+	op.ImportShoulder, err = decodeInt(fields[12])
 	if err != nil {
 		return
 	}
 
 	// parse ImportHighShoulder field from fields[13]
-	op.ImportHighShoulder, err = strconv.Atoi(fields[13])
+	op.ImportHighShoulder, err = decodeInt(fields[13])
 	if err != nil {
 		return
 	}
@@ -252,25 +466,25 @@ func decodeOutput(input string) (op Output, err error) {
 	}
 
 	// parse ExportPeak field from fields[14]
-	op.ExportPeak, err = strconv.Atoi(fields[14])
+	op.ExportPeak, err = decodeInt(fields[14])
 	if err != nil {
 		return
 	}
 
 	// parse ExportOffPeak field from fields[15]
-	op.ExportOffPeak, err = strconv.Atoi(fields[15])
+	op.ExportOffPeak, err = decodeInt(fields[15])
 	if err != nil {
 		return
 	}
 
 	// parse ExportShoulder field from fields[16]
-	op.ExportShoulder, err = strconv.Atoi(fields[16])
+	op.ExportShoulder, err = decodeInt(fields[16])
 	if err != nil {
 		return
 	}
 
 	// parse ExportHighShoulder field from fields[17]
-	op.ExportHighShoulder, err = strconv.Atoi(fields[17])
+	op.ExportHighShoulder, err = decodeInt(fields[17])
 	if err != nil {
 		return
 	}
@@ -280,7 +494,7 @@ func decodeOutput(input string) (op Output, err error) {
 	}
 
 	// parse Insolation field from fields[18]
-	op.Insolation, err = strconv.Atoi(fields[18])
+	op.Insolation, err = decodeInt(fields[18])
 	if err != nil {
 		return
 	}
@@ -316,3 +530,45 @@ func (b BatchOutput) Encode() (string, error) {
 
 	return fmt.Sprintf("data=%s", strings.Join(items, ";")), nil
 }
+
+// OutputUploader uploads outputs one by one or in batches, it is implemented
+// by API
+type OutputUploader interface {
+	AddOutput(o Output) error
+	AddBatchOutput(b BatchOutput) error
+}
+
+// UploadOutputs uploads given outputs in batches of BatchOutputMaxSizeDonating
+// when donating and one by one otherwise, single outputs using AddOutput.
+// After every batch, uploaded is called with it when set. The error of the
+// first failing upload is returned as is
+func UploadOutputs(u OutputUploader, outputs BatchOutput, donating bool, uploaded func(b BatchOutput)) error {
+	size := BatchOutputMaxSize
+	if donating {
+		size = BatchOutputMaxSizeDonating
+	}
+
+	for start := 0; start < len(outputs); start += size {
+		end := start + size
+		if end > len(outputs) {
+			end = len(outputs)
+		}
+
+		batch := outputs[start:end]
+		var err error
+		if len(batch) == 1 {
+			err = u.AddOutput(batch[0])
+		} else {
+			err = u.AddBatchOutput(batch)
+		}
+		if err != nil {
+			return err
+		}
+
+		if uploaded != nil {
+			uploaded(batch)
+		}
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package pvoutput
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"testing"
 	"time"
@@ -177,6 +178,23 @@ func TestDecodeOutput(t *testing.T) {
 	if assert.NoError(t, err) {
 		assert.Equal(t, 12910, output.Insolation)
 	}
+
+	// values PVOutput doesn't have, or that are missing from older
+	// responses, are unset
+	output, err = decodeOutput("20110327,4413,NaN,NaN,NaN,NaN,,,NaN,NaN,NaN,NaN,NaN,NaN")
+	if assert.NoError(t, err) {
+		assert.Equal(t, UnsetFloat, output.Efficiency)
+		assert.Equal(t, UnsetInt, output.Exported)
+		assert.True(t, output.PeakTime.IsZero())
+		assert.Equal(t, UnsetFloat, output.MinTemp)
+		assert.Equal(t, UnsetInt, output.ImportPeak)
+		assert.Equal(t, UnsetInt, output.ExportPeak)
+		assert.Equal(t, UnsetInt, output.Insolation)
+		assert.Equal(t, UnsetString, output.Comments)
+	}
+
+	_, err = decodeOutput("20110327,4413,0.460,1234")
+	assert.EqualError(t, err, "not enough fields in output")
 }
 
 func TestEncodeBatchOutput(t *testing.T) {
@@ -218,3 +236,134 @@ func TestEncodeBatchOutput(t *testing.T) {
 		assert.Equal(t, "data=20150101,850,,1100,,,,10.4,20.5", result)
 	}
 }
+
+func TestOutputJSON(t *testing.T) {
+	o := NewOutput()
+	o.Date = time.Date(2020, 8, 18, 0, 0, 0, 0, time.UTC)
+	o.Generated = 12000
+	o.PeakPower = 3100
+	o.PeakTime = time.Date(0, 1, 1, 12, 5, 0, 0, time.UTC)
+	o.Condition = "Fine"
+	o.MinTemp = -1.5
+	o.Comments = "new inverter"
+	o.ExportPeak = 0
+
+	data, err := json.Marshal(o)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"date": "2020-08-18",
+		"generated_wh": 12000,
+		"peak_power_w": 3100,
+		"peak_time": "12:05",
+		"condition": "Fine",
+		"min_temperature_c": -1.5,
+		"comments": "new inverter",
+		"export_peak_wh": 0
+	}`, string(data))
+
+	decoded := Output{}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, o, decoded)
+
+	data, err = json.Marshal(NewOutput())
+	require.NoError(t, err)
+	assert.Equal(t, "{}", string(data))
+
+	// the date can be a timestamp as well
+	require.NoError(t, json.Unmarshal([]byte(`{"date":"2020-08-18T00:00:00Z"}`), &decoded))
+	assert.Equal(t, o.Date, decoded.Date)
+
+	assert.EqualError(t, json.Unmarshal([]byte(`{"date":"18-08-2020"}`), &decoded), `invalid date "18-08-2020"`)
+	assert.EqualError(t, json.Unmarshal([]byte(`{"peak_time":"noon"}`), &decoded), `invalid peak time "noon"`)
+}
+
+func TestOutputText(t *testing.T) {
+	o := NewOutput()
+	o.Date = time.Date(2020, 8, 18, 0, 0, 0, 0, time.UTC)
+	o.Generated = 12000
+	o.Consumed = 8000
+	o.PeakTime = time.Date(0, 1, 1, 12, 5, 0, 0, time.UTC)
+	o.Condition = "Fine"
+	o.MaxTemp = 24.5
+	o.ImportOffPeak = 1500
+
+	text, err := o.MarshalText()
+	require.NoError(t, err)
+	assert.Equal(t, "20200818,12000,,8000,,12:05,Fine,,24.5,,,1500", string(text))
+
+	decoded := Output{}
+	require.NoError(t, decoded.UnmarshalText(text))
+	assert.Equal(t, o, decoded)
+
+	o.Comments = "cloudy, then sunny"
+	_, err = o.MarshalText()
+	assert.EqualError(t, err, "cm can't hold commas or semicolons")
+
+	for text, msg := range map[string]string{
+		"":                       "invalid date",
+		"20200818,lots":          `invalid g "lots"`,
+		"20200818,,,,,noon":      `invalid pt "noon"`,
+		"20200818,,,,,,,,,,,,,,": "expected at most 13 fields",
+	} {
+		assert.EqualError(t, decoded.UnmarshalText([]byte(text)), msg, text)
+	}
+}
+
+// outputRecorder records the outputs uploaded one by one and in batches
+type outputRecorder struct {
+	single  []Output
+	batches []BatchOutput
+	err     error
+}
+
+func (r *outputRecorder) AddOutput(o Output) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.single = append(r.single, o)
+
+	return nil
+}
+
+func (r *outputRecorder) AddBatchOutput(b BatchOutput) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.batches = append(r.batches, b)
+
+	return nil
+}
+
+func TestUploadOutputs(t *testing.T) {
+	outputs := BatchOutput{}
+	for d := 1; d <= 150; d++ {
+		o := NewOutput()
+		o.Date = time.Date(2026, 1, d, 0, 0, 0, 0, time.UTC)
+		outputs = append(outputs, o)
+	}
+
+	// one by one when not donating
+	r := &outputRecorder{}
+	uploaded := 0
+	require.NoError(t, UploadOutputs(r, outputs[:3], false, func(b BatchOutput) { uploaded += len(b) }))
+	assert.Len(t, r.single, 3)
+	assert.Empty(t, r.batches)
+	assert.Equal(t, 3, uploaded)
+
+	// in batches when donating, a single output left is uploaded on its own
+	r = &outputRecorder{}
+	require.NoError(t, UploadOutputs(r, outputs[:101], true, nil))
+	if assert.Len(t, r.batches, 1) {
+		assert.Len(t, r.batches[0], 100)
+	}
+	if assert.Len(t, r.single, 1) {
+		assert.Equal(t, outputs[100].Date, r.single[0].Date)
+	}
+
+	// the first error stops the upload
+	r = &outputRecorder{err: ErrRateLimitExceeded}
+	uploaded = 0
+	err := UploadOutputs(r, outputs, true, func(b BatchOutput) { uploaded += len(b) })
+	assert.Equal(t, ErrRateLimitExceeded, err)
+	assert.Equal(t, 0, uploaded)
+}
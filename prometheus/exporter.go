@@ -0,0 +1,353 @@
+// Package prometheus exposes the status and statistics of a PVOutput system
+// as Prometheus metrics. The Exporter polls PVOutput, mirrors the statuses
+// uploaded locally, or both, and serves the metrics in Prometheus' text
+// format
+package prometheus
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/skoef/pvoutput"
+)
+
+// DefaultInterval is a polling interval fitting PVOutput's rate limit next
+// to regular status uploads
+const DefaultInterval = 5 * time.Minute
+
+// Sources of status metrics, as set in their source label
+const (
+	SourcePVOutput = "pvoutput"
+	SourceLocal    = "local"
+)
+
+// polled requests, as set in the request label of poll errors
+const (
+	requestStatus    = "getstatus"
+	requestStatistic = "getstatistic"
+)
+
+// Source reads the latest status and lifetime statistics of a system, it is
+// implemented by pvoutput.API
+type Source interface {
+	GetStatus(t time.Time) (pvoutput.Status, error)
+	GetStatistic(from, to time.Time) (pvoutput.Statistic, error)
+}
+
+// Uploader uploads statuses and outputs, it is implemented by pvoutput.API
+type Uploader interface {
+	AddStatus(s pvoutput.Status) error
+	AddBatchStatus(b pvoutput.BatchStatus) error
+	AddOutput(o pvoutput.Output) error
+	AddBatchOutput(b pvoutput.BatchOutput) error
+}
+
+// Exporter collects metrics of a system and serves them as http.Handler
+type Exporter struct {
+	// Source is polled by Poll and Run, it can be nil when only local
+	// statuses are mirrored
+	Source Source
+	// Location is the time zone of the system, which PVOutput reports its
+	// times in. The local time zone by default
+	Location *time.Location
+	now      func() time.Time
+
+	mu           sync.Mutex
+	remote       *pvoutput.Status
+	local        *pvoutput.Status
+	statistic    *pvoutput.Statistic
+	lastPoll     time.Time
+	pollErrors   map[string]int
+	uploads      int
+	uploadErrors int
+	mirrored     bool
+	limiters     []pvoutput.RateLimited
+}
+
+// NewExporter returns a new Exporter polling given Source, which can be nil
+func NewExporter(s Source) *Exporter {
+	e := &Exporter{
+		Source:     s,
+		Location:   time.Local,
+		now:        time.Now,
+		pollErrors: map[string]int{requestStatus: 0, requestStatistic: 0},
+	}
+
+	if rl, ok := s.(pvoutput.RateLimited); ok {
+		e.limiters = append(e.limiters, rl)
+	}
+
+	return e
+}
+
+// Poll reads the latest status and the lifetime statistics from the Source.
+// Both are requested, the first error is returned
+func (e *Exporter) Poll() error {
+	if e.Source == nil {
+		return errors.New("no source to poll")
+	}
+
+	status, statusErr := e.Source.GetStatus(time.Time{})
+	statistic, statisticErr := e.Source.GetStatistic(time.Time{}, time.Time{})
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if statusErr != nil {
+		e.pollErrors[requestStatus]++
+	} else {
+		// PVOutput reports the time without time zone
+		t := status.DateTime
+		status.DateTime = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, e.Location)
+		e.remote = &status
+	}
+
+	if statisticErr != nil {
+		e.pollErrors[requestStatistic]++
+	} else {
+		e.statistic = &statistic
+	}
+
+	if statusErr != nil {
+		return statusErr
+	}
+	if statisticErr != nil {
+		return statisticErr
+	}
+
+	e.lastPoll = e.now()
+
+	return nil
+}
+
+// Run polls the Source right away and then every interval, until given
+// channel is closed. Errors are counted in the metrics. Without Source, Run
+// returns right away
+func (e *Exporter) Run(interval time.Duration, stop <-chan struct{}) {
+	if e.Source == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		e.Poll()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Observe records a status uploaded locally, it is exposed with source
+// label local when it is the most recent one observed
+func (e *Exporter) Observe(s pvoutput.Status) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.local == nil || !s.DateTime.Before(e.local.DateTime) {
+		e.local = &s
+	}
+}
+
+// uploaded records the result of an upload
+func (e *Exporter) uploaded(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.uploads++
+	if err != nil {
+		e.uploadErrors++
+	}
+}
+
+// Mirror returns an Uploader passing uploads on to given Uploader, observing
+// the statuses that are uploaded successfully and counting uploads and
+// upload errors
+func (e *Exporter) Mirror(u Uploader) Uploader {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.mirrored = true
+	if rl, ok := u.(pvoutput.RateLimited); ok {
+		e.limiters = append(e.limiters, rl)
+	}
+
+	return mirror{exporter: e, uploader: u}
+}
+
+// mirror is the Uploader returned by Mirror
+type mirror struct {
+	exporter *Exporter
+	uploader Uploader
+}
+
+func (m mirror) AddStatus(s pvoutput.Status) error {
+	err := m.uploader.AddStatus(s)
+	m.exporter.uploaded(err)
+	if err == nil {
+		m.exporter.Observe(s)
+	}
+
+	return err
+}
+
+func (m mirror) AddBatchStatus(b pvoutput.BatchStatus) error {
+	err := m.uploader.AddBatchStatus(b)
+	m.exporter.uploaded(err)
+	if err == nil {
+		for _, s := range b {
+			m.exporter.Observe(s)
+		}
+	}
+
+	return err
+}
+
+func (m mirror) AddOutput(o pvoutput.Output) error {
+	err := m.uploader.AddOutput(o)
+	m.exporter.uploaded(err)
+
+	return err
+}
+
+func (m mirror) AddBatchOutput(b pvoutput.BatchOutput) error {
+	err := m.uploader.AddBatchOutput(b)
+	m.exporter.uploaded(err)
+
+	return err
+}
+
+// statusMetrics holds the metrics taken from statuses
+type statusMetrics struct {
+	timestamp, generating, generated, consuming, consumed, temperature, voltage, output *metric
+}
+
+// add adds the samples of given status from given source
+func (m statusMetrics) add(s pvoutput.Status, source string) {
+	m.timestamp.add(float64(s.DateTime.Unix()), "source", source)
+
+	cumulative := s.Cumulative
+	if s.Generating != pvoutput.UnsetInt {
+		m.generating.add(float64(s.Generating), "source", source)
+	}
+	// lifetime energy values are left out, they don't tell the energy today
+	if s.Generated != pvoutput.UnsetInt && cumulative != pvoutput.StatusCumulativeAll && cumulative != pvoutput.StatusCumulativeGenerating {
+		m.generated.add(float64(s.Generated), "source", source)
+	}
+	if s.Consuming != pvoutput.UnsetInt {
+		m.consuming.add(float64(s.Consuming), "source", source)
+	}
+	if s.Consumed != pvoutput.UnsetInt && cumulative != pvoutput.StatusCumulativeAll && cumulative != pvoutput.StatusCumulativeConsuming {
+		m.consumed.add(float64(s.Consumed), "source", source)
+	}
+	if s.Temperature != pvoutput.UnsetFloat {
+		m.temperature.add(s.Temperature, "source", source)
+	}
+	if s.Voltage != pvoutput.UnsetFloat {
+		m.voltage.add(s.Voltage, "source", source)
+	}
+	if s.Output != pvoutput.UnsetFloat && source == SourcePVOutput {
+		m.output.add(s.Output, "source", source)
+	}
+}
+
+// metrics returns the current metrics
+func (e *Exporter) metrics() []*metric {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	sm := statusMetrics{
+		timestamp:   &metric{name: "pvoutput_status_timestamp_seconds", help: "Time of the latest status.", typ: typeGauge},
+		generating:  &metric{name: "pvoutput_generating_watts", help: "Power being generated.", typ: typeGauge},
+		generated:   &metric{name: "pvoutput_generated_today_watt_hours", help: "Energy generated today.", typ: typeGauge},
+		consuming:   &metric{name: "pvoutput_consuming_watts", help: "Power being consumed.", typ: typeGauge},
+		consumed:    &metric{name: "pvoutput_consumed_today_watt_hours", help: "Energy consumed today.", typ: typeGauge},
+		temperature: &metric{name: "pvoutput_temperature_celsius", help: "Temperature.", typ: typeGauge},
+		voltage:     &metric{name: "pvoutput_voltage_volts", help: "Voltage.", typ: typeGauge},
+		output:      &metric{name: "pvoutput_normalised_output_kw_per_kw", help: "Power being generated per kW of system size.", typ: typeGauge},
+	}
+	if e.remote != nil {
+		sm.add(*e.remote, SourcePVOutput)
+	}
+	if e.local != nil {
+		sm.add(*e.local, SourceLocal)
+	}
+
+	generated := &metric{name: "pvoutput_lifetime_generated_watt_hours_total", help: "Energy generated over the system's lifetime.", typ: typeCounter}
+	exported := &metric{name: "pvoutput_lifetime_exported_watt_hours_total", help: "Energy exported over the system's lifetime.", typ: typeCounter}
+	consumed := &metric{name: "pvoutput_lifetime_consumed_watt_hours_total", help: "Energy consumed over the system's lifetime.", typ: typeCounter}
+	outputs := &metric{name: "pvoutput_outputs", help: "Number of daily outputs.", typ: typeGauge}
+	efficiency := &metric{name: "pvoutput_average_efficiency_kwh_per_kw", help: "Average daily energy generated per kW of system size.", typ: typeGauge}
+	record := &metric{name: "pvoutput_record_efficiency_kwh_per_kw", help: "Highest daily energy generated per kW of system size.", typ: typeGauge}
+	if st := e.statistic; st != nil {
+		for _, v := range []struct {
+			m     *metric
+			value int
+		}{
+			{generated, st.Generated},
+			{exported, st.Exported},
+			{consumed, st.Consumed},
+			{outputs, st.Outputs},
+		} {
+			if v.value != pvoutput.UnsetInt {
+				v.m.add(float64(v.value))
+			}
+		}
+		if st.AverageEfficiency != pvoutput.UnsetFloat {
+			efficiency.add(st.AverageEfficiency)
+		}
+		if st.RecordEfficiency != pvoutput.UnsetFloat {
+			record.add(st.RecordEfficiency)
+		}
+	}
+
+	lastPoll := &metric{name: "pvoutput_last_poll_success_timestamp_seconds", help: "Time of the last poll without errors.", typ: typeGauge}
+	pollErrors := &metric{name: "pvoutput_poll_errors_total", help: "Number of failed requests while polling.", typ: typeCounter}
+	if e.Source != nil {
+		if !e.lastPoll.IsZero() {
+			lastPoll.add(float64(e.lastPoll.Unix()))
+		}
+		for _, request := range []string{requestStatus, requestStatistic} {
+			pollErrors.add(float64(e.pollErrors[request]), "request", request)
+		}
+	}
+
+	uploads := &metric{name: "pvoutput_uploads_total", help: "Number of uploads.", typ: typeCounter}
+	uploadErrors := &metric{name: "pvoutput_upload_errors_total", help: "Number of failed uploads.", typ: typeCounter}
+	if e.mirrored {
+		uploads.add(float64(e.uploads))
+		uploadErrors.add(float64(e.uploadErrors))
+	}
+
+	limit := &metric{name: "pvoutput_rate_limit_requests_per_hour", help: "Requests allowed per hour.", typ: typeGauge}
+	remaining := &metric{name: "pvoutput_rate_limit_remaining", help: "Requests left until the rate limit resets.", typ: typeGauge}
+	reset := &metric{name: "pvoutput_rate_limit_reset_timestamp_seconds", help: "Time the rate limit resets.", typ: typeGauge}
+	for _, rl := range e.limiters {
+		if l, known := rl.RateLimit(); known {
+			limit.add(float64(l.Limit))
+			remaining.add(float64(l.Remaining))
+			reset.add(float64(l.Reset.Unix()))
+			break
+		}
+	}
+
+	return []*metric{
+		sm.timestamp, sm.generating, sm.generated, sm.consuming, sm.consumed, sm.temperature, sm.voltage, sm.output,
+		generated, exported, consumed, outputs, efficiency, record,
+		lastPoll, pollErrors, uploads, uploadErrors,
+		limit, remaining, reset,
+	}
+}
+
+// ServeHTTP implements http.Handler, writing the metrics in Prometheus'
+// text format
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeMetrics(w, e.metrics())
+}
@@ -0,0 +1,206 @@
+package prometheus
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/skoef/pvoutput"
+	"github.com/skoef/pvoutput/internal/pvtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSource returns the configured status and statistic or errors
+type fakeSource struct {
+	status       pvoutput.Status
+	statistic    pvoutput.Statistic
+	statusErr    error
+	statisticErr error
+	rateLimit    pvoutput.RateLimit
+}
+
+func (s *fakeSource) GetStatus(t time.Time) (pvoutput.Status, error) {
+	return s.status, s.statusErr
+}
+
+func (s *fakeSource) GetStatistic(from, to time.Time) (pvoutput.Statistic, error) {
+	return s.statistic, s.statisticErr
+}
+
+func (s *fakeSource) RateLimit() (pvoutput.RateLimit, bool) {
+	return s.rateLimit, !s.rateLimit.Reset.IsZero()
+}
+
+// scrape returns the metrics served by given exporter
+func scrape(t *testing.T, e *Exporter) string {
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, 200, rec.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+
+	return rec.Body.String()
+}
+
+func TestExporterPoll(t *testing.T) {
+	status := pvoutput.NewStatus()
+	status.DateTime = time.Date(2026, 6, 1, 12, 30, 0, 0, time.UTC)
+	status.Generated = 12936
+	status.Generating = 2020
+	status.Output = 0.505
+	status.Temperature = 15.3
+
+	source := &fakeSource{
+		status: status,
+		statistic: pvoutput.Statistic{
+			Generated:         24600,
+			Exported:          14220,
+			Outputs:           27,
+			AverageEfficiency: 3.358,
+			RecordEfficiency:  4.653,
+			Consumed:          pvoutput.UnsetInt,
+		},
+		rateLimit: pvoutput.RateLimit{Limit: 60, Remaining: 42, Reset: time.Unix(1780315200, 0)},
+	}
+
+	e := NewExporter(source)
+	e.Location = time.FixedZone("CEST", 2*3600)
+	e.now = func() time.Time { return time.Unix(1780310000, 0) }
+	require.NoError(t, e.Poll())
+
+	assert.Equal(t, `# HELP pvoutput_status_timestamp_seconds Time of the latest status.
+# TYPE pvoutput_status_timestamp_seconds gauge
+pvoutput_status_timestamp_seconds{source="pvoutput"} 1.7803098e+09
+# HELP pvoutput_generating_watts Power being generated.
+# TYPE pvoutput_generating_watts gauge
+pvoutput_generating_watts{source="pvoutput"} 2020
+# HELP pvoutput_generated_today_watt_hours Energy generated today.
+# TYPE pvoutput_generated_today_watt_hours gauge
+pvoutput_generated_today_watt_hours{source="pvoutput"} 12936
+# HELP pvoutput_temperature_celsius Temperature.
+# TYPE pvoutput_temperature_celsius gauge
+pvoutput_temperature_celsius{source="pvoutput"} 15.3
+# HELP pvoutput_normalised_output_kw_per_kw Power being generated per kW of system size.
+# TYPE pvoutput_normalised_output_kw_per_kw gauge
+pvoutput_normalised_output_kw_per_kw{source="pvoutput"} 0.505
+# HELP pvoutput_lifetime_generated_watt_hours_total Energy generated over the system's lifetime.
+# TYPE pvoutput_lifetime_generated_watt_hours_total counter
+pvoutput_lifetime_generated_watt_hours_total 24600
+# HELP pvoutput_lifetime_exported_watt_hours_total Energy exported over the system's lifetime.
+# TYPE pvoutput_lifetime_exported_watt_hours_total counter
+pvoutput_lifetime_exported_watt_hours_total 14220
+# HELP pvoutput_outputs Number of daily outputs.
+# TYPE pvoutput_outputs gauge
+pvoutput_outputs 27
+# HELP pvoutput_average_efficiency_kwh_per_kw Average daily energy generated per kW of system size.
+# TYPE pvoutput_average_efficiency_kwh_per_kw gauge
+pvoutput_average_efficiency_kwh_per_kw 3.358
+# HELP pvoutput_record_efficiency_kwh_per_kw Highest daily energy generated per kW of system size.
+# TYPE pvoutput_record_efficiency_kwh_per_kw gauge
+pvoutput_record_efficiency_kwh_per_kw 4.653
+# HELP pvoutput_last_poll_success_timestamp_seconds Time of the last poll without errors.
+# TYPE pvoutput_last_poll_success_timestamp_seconds gauge
+pvoutput_last_poll_success_timestamp_seconds 1.78031e+09
+# HELP pvoutput_poll_errors_total Number of failed requests while polling.
+# TYPE pvoutput_poll_errors_total counter
+pvoutput_poll_errors_total{request="getstatus"} 0
+pvoutput_poll_errors_total{request="getstatistic"} 0
+# HELP pvoutput_rate_limit_requests_per_hour Requests allowed per hour.
+# TYPE pvoutput_rate_limit_requests_per_hour gauge
+pvoutput_rate_limit_requests_per_hour 60
+# HELP pvoutput_rate_limit_remaining Requests left until the rate limit resets.
+# TYPE pvoutput_rate_limit_remaining gauge
+pvoutput_rate_limit_remaining 42
+# HELP pvoutput_rate_limit_reset_timestamp_seconds Time the rate limit resets.
+# TYPE pvoutput_rate_limit_reset_timestamp_seconds gauge
+pvoutput_rate_limit_reset_timestamp_seconds 1.7803152e+09
+`, scrape(t, e))
+
+	// errors are counted, the previous values are kept
+	source.statusErr = errors.New("Bad request 400: No status found")
+	assert.EqualError(t, e.Poll(), "Bad request 400: No status found")
+	source.statusErr, source.statisticErr = nil, errors.New("Unauthorized 401: Invalid API Key")
+	assert.EqualError(t, e.Poll(), "Unauthorized 401: Invalid API Key")
+
+	metrics := scrape(t, e)
+	assert.Contains(t, metrics, `pvoutput_poll_errors_total{request="getstatus"} 1`+"\n")
+	assert.Contains(t, metrics, `pvoutput_poll_errors_total{request="getstatistic"} 1`+"\n")
+	assert.Contains(t, metrics, "pvoutput_lifetime_generated_watt_hours_total 24600\n")
+	assert.Contains(t, metrics, "pvoutput_last_poll_success_timestamp_seconds 1.78031e+09\n")
+}
+
+func TestExporterMirror(t *testing.T) {
+	e := NewExporter(nil)
+	uploader := &pvtest.Uploader{}
+	mirrored := e.Mirror(uploader)
+
+	// nothing but the upload counters before the first upload
+	assert.Equal(t, `# HELP pvoutput_uploads_total Number of uploads.
+# TYPE pvoutput_uploads_total counter
+pvoutput_uploads_total 0
+# HELP pvoutput_upload_errors_total Number of failed uploads.
+# TYPE pvoutput_upload_errors_total counter
+pvoutput_upload_errors_total 0
+`, scrape(t, e))
+
+	newStatus := func(minute, generating int) pvoutput.Status {
+		s := pvoutput.NewStatus()
+		s.DateTime = time.Date(2026, 6, 1, 12, minute, 0, 0, time.UTC)
+		s.Generating = generating
+		s.Generated = 100000
+		s.Cumulative = pvoutput.StatusCumulativeGenerating
+		s.Consumed = 2000
+		s.Voltage = 231.2
+
+		return s
+	}
+
+	// without source, there is nothing to poll
+	assert.EqualError(t, e.Poll(), "no source to poll")
+	done := make(chan struct{})
+	go func() {
+		e.Run(time.Millisecond, make(chan struct{}))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run didn't return without source")
+	}
+
+	require.NoError(t, mirrored.AddBatchStatus(pvoutput.BatchStatus{newStatus(5, 1500), newStatus(10, 1600)}))
+	// an older status doesn't replace the latest
+	require.NoError(t, mirrored.AddStatus(newStatus(0, 1400)))
+	require.NoError(t, mirrored.AddOutput(pvoutput.NewOutput()))
+
+	// failed uploads are counted, their statuses aren't observed
+	uploader.Err = errors.New("Bad request 400: Moon Powered")
+	assert.Error(t, mirrored.AddStatus(newStatus(15, 1700)))
+	assert.Error(t, mirrored.AddBatchOutput(pvoutput.BatchOutput{pvoutput.NewOutput()}))
+
+	assert.Equal(t, `# HELP pvoutput_status_timestamp_seconds Time of the latest status.
+# TYPE pvoutput_status_timestamp_seconds gauge
+pvoutput_status_timestamp_seconds{source="local"} 1.7803158e+09
+# HELP pvoutput_generating_watts Power being generated.
+# TYPE pvoutput_generating_watts gauge
+pvoutput_generating_watts{source="local"} 1600
+# HELP pvoutput_consumed_today_watt_hours Energy consumed today.
+# TYPE pvoutput_consumed_today_watt_hours gauge
+pvoutput_consumed_today_watt_hours{source="local"} 2000
+# HELP pvoutput_voltage_volts Voltage.
+# TYPE pvoutput_voltage_volts gauge
+pvoutput_voltage_volts{source="local"} 231.2
+# HELP pvoutput_uploads_total Number of uploads.
+# TYPE pvoutput_uploads_total counter
+pvoutput_uploads_total 5
+# HELP pvoutput_upload_errors_total Number of failed uploads.
+# TYPE pvoutput_upload_errors_total counter
+pvoutput_upload_errors_total 2
+`, scrape(t, e))
+}
+
+func TestFormatLabels(t *testing.T) {
+	assert.Equal(t, "", formatLabels(nil))
+	assert.Equal(t, `{a="1",b="say \"hi\"\n"}`, formatLabels(map[string]string{"b": "say \"hi\"\n", "a": "1"}))
+}
@@ -0,0 +1,98 @@
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// metric types
+const (
+	typeGauge   = "gauge"
+	typeCounter = "counter"
+)
+
+// sample is a single value of a metric with its labels
+type sample struct {
+	labels map[string]string
+	value  float64
+}
+
+// metric is a metric family as written in Prometheus' text format
+type metric struct {
+	name    string
+	help    string
+	typ     string
+	samples []sample
+}
+
+// add adds a sample with given value and labels as name/value pairs
+func (m *metric) add(value float64, labels ...string) {
+	s := sample{labels: map[string]string{}, value: value}
+	for i := 0; i+1 < len(labels); i += 2 {
+		s.labels[labels[i]] = labels[i+1]
+	}
+
+	m.samples = append(m.samples, s)
+}
+
+// formatValue formats a sample value as Prometheus expects it
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// labelEscaper escapes label values
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels formats given labels sorted by name, or returns an empty
+// string when there are none
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	names := []string{}
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := []string{}
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, labelEscaper.Replace(labels[name])))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// writeMetrics writes given metrics in Prometheus' text format, leaving out
+// metrics without samples
+func writeMetrics(w io.Writer, metrics []*metric) error {
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		if len(m.samples) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(bw, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(bw, "# TYPE %s %s\n", m.name, m.typ)
+		for _, s := range m.samples {
+			fmt.Fprintf(bw, "%s%s %s\n", m.name, formatLabels(s.labels), formatValue(s.value))
+		}
+	}
+
+	return bw.Flush()
+}
@@ -1,6 +1,136 @@
 package pvoutput
 
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
 // PVEncodable is an interface that API objects need to implement
 type PVEncodable interface {
 	Encode() (string, error)
 }
+
+// decodeInt parses an integer field of an API response. PVOutput returns NaN
+// for values that are not set, these are returned as "unset"
+func decodeInt(field string) (int, error) {
+	if field == "NaN" || field == "" {
+		return UnsetInt, nil
+	}
+
+	return strconv.Atoi(field)
+}
+
+// decodeFloat parses a float field of an API response, like decodeInt
+func decodeFloat(field string) (float64, error) {
+	if field == "NaN" || field == "" {
+		return UnsetFloat, nil
+	}
+
+	return strconv.ParseFloat(field, 64)
+}
+
+// jsonInt returns a pointer to given value for JSON encoding, or nil when it
+// is unset so it is left out
+func jsonInt(v int) *int {
+	if v == UnsetInt {
+		return nil
+	}
+
+	return &v
+}
+
+// jsonFloat is the float equivalent of jsonInt
+func jsonFloat(v float64) *float64 {
+	if v == UnsetFloat {
+		return nil
+	}
+
+	return &v
+}
+
+// jsonString is the string equivalent of jsonInt, empty strings are left out
+// as well
+func jsonString(v string) *string {
+	if v == UnsetString || v == "" {
+		return nil
+	}
+
+	return &v
+}
+
+// jsonLayout returns a pointer to given time formatted with given layout, or
+// nil when it is zero
+func jsonLayout(t time.Time, layout string) *string {
+	if t.IsZero() {
+		return nil
+	}
+
+	v := t.Format(layout)
+
+	return &v
+}
+
+// textFields splits a line in PVOutput's batch format into a map of given
+// keys onto their values, leaving out empty values
+func textFields(text []byte, keys []string) (map[string]string, error) {
+	fields := strings.Split(strings.TrimSpace(string(text)), ",")
+	if len(fields) > len(keys) {
+		return nil, fmt.Errorf("expected at most %d fields", len(keys))
+	}
+
+	values := map[string]string{}
+	for i, f := range fields {
+		if f != "" {
+			values[keys[i]] = f
+		}
+	}
+
+	return values, nil
+}
+
+// textInt parses the integer value of given key, leaving dst untouched when
+// there is none
+func textInt(values map[string]string, key string, dst *int) error {
+	v, ok := values[key]
+	if !ok {
+		return nil
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", key, v)
+	}
+	*dst = i
+
+	return nil
+}
+
+// textFloat is the float equivalent of textInt
+func textFloat(values map[string]string, key string, dst *float64) error {
+	v, ok := values[key]
+	if !ok {
+		return nil
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", key, v)
+	}
+	*dst = f
+
+	return nil
+}
+
+// textLine joins the values of given keys into a line in PVOutput's batch
+// format, without trailing empty fields
+func textLine(data url.Values, keys []string) []byte {
+	fields := []string{}
+	for _, key := range keys {
+		fields = append(fields, data.Get(key))
+	}
+
+	return []byte(strings.TrimRight(strings.Join(fields, ","), ","))
+}
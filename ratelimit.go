@@ -0,0 +1,127 @@
+package pvoutput
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrRateLimitExceeded is returned when the hourly request budget as reported
+// by PVOutput is used up and no request is made
+var ErrRateLimitExceeded = errors.New("rate limit exceeded")
+
+// RateLimited is implemented by anything that knows PVOutput's rate limit,
+// like API and Manager
+type RateLimited interface {
+	RateLimit() (RateLimit, bool)
+}
+
+// RateLimit holds the request budget PVOutput reports in its response
+// headers as described on https://pvoutput.org/help.html#api-ratelimit
+type RateLimit struct {
+	Limit     int       // requests per hour
+	Remaining int       // requests left this hour
+	Reset     time.Time // moment the budget is reset
+}
+
+// rateLimiter keeps track of the RateLimit across requests. It is shared
+// between all API objects created by the same Manager
+type rateLimiter struct {
+	mu    sync.Mutex
+	limit RateLimit
+	known bool
+}
+
+// allow checks if a request can be made at given time
+func (r *rateLimiter) allow(now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.known || now.After(r.limit.Reset) {
+		return nil
+	}
+
+	if r.limit.Remaining <= 0 {
+		return ErrRateLimitExceeded
+	}
+
+	// claim one request from the budget, so concurrent requests don't
+	// overdraw it before the response headers come in
+	r.limit.Remaining--
+
+	return nil
+}
+
+// update reads the rate limit headers from given response headers
+func (r *rateLimiter) update(h http.Header) {
+	limit, err := strconv.Atoi(h.Get("X-Rate-Limit-Limit"))
+	if err != nil {
+		return
+	}
+	remaining, err := strconv.Atoi(h.Get("X-Rate-Limit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(h.Get("X-Rate-Limit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.limit = RateLimit{
+		Limit:     limit,
+		Remaining: remaining,
+		Reset:     time.Unix(reset, 0),
+	}
+	r.known = true
+}
+
+// wait checks if a request can be made like allow does. When the budget is
+// used up, it sleeps until the budget is reset and checks again
+func (r *rateLimiter) wait(now func() time.Time, sleep func(time.Duration)) error {
+	err := r.allow(now())
+	if err != ErrRateLimitExceeded {
+		return err
+	}
+
+	limit, _ := r.get()
+	if wait := limit.Reset.Sub(now()); wait > 0 {
+		sleep(wait + time.Second)
+	}
+
+	return r.allow(now())
+}
+
+// allowRequest checks if given API can make a request, waiting for the rate
+// limit to reset when it was set up to with WithRateLimitWait
+func (a API) allowRequest() error {
+	if a.limiter == nil {
+		return nil
+	}
+
+	now, sleep := a.now, a.sleep
+	if now == nil {
+		now = time.Now
+	}
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+
+	if !a.waitForRateLimit {
+		return a.limiter.allow(now())
+	}
+
+	return a.limiter.wait(now, sleep)
+}
+
+// get returns the last known RateLimit
+func (r *rateLimiter) get() (RateLimit, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.limit, r.known
+}
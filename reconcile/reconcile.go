@@ -0,0 +1,272 @@
+// Package reconcile compares the statuses and outputs on PVOutput with local
+// data, like the history of uploads or a meter's records, and corrects the
+// outputs on PVOutput that drifted from it
+package reconcile
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/skoef/pvoutput"
+	"github.com/skoef/pvoutput/history"
+)
+
+// Remote downloads statuses and outputs and uploads corrected outputs, it is
+// implemented by pvoutput.API
+type Remote interface {
+	GetStatusHistory(o pvoutput.StatusHistoryOptions) ([]pvoutput.Status, error)
+	GetOutput(from, to time.Time) ([]pvoutput.Output, error)
+	AddOutput(o pvoutput.Output) error
+	AddBatchOutput(b pvoutput.BatchOutput) error
+}
+
+// Local reads the statuses and outputs PVOutput should have between the
+// from and to dates, both inclusive
+type Local interface {
+	Statuses(from, to time.Time) ([]pvoutput.Status, error)
+	Outputs(from, to time.Time) ([]pvoutput.Output, error)
+}
+
+// historyLocal is the Local of a history.Store
+type historyLocal struct {
+	store history.Store
+}
+
+// FromHistory returns a Local reading the statuses and outputs recorded in
+// given store, whether uploading them succeeded or not
+func FromHistory(s history.Store) Local {
+	return historyLocal{store: s}
+}
+
+func (h historyLocal) Statuses(from, to time.Time) ([]pvoutput.Status, error) {
+	records, err := h.store.Statuses(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []pvoutput.Status{}
+	for _, r := range records {
+		statuses = append(statuses, r.Status)
+	}
+
+	return statuses, nil
+}
+
+func (h historyLocal) Outputs(from, to time.Time) ([]pvoutput.Output, error) {
+	records, err := h.store.Outputs(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := []pvoutput.Output{}
+	for _, r := range records {
+		outputs = append(outputs, r.Output)
+	}
+
+	return outputs, nil
+}
+
+// Tolerance is how much numeric values on PVOutput may differ from local
+// values without being reported. A difference within either the absolute or
+// the relative tolerance is accepted
+type Tolerance struct {
+	// Absolute is the largest difference in the unit of the field, like Wh
+	Absolute float64
+	// Relative is the largest difference as a fraction of the local value,
+	// e.g. 0.01 for 1%
+	Relative float64
+}
+
+// accepts tells if the difference between given values is within the
+// tolerance
+func (t Tolerance) accepts(local, remote float64) bool {
+	diff := math.Abs(local - remote)
+
+	return diff <= t.Absolute || diff <= t.Relative*math.Abs(local)
+}
+
+// Report is the outcome of reconciling a period
+type Report struct {
+	// Differences are the differences beyond tolerance in order of time
+	Differences []history.Difference
+	// Corrected are the dates whose local outputs were uploaded again
+	Corrected []time.Time
+}
+
+// Reconciler compares PVOutput's statuses and outputs with local ones
+type Reconciler struct {
+	Remote Remote
+	Local  Local
+	// Tolerances are the tolerances of fields, named like in the JSON
+	// representation of statuses and outputs
+	Tolerances map[string]Tolerance
+	// DefaultTolerance applies to numeric fields without tolerance. Values
+	// are compared exactly by default
+	DefaultTolerance Tolerance
+	// Correct makes ReconcileOutputs upload the local outputs of the dates
+	// that differ again
+	Correct bool
+	// Donating allows larger batches of corrected outputs
+	Donating bool
+	now      func() time.Time
+}
+
+// NewReconciler returns a new Reconciler comparing given Remote with given
+// Local
+func NewReconciler(r Remote, l Local) *Reconciler {
+	return &Reconciler{
+		Remote:     r,
+		Local:      l,
+		Tolerances: map[string]Tolerance{},
+		now:        time.Now,
+	}
+}
+
+// equal is the history.EqualFunc applying the tolerances
+func (r *Reconciler) equal(field string, local, remote interface{}) bool {
+	l, lok := local.(float64)
+	rm, rok := remote.(float64)
+	if !lok || !rok {
+		return local == remote
+	}
+
+	t, ok := r.Tolerances[field]
+	if !ok {
+		t = r.DefaultTolerance
+	}
+
+	return t.accepts(l, rm)
+}
+
+// dates returns the first and last day to reconcile. The last day defaults
+// to today
+func (r *Reconciler) dates(from, to time.Time) (time.Time, time.Time, error) {
+	if from.IsZero() {
+		return from, to, errors.New("start date is required")
+	}
+	if to.IsZero() {
+		to = r.now()
+	}
+	if to.Before(from) {
+		return from, to, errors.New("end date is before start date")
+	}
+
+	return pvoutput.DateOf(from), pvoutput.DateOf(to), nil
+}
+
+// ReconcileStatuses compares the statuses of the days from from to to, both
+// inclusive, with the local statuses. A zero to reconciles up to today.
+// Statuses are never corrected, since PVOutput only accepts recent ones
+func (r *Reconciler) ReconcileStatuses(from, to time.Time) (Report, error) {
+	report := Report{}
+
+	start, end, err := r.dates(from, to)
+	if err != nil {
+		return report, err
+	}
+
+	local, err := r.Local.Statuses(start, end)
+	if err != nil {
+		return report, fmt.Errorf("could not read local statuses: %s", err)
+	}
+	records := []history.StatusRecord{}
+	for _, s := range local {
+		records = append(records, history.StatusRecord{Status: s})
+	}
+
+	remote := []pvoutput.Status{}
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		statuses, err := pvoutput.StatusesOfDay(r.Remote, d, time.Time{})
+		if err != nil {
+			return report, fmt.Errorf("could not download statuses of %s: %s", d.Format("2006-01-02"), err)
+		}
+		remote = append(remote, statuses...)
+	}
+
+	report.Differences, err = history.DiffStatusesFunc(records, remote, r.equal)
+
+	return report, err
+}
+
+// ReconcileOutputs compares the outputs of the days from from to to, both
+// inclusive, with the local outputs. A zero to reconciles up to today. With
+// Correct set, the local outputs of the dates that differ or are missing on
+// PVOutput are uploaded again. Their unset fields are left untouched by
+// PVOutput
+func (r *Reconciler) ReconcileOutputs(from, to time.Time) (Report, error) {
+	report := Report{}
+
+	start, end, err := r.dates(from, to)
+	if err != nil {
+		return report, err
+	}
+
+	local, err := r.Local.Outputs(start, end)
+	if err != nil {
+		return report, fmt.Errorf("could not read local outputs: %s", err)
+	}
+	records := []history.OutputRecord{}
+	for _, o := range local {
+		records = append(records, history.OutputRecord{Output: o})
+	}
+
+	remote := []pvoutput.Output{}
+	for pageStart := start; !pageStart.After(end); pageStart = pageStart.AddDate(0, 0, pvoutput.OutputPageDays) {
+		pageEnd := pageStart.AddDate(0, 0, pvoutput.OutputPageDays-1)
+		if pageEnd.After(end) {
+			pageEnd = end
+		}
+
+		outputs, err := r.Remote.GetOutput(pageStart, pageEnd)
+		if err != nil && !errors.Is(err, pvoutput.ErrNoData) {
+			return report, fmt.Errorf("could not download outputs from %s: %s", pageStart.Format("2006-01-02"), err)
+		}
+		remote = append(remote, outputs...)
+	}
+
+	if report.Differences, err = history.DiffOutputsFunc(records, remote, r.equal); err != nil {
+		return report, err
+	}
+
+	if !r.Correct {
+		return report, nil
+	}
+
+	differing := map[string]bool{}
+	for _, d := range report.Differences {
+		if d.Kind != history.MissingLocally {
+			differing[d.Time.Format("2006-01-02")] = true
+		}
+	}
+
+	corrections := pvoutput.BatchOutput{}
+	for _, o := range local {
+		if differing[o.Date.Format("2006-01-02")] {
+			corrections = append(corrections, o)
+		}
+	}
+	sort.Slice(corrections, func(i, j int) bool { return corrections[i].Date.Before(corrections[j].Date) })
+
+	report.Corrected, err = r.upload(corrections)
+
+	return report, err
+}
+
+// upload uploads given outputs in batches as large as allowed and returns
+// the dates that were uploaded
+func (r *Reconciler) upload(outputs pvoutput.BatchOutput) ([]time.Time, error) {
+	uploaded := []time.Time{}
+	err := pvoutput.UploadOutputs(r.Remote, outputs, r.Donating, func(b pvoutput.BatchOutput) {
+		for _, o := range b {
+			uploaded = append(uploaded, o.Date)
+		}
+	})
+	if err != nil {
+		return uploaded, fmt.Errorf("could not upload outputs from %s: %s", outputs[len(uploaded)].Date.Format("2006-01-02"), err)
+	}
+
+	return uploaded, nil
+}
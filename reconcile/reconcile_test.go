@@ -0,0 +1,259 @@
+package reconcile
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/skoef/pvoutput"
+	"github.com/skoef/pvoutput/history"
+	"github.com/skoef/pvoutput/internal/pvtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRemote serves statuses and outputs like PVOutput does and records
+// requests and uploads, failing uploads with err when set
+type fakeRemote struct {
+	statuses      []pvoutput.Status
+	outputs       []pvoutput.Output
+	requests      []string
+	outputBatches []pvoutput.BatchOutput
+	err           error
+}
+
+func (f *fakeRemote) GetStatusHistory(o pvoutput.StatusHistoryOptions) ([]pvoutput.Status, error) {
+	f.requests = append(f.requests, "status "+o.Date.Format("2006-01-02")+" "+o.From.Format("15:04"))
+
+	page := []pvoutput.Status{}
+	for _, s := range f.statuses {
+		if pvoutput.DateOf(s.DateTime) != o.Date || s.DateTime.Before(o.From) && !o.From.IsZero() {
+			continue
+		}
+		if len(page) == o.Limit {
+			break
+		}
+		page = append(page, s)
+	}
+
+	if len(page) == 0 {
+		return nil, pvoutput.ErrNoData
+	}
+
+	return page, nil
+}
+
+func (f *fakeRemote) GetOutput(from, to time.Time) ([]pvoutput.Output, error) {
+	f.requests = append(f.requests, "output "+from.Format("2006-01-02")+" "+to.Format("2006-01-02"))
+
+	outputs := []pvoutput.Output{}
+	for _, o := range f.outputs {
+		if !o.Date.Before(from) && !o.Date.After(to) {
+			outputs = append(outputs, o)
+		}
+	}
+
+	if len(outputs) == 0 {
+		return nil, pvoutput.ErrNoData
+	}
+
+	return outputs, nil
+}
+
+func (f *fakeRemote) AddOutput(o pvoutput.Output) error {
+	return f.AddBatchOutput(pvoutput.BatchOutput{o})
+}
+
+func (f *fakeRemote) AddBatchOutput(b pvoutput.BatchOutput) error {
+	if f.err != nil {
+		err := f.err
+		f.err = nil
+		return err
+	}
+	f.outputBatches = append(f.outputBatches, b)
+
+	return nil
+}
+
+// fakeLocal holds the local statuses and outputs
+type fakeLocal struct {
+	statuses []pvoutput.Status
+	outputs  []pvoutput.Output
+}
+
+func (f fakeLocal) Statuses(from, to time.Time) ([]pvoutput.Status, error) {
+	return f.statuses, nil
+}
+
+func (f fakeLocal) Outputs(from, to time.Time) ([]pvoutput.Output, error) {
+	return f.outputs, nil
+}
+
+func date(d int) time.Time {
+	return time.Date(2026, 3, d, 0, 0, 0, 0, time.UTC)
+}
+
+func outputOn(d, generated, exported int) pvoutput.Output {
+	o := pvtest.OutputOn(date(d), generated)
+	o.Exported = exported
+
+	return o
+}
+
+var now = time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+func TestReconcileOutputs(t *testing.T) {
+	remote := &fakeRemote{outputs: []pvoutput.Output{
+		outputOn(1, 14000, 9000),
+		outputOn(2, 11000, 8000),
+		outputOn(3, 13050, 7000),
+		outputOn(5, 12000, 6000),
+	}}
+	local := fakeLocal{outputs: []pvoutput.Output{
+		outputOn(1, 14000, 9000),
+		outputOn(2, 12000, 8010),
+		outputOn(3, 13000, 7000),
+		outputOn(4, 10000, 5000),
+	}}
+
+	r := NewReconciler(remote, local)
+	r.now = func() time.Time { return now }
+	r.DefaultTolerance = Tolerance{Relative: 0.01}
+	r.Tolerances["exported_wh"] = Tolerance{Absolute: 5}
+
+	report, err := r.ReconcileOutputs(date(1), time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"output 2026-03-01 2026-03-10"}, remote.requests)
+	assert.Equal(t, []history.Difference{
+		{Kind: history.Mismatch, Time: date(2), Field: "exported_wh", Local: 8010.0, Remote: 8000.0},
+		{Kind: history.Mismatch, Time: date(2), Field: "generated_wh", Local: 12000.0, Remote: 11000.0},
+		{Kind: history.MissingRemotely, Time: date(4)},
+		{Kind: history.MissingLocally, Time: date(5)},
+	}, report.Differences)
+	assert.Empty(t, report.Corrected)
+	assert.Empty(t, remote.outputBatches)
+
+	// the local outputs of the dates that differ are uploaded again, one by
+	// one unless donating
+	r.Correct = true
+	report, err = r.ReconcileOutputs(date(1), date(5))
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{date(2), date(4)}, report.Corrected)
+	require.Len(t, remote.outputBatches, 2)
+	assert.Equal(t, 12000, remote.outputBatches[0][0].Generated)
+	assert.Equal(t, 10000, remote.outputBatches[1][0].Generated)
+
+	remote.outputBatches = nil
+	r.Donating = true
+	report, err = r.ReconcileOutputs(date(1), date(5))
+	require.NoError(t, err)
+	assert.Len(t, report.Corrected, 2)
+	require.Len(t, remote.outputBatches, 1)
+	assert.Len(t, remote.outputBatches[0], 2)
+
+	remote.err = errors.New("Bad request 400: Date is in the future")
+	report, err = r.ReconcileOutputs(date(1), date(5))
+	assert.EqualError(t, err, "could not upload outputs from 2026-03-02: Bad request 400: Date is in the future")
+	assert.Len(t, report.Differences, 4)
+	assert.Empty(t, report.Corrected)
+
+	_, err = r.ReconcileOutputs(time.Time{}, date(5))
+	assert.EqualError(t, err, "start date is required")
+	_, err = r.ReconcileOutputs(date(5), date(1))
+	assert.EqualError(t, err, "end date is before start date")
+}
+
+func TestReconcileOutputsPages(t *testing.T) {
+	remote := &fakeRemote{}
+	r := NewReconciler(remote, fakeLocal{})
+	r.now = func() time.Time { return now }
+
+	report, err := r.ReconcileOutputs(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Empty(t, report.Differences)
+	assert.Equal(t, []string{
+		"output 2026-01-01 2026-01-30",
+		"output 2026-01-31 2026-03-01",
+		"output 2026-03-02 2026-03-05",
+	}, remote.requests)
+}
+
+func TestReconcileStatuses(t *testing.T) {
+	remote := &fakeRemote{}
+	for i := 0; i < 300; i++ {
+		remote.statuses = append(remote.statuses, pvtest.StatusAt(date(1).Add(time.Duration(i)*time.Minute), 1000+i))
+	}
+
+	local := fakeLocal{statuses: []pvoutput.Status{
+		pvtest.StatusAt(date(1), 1000),
+		pvtest.StatusAt(date(1).Add(10*time.Minute), 1020),
+		pvtest.StatusAt(date(1).Add(299*time.Minute), 1299),
+		pvtest.StatusAt(date(2).Add(12*time.Hour), 1500),
+	}}
+	local.statuses[0].Temperature = 12.5
+
+	r := NewReconciler(remote, local)
+	r.now = func() time.Time { return now }
+	r.Tolerances["generating_w"] = Tolerance{Absolute: 5}
+
+	report, err := r.ReconcileStatuses(date(1), date(2))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"status 2026-03-01 00:00", "status 2026-03-01 04:48", "status 2026-03-02 00:00"}, remote.requests)
+
+	// statuses PVOutput has, but that aren't available locally are reported
+	// as well
+	missingLocally := 0
+	for _, d := range report.Differences {
+		if d.Kind == history.MissingLocally {
+			missingLocally++
+		}
+	}
+	assert.Equal(t, 297, missingLocally)
+
+	assert.Contains(t, report.Differences, history.Difference{Kind: history.Mismatch, Time: date(1), Field: "temperature_c", Local: 12.5, Remote: nil})
+	assert.Contains(t, report.Differences, history.Difference{Kind: history.Mismatch, Time: date(1).Add(10 * time.Minute), Field: "generating_w", Local: 1020.0, Remote: 1010.0})
+	assert.Contains(t, report.Differences, history.Difference{Kind: history.MissingRemotely, Time: date(2).Add(12 * time.Hour)})
+	assert.Len(t, report.Differences, 300)
+}
+
+// memoryStore is a history.Store keeping its records in memory
+type memoryStore struct {
+	statuses []history.StatusRecord
+	outputs  []history.OutputRecord
+}
+
+func (m *memoryStore) AddStatuses(records []history.StatusRecord) error {
+	m.statuses = append(m.statuses, records...)
+	return nil
+}
+
+func (m *memoryStore) AddOutputs(records []history.OutputRecord) error {
+	m.outputs = append(m.outputs, records...)
+	return nil
+}
+
+func (m *memoryStore) Statuses(from, to time.Time) ([]history.StatusRecord, error) {
+	return m.statuses, nil
+}
+
+func (m *memoryStore) Outputs(from, to time.Time) ([]history.OutputRecord, error) {
+	return m.outputs, nil
+}
+
+func TestFromHistory(t *testing.T) {
+	store := &memoryStore{}
+	require.NoError(t, store.AddOutputs([]history.OutputRecord{
+		{Output: outputOn(1, 14000, 9000), Upload: history.Upload{Response: "Unauthorized 401: Invalid API Key"}},
+	}))
+	require.NoError(t, store.AddStatuses([]history.StatusRecord{
+		{Status: pvtest.StatusAt(date(1), 1500), Upload: history.Upload{Uploaded: true}},
+	}))
+
+	l := FromHistory(store)
+	outputs, err := l.Outputs(date(1), date(1))
+	require.NoError(t, err)
+	assert.Equal(t, []pvoutput.Output{outputOn(1, 14000, 9000)}, outputs)
+	statuses, err := l.Statuses(date(1), date(1))
+	require.NoError(t, err)
+	assert.Equal(t, []pvoutput.Status{pvtest.StatusAt(date(1), 1500)}, statuses)
+}
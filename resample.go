@@ -0,0 +1,283 @@
+package pvoutput
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+// Sample represents a raw reading from an inverter or meter, taken at any
+// moment in time
+type Sample struct {
+	Time       time.Time
+	Generating float64 // watts
+	Consuming  float64 // watts
+	Generated  float64 // lifetime watt hours
+	Consumed   float64 // lifetime watt hours
+}
+
+// NewSample initialises and returns a new Sample with all values set to
+// "unset", similar to NewStatus
+func NewSample() Sample {
+	return Sample{
+		Generating: UnsetFloat,
+		Consuming:  UnsetFloat,
+		Generated:  UnsetFloat,
+		Consumed:   UnsetFloat,
+	}
+}
+
+// GapFill determines how a Resampler handles intervals without any samples
+type GapFill int
+
+const (
+	// GapFillNone skips intervals without samples
+	GapFillNone GapFill = iota
+	// GapFillPrevious repeats the power values of the previous interval
+	GapFillPrevious
+	// GapFillZero sets power values to zero
+	GapFillZero
+)
+
+// Resampler converts irregular samples into Status updates aligned to the
+// system's status interval. Power values are averaged over the interval,
+// weighted by the time each sample was valid. Energy values are derived from
+// the lifetime counters and are relative to the start of the day, as expected
+// by PVOutput
+type Resampler struct {
+	Interval time.Duration
+	GapFill  GapFill
+}
+
+// NewResampler returns a new Resampler for given status interval
+func NewResampler(interval time.Duration) Resampler {
+	return Resampler{
+		Interval: interval,
+		GapFill:  GapFillNone,
+	}
+}
+
+// Boundary returns the end of the interval given time falls in, aligned to
+// the wall clock of its location
+func (r Resampler) Boundary(t time.Time) time.Time {
+	y, m, d := t.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	since := t.Sub(midnight)
+
+	n := since / r.Interval
+	if since%r.Interval != 0 {
+		n++
+	}
+
+	return midnight.Add(n * r.Interval)
+}
+
+// StatusTime returns the time the Status of the interval ending at given
+// time is reported at. The interval ending at midnight is reported at 23:59,
+// since PVOutput takes 00:00 as the start of the next day
+func StatusTime(end time.Time) time.Time {
+	if end.Hour() == 0 && end.Minute() == 0 {
+		return end.Add(-time.Minute)
+	}
+
+	return end
+}
+
+// average returns the time weighted average of the values between start and
+// end. Each sample is valid until the next sample, but at most one interval
+func (r Resampler) average(sorted []Sample, start, end time.Time, value func(Sample) float64) float64 {
+	var sum, weight, plain float64
+	var count int
+
+	// only samples up to one interval before start can be valid in it
+	lo := sort.Search(len(sorted), func(i int) bool {
+		return sorted[i].Time.After(start.Add(-r.Interval))
+	})
+	hi := sort.Search(len(sorted), func(i int) bool {
+		return sorted[i].Time.After(end)
+	})
+
+	for i := lo; i < hi; i++ {
+		s := sorted[i]
+		v := value(s)
+		if v == UnsetFloat {
+			continue
+		}
+
+		if s.Time.After(start) && !s.Time.After(end) {
+			plain += v
+			count++
+		}
+
+		from := s.Time
+		until := from.Add(r.Interval)
+		for _, next := range sorted[i+1:] {
+			if value(next) != UnsetFloat {
+				if next.Time.Before(until) {
+					until = next.Time
+				}
+				break
+			}
+		}
+
+		if from.Before(start) {
+			from = start
+		}
+		if until.After(end) {
+			until = end
+		}
+		if until.After(from) {
+			d := until.Sub(from).Seconds()
+			sum += v * d
+			weight += d
+		}
+	}
+
+	if weight > 0 {
+		return sum / weight
+	}
+
+	// samples without any duration, like a single sample on the boundary
+	if count > 0 {
+		return plain / float64(count)
+	}
+
+	return UnsetFloat
+}
+
+// resampleCounter keeps track of a lifetime counter while resampling
+type resampleCounter struct {
+	value    func(Sample) float64
+	first    float64
+	current  float64
+	previous float64
+	baseline float64
+}
+
+func newResampleCounter(value func(Sample) float64) *resampleCounter {
+	return &resampleCounter{
+		value:    value,
+		first:    UnsetFloat,
+		current:  UnsetFloat,
+		previous: UnsetFloat,
+		baseline: UnsetFloat,
+	}
+}
+
+func (c *resampleCounter) observe(s Sample) {
+	v := c.value(s)
+	if v == UnsetFloat {
+		return
+	}
+
+	if c.first == UnsetFloat {
+		c.first = v
+	}
+	c.current = v
+}
+
+// daily returns the energy since the start of the day and starts a new day
+// first if requested
+func (c *resampleCounter) daily(newDay bool) int {
+	if newDay || c.baseline == UnsetFloat {
+		if c.previous != UnsetFloat {
+			c.baseline = c.previous
+		} else {
+			c.baseline = c.first
+		}
+	}
+	c.previous = c.current
+
+	if c.current == UnsetFloat || c.baseline == UnsetFloat {
+		return UnsetInt
+	}
+
+	return int(math.Round(math.Max(0, c.current-c.baseline)))
+}
+
+func roundPower(v float64) int {
+	if v == UnsetFloat {
+		return UnsetInt
+	}
+
+	return int(math.Round(v))
+}
+
+// Resample converts given samples into Status updates, one for every
+// interval between the first and last sample. Statuses are dated at the end
+// of their interval, as returned by StatusTime
+func (r Resampler) Resample(samples []Sample) ([]Status, error) {
+	if r.Interval <= 0 || (24*time.Hour)%r.Interval != 0 {
+		return nil, errors.New("Interval should evenly divide a day")
+	}
+
+	statuses := []Status{}
+	if len(samples) == 0 {
+		return statuses, nil
+	}
+
+	sorted := make([]Sample, len(samples))
+	copy(sorted, samples)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+
+	if sorted[0].Time.IsZero() {
+		return nil, errors.New("Time is required on Sample")
+	}
+
+	generated := newResampleCounter(func(s Sample) float64 { return s.Generated })
+	consumed := newResampleCounter(func(s Sample) float64 { return s.Consumed })
+
+	var (
+		previous Status
+		next     int
+		lastDay  time.Time
+	)
+
+	last := r.Boundary(sorted[len(sorted)-1].Time)
+	for end := r.Boundary(sorted[0].Time); !end.After(last); end = r.Boundary(end.Add(r.Interval)) {
+		start := end.Add(-r.Interval)
+
+		inInterval := 0
+		for ; next < len(sorted) && !sorted[next].Time.After(end); next++ {
+			generated.observe(sorted[next])
+			consumed.observe(sorted[next])
+			inInterval++
+		}
+
+		// the interval ending at midnight closes its day
+		at := StatusTime(end)
+		y, m, d := at.Date()
+		day := time.Date(y, m, d, 0, 0, 0, 0, at.Location())
+		newDay := !day.Equal(lastDay)
+		lastDay = day
+
+		s := NewStatus()
+		s.DateTime = at
+		s.Generated = generated.daily(newDay)
+		s.Consumed = consumed.daily(newDay)
+
+		if inInterval > 0 {
+			s.Generating = roundPower(r.average(sorted, start, end, func(s Sample) float64 { return s.Generating }))
+			s.Consuming = roundPower(r.average(sorted, start, end, func(s Sample) float64 { return s.Consuming }))
+		} else {
+			switch r.GapFill {
+			case GapFillNone:
+				continue
+			case GapFillPrevious:
+				s.Generating = previous.Generating
+				s.Consuming = previous.Consuming
+			case GapFillZero:
+				s.Generating = 0
+				s.Consuming = 0
+			}
+		}
+
+		statuses = append(statuses, s)
+		previous = s
+	}
+
+	return statuses, nil
+}
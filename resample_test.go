@@ -0,0 +1,123 @@
+package pvoutput
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResamplerBoundary(t *testing.T) {
+	r := NewResampler(5 * time.Minute)
+	for in, out := range map[string]string{
+		"10:00:00": "10:00",
+		"10:00:01": "10:05",
+		"10:04:59": "10:05",
+		"23:58:00": "00:00",
+	} {
+		tm, _ := time.Parse("20060102 15:04:05", "20200818 "+in)
+		assert.Equal(t, out, r.Boundary(tm).Format("15:04"), in)
+	}
+}
+
+func TestStatusTime(t *testing.T) {
+	midnight := time.Date(2020, 8, 19, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2020, 8, 18, 23, 59, 0, 0, time.UTC), StatusTime(midnight))
+	assert.Equal(t, midnight.Add(5*time.Minute), StatusTime(midnight.Add(5*time.Minute)))
+}
+
+func TestResample(t *testing.T) {
+	base, _ := time.Parse("20060102 15:04", "20200818 10:00")
+	newSample := func(offset time.Duration, power, energy float64) Sample {
+		s := NewSample()
+		s.Time = base.Add(offset)
+		s.Generating = power
+		s.Generated = energy
+
+		return s
+	}
+
+	// invalid intervals
+	_, err := Resampler{}.Resample(nil)
+	assert.Error(t, err)
+	_, err = NewResampler(7 * time.Minute).Resample(nil)
+	assert.Error(t, err)
+
+	statuses, err := NewResampler(5 * time.Minute).Resample(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, statuses)
+
+	// irregular samples, out of order
+	samples := []Sample{
+		newSample(4*time.Minute, 2000, 10050),
+		newSample(10*time.Second, 1000, 10000),
+		newSample(3*time.Minute, 1600, 10030),
+		newSample(7*time.Minute, 3000, 10120),
+	}
+
+	statuses, err = NewResampler(5 * time.Minute).Resample(samples)
+	if assert.NoError(t, err) && assert.Len(t, statuses, 2) {
+		assert.Equal(t, "10:05", statuses[0].DateTime.Format("15:04"))
+		// 1000W for 170s, 1600W for 60s, 2000W for 60s
+		assert.Equal(t, 1331, statuses[0].Generating)
+		assert.Equal(t, 50, statuses[0].Generated)
+		// consumption is not in the samples
+		assert.Equal(t, UnsetInt, statuses[0].Consuming)
+		assert.Equal(t, UnsetInt, statuses[0].Consumed)
+
+		assert.Equal(t, "10:10", statuses[1].DateTime.Format("15:04"))
+		// 2000W for 120s and 3000W for 180s
+		assert.Equal(t, 2600, statuses[1].Generating)
+		assert.Equal(t, 120, statuses[1].Generated)
+	}
+
+	// gaps between samples
+	samples = []Sample{
+		newSample(2*time.Minute, 1000, 10000),
+		newSample(17*time.Minute, 500, 10100),
+	}
+
+	statuses, err = NewResampler(5 * time.Minute).Resample(samples)
+	if assert.NoError(t, err) && assert.Len(t, statuses, 2) {
+		assert.Equal(t, "10:05", statuses[0].DateTime.Format("15:04"))
+		assert.Equal(t, "10:20", statuses[1].DateTime.Format("15:04"))
+		assert.Equal(t, 100, statuses[1].Generated)
+	}
+
+	r := NewResampler(5 * time.Minute)
+	r.GapFill = GapFillPrevious
+	statuses, err = r.Resample(samples)
+	if assert.NoError(t, err) && assert.Len(t, statuses, 4) {
+		assert.Equal(t, "10:10", statuses[1].DateTime.Format("15:04"))
+		// first sample is valid for one interval only
+		assert.Equal(t, 1000, statuses[1].Generating)
+		assert.Equal(t, 0, statuses[1].Generated)
+		assert.Equal(t, 1000, statuses[2].Generating)
+	}
+
+	r.GapFill = GapFillZero
+	statuses, err = r.Resample(samples)
+	if assert.NoError(t, err) && assert.Len(t, statuses, 4) {
+		assert.Equal(t, 0, statuses[1].Generating)
+		assert.Equal(t, 0, statuses[2].Generating)
+	}
+
+	// energy is relative to the start of each day
+	base, _ = time.Parse("20060102 15:04", "20200818 23:50")
+	samples = []Sample{
+		newSample(time.Minute, 100, 50000),
+		newSample(9*time.Minute, 100, 50010),
+		newSample(14*time.Minute, 100, 50020),
+	}
+
+	statuses, err = NewResampler(5 * time.Minute).Resample(samples)
+	if assert.NoError(t, err) && assert.Len(t, statuses, 3) {
+		assert.Equal(t, "20200818 23:55", statuses[0].DateTime.Format("20060102 15:04"))
+		assert.Equal(t, 0, statuses[0].Generated)
+		// the interval ending at midnight is reported at 23:59
+		assert.Equal(t, "20200818 23:59", statuses[1].DateTime.Format("20060102 15:04"))
+		assert.Equal(t, 10, statuses[1].Generated)
+		assert.Equal(t, "20200819 00:05", statuses[2].DateTime.Format("20060102 15:04"))
+		assert.Equal(t, 10, statuses[2].Generated)
+	}
+}
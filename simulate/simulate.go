@@ -0,0 +1,317 @@
+// Package simulate generates synthetic statuses and daily outputs of a PV
+// system, for demos and load tests. Generation follows the position of the
+// sun under a clear sky, dimmed by clouds and derated by the temperature of
+// the cells. Consumption follows a household profile with morning and
+// evening peaks. Generated data only depends on the settings, the seed and
+// the date, so a day can be generated again on its own
+package simulate
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/skoef/pvoutput"
+)
+
+// Defaults of NewSystem and NewGenerator
+const (
+	DefaultTemperatureCoefficient = -0.004
+	DefaultLosses                 = 0.14
+	DefaultInterval               = 5 * time.Minute
+)
+
+// System describes the simulated PV system
+type System struct {
+	// Size is the peak power of the panels in W
+	Size int
+	// Latitude and Longitude locate the system in degrees
+	Latitude  float64
+	Longitude float64
+	// Tilt is the angle of the panels with the ground and Azimuth the
+	// direction they face clockwise from north, both in degrees
+	Tilt    float64
+	Azimuth float64
+	// TemperatureCoefficient is the relative change in power per °C the
+	// cells are warmer than 25 °C
+	TemperatureCoefficient float64
+	// Losses is the fraction of power lost in wiring and the inverter
+	Losses float64
+}
+
+// NewSystem returns a new System of given size at given location, with its
+// panels tilted by the latitude up to 40° and facing the equator
+func NewSystem(size int, latitude, longitude float64) System {
+	s := System{
+		Size:                   size,
+		Latitude:               latitude,
+		Longitude:              longitude,
+		Tilt:                   math.Min(math.Abs(latitude), 40),
+		Azimuth:                180,
+		TemperatureCoefficient: DefaultTemperatureCoefficient,
+		Losses:                 DefaultLosses,
+	}
+	if latitude < 0 {
+		s.Azimuth = 0
+	}
+
+	return s
+}
+
+// Clouds is the cloudiness model. Every day gets its own cloud cover around
+// Cover, which wanders around during the day
+type Clouds struct {
+	// Cover is the average cloud cover, from 0 for clear skies to 1 for
+	// overcast
+	Cover float64
+	// Variability is how much the cover changes from day to day and within
+	// days, from 0 to 1
+	Variability float64
+}
+
+// Climate determines the temperature over the year and the day, which peaks
+// mid summer and mid afternoon
+type Climate struct {
+	// MeanTemperature is the average temperature over the year in °C
+	MeanTemperature float64
+	// AnnualSwing is how much warmer the average summer day is in °C
+	AnnualSwing float64
+	// DailySwing is how much warmer the afternoon is than the day's average
+	// in °C
+	DailySwing float64
+}
+
+// Consumption is the household's consumption profile
+type Consumption struct {
+	// Base is the continuous consumption in W
+	Base int
+	// Peak is the additional consumption at the morning and evening peaks
+	// in W
+	Peak int
+}
+
+// Generator generates the statuses and outputs of a system
+type Generator struct {
+	System  System
+	Clouds  Clouds
+	Climate Climate
+	// Consumption is left out of statuses and outputs when zero
+	Consumption Consumption
+	// Interval is the time between statuses
+	Interval time.Duration
+	// Location is the time zone of the system, the local time zone by
+	// default
+	Location *time.Location
+	Seed     int64
+}
+
+// NewGenerator returns a new Generator of given system and seed, with a
+// temperate climate, partly cloudy skies and the consumption of a small
+// household
+func NewGenerator(s System, seed int64) *Generator {
+	return &Generator{
+		System:      s,
+		Clouds:      Clouds{Cover: 0.5, Variability: 0.5},
+		Climate:     Climate{MeanTemperature: 10, AnnualSwing: 8, DailySwing: 5},
+		Consumption: Consumption{Base: 250, Peak: 1500},
+		Interval:    DefaultInterval,
+		Location:    time.Local,
+		Seed:        seed,
+	}
+}
+
+// validate checks the settings of the Generator
+func (g *Generator) validate() error {
+	s := g.System
+	switch {
+	case s.Size <= 0:
+		return errors.New("size should be positive")
+	case s.Latitude < -90 || s.Latitude > 90:
+		return errors.New("latitude should be between -90 and 90")
+	case s.Longitude < -180 || s.Longitude > 180:
+		return errors.New("longitude should be between -180 and 180")
+	case s.Tilt < 0 || s.Tilt > 90:
+		return errors.New("tilt should be between 0 and 90")
+	case s.Losses < 0 || s.Losses >= 1:
+		return errors.New("losses should be between 0 and 1")
+	case g.Clouds.Cover < 0 || g.Clouds.Cover > 1:
+		return errors.New("cloud cover should be between 0 and 1")
+	case g.Clouds.Variability < 0 || g.Clouds.Variability > 1:
+		return errors.New("cloud variability should be between 0 and 1")
+	case g.Consumption.Base < 0 || g.Consumption.Peak < 0:
+		return errors.New("consumption should not be negative")
+	case g.Interval < time.Minute || g.Interval%time.Minute != 0:
+		return errors.New("interval should be a whole number of minutes")
+	}
+
+	return nil
+}
+
+// location returns the Generator's location, defaulting to the local time
+// zone
+func (g *Generator) location() *time.Location {
+	if g.Location == nil {
+		return time.Local
+	}
+
+	return g.Location
+}
+
+// condition returns PVOutput's weather condition of given cloud cover
+func condition(cover float64) string {
+	switch {
+	case cover < 0.2:
+		return "Fine"
+	case cover < 0.5:
+		return "Partly Cloudy"
+	case cover < 0.8:
+		return "Mostly Cloudy"
+	}
+
+	return "Cloudy"
+}
+
+// peak returns the height of a bell curve with its top at center and given
+// width in hours, at given hour
+func peak(hour, center, width float64) float64 {
+	d := (hour - center) / width
+
+	return math.Exp(-d * d / 2)
+}
+
+// round rounds given value to given number of decimals
+func round(v float64, decimals int) float64 {
+	p := math.Pow(10, float64(decimals))
+
+	return math.Round(v*p) / p
+}
+
+// Components of the simulation that draw random numbers from their own
+// source, so changing one does not change the others
+const (
+	randClouds = iota
+	randTemperature
+	randConsumption
+	randVoltage
+)
+
+// newRand returns the source of random numbers of given component on given
+// day, seeded from the Generator's seed
+func (g *Generator) newRand(dayNumber int64, component int64) *rand.Rand {
+	return rand.New(rand.NewSource((g.Seed*1000003+dayNumber)*4 + component))
+}
+
+// Day returns the statuses of the day of given date, every Interval from
+// midnight up to the last one at 23:59, and its output. The statuses hold the
+// average power over the interval up to their time and the energy since
+// midnight. The output holds
+// the totals of the whole day
+func (g *Generator) Day(date time.Time) ([]pvoutput.Status, pvoutput.Output, error) {
+	o := pvoutput.NewOutput()
+	if err := g.validate(); err != nil {
+		return nil, o, err
+	}
+
+	s := g.System
+	loc := g.location()
+	y, m, d := date.Date()
+	start := time.Date(y, m, d, 0, 0, 0, 0, loc)
+	end := time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+
+	// every day gets its own random numbers, drawn in a fixed order from a
+	// source per component
+	dayNumber := time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / 86400
+	clouds := g.newRand(dayNumber, randClouds)
+	temperature := g.newRand(dayNumber, randTemperature)
+	noise := g.newRand(dayNumber, randConsumption)
+	voltage := g.newRand(dayNumber, randVoltage)
+
+	dayCover := math.Max(0, math.Min(1, g.Clouds.Cover+0.5*g.Clouds.Variability*clouds.NormFloat64()))
+	season := math.Cos(2 * math.Pi * float64(start.YearDay()-196) / 365.25)
+	if s.Latitude < 0 {
+		season = -season
+	}
+	dayTemp := g.Climate.MeanTemperature + g.Climate.AnnualSwing*season + 2*temperature.NormFloat64()
+	consuming := g.Consumption.Base > 0 || g.Consumption.Peak > 0
+
+	statuses := []pvoutput.Status{}
+	var generated, consumed, exported, intervalPower, intervalConsumption, coverSum float64
+	minutes, peakPower := 0, 0
+	cover := dayCover
+	o.MinTemp, o.MaxTemp = math.Inf(1), math.Inf(-1)
+
+	for t := start; t.Before(end); t = t.Add(time.Minute) {
+		hour := float64(t.Hour()) + float64(t.Minute())/60
+
+		// the cloud cover wanders around the day's cover
+		cover += 0.1*(dayCover-cover) + 0.08*g.Clouds.Variability*clouds.NormFloat64()
+		cover = math.Max(0, math.Min(1, cover))
+		coverSum += cover
+
+		// irradiance in the middle of the minute, dimmed by the clouds as
+		// described by Kasten and Czeplak
+		cosZenith, azimuth := sunPosition(t.Add(30*time.Second), s.Latitude, s.Longitude)
+		irradiance := clearSkyIrradiance(cosZenith, azimuth, s.Tilt, s.Azimuth) * (1 - 0.75*math.Pow(cover, 3.4))
+
+		ambient := dayTemp + g.Climate.DailySwing*math.Cos(2*math.Pi*(hour-15)/24)
+		cell := ambient + irradiance*25/800
+		power := float64(s.Size) * irradiance / 1000 * (1 + s.TemperatureCoefficient*(cell-25)) * (1 - s.Losses)
+		power = math.Max(0, math.Min(float64(s.Size), power))
+
+		consumption := 0.0
+		if consuming {
+			consumption = float64(g.Consumption.Base) +
+				float64(g.Consumption.Peak)*(0.6*peak(hour, 7.5, 1)+peak(hour, 19, 1.5))
+			consumption = math.Max(0, consumption*(1+0.1*noise.NormFloat64()))
+		}
+
+		generated += power / 60
+		consumed += consumption / 60
+		exported += math.Max(0, power-consumption) / 60
+		intervalPower += power
+		intervalConsumption += consumption
+		minutes++
+
+		// the interval ending at midnight closes the day at 23:59
+		next := t.Add(time.Minute)
+		if next.Sub(start)%g.Interval != 0 && next.Before(end) {
+			continue
+		}
+
+		st := pvoutput.NewStatus()
+		st.DateTime = pvoutput.StatusTime(next)
+		st.Generating = int(math.Round(intervalPower / float64(minutes)))
+		st.Generated = int(math.Round(generated))
+		if consuming {
+			st.Consuming = int(math.Round(intervalConsumption / float64(minutes)))
+			st.Consumed = int(math.Round(consumed))
+		}
+		st.Temperature = round(ambient, 1)
+		st.Voltage = round(230+1.5*voltage.NormFloat64(), 1)
+		statuses = append(statuses, st)
+
+		if st.Generating > peakPower {
+			peakPower = st.Generating
+			o.PeakTime = st.DateTime
+		}
+		o.MinTemp = math.Min(o.MinTemp, st.Temperature)
+		o.MaxTemp = math.Max(o.MaxTemp, st.Temperature)
+
+		intervalPower, intervalConsumption, minutes = 0, 0, 0
+	}
+
+	o.Date = start
+	o.Generated = int(math.Round(generated))
+	o.Exported = int(math.Round(exported))
+	o.Efficiency = round(generated/float64(s.Size), 3)
+	if consuming {
+		o.Consumed = int(math.Round(consumed))
+	}
+	if peakPower > 0 {
+		o.PeakPower = peakPower
+	}
+	o.Condition = condition(coverSum / end.Sub(start).Minutes())
+
+	return statuses, o, nil
+}
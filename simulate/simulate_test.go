@@ -0,0 +1,190 @@
+package simulate
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var amsterdam = time.FixedZone("CET", 3600)
+
+func testGenerator(seed int64) *Generator {
+	g := NewGenerator(NewSystem(4000, 52.37, 4.9), seed)
+	g.Location = amsterdam
+
+	return g
+}
+
+func TestNewSystem(t *testing.T) {
+	s := NewSystem(4000, 52.37, 4.9)
+	assert.Equal(t, 40.0, s.Tilt)
+	assert.Equal(t, 180.0, s.Azimuth)
+	assert.Equal(t, DefaultLosses, s.Losses)
+
+	s = NewSystem(5000, -33.87, 151.21)
+	assert.InDelta(t, 33.87, s.Tilt, 0.001)
+	assert.Equal(t, 0.0, s.Azimuth)
+}
+
+func TestDay(t *testing.T) {
+	g := testGenerator(42)
+	date := time.Date(2026, 6, 21, 0, 0, 0, 0, time.UTC)
+
+	statuses, o, err := g.Day(date)
+	require.NoError(t, err)
+
+	// every 5 minutes, up to the end of the day at 23:59
+	require.Len(t, statuses, 288)
+	assert.Equal(t, time.Date(2026, 6, 21, 0, 5, 0, 0, amsterdam), statuses[0].DateTime)
+	assert.Equal(t, time.Date(2026, 6, 21, 23, 55, 0, 0, amsterdam), statuses[286].DateTime)
+	assert.Equal(t, time.Date(2026, 6, 21, 23, 59, 0, 0, amsterdam), statuses[287].DateTime)
+	assert.Equal(t, time.Date(2026, 6, 21, 0, 0, 0, 0, amsterdam), o.Date)
+
+	peak := statuses[0]
+	for i, s := range statuses {
+		// no generation at night and energy only increases
+		if s.DateTime.Hour() < 3 || s.DateTime.Hour() >= 22 {
+			assert.Equal(t, 0, s.Generating, s.DateTime)
+		}
+		if i > 0 {
+			assert.True(t, s.Generated >= statuses[i-1].Generated)
+			assert.True(t, s.Consumed > statuses[i-1].Consumed)
+		}
+		assert.True(t, s.Generating <= 4000)
+		assert.True(t, s.Consuming > 0)
+		assert.True(t, s.Voltage > 220 && s.Voltage < 240)
+		if s.Generating > peak.Generating {
+			peak = s
+		}
+	}
+
+	// the output matches the statuses
+	assert.Equal(t, peak.Generating, o.PeakPower)
+	assert.Equal(t, peak.DateTime, o.PeakTime)
+	assert.Equal(t, statuses[287].Generated, o.Generated)
+	assert.Equal(t, statuses[287].Consumed, o.Consumed)
+	assert.True(t, o.Exported > 0 && o.Exported < o.Generated)
+	assert.InDelta(t, float64(o.Generated)/4000, o.Efficiency, 0.001)
+	assert.NotEmpty(t, o.Condition)
+	for _, s := range statuses {
+		assert.True(t, s.Temperature >= o.MinTemp && s.Temperature <= o.MaxTemp)
+	}
+
+	// the same seed and date give the same day, regardless of the days
+	// generated before
+	_, _, err = g.Day(date.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	again, o2, err := testGenerator(42).Day(date)
+	require.NoError(t, err)
+	assert.Equal(t, statuses, again)
+	assert.Equal(t, o, o2)
+
+	_, o3, err := testGenerator(43).Day(date)
+	require.NoError(t, err)
+	assert.NotEqual(t, o.Generated, o3.Generated)
+}
+
+func TestDayWeather(t *testing.T) {
+	generated := func(g *Generator, month time.Month) int {
+		total := 0
+		for d := 1; d <= 7; d++ {
+			_, o, err := g.Day(time.Date(2026, month, d, 0, 0, 0, 0, time.UTC))
+			require.NoError(t, err)
+			total += o.Generated
+		}
+
+		return total
+	}
+
+	g := testGenerator(1)
+	g.Clouds = Clouds{}
+	clear := generated(g, time.June)
+	assert.True(t, clear > generated(g, time.December)*2)
+
+	// clouds dim the sun
+	g.Clouds = Clouds{Cover: 1}
+	assert.True(t, generated(g, time.June) < clear/2)
+	_, o, err := g.Day(time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, "Cloudy", o.Condition)
+
+	// panels facing north generate less
+	g.Clouds = Clouds{}
+	g.System.Azimuth = 0
+	assert.True(t, generated(g, time.June) < clear)
+
+	// hot cells generate less
+	g = testGenerator(1)
+	g.Clouds = Clouds{}
+	g.Climate.MeanTemperature = 30
+	assert.True(t, generated(g, time.June) < clear)
+
+	// without consumption profile, consumption is left out
+	g = testGenerator(1)
+	g.Consumption = Consumption{}
+	statuses, o, err := g.Day(time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, -1, statuses[0].Consuming)
+	assert.Equal(t, -1, o.Consumed)
+	assert.Equal(t, o.Generated, o.Exported)
+
+	// the weather doesn't depend on the consumption profile
+	consuming, o2, err := testGenerator(1).Day(time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, o.Generated, o2.Generated)
+	assert.Equal(t, o.Condition, o2.Condition)
+	for i, s := range statuses {
+		assert.Equal(t, consuming[i].Generating, s.Generating)
+		assert.Equal(t, consuming[i].Temperature, s.Temperature)
+		assert.Equal(t, consuming[i].Voltage, s.Voltage)
+	}
+
+	// near the pole in winter, the sun doesn't rise
+	g = NewGenerator(NewSystem(4000, 78.2, 15.6), 1)
+	g.Location = time.UTC
+	statuses, o, err = g.Day(time.Date(2026, 12, 21, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, 0, o.Generated)
+	assert.Equal(t, -1, o.PeakPower)
+	assert.True(t, o.PeakTime.IsZero())
+	assert.Equal(t, 0, statuses[len(statuses)-1].Generated)
+	assert.False(t, math.IsInf(o.MinTemp, 0))
+}
+
+func TestDayInterval(t *testing.T) {
+	g := testGenerator(42)
+	g.Interval = 15 * time.Minute
+	statuses, _, err := g.Day(time.Date(2026, 6, 21, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Len(t, statuses, 96)
+
+	// days with a daylight saving time change are shorter or longer
+	g.Interval = DefaultInterval
+	g.Location, err = time.LoadLocation("Europe/Amsterdam")
+	require.NoError(t, err)
+	statuses, _, err = g.Day(time.Date(2026, 3, 29, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Len(t, statuses, 276)
+}
+
+func TestValidate(t *testing.T) {
+	for msg, change := range map[string]func(g *Generator){
+		"size should be positive":                      func(g *Generator) { g.System.Size = 0 },
+		"latitude should be between -90 and 90":        func(g *Generator) { g.System.Latitude = 91 },
+		"longitude should be between -180 and 180":     func(g *Generator) { g.System.Longitude = -181 },
+		"tilt should be between 0 and 90":              func(g *Generator) { g.System.Tilt = 95 },
+		"losses should be between 0 and 1":             func(g *Generator) { g.System.Losses = 1 },
+		"cloud cover should be between 0 and 1":        func(g *Generator) { g.Clouds.Cover = 1.5 },
+		"cloud variability should be between 0 and 1":  func(g *Generator) { g.Clouds.Variability = -1 },
+		"consumption should not be negative":           func(g *Generator) { g.Consumption.Base = -1 },
+		"interval should be a whole number of minutes": func(g *Generator) { g.Interval = 90 * time.Second },
+	} {
+		g := testGenerator(1)
+		change(g)
+		_, _, err := g.Day(time.Now())
+		assert.EqualError(t, err, msg)
+	}
+}
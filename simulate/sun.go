@@ -0,0 +1,73 @@
+package simulate
+
+import (
+	"math"
+	"time"
+)
+
+const rad = math.Pi / 180
+
+// solarConstant is the irradiance of the sun outside the atmosphere in W/m²
+const solarConstant = 1361.0
+
+// sunPosition returns the cosine of the sun's zenith angle and its azimuth
+// in radians, clockwise from north, at given time and coordinates in
+// degrees. It uses NOAA's low precision equations, which are accurate to
+// within a few tenths of a degree
+func sunPosition(t time.Time, latitude, longitude float64) (cosZenith, azimuth float64) {
+	t = t.UTC()
+	hours := float64(t.Hour()) + float64(t.Minute())/60 + float64(t.Second())/3600
+
+	// fractional year, equation of time in minutes and declination
+	g := 2 * math.Pi / 365 * (float64(t.YearDay()-1) + (hours-12)/24)
+	eqTime := 229.18 * (0.000075 + 0.001868*math.Cos(g) - 0.032077*math.Sin(g) -
+		0.014615*math.Cos(2*g) - 0.040849*math.Sin(2*g))
+	declination := 0.006918 - 0.399912*math.Cos(g) + 0.070257*math.Sin(g) -
+		0.006758*math.Cos(2*g) + 0.000907*math.Sin(2*g) -
+		0.002697*math.Cos(3*g) + 0.00148*math.Sin(3*g)
+
+	// true solar time in minutes and hour angle
+	solarTime := hours*60 + eqTime + 4*longitude
+	hourAngle := (solarTime/4 - 180) * rad
+
+	lat := latitude * rad
+	cosZenith = math.Sin(lat)*math.Sin(declination) + math.Cos(lat)*math.Cos(declination)*math.Cos(hourAngle)
+	cosZenith = math.Max(-1, math.Min(1, cosZenith))
+
+	sinZenith := math.Sqrt(1 - cosZenith*cosZenith)
+	if sinZenith == 0 || math.Cos(lat) == 0 {
+		return cosZenith, math.Pi
+	}
+
+	sinAz := -math.Sin(hourAngle) * math.Cos(declination) / sinZenith
+	cosAz := (math.Sin(declination) - math.Sin(lat)*cosZenith) / (math.Cos(lat) * sinZenith)
+	azimuth = math.Atan2(sinAz, cosAz)
+	if azimuth < 0 {
+		azimuth += 2 * math.Pi
+	}
+
+	return cosZenith, azimuth
+}
+
+// clearSkyIrradiance returns the irradiance in W/m² on a plane of given tilt
+// and azimuth in degrees, under a clear sky with the sun at given position.
+// Direct irradiance follows Meinel's air mass model, diffuse irradiance is
+// taken as a fixed part of it and the ground reflects a fifth of the light
+func clearSkyIrradiance(cosZenith, sunAzimuth, tilt, azimuth float64) float64 {
+	if cosZenith <= 0.01 {
+		return 0
+	}
+
+	airMass := 1 / cosZenith
+	direct := solarConstant * math.Pow(0.7, math.Pow(airMass, 0.678))
+	diffuse := 0.1 * direct
+	global := direct*cosZenith + diffuse
+
+	beta := tilt * rad
+	sinZenith := math.Sqrt(1 - cosZenith*cosZenith)
+	cosIncidence := cosZenith*math.Cos(beta) + sinZenith*math.Sin(beta)*math.Cos(sunAzimuth-azimuth*rad)
+
+	return math.Max(0, direct*cosIncidence) +
+		diffuse*(1+math.Cos(beta))/2 +
+		0.2*global*(1-math.Cos(beta))/2
+}
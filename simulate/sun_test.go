@@ -0,0 +1,47 @@
+package simulate
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSunPosition(t *testing.T) {
+	// Amsterdam at the summer solstice: the sun is highest around 13:40 CEST,
+	// at 61° above the horizon, due south
+	cosZenith, azimuth := sunPosition(time.Date(2026, 6, 21, 11, 40, 0, 0, time.UTC), 52.37, 4.9)
+	assert.InDelta(t, 61, 90-math.Acos(cosZenith)/rad, 0.5)
+	assert.InDelta(t, 180, azimuth/rad, 2)
+
+	// at sunrise the sun is on the horizon in the north east
+	cosZenith, azimuth = sunPosition(time.Date(2026, 6, 21, 3, 18, 0, 0, time.UTC), 52.37, 4.9)
+	assert.InDelta(t, 0, 90-math.Acos(cosZenith)/rad, 1)
+	assert.InDelta(t, 49, azimuth/rad, 2)
+
+	// at midnight the sun is below the horizon
+	cosZenith, _ = sunPosition(time.Date(2026, 6, 21, 23, 40, 0, 0, time.UTC), 52.37, 4.9)
+	assert.True(t, cosZenith < 0)
+
+	// Sydney at noon in its summer, with the sun in the north
+	cosZenith, azimuth = sunPosition(time.Date(2026, 12, 21, 1, 57, 0, 0, time.UTC), -33.87, 151.21)
+	assert.InDelta(t, 79.6, 90-math.Acos(cosZenith)/rad, 0.5)
+	assert.True(t, azimuth/rad < 10 || azimuth/rad > 350)
+}
+
+func TestClearSkyIrradiance(t *testing.T) {
+	// the sun at its zenith shines about 1000 W/m² on a flat panel
+	assert.InDelta(t, 1000, clearSkyIrradiance(1, 0, 0, 180), 100)
+	assert.Equal(t, 0.0, clearSkyIrradiance(-0.2, 0, 0, 180))
+
+	// a panel facing the low sun receives more than a flat one, and much
+	// more than one facing away from it
+	cosZenith := math.Cos(60 * rad)
+	facing := clearSkyIrradiance(cosZenith, math.Pi, 60, 180)
+	flat := clearSkyIrradiance(cosZenith, math.Pi, 0, 180)
+	away := clearSkyIrradiance(cosZenith, math.Pi, 60, 0)
+	assert.True(t, facing > flat)
+	assert.True(t, flat > away)
+	assert.True(t, away > 0)
+}
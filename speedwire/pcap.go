@@ -0,0 +1,184 @@
+package speedwire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// Port is the UDP port Speedwire datagrams are sent to
+const Port = 9522
+
+const (
+	pcapMagicMicro = 0xa1b2c3d4
+	pcapMagicNano  = 0xa1b23c4d
+	// link types
+	linkTypeEthernet = 1
+	linkTypeRaw      = 101
+	linkTypeLinuxSLL = 113
+	// ether types
+	etherTypeIPv4 = 0x0800
+	etherTypeVLAN = 0x8100
+	// IP protocol number of UDP
+	protocolUDP = 17
+	// maxSnapLen is the largest snapshot length tcpdump and Wireshark use
+	maxSnapLen = 262144
+	// maxFrameSize is the largest frame that can hold a Speedwire datagram:
+	// an Ethernet header with VLAN tag, an IPv4 header with options, a UDP
+	// header and the datagram
+	maxFrameSize = 18 + 60 + 8 + maxDatagramSize
+)
+
+// PcapReader replays Speedwire datagrams from a capture file in the classic
+// pcap format, as written by tcpdump and Wireshark. Only IPv4 UDP packets to
+// Port are returned, everything else is skipped
+type PcapReader struct {
+	r        io.Reader
+	order    binary.ByteOrder
+	nano     bool
+	snapLen  uint32
+	linkType uint32
+}
+
+// NewPcapReader returns a new PcapReader reading from r, after reading the
+// capture's file header
+func NewPcapReader(r io.Reader) (*PcapReader, error) {
+	hdr := make([]byte, 24)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, err
+	}
+
+	p := &PcapReader{r: r}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch order.Uint32(hdr) {
+		case pcapMagicMicro:
+			p.order = order
+		case pcapMagicNano:
+			p.order = order
+			p.nano = true
+		}
+	}
+
+	if p.order == nil {
+		return nil, errors.New("not a pcap file")
+	}
+
+	p.snapLen = p.order.Uint32(hdr[16:])
+	if p.snapLen == 0 || p.snapLen > maxSnapLen {
+		p.snapLen = maxSnapLen
+	}
+
+	p.linkType = p.order.Uint32(hdr[20:])
+	switch p.linkType {
+	case linkTypeEthernet, linkTypeRaw, linkTypeLinuxSLL:
+	default:
+		return nil, fmt.Errorf("unsupported link type %d", p.linkType)
+	}
+
+	return p, nil
+}
+
+// ReadPacket returns the UDP payload of the next Speedwire packet in the
+// capture and the moment it was captured
+func (p *PcapReader) ReadPacket() ([]byte, time.Time, error) {
+	hdr := make([]byte, 16)
+	for {
+		if _, err := io.ReadFull(p.r, hdr); err != nil {
+			return nil, time.Time{}, err
+		}
+
+		sec := int64(p.order.Uint32(hdr))
+		frac := int64(p.order.Uint32(hdr[4:]))
+		if !p.nano {
+			frac *= 1000
+		}
+		t := time.Unix(sec, frac)
+
+		// the captured length comes from the file, so it is checked before
+		// allocating anything. Frames too large for Speedwire are skipped
+		length := p.order.Uint32(hdr[8:])
+		if length > p.snapLen {
+			return nil, t, fmt.Errorf("packet of %d bytes exceeds the snapshot length", length)
+		}
+		if length > maxFrameSize {
+			if _, err := io.CopyN(ioutil.Discard, p.r, int64(length)); err != nil {
+				return nil, t, unexpectedEOF(err)
+			}
+			continue
+		}
+
+		frame := make([]byte, length)
+		if _, err := io.ReadFull(p.r, frame); err != nil {
+			return nil, t, unexpectedEOF(err)
+		}
+
+		if payload, ok := p.udpPayload(frame); ok {
+			return payload, t, nil
+		}
+	}
+}
+
+// unexpectedEOF returns io.ErrUnexpectedEOF for io.EOF, since the capture
+// ended within a packet
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+// udpPayload returns the payload of given frame if it is an IPv4 UDP packet
+// to Port
+func (p *PcapReader) udpPayload(frame []byte) ([]byte, bool) {
+	var ip []byte
+	switch p.linkType {
+	case linkTypeEthernet:
+		if len(frame) < 14 {
+			return nil, false
+		}
+		etherType, offset := binary.BigEndian.Uint16(frame[12:]), 14
+		if etherType == etherTypeVLAN {
+			if len(frame) < 18 {
+				return nil, false
+			}
+			etherType, offset = binary.BigEndian.Uint16(frame[16:]), 18
+		}
+		if etherType != etherTypeIPv4 {
+			return nil, false
+		}
+		ip = frame[offset:]
+	case linkTypeLinuxSLL:
+		if len(frame) < 16 || binary.BigEndian.Uint16(frame[14:]) != etherTypeIPv4 {
+			return nil, false
+		}
+		ip = frame[16:]
+	default:
+		ip = frame
+	}
+
+	if len(ip) < 20 || ip[0]>>4 != 4 || ip[9] != protocolUDP {
+		return nil, false
+	}
+
+	ihl := int(ip[0]&0x0f) * 4
+	total := int(binary.BigEndian.Uint16(ip[2:]))
+	if ihl < 20 || total < ihl+8 || total > len(ip) {
+		return nil, false
+	}
+
+	udp := ip[ihl:total]
+	if binary.BigEndian.Uint16(udp[2:]) != Port {
+		return nil, false
+	}
+
+	length := int(binary.BigEndian.Uint16(udp[4:]))
+	if length < 8 || length > len(udp) {
+		return nil, false
+	}
+
+	return udp[8:length], true
+}
@@ -0,0 +1,138 @@
+package speedwire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPcapReader(t *testing.T) {
+	f, err := os.Open("testdata/emeter.pcap")
+	require.NoError(t, err)
+	defer f.Close()
+
+	p, err := NewPcapReader(f)
+	require.NoError(t, err)
+
+	// the packet to another port is skipped, the other SMA datagram is not
+	sizes := []int{}
+	for {
+		data, _, err := p.ReadPacket()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		sizes = append(sizes, len(data))
+	}
+	assert.Equal(t, []int{252, 108, 252}, sizes)
+
+	_, err = NewPcapReader(bytes.NewReader(make([]byte, 24)))
+	assert.Error(t, err)
+}
+
+func TestReaderReplay(t *testing.T) {
+	f, err := os.Open("testdata/emeter.pcap")
+	require.NoError(t, err)
+	defer f.Close()
+
+	p, err := NewPcapReader(f)
+	require.NoError(t, err)
+
+	r := NewReader(p)
+
+	d, ts, err := r.Read()
+	if assert.NoError(t, err) {
+		assert.Equal(t, time.Unix(1560346262, 0), ts)
+		assert.Equal(t, uint32(1000), d.Ticker)
+		assert.Equal(t, 1234.0, d.ImportPower)
+	}
+
+	// the non-EMETER datagram in between is skipped
+	d, ts, err = r.Read()
+	if assert.NoError(t, err) {
+		assert.Equal(t, time.Unix(1560346264, 0), ts)
+		assert.Equal(t, uint32(2000), d.Ticker)
+		assert.Equal(t, 2500.0, d.ExportPower)
+		assert.Equal(t, 1234570, d.Status(ts).Consumed)
+		assert.Equal(t, 0, d.Status(ts).Consuming)
+	}
+
+	_, _, err = r.Read()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestReaderSerialNumber(t *testing.T) {
+	f, err := os.Open("testdata/emeter.pcap")
+	require.NoError(t, err)
+	defer f.Close()
+
+	p, err := NewPcapReader(f)
+	require.NoError(t, err)
+
+	r := NewReader(p)
+	r.SerialNumber = 1
+	_, _, err = r.Read()
+	assert.Equal(t, io.EOF, err)
+}
+
+// packets is a PacketSource returning given datagrams
+type packets [][]byte
+
+func (p *packets) ReadPacket() ([]byte, time.Time, error) {
+	if len(*p) == 0 {
+		return nil, time.Time{}, io.EOF
+	}
+
+	data := (*p)[0]
+	*p = (*p)[1:]
+
+	return data, time.Unix(1560346262, 0), nil
+}
+
+func TestReaderSkipsUndecodable(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/emeter.bin")
+	require.NoError(t, err)
+
+	// a short datagram, a truncated EMETER datagram and one that isn't SMA's
+	src := &packets{data[:10], data[:len(data)-8], []byte("discovery"), data}
+	d, _, err := NewReader(src).Read()
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint32(1000), d.Ticker)
+	}
+}
+
+func TestPcapReaderLength(t *testing.T) {
+	capture := func(snapLen, length uint32, body int) *bytes.Reader {
+		buf := make([]byte, 24+16)
+		binary.LittleEndian.PutUint32(buf, pcapMagicMicro)
+		binary.LittleEndian.PutUint32(buf[16:], snapLen)
+		binary.LittleEndian.PutUint32(buf[20:], linkTypeRaw)
+		binary.LittleEndian.PutUint32(buf[24+8:], length)
+
+		return bytes.NewReader(append(buf, make([]byte, body)...))
+	}
+
+	// lengths beyond the snapshot length are rejected before allocating
+	p, err := NewPcapReader(capture(65535, 0xFFFFFFFF, 0))
+	require.NoError(t, err)
+	_, _, err = p.ReadPacket()
+	assert.EqualError(t, err, "packet of 4294967295 bytes exceeds the snapshot length")
+
+	// frames too large for Speedwire are skipped
+	p, err = NewPcapReader(capture(65535, 9000, 9000))
+	require.NoError(t, err)
+	_, _, err = p.ReadPacket()
+	assert.Equal(t, io.EOF, err)
+
+	p, err = NewPcapReader(capture(65535, 9000, 100))
+	require.NoError(t, err)
+	_, _, err = p.ReadPacket()
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
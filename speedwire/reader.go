@@ -0,0 +1,98 @@
+package speedwire
+
+import (
+	"net"
+	"time"
+)
+
+// maxDatagramSize is large enough for any Speedwire datagram
+const maxDatagramSize = 1500
+
+// PacketSource provides raw datagrams along with the moment they were
+// received. It is implemented by Listener for live traffic and by PcapReader
+// for replaying captures
+type PacketSource interface {
+	ReadPacket() ([]byte, time.Time, error)
+}
+
+// Reader reads EMETER datagrams from a PacketSource
+type Reader struct {
+	// SerialNumber, when not 0, limits the datagrams returned to the meter
+	// with this serial number
+	SerialNumber uint32
+	src          PacketSource
+}
+
+// NewReader returns a new Reader reading from src
+func NewReader(src PacketSource) *Reader {
+	return &Reader{src: src}
+}
+
+// Read returns the next EMETER datagram and the moment it was received.
+// Other SMA traffic, datagrams that fail to decode and datagrams of other
+// meters are skipped, since anything may be sent to the multicast group
+func (r *Reader) Read() (*Datagram, time.Time, error) {
+	for {
+		data, t, err := r.src.ReadPacket()
+		if err != nil {
+			return nil, t, err
+		}
+
+		d, err := Decode(data)
+		if err != nil {
+			continue
+		}
+
+		if r.SerialNumber != 0 && d.SerialNumber != r.SerialNumber {
+			continue
+		}
+
+		return d, t, nil
+	}
+}
+
+// Listener receives datagrams sent to the Speedwire multicast group
+type Listener struct {
+	conn *net.UDPConn
+	buf  []byte
+}
+
+// Listen joins the Speedwire multicast group on the interface with given
+// name, or on the system's default interface when name is empty
+func Listen(name string) (*Listener, error) {
+	var ifi *net.Interface
+	if name != "" {
+		var err error
+		if ifi, err = net.InterfaceByName(name); err != nil {
+			return nil, err
+		}
+	}
+
+	addr, err := net.ResolveUDPAddr("udp4", MulticastAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenMulticastUDP("udp4", ifi, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Listener{conn: conn, buf: make([]byte, maxDatagramSize)}, nil
+}
+
+// ReadPacket returns the next datagram received. The returned slice is only
+// valid until the next call
+func (l *Listener) ReadPacket() ([]byte, time.Time, error) {
+	n, _, err := l.conn.ReadFromUDP(l.buf)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return l.buf[:n], time.Now(), nil
+}
+
+// Close leaves the multicast group
+func (l *Listener) Close() error {
+	return l.conn.Close()
+}
@@ -0,0 +1,188 @@
+// Package speedwire decodes the EMETER datagrams SMA energy meters and Sunny
+// Home Managers broadcast over Speedwire and maps them onto PVOutput's data
+// structures
+package speedwire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/skoef/pvoutput"
+)
+
+const (
+	// MulticastAddress is the address EMETER datagrams are sent to
+	MulticastAddress = "239.12.255.254:9522"
+	// ProtocolEMETER is the protocol ID of EMETER datagrams
+	ProtocolEMETER uint16 = 0x6069
+)
+
+// OBIS measurement indices, the c part of the channel ID
+const (
+	IndexImportPower   = 1
+	IndexExportPower   = 2
+	IndexL1ImportPower = 21
+	IndexL1ExportPower = 22
+	IndexL1Voltage     = 32
+	IndexL2ImportPower = 41
+	IndexL2ExportPower = 42
+	IndexL2Voltage     = 52
+	IndexL3ImportPower = 61
+	IndexL3ExportPower = 62
+	IndexL3Voltage     = 72
+)
+
+const (
+	// measurement types, the d part of the channel ID
+	typeActual  = 4
+	typeCounter = 8
+	// the software version channel has a 4 byte value
+	channelVersion = 0x90
+)
+
+var (
+	// ErrNotEMETER is returned when decoding a datagram that is not an
+	// EMETER datagram, e.g. inverter traffic on the same multicast group
+	ErrNotEMETER = errors.New("not an EMETER datagram")
+
+	smaSignature = []byte("SMA\x00")
+)
+
+// Channel identifies a measurement in a datagram
+type Channel struct {
+	Index uint8 // measurement index, e.g. IndexImportPower
+	Type  uint8 // 4 for actual values, 8 for counters
+}
+
+// Phase holds the measurements of a single phase
+type Phase struct {
+	ImportPower float64 // watts
+	ExportPower float64 // watts
+	Voltage     float64 // volts
+}
+
+// Datagram is a decoded EMETER datagram
+type Datagram struct {
+	SusyID       uint16
+	SerialNumber uint32
+	Ticker       uint32 // milliseconds, wraps around
+	ImportPower  float64
+	ExportPower  float64
+	ImportEnergy float64 // lifetime watt hours
+	ExportEnergy float64 // lifetime watt hours
+	Phases       [3]Phase
+	// Values holds all raw values by channel
+	Values map[Channel]uint64
+}
+
+// Decode decodes given EMETER datagram
+func Decode(data []byte) (*Datagram, error) {
+	if len(data) < 4 || !bytes.Equal(data[:4], smaSignature) {
+		return nil, errors.New("not an SMA datagram")
+	}
+	if len(data) < 18 {
+		return nil, errors.New("datagram too short")
+	}
+
+	length := int(binary.BigEndian.Uint16(data[12:]))
+	if tag := binary.BigEndian.Uint16(data[14:]); tag != 0x0010 {
+		return nil, fmt.Errorf("unexpected tag %04x", tag)
+	}
+	if binary.BigEndian.Uint16(data[16:]) != ProtocolEMETER {
+		return nil, ErrNotEMETER
+	}
+	if length < 12 || 16+length > len(data) {
+		return nil, errors.New("datagram too short")
+	}
+
+	d := &Datagram{
+		SusyID:       binary.BigEndian.Uint16(data[18:]),
+		SerialNumber: binary.BigEndian.Uint32(data[20:]),
+		Ticker:       binary.BigEndian.Uint32(data[24:]),
+		Values:       map[Channel]uint64{},
+	}
+
+	payload := data[28 : 16+length]
+	for len(payload) > 0 {
+		if len(payload) < 4 {
+			return nil, errors.New("truncated channel header")
+		}
+
+		channel, index, typ := payload[0], payload[1], payload[2]
+		payload = payload[4:]
+
+		size := 4
+		if typ == typeCounter {
+			size = 8
+		}
+		if len(payload) < size {
+			return nil, errors.New("truncated channel value")
+		}
+
+		if channel == channelVersion {
+			payload = payload[size:]
+			continue
+		}
+
+		var v uint64
+		if size == 4 {
+			v = uint64(binary.BigEndian.Uint32(payload))
+		} else {
+			v = binary.BigEndian.Uint64(payload)
+		}
+		d.Values[Channel{Index: index, Type: typ}] = v
+		payload = payload[size:]
+	}
+
+	d.ImportPower = d.power(IndexImportPower)
+	d.ExportPower = d.power(IndexExportPower)
+	d.ImportEnergy = d.energy(IndexImportPower)
+	d.ExportEnergy = d.energy(IndexExportPower)
+	for i, idx := range [][3]uint8{
+		{IndexL1ImportPower, IndexL1ExportPower, IndexL1Voltage},
+		{IndexL2ImportPower, IndexL2ExportPower, IndexL2Voltage},
+		{IndexL3ImportPower, IndexL3ExportPower, IndexL3Voltage},
+	} {
+		d.Phases[i] = Phase{
+			ImportPower: d.power(idx[0]),
+			ExportPower: d.power(idx[1]),
+			Voltage:     float64(d.Values[Channel{Index: idx[2], Type: typeActual}]) / 1000,
+		}
+	}
+
+	return d, nil
+}
+
+// power returns the actual value of given index in watts, it is sent in
+// units of 0.1W
+func (d *Datagram) power(index uint8) float64 {
+	return float64(d.Values[Channel{Index: index, Type: typeActual}]) / 10
+}
+
+// energy returns the counter value of given index in watt hours, it is sent
+// in watt seconds
+func (d *Datagram) energy(index uint8) float64 {
+	return float64(d.Values[Channel{Index: index, Type: typeCounter}]) / 3600
+}
+
+// Status returns a Status for given moment, typically the moment the
+// datagram was received. Like a P1 smart meter, the energy meter measures
+// the grid connection: Consumed is the lifetime energy imported from the grid,
+// so Cumulative is set to StatusCumulativeConsuming, and Consuming is the
+// power imported from the grid
+func (d *Datagram) Status(t time.Time) pvoutput.Status {
+	s := pvoutput.NewStatus()
+	s.DateTime = t
+	s.Consumed = int(math.Round(d.ImportEnergy))
+	s.Consuming = int(math.Round(math.Max(0, d.ImportPower-d.ExportPower)))
+	s.Cumulative = pvoutput.StatusCumulativeConsuming
+	if d.Phases[0].Voltage > 0 {
+		s.Voltage = d.Phases[0].Voltage
+	}
+
+	return s
+}
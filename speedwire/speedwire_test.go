@@ -0,0 +1,72 @@
+package speedwire
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/skoef/pvoutput"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecode(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/emeter.bin")
+	require.NoError(t, err)
+
+	d, err := Decode(data)
+	require.NoError(t, err)
+
+	assert.Equal(t, uint16(0x0174), d.SusyID)
+	assert.Equal(t, uint32(1900123456), d.SerialNumber)
+	assert.Equal(t, uint32(1000), d.Ticker)
+	assert.Equal(t, 1234.0, d.ImportPower)
+	assert.Equal(t, 0.0, d.ExportPower)
+	assert.Equal(t, 1234567.0, d.ImportEnergy)
+	assert.Equal(t, 765432.0, d.ExportEnergy)
+	assert.Equal(t, Phase{ImportPower: 500, Voltage: 230.1}, d.Phases[0])
+	assert.Equal(t, Phase{ImportPower: 400, Voltage: 231.2}, d.Phases[1])
+	assert.Equal(t, Phase{ImportPower: 334, Voltage: 229.8}, d.Phases[2])
+
+	// channels not mapped onto fields are available as raw values
+	_, ok := d.Values[Channel{Index: 13, Type: typeActual}]
+	assert.True(t, ok)
+
+	// corrupt datagrams
+	_, err = Decode(data[:20])
+	assert.Error(t, err)
+	_, err = Decode(data[:100])
+	assert.Error(t, err)
+	_, err = Decode([]byte("foobar"))
+	assert.Error(t, err)
+
+	// other protocols on the same group
+	other := append([]byte{}, data...)
+	binary.BigEndian.PutUint16(other[16:], 0x6065)
+	_, err = Decode(other)
+	assert.Equal(t, ErrNotEMETER, err)
+}
+
+func TestDatagramStatus(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/emeter.bin")
+	require.NoError(t, err)
+
+	d, err := Decode(data)
+	require.NoError(t, err)
+
+	now := time.Date(2019, 6, 12, 15, 31, 2, 0, time.UTC)
+	s := d.Status(now)
+	assert.Equal(t, now, s.DateTime)
+	assert.Equal(t, 1234567, s.Consumed)
+	assert.Equal(t, 1234, s.Consuming)
+	assert.Equal(t, pvoutput.StatusCumulativeConsuming, s.Cumulative)
+	assert.Equal(t, 230.1, s.Voltage)
+	assert.Equal(t, -1, s.Generated)
+	assert.Equal(t, -1, s.Generating)
+
+	// exporting to the grid
+	d.ImportPower = 0
+	d.ExportPower = 2500
+	assert.Equal(t, 0, d.Status(now).Consuming)
+}
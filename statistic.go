@@ -0,0 +1,135 @@
+package pvoutput
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Statistic represents the aggregated statistics of a system over a period,
+// as returned by GetStatistic. Consumption fields are only set when the
+// system records consumption
+type Statistic struct {
+	Generated          int     // watt hours
+	Exported           int     // watt hours
+	AverageGeneration  int     // watt hours
+	MinimumGeneration  int     // watt hours
+	MaximumGeneration  int     // watt hours
+	AverageEfficiency  float64 // kWh/kW
+	Outputs            int     // number of outputs
+	DateFrom           time.Time
+	DateTo             time.Time
+	RecordEfficiency   float64 // kWh/kW
+	RecordDate         time.Time
+	Consumed           int // watt hours
+	ImportPeak         int // watt hours
+	ImportOffPeak      int // watt hours
+	ImportShoulder     int // watt hours
+	ImportHighShoulder int // watt hours
+	AverageConsumption int // watt hours
+	MinimumConsumption int // watt hours
+	MaximumConsumption int // watt hours
+}
+
+func decodeStatistic(input string) (st Statistic, err error) {
+	fields := strings.Split(strings.TrimSpace(input), ",")
+	if len(fields) < 11 {
+		err = errors.New("not enough fields in statistic")
+		return
+	}
+
+	// parse Generated field from fields[0]
+	st.Generated, err = decodeInt(fields[0])
+	if err != nil {
+		return
+	}
+
+	// parse Exported field from fields[1]
+	st.Exported, err = decodeInt(fields[1])
+	if err != nil {
+		return
+	}
+
+	// parse AverageGeneration field from fields[2]
+	st.AverageGeneration, err = decodeInt(fields[2])
+	if err != nil {
+		return
+	}
+
+	// parse MinimumGeneration field from fields[3]
+	st.MinimumGeneration, err = decodeInt(fields[3])
+	if err != nil {
+		return
+	}
+
+	// parse MaximumGeneration field from fields[4]
+	st.MaximumGeneration, err = decodeInt(fields[4])
+	if err != nil {
+		return
+	}
+
+	// parse AverageEfficiency field from fields[5]
+	st.AverageEfficiency, err = decodeFloat(fields[5])
+	if err != nil {
+		return
+	}
+
+	// parse Outputs field from fields[6]
+	st.Outputs, err = decodeInt(fields[6])
+	if err != nil {
+		return
+	}
+
+	// parse DateFrom and DateTo fields from fields[7] and fields[8]
+	st.DateFrom, err = time.Parse("20060102", fields[7])
+	if err != nil {
+		return
+	}
+	st.DateTo, err = time.Parse("20060102", fields[8])
+	if err != nil {
+		return
+	}
+
+	// parse RecordEfficiency field from fields[9]
+	st.RecordEfficiency, err = decodeFloat(fields[9])
+	if err != nil {
+		return
+	}
+
+	// parse RecordDate field from fields[10]
+	st.RecordDate, err = time.Parse("20060102", fields[10])
+	if err != nil {
+		return
+	}
+
+	if len(fields) < 19 {
+		st.Consumed = UnsetInt
+		st.ImportPeak = UnsetInt
+		st.ImportOffPeak = UnsetInt
+		st.ImportShoulder = UnsetInt
+		st.ImportHighShoulder = UnsetInt
+		st.AverageConsumption = UnsetInt
+		st.MinimumConsumption = UnsetInt
+		st.MaximumConsumption = UnsetInt
+		return
+	}
+
+	// parse consumption fields from fields[11] up to fields[18]
+	for i, dst := range []*int{
+		&st.Consumed,
+		&st.ImportPeak,
+		&st.ImportOffPeak,
+		&st.ImportShoulder,
+		&st.ImportHighShoulder,
+		&st.AverageConsumption,
+		&st.MinimumConsumption,
+		&st.MaximumConsumption,
+	} {
+		*dst, err = decodeInt(fields[11+i])
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
@@ -0,0 +1,50 @@
+package pvoutput
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeStatistic(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/statistic/normal")
+	require.NoError(t, err)
+
+	st, err := decodeStatistic(string(data))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 24600, st.Generated)
+		assert.Equal(t, 14220, st.Exported)
+		assert.Equal(t, 913, st.AverageGeneration)
+		assert.Equal(t, 2, st.MinimumGeneration)
+		assert.Equal(t, 2857, st.MaximumGeneration)
+		assert.Equal(t, 3.358, st.AverageEfficiency)
+		assert.Equal(t, 27, st.Outputs)
+		assert.Equal(t, time.Date(2010, 9, 1, 0, 0, 0, 0, time.UTC), st.DateFrom)
+		assert.Equal(t, time.Date(2010, 9, 27, 0, 0, 0, 0, time.UTC), st.DateTo)
+		assert.Equal(t, 4.653, st.RecordEfficiency)
+		assert.Equal(t, time.Date(2010, 9, 16, 0, 0, 0, 0, time.UTC), st.RecordDate)
+		assert.Equal(t, -1, st.Consumed)
+		assert.Equal(t, -1, st.MaximumConsumption)
+	}
+
+	data, err = ioutil.ReadFile("testdata/statistic/consumption")
+	require.NoError(t, err)
+
+	st, err = decodeStatistic(string(data))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 10237, st.Consumed)
+		assert.Equal(t, 3011, st.ImportPeak)
+		assert.Equal(t, 6021, st.ImportOffPeak)
+		assert.Equal(t, 1205, st.ImportShoulder)
+		assert.Equal(t, 0, st.ImportHighShoulder)
+		assert.Equal(t, 379, st.AverageConsumption)
+		assert.Equal(t, 124, st.MinimumConsumption)
+		assert.Equal(t, 1002, st.MaximumConsumption)
+	}
+
+	_, err = decodeStatistic("24600,14220")
+	assert.Error(t, err)
+}
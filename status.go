@@ -1,6 +1,7 @@
 package pvoutput
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/url"
@@ -21,19 +22,39 @@ var (
 		"v4", // consuming
 		"v5", // temperature
 		"v6", // voltage
+		"v7", // extended data
+		"v8",
+		"v9",
+		"v10",
+		"v11",
+		"v12",
 	}
+	// statusTextKeys are the keys of a batch status line as written by
+	// MarshalText, with the cumulative flag trailing the batch keys
+	statusTextKeys = append(statusBatchKeys[:len(statusBatchKeys):len(statusBatchKeys)], "c1")
 )
 
 const (
 	// BatchStatusMaxSize determines the maximum batch size
 	// this is 30 according to PVOutput's docs
 	BatchStatusMaxSize = 30
+	// StatusHistoryMaxLimit is the maximum number of statuses returned by
+	// GetStatusHistory
+	StatusHistoryMaxLimit = 288
+	// StatusMaxAgeDays is how many days back statuses can be added when not
+	// in donating mode
+	StatusMaxAgeDays = 14
+	// StatusMaxAgeDaysDonating is how many days back statuses can be added
+	// when in donating mode
+	StatusMaxAgeDaysDonating = 90
 )
 
 // StatusCumulative is a flag to tell if and how a status update has cumulative Wh values
 type StatusCumulative int
 
 const (
+	// StatusCumulativeUnset no Wh values are lifetime energy values
+	StatusCumulativeUnset StatusCumulative = UnsetInt
 	// StatusCumulativeAll all Wh values are lifetime energy values
 	StatusCumulativeAll StatusCumulative = 1
 	// StatusCumulativeGenerating generation Wh values are lifetime energy values
@@ -54,6 +75,9 @@ type Status struct {
 	Temperature float64 // celsius
 	Voltage     float64 // volts
 	Cumulative  StatusCumulative
+	// Extended holds the values of extended data fields v7 to v12, as
+	// defined with SystemUpdate
+	Extended [6]float64
 }
 
 // NewStatus initialises and returns a new Status
@@ -65,13 +89,22 @@ type Status struct {
 // body
 func NewStatus() Status {
 	return Status{
-		Generated:   outputUnsetInt,
-		Generating:  outputUnsetInt,
-		Consumed:    outputUnsetInt,
-		Consuming:   outputUnsetInt,
-		Temperature: outputUnsetFloat,
-		Voltage:     outputUnsetFloat,
-		Cumulative:  StatusCumulative(outputUnsetInt),
+		Generated:   UnsetInt,
+		Generating:  UnsetInt,
+		Consumed:    UnsetInt,
+		Consuming:   UnsetInt,
+		Output:      UnsetFloat,
+		Temperature: UnsetFloat,
+		Voltage:     UnsetFloat,
+		Cumulative:  StatusCumulativeUnset,
+		Extended: [6]float64{
+			UnsetFloat,
+			UnsetFloat,
+			UnsetFloat,
+			UnsetFloat,
+			UnsetFloat,
+			UnsetFloat,
+		},
 	}
 }
 
@@ -84,27 +117,32 @@ func (s Status) encode() (url.Values, error) {
 	data.Set("d", s.DateTime.Format("20060102"))
 	data.Set("t", s.DateTime.Format("15:04"))
 
-	if s.Generated != outputUnsetInt {
+	if s.Generated != UnsetInt {
 		data.Set("v1", fmt.Sprintf("%d", s.Generated))
 	}
-	if s.Generating != outputUnsetInt {
+	if s.Generating != UnsetInt {
 		data.Set("v2", fmt.Sprintf("%d", s.Generating))
 	}
-	if s.Consumed != outputUnsetInt {
+	if s.Consumed != UnsetInt {
 		data.Set("v3", fmt.Sprintf("%d", s.Consumed))
 	}
-	if s.Consuming != outputUnsetInt {
+	if s.Consuming != UnsetInt {
 		data.Set("v4", fmt.Sprintf("%d", s.Consuming))
 	}
-	if s.Temperature != outputUnsetFloat {
+	if s.Temperature != UnsetFloat {
 		data.Set("v5", fmt.Sprintf("%0.1f", s.Temperature))
 	}
-	if s.Voltage != outputUnsetFloat {
+	if s.Voltage != UnsetFloat {
 		data.Set("v6", fmt.Sprintf("%0.1f", s.Voltage))
 	}
-	if int(s.Cumulative) != outputUnsetInt {
+	if s.Cumulative != StatusCumulativeUnset {
 		data.Set("c1", fmt.Sprintf("%d", s.Cumulative))
 	}
+	for i, v := range s.Extended {
+		if v != UnsetFloat {
+			data.Set(fmt.Sprintf("v%d", ExtendedFirst+i), strconv.FormatFloat(v, 'f', -1, 64))
+		}
+	}
 
 	return data, nil
 }
@@ -119,10 +157,174 @@ func (s Status) Encode() (string, error) {
 	return data.Encode(), nil
 }
 
+// statusJSON is the JSON representation of a Status, unset fields are nil
+type statusJSON struct {
+	DateTime    *time.Time `json:"date_time,omitempty"`
+	Generated   *int       `json:"generated_wh,omitempty"`
+	Generating  *int       `json:"generating_w,omitempty"`
+	Consumed    *int       `json:"consumed_wh,omitempty"`
+	Consuming   *int       `json:"consuming_w,omitempty"`
+	Output      *float64   `json:"normalised_output_kw_per_kw,omitempty"`
+	Temperature *float64   `json:"temperature_c,omitempty"`
+	Voltage     *float64   `json:"voltage_v,omitempty"`
+	Cumulative  *int       `json:"cumulative,omitempty"`
+	Extended7   *float64   `json:"v7,omitempty"`
+	Extended8   *float64   `json:"v8,omitempty"`
+	Extended9   *float64   `json:"v9,omitempty"`
+	Extended10  *float64   `json:"v10,omitempty"`
+	Extended11  *float64   `json:"v11,omitempty"`
+	Extended12  *float64   `json:"v12,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler. Unset fields are left out, the
+// DateTime is encoded in RFC 3339 format
+func (s Status) MarshalJSON() ([]byte, error) {
+	j := statusJSON{
+		Generated:   jsonInt(s.Generated),
+		Generating:  jsonInt(s.Generating),
+		Consumed:    jsonInt(s.Consumed),
+		Consuming:   jsonInt(s.Consuming),
+		Output:      jsonFloat(s.Output),
+		Temperature: jsonFloat(s.Temperature),
+		Voltage:     jsonFloat(s.Voltage),
+		Cumulative:  jsonInt(int(s.Cumulative)),
+		Extended7:   jsonFloat(s.Extended[0]),
+		Extended8:   jsonFloat(s.Extended[1]),
+		Extended9:   jsonFloat(s.Extended[2]),
+		Extended10:  jsonFloat(s.Extended[3]),
+		Extended11:  jsonFloat(s.Extended[4]),
+		Extended12:  jsonFloat(s.Extended[5]),
+	}
+	if !s.DateTime.IsZero() {
+		j.DateTime = &s.DateTime
+	}
+
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Fields missing from the JSON
+// object are unset, like they are in NewStatus
+func (s *Status) UnmarshalJSON(data []byte) error {
+	j := statusJSON{}
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	*s = NewStatus()
+	if j.DateTime != nil {
+		s.DateTime = *j.DateTime
+	}
+	for _, f := range []struct {
+		src *int
+		dst *int
+	}{
+		{j.Generated, &s.Generated},
+		{j.Generating, &s.Generating},
+		{j.Consumed, &s.Consumed},
+		{j.Consuming, &s.Consuming},
+	} {
+		if f.src != nil {
+			*f.dst = *f.src
+		}
+	}
+	for _, f := range []struct {
+		src *float64
+		dst *float64
+	}{
+		{j.Output, &s.Output},
+		{j.Temperature, &s.Temperature},
+		{j.Voltage, &s.Voltage},
+		{j.Extended7, &s.Extended[0]},
+		{j.Extended8, &s.Extended[1]},
+		{j.Extended9, &s.Extended[2]},
+		{j.Extended10, &s.Extended[3]},
+		{j.Extended11, &s.Extended[4]},
+		{j.Extended12, &s.Extended[5]},
+	} {
+		if f.src != nil {
+			*f.dst = *f.src
+		}
+	}
+	if j.Cumulative != nil {
+		s.Cumulative = StatusCumulative(*j.Cumulative)
+	}
+
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler, encoding the status as a
+// line of PVOutput's batch status format: date, time and v1 to v12. Output is
+// only reported by PVOutput and is not part of this format. When Cumulative
+// is set, it follows as extra c1 column, so it survives a round-trip. That
+// column is not part of PVOutput's format, which takes c1 as parameter of the
+// whole batch, so such lines can't be passed to PVOutput as is
+func (s Status) MarshalText() ([]byte, error) {
+	data, err := s.encode()
+	if err != nil {
+		return nil, err
+	}
+
+	return textLine(data, statusTextKeys), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, decoding a line of
+// PVOutput's batch status format as written by MarshalText. Empty fields are
+// unset
+func (s *Status) UnmarshalText(text []byte) error {
+	values, err := textFields(text, statusTextKeys)
+	if err != nil {
+		return err
+	}
+
+	st := NewStatus()
+	st.DateTime, err = time.Parse("20060102-15:04", values["d"]+"-"+values["t"])
+	if err != nil {
+		return errors.New("invalid date or time")
+	}
+
+	for _, f := range []struct {
+		key string
+		dst *int
+	}{
+		{"v1", &st.Generated},
+		{"v2", &st.Generating},
+		{"v3", &st.Consumed},
+		{"v4", &st.Consuming},
+	} {
+		if err := textInt(values, f.key, f.dst); err != nil {
+			return err
+		}
+	}
+	if err := textFloat(values, "v5", &st.Temperature); err != nil {
+		return err
+	}
+	if err := textFloat(values, "v6", &st.Voltage); err != nil {
+		return err
+	}
+	for i := range st.Extended {
+		if err := textFloat(values, fmt.Sprintf("v%d", ExtendedFirst+i), &st.Extended[i]); err != nil {
+			return err
+		}
+	}
+	cumulative := int(st.Cumulative)
+	if err := textInt(values, "c1", &cumulative); err != nil {
+		return err
+	}
+	st.Cumulative = StatusCumulative(cumulative)
+
+	*s = st
+
+	return nil
+}
+
+// decodeStatus decodes a single status. Fields PVOutput returns as NaN are
+// unset, like they are in NewStatus
 func decodeStatus(input string) (s Status, err error) {
-	fields := strings.Split(strings.TrimSpace(input), ",")
+	s = NewStatus()
 
+	fields := strings.Split(strings.TrimSpace(input), ",")
 	if len(fields) < 9 {
+		err = errors.New("not enough fields in status")
 		return
 	}
 
@@ -133,43 +335,43 @@ func decodeStatus(input string) (s Status, err error) {
 	}
 
 	// parse Generated field from fields[2]
-	s.Generated, err = strconv.Atoi(fields[2])
+	s.Generated, err = decodeInt(fields[2])
 	if err != nil {
 		return
 	}
 
 	// parse Generating field from fields[3]
-	s.Generating, err = strconv.Atoi(fields[3])
+	s.Generating, err = decodeInt(fields[3])
 	if err != nil {
 		return
 	}
 
 	// parse Consumed field from fields[4]
-	s.Consumed, err = strconv.Atoi(fields[4])
+	s.Consumed, err = decodeInt(fields[4])
 	if err != nil {
 		return
 	}
 
 	// parse Consuming field from fields[5]
-	s.Consuming, err = strconv.Atoi(fields[5])
+	s.Consuming, err = decodeInt(fields[5])
 	if err != nil {
 		return
 	}
 
 	// parse Output field from fields[6]
-	s.Output, err = strconv.ParseFloat(fields[6], 64)
+	s.Output, err = decodeFloat(fields[6])
 	if err != nil {
 		return
 	}
 
 	// parse Temperature field from fields[7]
-	s.Temperature, err = strconv.ParseFloat(fields[7], 64)
+	s.Temperature, err = decodeFloat(fields[7])
 	if err != nil {
 		return
 	}
 
 	// parse Voltage field from fields[8]
-	s.Voltage, err = strconv.ParseFloat(fields[8], 64)
+	s.Voltage, err = decodeFloat(fields[8])
 	if err != nil {
 		return
 	}
@@ -209,3 +411,183 @@ func (b BatchStatus) Encode() (string, error) {
 
 	return fmt.Sprintf("data=%s", strings.Join(items, ";")), nil
 }
+
+// StatusHistoryOptions determines which statuses GetStatusHistory returns.
+// Zero values are not sent to PVOutput
+type StatusHistoryOptions struct {
+	Date      time.Time // day to return statuses of, today when zero
+	From      time.Time // time of day to start at
+	To        time.Time // time of day to end at
+	Ascending bool
+	Limit     int
+}
+
+func (o StatusHistoryOptions) values() (url.Values, error) {
+	params := url.Values{}
+	params.Set("h", "1")
+
+	if !o.Date.IsZero() {
+		params.Set("d", o.Date.Format("20060102"))
+	}
+	if !o.From.IsZero() {
+		params.Set("from", o.From.Format("15:04"))
+	}
+	if !o.To.IsZero() {
+		params.Set("to", o.To.Format("15:04"))
+	}
+	if o.Ascending {
+		params.Set("asc", "1")
+	}
+
+	if o.Limit < 0 || o.Limit > StatusHistoryMaxLimit {
+		return nil, fmt.Errorf("Limit should be between 0 and %d", StatusHistoryMaxLimit)
+	}
+	if o.Limit > 0 {
+		params.Set("limit", fmt.Sprintf("%d", o.Limit))
+	}
+
+	return params, nil
+}
+
+// StatusHistorySource returns the status history of a day, it is
+// implemented by API
+type StatusHistorySource interface {
+	GetStatusHistory(o StatusHistoryOptions) ([]Status, error)
+}
+
+// DateOf returns the date of given time as PVOutput returns it, at midnight
+// UTC
+func DateOf(t time.Time) time.Time {
+	y, m, d := t.Date()
+
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// StatusesOfDay returns the statuses of given day after given time, which
+// may be zero, in order of time. It pages through the status history when
+// the day holds more statuses than PVOutput returns at once. A day without
+// statuses is not an error
+func StatusesOfDay(src StatusHistorySource, date, after time.Time) ([]Status, error) {
+	date = DateOf(date)
+	o := StatusHistoryOptions{
+		Date:      date,
+		Ascending: true,
+		Limit:     StatusHistoryMaxLimit,
+	}
+	if !after.IsZero() && DateOf(after).Equal(date) {
+		o.From = after.Add(time.Minute)
+	}
+
+	statuses := []Status{}
+	for o.From.IsZero() || DateOf(o.From).Equal(date) {
+		page, err := src.GetStatusHistory(o)
+		if errors.Is(err, ErrNoData) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// a page without new statuses would be requested again
+		count := len(statuses)
+		for _, s := range page {
+			if !after.IsZero() && !s.DateTime.After(after) {
+				continue
+			}
+			if len(statuses) > 0 && !s.DateTime.After(statuses[len(statuses)-1].DateTime) {
+				continue
+			}
+			statuses = append(statuses, s)
+		}
+
+		if len(page) < o.Limit || len(statuses) == count {
+			break
+		}
+		o.From = statuses[len(statuses)-1].DateTime.Add(time.Minute)
+	}
+
+	return statuses, nil
+}
+
+// decodeStatusHistory decodes a single status in history mode, which holds
+// both instantaneous and average power. Generating is set to the average
+// power, like it is in regular statuses
+func decodeStatusHistory(input string) (s Status, err error) {
+	fields := strings.Split(strings.TrimSpace(input), ",")
+	if len(fields) < 11 {
+		err = errors.New("not enough fields in status")
+		return
+	}
+
+	s = NewStatus()
+
+	// parse DateTime field from fields[0]+fields[1]
+	s.DateTime, err = time.Parse("20060102-15:04", fmt.Sprintf("%s-%s", fields[0], fields[1]))
+	if err != nil {
+		return
+	}
+
+	// parse Generated field from fields[2]
+	s.Generated, err = decodeInt(fields[2])
+	if err != nil {
+		return
+	}
+
+	// fields[3] and fields[4] hold efficiency and instantaneous power
+
+	// parse Generating field from fields[5]
+	s.Generating, err = decodeInt(fields[5])
+	if err != nil {
+		return
+	}
+
+	// parse Output field from fields[6]
+	s.Output, err = decodeFloat(fields[6])
+	if err != nil {
+		return
+	}
+
+	// parse Consumed field from fields[7]
+	s.Consumed, err = decodeInt(fields[7])
+	if err != nil {
+		return
+	}
+
+	// parse Consuming field from fields[8]
+	s.Consuming, err = decodeInt(fields[8])
+	if err != nil {
+		return
+	}
+
+	// parse Temperature field from fields[9]
+	s.Temperature, err = decodeFloat(fields[9])
+	if err != nil {
+		return
+	}
+
+	// parse Voltage field from fields[10]
+	s.Voltage, err = decodeFloat(fields[10])
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// statusDeletion identifies the status to delete with DeleteStatus
+type statusDeletion struct {
+	DateTime time.Time
+}
+
+// Encode returns API string for this object
+func (d statusDeletion) Encode() (string, error) {
+	if d.DateTime.IsZero() {
+		return "", errors.New("DateTime is required to delete a status")
+	}
+
+	data := url.Values{}
+	data.Set("d", d.DateTime.Format("20060102"))
+	data.Set("t", d.DateTime.Format("15:04"))
+
+	return data.Encode(), nil
+}
@@ -1,7 +1,10 @@
 package pvoutput
 
 import (
+	"encoding/json"
+	"errors"
 	"io/ioutil"
+	"strings"
 	"testing"
 	"time"
 
@@ -73,6 +76,13 @@ func TestStatusEncode(t *testing.T) {
 	s.Cumulative = StatusCumulativeConsuming
 	result, _ = s.Encode()
 	assert.Equal(t, "c1=3&d=20200818&t=12%3A34", result)
+
+	// test extended data
+	s = newValidStatus()
+	s.Extended[0] = 12.5
+	s.Extended[5] = -3
+	result, _ = s.Encode()
+	assert.Equal(t, "d=20200818&t=12%3A34&v12=-3&v7=12.5", result)
 }
 
 func TestDecodeStatus(t *testing.T) {
@@ -91,6 +101,22 @@ func TestDecodeStatus(t *testing.T) {
 		assert.Equal(t, 15.3, status.Temperature)
 		assert.Equal(t, 240.1, status.Voltage)
 	}
+
+	// values PVOutput doesn't have are unset
+	status, err = decodeStatus("20101107,18:30,12936,202,NaN,NaN,NaN,NaN,NaN")
+	if assert.NoError(t, err) {
+		assert.Equal(t, UnsetInt, status.Consumed)
+		assert.Equal(t, UnsetInt, status.Consuming)
+		assert.Equal(t, UnsetFloat, status.Output)
+		assert.Equal(t, UnsetFloat, status.Temperature)
+		assert.Equal(t, StatusCumulativeUnset, status.Cumulative)
+		assert.Equal(t, UnsetFloat, status.Extended[0])
+	}
+
+	_, err = decodeStatus("20101107,18:30,12936,202")
+	assert.EqualError(t, err, "not enough fields in status")
+	_, err = decodeStatus("")
+	assert.Error(t, err)
 }
 
 func TestEncodeBatchStatus(t *testing.T) {
@@ -154,4 +180,201 @@ func TestEncodeBatchStatus(t *testing.T) {
 	if assert.NoError(t, err) {
 		assert.Equal(t, "data=20110112,04:15,,,2000,210", result)
 	}
+
+	// extended data follows the voltage
+	b = BatchStatus{NewStatus()}
+	b[0].DateTime, _ = time.Parse("200601021504", "201101121020")
+	b[0].Generated = 900
+	b[0].Extended[1] = 42.1
+
+	result, err = b.Encode()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "data=20110112,10:20,900,,,,,,,42.1", result)
+	}
+}
+
+func TestDecodeStatusHistory(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/status/history")
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), ";")
+	require.Len(t, lines, 2)
+
+	status, err := decodeStatusHistory(lines[0])
+	if assert.NoError(t, err) {
+		dtime, _ := time.Parse("200601021504", "201011071400")
+		assert.Equal(t, dtime, status.DateTime)
+		assert.Equal(t, 12936, status.Generated)
+		assert.Equal(t, 1200, status.Generating)
+		assert.Equal(t, 0.303, status.Output)
+		assert.Equal(t, 19832, status.Consumed)
+		assert.Equal(t, 459, status.Consuming)
+		assert.Equal(t, 15.3, status.Temperature)
+		assert.Equal(t, 240.1, status.Voltage)
+	}
+
+	// NaN values are unset
+	status, err = decodeStatusHistory(lines[1])
+	if assert.NoError(t, err) {
+		assert.Equal(t, 12836, status.Generated)
+		assert.Equal(t, -1, status.Generating)
+		assert.Equal(t, -1, status.Consumed)
+		assert.Equal(t, -1.0, status.Temperature)
+	}
+
+	_, err = decodeStatusHistory("20101107,14:00")
+	assert.Error(t, err)
+}
+
+func TestStatusJSON(t *testing.T) {
+	s := NewStatus()
+	s.DateTime = time.Date(2020, 8, 18, 12, 34, 0, 0, time.FixedZone("CEST", 2*3600))
+	s.Generated = 0
+	s.Generating = 1500
+	s.Temperature = 21.5
+	s.Cumulative = StatusCumulativeAll
+	s.Extended[1] = 3.25
+
+	data, err := json.Marshal(s)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"date_time": "2020-08-18T12:34:00+02:00",
+		"generated_wh": 0,
+		"generating_w": 1500,
+		"temperature_c": 21.5,
+		"cumulative": 1,
+		"v8": 3.25
+	}`, string(data))
+
+	// fields missing from the JSON are unset
+	decoded := Status{}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.True(t, s.DateTime.Equal(decoded.DateTime))
+	decoded.DateTime = s.DateTime
+	assert.Equal(t, s, decoded)
+
+	data, err = json.Marshal(NewStatus())
+	require.NoError(t, err)
+	assert.Equal(t, "{}", string(data))
+
+	assert.Error(t, json.Unmarshal([]byte(`{"date_time":"20200818"}`), &decoded))
+}
+
+func TestStatusText(t *testing.T) {
+	s := NewStatus()
+	s.DateTime = time.Date(2020, 8, 18, 12, 34, 0, 0, time.UTC)
+	s.Generated = 1200
+	s.Consuming = 300
+	s.Voltage = 230.1
+	s.Extended[0] = 12.5
+
+	text, err := s.MarshalText()
+	require.NoError(t, err)
+	assert.Equal(t, "20200818,12:34,1200,,,300,,230.1,12.5", string(text))
+
+	decoded := Status{}
+	require.NoError(t, decoded.UnmarshalText(text))
+	assert.Equal(t, s, decoded)
+
+	// the cumulative flag trails the batch fields
+	s.Cumulative = StatusCumulativeGenerating
+	text, err = s.MarshalText()
+	require.NoError(t, err)
+	assert.Equal(t, "20200818,12:34,1200,,,300,,230.1,12.5,,,,,,2", string(text))
+	require.NoError(t, decoded.UnmarshalText(text))
+	assert.Equal(t, s, decoded)
+
+	_, err = NewStatus().MarshalText()
+	assert.Error(t, err)
+
+	for text, msg := range map[string]string{
+		"20200818":                       "invalid date or time",
+		"20200818,12:34,x":               `invalid v1 "x"`,
+		"20200818,12:34,,,,,warm":        `invalid v5 "warm"`,
+		"20200818,12:34,,,,,,,,,,,,,all": `invalid c1 "all"`,
+		"20200818,12:34,,,,,,,,,,,,,,,,": "expected at most 15 fields",
+	} {
+		assert.EqualError(t, decoded.UnmarshalText([]byte(text)), msg, text)
+	}
+}
+
+// pagedHistory serves the status history a page at a time, like PVOutput
+type pagedHistory struct {
+	statuses []Status
+	requests []string
+	err      error
+	// ignoreFrom returns the first page of the day for every request
+	ignoreFrom bool
+}
+
+func (h *pagedHistory) GetStatusHistory(o StatusHistoryOptions) ([]Status, error) {
+	h.requests = append(h.requests, o.Date.Format("2006-01-02")+" "+o.From.Format("15:04"))
+	if h.err != nil {
+		return nil, h.err
+	}
+
+	if h.ignoreFrom {
+		o.From = time.Time{}
+	}
+
+	page := []Status{}
+	for _, s := range h.statuses {
+		if !DateOf(s.DateTime).Equal(o.Date) || s.DateTime.Format("15:04") < o.From.Format("15:04") {
+			continue
+		}
+		if len(page) == o.Limit {
+			break
+		}
+		page = append(page, s)
+	}
+	if len(page) == 0 {
+		return nil, ErrNoData
+	}
+
+	return page, nil
+}
+
+func TestStatusesOfDay(t *testing.T) {
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	h := &pagedHistory{}
+	for i := 0; i < 1440; i++ {
+		s := NewStatus()
+		s.DateTime = day.Add(time.Duration(i) * time.Minute)
+		h.statuses = append(h.statuses, s)
+	}
+
+	// a day of statuses every minute takes multiple pages
+	statuses, err := StatusesOfDay(h, day.Add(12*time.Hour), time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, statuses, 1440)
+	assert.Equal(t, []string{"2026-03-01 00:00", "2026-03-01 04:48", "2026-03-01 09:36", "2026-03-01 14:24", "2026-03-01 19:12"}, h.requests)
+
+	// statuses up to given time are left out
+	statuses, err = StatusesOfDay(h, day, day.Add(23*time.Hour))
+	require.NoError(t, err)
+	if assert.Len(t, statuses, 59) {
+		assert.Equal(t, day.Add(23*time.Hour+time.Minute), statuses[0].DateTime)
+	}
+
+	// a time on another day doesn't limit the statuses
+	statuses, err = StatusesOfDay(h, day, day.AddDate(0, 0, -1))
+	require.NoError(t, err)
+	assert.Len(t, statuses, 1440)
+
+	// a day without statuses is empty
+	statuses, err = StatusesOfDay(h, day.AddDate(0, 0, 1), time.Time{})
+	require.NoError(t, err)
+	assert.Empty(t, statuses)
+
+	// a page without new statuses ends the paging
+	h.requests = nil
+	h.ignoreFrom = true
+	statuses, err = StatusesOfDay(h, day, time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, statuses, StatusHistoryMaxLimit)
+	assert.Len(t, h.requests, 2)
+
+	h.err = errors.New("Unauthorized 401: Invalid API Key")
+	_, err = StatusesOfDay(h, day, time.Time{})
+	assert.EqualError(t, err, "Unauthorized 401: Invalid API Key")
 }
@@ -0,0 +1,139 @@
+package sunspec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTimeout is the default timeout for a Modbus request
+	DefaultTimeout = 5 * time.Second
+	// maxRegisters is the maximum number of registers in a single request
+	maxRegisters = 125
+	// function code for reading holding registers
+	funcReadHoldingRegisters = 0x03
+)
+
+// Client is a minimal Modbus TCP client, able to read holding registers
+type Client struct {
+	Timeout time.Duration
+	conn    net.Conn
+	unitID  byte
+	txID    uint16
+	mu      sync.Mutex
+}
+
+// Dial connects to the Modbus TCP server at given address (host:port) and
+// returns a Client for given unit ID
+func Dial(address string, unitID byte) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", address, DefaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClient(conn, unitID), nil
+}
+
+// NewClient returns a Client using given connection
+func NewClient(conn net.Conn, unitID byte) *Client {
+	return &Client{
+		Timeout: DefaultTimeout,
+		conn:    conn,
+		unitID:  unitID,
+	}
+}
+
+// Close closes the underlying connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// ReadHoldingRegisters reads count holding registers starting at addr. Reads
+// of more than 125 registers are split into multiple requests
+func (c *Client) ReadHoldingRegisters(addr, count uint16) ([]uint16, error) {
+	regs := make([]uint16, 0, count)
+	for count > 0 {
+		n := count
+		if n > maxRegisters {
+			n = maxRegisters
+		}
+
+		part, err := c.readHoldingRegisters(addr, n)
+		if err != nil {
+			return nil, err
+		}
+
+		regs = append(regs, part...)
+		addr += n
+		count -= n
+	}
+
+	return regs, nil
+}
+
+func (c *Client) readHoldingRegisters(addr, count uint16) ([]uint16, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.txID++
+	if c.Timeout > 0 {
+		if err := c.conn.SetDeadline(time.Now().Add(c.Timeout)); err != nil {
+			return nil, err
+		}
+	}
+
+	// MBAP header followed by the PDU
+	req := make([]byte, 12)
+	binary.BigEndian.PutUint16(req[0:], c.txID)
+	binary.BigEndian.PutUint16(req[2:], 0) // protocol ID
+	binary.BigEndian.PutUint16(req[4:], 6) // remaining length
+	req[6] = c.unitID
+	req[7] = funcReadHoldingRegisters
+	binary.BigEndian.PutUint16(req[8:], addr)
+	binary.BigEndian.PutUint16(req[10:], count)
+
+	if _, err := c.conn.Write(req); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		return nil, err
+	}
+
+	if txID := binary.BigEndian.Uint16(header[0:]); txID != c.txID {
+		return nil, fmt.Errorf("unexpected transaction ID %d", txID)
+	}
+
+	length := binary.BigEndian.Uint16(header[4:])
+	if length < 3 {
+		return nil, errors.New("response too short")
+	}
+
+	pdu := make([]byte, length-1)
+	if _, err := io.ReadFull(c.conn, pdu); err != nil {
+		return nil, err
+	}
+
+	if pdu[0] == funcReadHoldingRegisters|0x80 {
+		return nil, fmt.Errorf("modbus exception %d", pdu[1])
+	}
+	if pdu[0] != funcReadHoldingRegisters {
+		return nil, fmt.Errorf("unexpected function code %d", pdu[0])
+	}
+	if int(pdu[1]) != int(count)*2 || len(pdu) != 2+int(count)*2 {
+		return nil, errors.New("unexpected number of registers in response")
+	}
+
+	regs := make([]uint16, count)
+	for i := range regs {
+		regs[i] = binary.BigEndian.Uint16(pdu[2+i*2:])
+	}
+
+	return regs, nil
+}
@@ -0,0 +1,108 @@
+package sunspec
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+)
+
+// simulator is an in-process Modbus TCP server serving a register map
+type simulator struct {
+	listener  net.Listener
+	mu        sync.Mutex
+	registers map[uint16]uint16
+	wg        sync.WaitGroup
+}
+
+func newSimulator(t *testing.T) *simulator {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &simulator{listener: l, registers: map[uint16]uint16{}}
+	s.wg.Add(1)
+	go s.serve()
+	t.Cleanup(s.close)
+
+	return s
+}
+
+func (s *simulator) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *simulator) close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+// set writes given registers starting at addr
+func (s *simulator) set(addr uint16, regs ...uint16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, r := range regs {
+		s.registers[addr+uint16(i)] = r
+	}
+}
+
+func (s *simulator) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+func (s *simulator) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer conn.Close()
+
+	for {
+		req := make([]byte, 12)
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+
+		addr := binary.BigEndian.Uint16(req[8:])
+		count := binary.BigEndian.Uint16(req[10:])
+
+		s.mu.Lock()
+		data := []byte{}
+		exception := false
+		for i := uint16(0); i < count; i++ {
+			r, ok := s.registers[addr+i]
+			if !ok {
+				exception = true
+				break
+			}
+			data = append(data, byte(r>>8), byte(r))
+		}
+		s.mu.Unlock()
+
+		pdu := append([]byte{req[7], byte(len(data))}, data...)
+		if exception {
+			// illegal data address
+			pdu = []byte{req[7] | 0x80, 0x02}
+		}
+
+		resp := make([]byte, 7, 7+len(pdu))
+		copy(resp, req[:4])
+		binary.BigEndian.PutUint16(resp[4:], uint16(len(pdu)+1))
+		resp[6] = req[6]
+		resp = append(resp, pdu...)
+
+		if _, err := conn.Write(resp); err != nil {
+			return
+		}
+	}
+}
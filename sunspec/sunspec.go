@@ -0,0 +1,345 @@
+// Package sunspec reads inverters and meters implementing the SunSpec
+// information models over Modbus TCP and maps their readings onto PVOutput's
+// data structures
+package sunspec
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/skoef/pvoutput"
+)
+
+const (
+	// ModelCommon is the SunSpec common model
+	ModelCommon uint16 = 1
+	// ModelEnd marks the end of the list of models
+	ModelEnd uint16 = 0xFFFF
+	// maxModels is the number of models Discover lists before giving up on
+	// finding the end marker
+	maxModels = 64
+)
+
+var (
+	// base addresses SunSpec devices may use for their register map
+	baseAddresses = []uint16{40000, 0, 50000}
+	// every SunSpec register map starts with "SunS"
+	sunSpecID = [2]uint16{0x5375, 0x6e53}
+	// integer inverter models with scale factors: single, split and three phase
+	inverterIntModels = []uint16{101, 102, 103}
+	// floating point inverter models: single, split and three phase
+	inverterFloatModels = []uint16{111, 112, 113}
+	// meter models with scale factors: single, split, wye and delta three phase
+	meterModels = []uint16{201, 202, 203, 204}
+)
+
+// Model is a SunSpec model found on a device
+type Model struct {
+	ID      uint16
+	Address uint16 // address of the model's ID register
+	Length  uint16 // number of registers, excluding ID and length
+}
+
+// Common holds the information from the common model
+type Common struct {
+	Manufacturer string
+	Model        string
+	Options      string
+	Version      string
+	SerialNumber string
+}
+
+// Device is a SunSpec device on a Modbus TCP connection
+type Device struct {
+	Common Common
+	Models []Model
+	client *Client
+	base   uint16
+}
+
+// Discover finds the SunSpec register map on the device behind given client
+// and lists its models
+func Discover(c *Client) (*Device, error) {
+	d := &Device{client: c}
+
+	found := false
+	for _, base := range baseAddresses {
+		regs, err := c.ReadHoldingRegisters(base, 2)
+		if err != nil {
+			continue
+		}
+		if regs[0] == sunSpecID[0] && regs[1] == sunSpecID[1] {
+			d.base = base
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		return nil, errors.New("no SunSpec register map found")
+	}
+
+	addr := d.base + 2
+	for {
+		regs, err := c.ReadHoldingRegisters(addr, 2)
+		if err != nil {
+			return nil, err
+		}
+
+		if regs[0] == ModelEnd {
+			break
+		}
+		if len(d.Models) == maxModels {
+			return nil, fmt.Errorf("no end marker found after %d models", maxModels)
+		}
+
+		d.Models = append(d.Models, Model{ID: regs[0], Address: addr, Length: regs[1]})
+
+		// a malformed length may point past the last register
+		next := uint32(addr) + 2 + uint32(regs[1])
+		if next > math.MaxUint16 {
+			return nil, fmt.Errorf("model %d at %d exceeds the register map", regs[0], addr)
+		}
+		addr = uint16(next)
+	}
+
+	if m, ok := d.Model(ModelCommon); ok {
+		regs, err := d.read(m)
+		if err != nil {
+			return nil, err
+		}
+		if len(regs) >= 66 {
+			d.Common = Common{
+				Manufacturer: decodeString(regs[2:18]),
+				Model:        decodeString(regs[18:34]),
+				Options:      decodeString(regs[34:42]),
+				Version:      decodeString(regs[42:50]),
+				SerialNumber: decodeString(regs[50:66]),
+			}
+		}
+	}
+
+	return d, nil
+}
+
+// Model returns the first model with given ID
+func (d *Device) Model(id uint16) (Model, bool) {
+	for _, m := range d.Models {
+		if m.ID == id {
+			return m, true
+		}
+	}
+
+	return Model{}, false
+}
+
+// firstModel returns the first model with any of given IDs
+func (d *Device) firstModel(ids []uint16) (Model, bool) {
+	for _, m := range d.Models {
+		for _, id := range ids {
+			if m.ID == id {
+				return m, true
+			}
+		}
+	}
+
+	return Model{}, false
+}
+
+// read reads all registers of given model, including ID and length
+func (d *Device) read(m Model) ([]uint16, error) {
+	return d.client.ReadHoldingRegisters(m.Address, m.Length+2)
+}
+
+// Inverter holds the readings of an inverter model. Values the inverter
+// doesn't implement are NaN
+type Inverter struct {
+	ACPower            float64 // watts
+	ACVoltage          float64 // volts, phase A to neutral
+	LifetimeEnergy     float64 // watt hours
+	DCVoltage          float64 // volts
+	DCPower            float64 // watts
+	CabinetTemperature float64 // degrees celsius
+	State              uint16  // operating state
+}
+
+// ReadInverter reads the first inverter model (101-103 or 111-113)
+func (d *Device) ReadInverter() (Inverter, error) {
+	if m, ok := d.firstModel(inverterIntModels); ok {
+		regs, err := d.read(m)
+		if err != nil {
+			return Inverter{}, err
+		}
+		if len(regs) < 40 {
+			return Inverter{}, fmt.Errorf("model %d too short", m.ID)
+		}
+
+		return Inverter{
+			ACPower:            scaled(regs[14], regs[15]),
+			ACVoltage:          scaledUnsigned(regs[10], regs[13]),
+			LifetimeEnergy:     scaledAcc32(regs[24], regs[25], regs[26]),
+			DCVoltage:          scaledUnsigned(regs[29], regs[30]),
+			DCPower:            scaled(regs[31], regs[32]),
+			CabinetTemperature: scaled(regs[33], regs[37]),
+			State:              regs[38],
+		}, nil
+	}
+
+	if m, ok := d.firstModel(inverterFloatModels); ok {
+		regs, err := d.read(m)
+		if err != nil {
+			return Inverter{}, err
+		}
+		if len(regs) < 49 {
+			return Inverter{}, fmt.Errorf("model %d too short", m.ID)
+		}
+
+		return Inverter{
+			ACPower:            float32At(regs, 22),
+			ACVoltage:          float32At(regs, 16),
+			LifetimeEnergy:     float32At(regs, 32),
+			DCVoltage:          float32At(regs, 36),
+			DCPower:            float32At(regs, 38),
+			CabinetTemperature: float32At(regs, 40),
+			State:              regs[48],
+		}, nil
+	}
+
+	return Inverter{}, errors.New("no inverter model found")
+}
+
+// Meter holds the readings of a meter model. Positive power is imported from
+// the grid, negative power is exported. Values the meter doesn't implement
+// are NaN
+type Meter struct {
+	Power    float64 // watts
+	Voltage  float64 // volts, phase A to neutral
+	Imported float64 // lifetime watt hours
+	Exported float64 // lifetime watt hours
+}
+
+// ReadMeter reads the first meter model (201-204)
+func (d *Device) ReadMeter() (Meter, error) {
+	m, ok := d.firstModel(meterModels)
+	if !ok {
+		return Meter{}, errors.New("no meter model found")
+	}
+
+	regs, err := d.read(m)
+	if err != nil {
+		return Meter{}, err
+	}
+	if len(regs) < 55 {
+		return Meter{}, fmt.Errorf("model %d too short", m.ID)
+	}
+
+	return Meter{
+		Power:    scaled(regs[18], regs[22]),
+		Voltage:  scaled(regs[8], regs[15]),
+		Exported: scaledAcc32(regs[38], regs[39], regs[54]),
+		Imported: scaledAcc32(regs[46], regs[47], regs[54]),
+	}, nil
+}
+
+// Status reads the inverter and, when available, the meter and returns a
+// Status for the current time. Generated holds the inverter's lifetime
+// energy, so Cumulative is set to StatusCumulativeGenerating. When a meter is
+// found, Consuming is the sum of generation and the power imported from the
+// grid
+func (d *Device) Status() (pvoutput.Status, error) {
+	s := pvoutput.NewStatus()
+	s.DateTime = time.Now()
+
+	inv, err := d.ReadInverter()
+	if err != nil {
+		return s, err
+	}
+
+	if !math.IsNaN(inv.ACPower) {
+		s.Generating = int(math.Round(math.Max(0, inv.ACPower)))
+	}
+	if !math.IsNaN(inv.LifetimeEnergy) {
+		s.Generated = int(math.Round(inv.LifetimeEnergy))
+		s.Cumulative = pvoutput.StatusCumulativeGenerating
+	}
+	if !math.IsNaN(inv.CabinetTemperature) {
+		s.Temperature = inv.CabinetTemperature
+	}
+	if !math.IsNaN(inv.ACVoltage) {
+		s.Voltage = inv.ACVoltage
+	}
+
+	if _, ok := d.firstModel(meterModels); ok && !math.IsNaN(inv.ACPower) {
+		meter, err := d.ReadMeter()
+		if err != nil {
+			return s, err
+		}
+
+		if !math.IsNaN(meter.Power) {
+			s.Consuming = int(math.Round(math.Max(0, float64(s.Generating)+meter.Power)))
+		}
+	}
+
+	return s, nil
+}
+
+// decodeString decodes a SunSpec string, 2 characters per register padded
+// with NUL characters
+func decodeString(regs []uint16) string {
+	b := make([]byte, 0, len(regs)*2)
+	for _, r := range regs {
+		b = append(b, byte(r>>8), byte(r))
+	}
+
+	return strings.TrimSpace(strings.TrimRight(string(b), "\x00"))
+}
+
+// scaleFactor returns the multiplier for given sunssf register
+func scaleFactor(sf uint16) (float64, bool) {
+	if sf == 0x8000 {
+		return 0, false
+	}
+
+	return math.Pow10(int(int16(sf))), true
+}
+
+// scaled returns the value of an int16 register with given scale factor
+func scaled(v, sf uint16) float64 {
+	f, ok := scaleFactor(sf)
+	if !ok || v == 0x8000 {
+		return math.NaN()
+	}
+
+	return float64(int16(v)) * f
+}
+
+// scaledUnsigned returns the value of an uint16 register with given scale
+// factor
+func scaledUnsigned(v, sf uint16) float64 {
+	f, ok := scaleFactor(sf)
+	if !ok || v == 0xFFFF {
+		return math.NaN()
+	}
+
+	return float64(v) * f
+}
+
+// scaledAcc32 returns the value of an acc32 register pair with given scale
+// factor
+func scaledAcc32(hi, lo, sf uint16) float64 {
+	f, ok := scaleFactor(sf)
+	v := uint32(hi)<<16 | uint32(lo)
+	if !ok || v == 0 {
+		return math.NaN()
+	}
+
+	return float64(v) * f
+}
+
+// float32At returns the value of the float32 register pair at given offset
+func float32At(regs []uint16, offset int) float64 {
+	return float64(math.Float32frombits(uint32(regs[offset])<<16 | uint32(regs[offset+1])))
+}
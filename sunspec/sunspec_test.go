@@ -0,0 +1,239 @@
+package sunspec
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// encodeString encodes s into n registers
+func encodeString(s string, n int) []uint16 {
+	b := make([]byte, n*2)
+	copy(b, s)
+
+	regs := make([]uint16, n)
+	for i := range regs {
+		regs[i] = uint16(b[i*2])<<8 | uint16(b[i*2+1])
+	}
+
+	return regs
+}
+
+// encodeFloat encodes f into 2 registers
+func encodeFloat(f float32) []uint16 {
+	bits := math.Float32bits(f)
+	return []uint16{uint16(bits >> 16), uint16(bits)}
+}
+
+// newModel returns the registers of a model with given values at offsets
+func newModel(id, length uint16, values map[int][]uint16) []uint16 {
+	regs := make([]uint16, length+2)
+	regs[0] = id
+	regs[1] = length
+	for offset, v := range values {
+		copy(regs[offset:], v)
+	}
+
+	return regs
+}
+
+func int16Reg(v int16) uint16 {
+	return uint16(v)
+}
+
+func setupDevice(s *simulator, base uint16, models ...[]uint16) {
+	regs := []uint16{0x5375, 0x6e53}
+	for _, m := range models {
+		regs = append(regs, m...)
+	}
+	regs = append(regs, ModelEnd, 0)
+
+	s.set(base, regs...)
+}
+
+func commonModel() []uint16 {
+	return newModel(ModelCommon, 66, map[int][]uint16{
+		2:  encodeString("Fronius", 16),
+		18: encodeString("Symo 5.0-3-M", 16),
+		42: encodeString("3.14.1-10", 8),
+		50: encodeString("12345678", 16),
+	})
+}
+
+func TestClient(t *testing.T) {
+	s := newSimulator(t)
+	regs := make([]uint16, 300)
+	for i := range regs {
+		regs[i] = uint16(i)
+	}
+	s.set(100, regs...)
+
+	c, err := Dial(s.addr(), 1)
+	require.NoError(t, err)
+	defer c.Close()
+
+	// more than 125 registers are read in multiple requests
+	got, err := c.ReadHoldingRegisters(100, 300)
+	if assert.NoError(t, err) {
+		assert.Equal(t, regs, got)
+	}
+
+	// unmapped registers result in an exception
+	_, err = c.ReadHoldingRegisters(500, 2)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "exception 2")
+	}
+}
+
+func TestDiscoverIntegerModels(t *testing.T) {
+	s := newSimulator(t)
+	setupDevice(s, 40000,
+		commonModel(),
+		newModel(103, 50, map[int][]uint16{
+			10: {2301},
+			13: {int16Reg(-1)},
+			14: {25000, int16Reg(-1)},
+			24: {0x0001, 0x86A0, 1},
+			29: {3805, int16Reg(-1)},
+			31: {2600, 0},
+			33: {452, 0x8000, 0x8000, 0x8000, int16Reg(-1), 4},
+		}),
+		newModel(203, 105, map[int][]uint16{
+			8:  {2300},
+			15: {int16Reg(-1)},
+			18: {int16Reg(-800)},
+			22: {0},
+			38: {0, 5000},
+			46: {0, 12000},
+			54: {0},
+		}),
+	)
+
+	c, err := Dial(s.addr(), 1)
+	require.NoError(t, err)
+	defer c.Close()
+
+	d, err := Discover(c)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Fronius", d.Common.Manufacturer)
+	assert.Equal(t, "Symo 5.0-3-M", d.Common.Model)
+	assert.Equal(t, "3.14.1-10", d.Common.Version)
+	assert.Equal(t, "12345678", d.Common.SerialNumber)
+
+	if assert.Len(t, d.Models, 3) {
+		assert.Equal(t, Model{ID: 1, Address: 40002, Length: 66}, d.Models[0])
+		assert.Equal(t, Model{ID: 103, Address: 40070, Length: 50}, d.Models[1])
+		assert.Equal(t, Model{ID: 203, Address: 40122, Length: 105}, d.Models[2])
+	}
+
+	inv, err := d.ReadInverter()
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2500.0, inv.ACPower)
+		assert.InDelta(t, 230.1, inv.ACVoltage, 0.001)
+		assert.Equal(t, 1000000.0, inv.LifetimeEnergy)
+		assert.InDelta(t, 380.5, inv.DCVoltage, 0.001)
+		assert.Equal(t, 2600.0, inv.DCPower)
+		assert.InDelta(t, 45.2, inv.CabinetTemperature, 0.001)
+		assert.Equal(t, uint16(4), inv.State)
+	}
+
+	meter, err := d.ReadMeter()
+	if assert.NoError(t, err) {
+		assert.Equal(t, -800.0, meter.Power)
+		assert.InDelta(t, 230.0, meter.Voltage, 0.001)
+		assert.Equal(t, 5000.0, meter.Exported)
+		assert.Equal(t, 12000.0, meter.Imported)
+	}
+
+	status, err := d.Status()
+	if assert.NoError(t, err) {
+		assert.False(t, status.DateTime.IsZero())
+		assert.Equal(t, 2500, status.Generating)
+		assert.Equal(t, 1000000, status.Generated)
+		assert.Equal(t, 1700, status.Consuming)
+		assert.InDelta(t, 45.2, status.Temperature, 0.001)
+		assert.InDelta(t, 230.1, status.Voltage, 0.001)
+		enc, err := status.Encode()
+		if assert.NoError(t, err) {
+			assert.Contains(t, enc, "c1=2")
+		}
+	}
+}
+
+func TestDiscoverFloatModels(t *testing.T) {
+	s := newSimulator(t)
+	nan := encodeFloat(float32(math.NaN()))
+	setupDevice(s, 0,
+		commonModel(),
+		newModel(113, 60, map[int][]uint16{
+			16: encodeFloat(229.9),
+			22: encodeFloat(1234.5),
+			32: encodeFloat(5e6),
+			36: nan,
+			38: encodeFloat(1300),
+			40: nan,
+			48: {4},
+		}),
+	)
+
+	c, err := Dial(s.addr(), 1)
+	require.NoError(t, err)
+	defer c.Close()
+
+	d, err := Discover(c)
+	require.NoError(t, err)
+	assert.Len(t, d.Models, 2)
+
+	inv, err := d.ReadInverter()
+	if assert.NoError(t, err) {
+		assert.InDelta(t, 1234.5, inv.ACPower, 0.001)
+		assert.True(t, math.IsNaN(inv.DCVoltage))
+	}
+
+	_, err = d.ReadMeter()
+	assert.Error(t, err)
+
+	status, err := d.Status()
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1235, status.Generating)
+		assert.Equal(t, 5000000, status.Generated)
+		assert.Equal(t, -1, status.Consuming)
+		assert.Equal(t, -1.0, status.Temperature)
+	}
+}
+
+func TestDiscoverNoSunSpec(t *testing.T) {
+	s := newSimulator(t)
+	s.set(40000, 1, 2)
+
+	c, err := Dial(s.addr(), 1)
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = Discover(c)
+	assert.Error(t, err)
+}
+
+func TestDiscoverMalformedModels(t *testing.T) {
+	s := newSimulator(t)
+	c, err := Dial(s.addr(), 1)
+	require.NoError(t, err)
+	defer c.Close()
+
+	// a length pointing past the last register
+	s.set(40000, 0x5375, 0x6e53, 1, 65000)
+	_, err = Discover(c)
+	assert.EqualError(t, err, "model 1 at 40002 exceeds the register map")
+
+	// models without an end marker
+	regs := []uint16{0x5375, 0x6e53}
+	for i := 0; i <= maxModels; i++ {
+		regs = append(regs, 120, 0)
+	}
+	s.set(40000, regs...)
+	_, err = Discover(c)
+	assert.EqualError(t, err, "no end marker found after 64 models")
+}
@@ -0,0 +1,86 @@
+package pvoutput
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supply represents the aggregated supply and demand of a region as
+// described on https://pvoutput.org/help.html#api-getsupply
+type Supply struct {
+	Timestamp     time.Time
+	Region        string
+	Utilisation   float64 // percentage of total size generating
+	TotalOutput   int     // watts generated
+	TotalInput    int     // watts consumed
+	AverageOutput int     // watts generated per system
+	AverageInput  int     // watts consumed per system
+	AverageNet    int     // watts
+	SystemsOut    int     // number of systems generating
+	SystemsIn     int     // number of systems consuming
+	TotalSize     int     // watts
+	AverageSize   int     // watts
+}
+
+func decodeSupply(input string) (s Supply, err error) {
+	fields := strings.Split(strings.TrimSpace(input), ",")
+	if len(fields) < 12 {
+		err = errors.New("not enough fields in supply")
+		return
+	}
+
+	// parse Timestamp field from fields[0]
+	s.Timestamp, err = time.Parse(time.RFC3339, fields[0])
+	if err != nil {
+		return
+	}
+
+	// get Region field from fields[1]
+	s.Region = fields[1]
+
+	// parse Utilisation field from fields[2]
+	s.Utilisation, err = strconv.ParseFloat(fields[2], 64)
+	if err != nil {
+		return
+	}
+
+	// parse the remaining integer fields from fields[3] onwards
+	for i, dst := range []*int{
+		&s.TotalOutput,
+		&s.TotalInput,
+		&s.AverageOutput,
+		&s.AverageInput,
+		&s.AverageNet,
+		&s.SystemsOut,
+		&s.SystemsIn,
+		&s.TotalSize,
+		&s.AverageSize,
+	} {
+		*dst, err = strconv.Atoi(fields[i+3])
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func decodeSupplies(input string) ([]Supply, error) {
+	supplies := []Supply{}
+	for _, line := range strings.Split(strings.TrimSpace(input), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		s, err := decodeSupply(line)
+		if err != nil {
+			return nil, err
+		}
+
+		supplies = append(supplies, s)
+	}
+
+	return supplies, nil
+}
@@ -0,0 +1,44 @@
+package pvoutput
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeSupply(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/supply/normal")
+	require.NoError(t, err)
+
+	supplies, err := decodeSupplies(string(data))
+	if assert.NoError(t, err) && assert.Len(t, supplies, 2) {
+		ts, _ := time.Parse(time.RFC3339, "2011-11-16T16:00:00+11:00")
+		assert.True(t, ts.Equal(supplies[0].Timestamp))
+		assert.Equal(t, "1:victoria", supplies[0].Region)
+		assert.Equal(t, 35.2, supplies[0].Utilisation)
+		assert.Equal(t, 3561742, supplies[0].TotalOutput)
+		assert.Equal(t, 1123580, supplies[0].TotalInput)
+		assert.Equal(t, 1256, supplies[0].AverageOutput)
+		assert.Equal(t, 682, supplies[0].AverageInput)
+		assert.Equal(t, 574, supplies[0].AverageNet)
+		assert.Equal(t, 2836, supplies[0].SystemsOut)
+		assert.Equal(t, 1647, supplies[0].SystemsIn)
+		assert.Equal(t, 10118620, supplies[0].TotalSize)
+		assert.Equal(t, 3568, supplies[0].AverageSize)
+		assert.Equal(t, "2:new south wales", supplies[1].Region)
+	}
+
+	// empty response means no supply data
+	supplies, err = decodeSupplies("")
+	assert.NoError(t, err)
+	assert.Empty(t, supplies)
+
+	// incomplete or malformed lines
+	_, err = decodeSupplies("2011-11-16T16:00:00+11:00,1:victoria,35.2")
+	assert.Error(t, err)
+	_, err = decodeSupplies("20111116,1:victoria,35.2,3561742,1123580,1256,682,574,2836,1647,10118620,3568")
+	assert.Error(t, err)
+}
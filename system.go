@@ -0,0 +1,241 @@
+package pvoutput
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// SystemNameMaxLength is the maximum length of a system's name
+	SystemNameMaxLength = 30
+	// ExtendedLabelMaxLength is the maximum length of an extended data label
+	ExtendedLabelMaxLength = 20
+	// ExtendedUnitMaxLength is the maximum length of an extended data unit
+	ExtendedUnitMaxLength = 10
+	// ExtendedFirst is the number of the first extended data field (v7)
+	ExtendedFirst = 7
+	// ExtendedLast is the number of the last extended data field (v12)
+	ExtendedLast = 12
+)
+
+var (
+	// colours are passed as 6 hexadecimal characters, without leading #
+	extendedColourRegexp = regexp.MustCompile("^[0-9a-fA-F]{6}$")
+	// status intervals PVOutput allows a system to be configured with
+	systemStatusIntervals = []int{5, 10, 15}
+)
+
+// ExtendedDataDefinition describes how PVOutput labels and plots one of the
+// extended data fields v7 to v12. Empty fields are left untouched
+type ExtendedDataDefinition struct {
+	Label  string
+	Unit   string
+	Colour string // hexadecimal RGB, e.g. ff0000
+}
+
+// SystemUpdate represents the data structure for a system update as
+// described on https://pvoutput.org/help.html#api-postsystem
+type SystemUpdate struct {
+	Name           string
+	StatusInterval int // minutes
+	// Extended holds the definitions of extended data fields, keyed by
+	// their number (7 to 12)
+	Extended map[int]ExtendedDataDefinition
+}
+
+// NewSystemUpdate initialises and returns a new SystemUpdate
+// similar to NewOutput and NewStatus, all fields are set to "unset" values
+// so only deliberately set fields are sent to PVOutput
+func NewSystemUpdate() SystemUpdate {
+	return SystemUpdate{
+		Name:           UnsetString,
+		StatusInterval: UnsetInt,
+		Extended:       map[int]ExtendedDataDefinition{},
+	}
+}
+
+func (u SystemUpdate) encode() (url.Values, error) {
+	data := url.Values{}
+
+	if u.Name != UnsetString {
+		if u.Name == "" {
+			return nil, errors.New("Name can not be empty")
+		}
+		if len(u.Name) > SystemNameMaxLength {
+			return nil, fmt.Errorf("Name exceeds %d characters", SystemNameMaxLength)
+		}
+		data.Set("n", u.Name)
+	}
+
+	if u.StatusInterval != UnsetInt {
+		valid := false
+		for _, i := range systemStatusIntervals {
+			if u.StatusInterval == i {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("StatusInterval should be one of %v", systemStatusIntervals)
+		}
+		data.Set("i", fmt.Sprintf("%d", u.StatusInterval))
+	}
+
+	// iterate the extended definitions in order, so errors are predictable
+	keys := make([]int, 0, len(u.Extended))
+	for k := range u.Extended {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	for _, k := range keys {
+		if k < ExtendedFirst || k > ExtendedLast {
+			return nil, fmt.Errorf("extended data field v%d does not exist", k)
+		}
+
+		def := u.Extended[k]
+		if len(def.Label) > ExtendedLabelMaxLength {
+			return nil, fmt.Errorf("label of v%d exceeds %d characters", k, ExtendedLabelMaxLength)
+		}
+		if len(def.Unit) > ExtendedUnitMaxLength {
+			return nil, fmt.Errorf("unit of v%d exceeds %d characters", k, ExtendedUnitMaxLength)
+		}
+		if def.Colour != "" && !extendedColourRegexp.MatchString(def.Colour) {
+			return nil, fmt.Errorf("colour of v%d should be 6 hexadecimal characters", k)
+		}
+
+		if def.Label != "" {
+			data.Set(fmt.Sprintf("v%dl", k), def.Label)
+		}
+		if def.Unit != "" {
+			data.Set(fmt.Sprintf("v%du", k), def.Unit)
+		}
+		if def.Colour != "" {
+			data.Set(fmt.Sprintf("v%dc", k), def.Colour)
+		}
+	}
+
+	if len(data) == 0 {
+		return nil, errors.New("nothing to update in SystemUpdate")
+	}
+
+	return data, nil
+}
+
+// Encode returns API string for this object
+func (u SystemUpdate) Encode() (string, error) {
+	data, err := u.encode()
+	if err != nil {
+		return "", err
+	}
+
+	return data.Encode(), nil
+}
+
+// System represents a system's details as returned by GetSystem
+type System struct {
+	Name           string
+	Size           int // watts
+	Postcode       string
+	Panels         int
+	PanelPower     int // watts
+	PanelBrand     string
+	Inverters      int
+	InverterPower  int // watts
+	InverterBrand  string
+	Orientation    string
+	ArrayTilt      float64 // degrees
+	Shade          string
+	InstallDate    time.Time
+	Latitude       float64
+	Longitude      float64
+	StatusInterval int // minutes
+}
+
+func decodeSystem(input string) (s System, err error) {
+	// secondary sections, like tariffs and teams, follow after a semicolon
+	fields := strings.Split(strings.SplitN(strings.TrimSpace(input), ";", 2)[0], ",")
+	if len(fields) < 16 {
+		err = errors.New("not enough fields in system")
+		return
+	}
+
+	// get Name field from fields[0]
+	s.Name = fields[0]
+
+	// parse Size field from fields[1]
+	s.Size, err = decodeInt(fields[1])
+	if err != nil {
+		return
+	}
+
+	// get Postcode field from fields[2]
+	s.Postcode = fields[2]
+
+	// parse Panels and PanelPower fields from fields[3] and fields[4]
+	s.Panels, err = decodeInt(fields[3])
+	if err != nil {
+		return
+	}
+	s.PanelPower, err = decodeInt(fields[4])
+	if err != nil {
+		return
+	}
+
+	// get PanelBrand field from fields[5]
+	s.PanelBrand = fields[5]
+
+	// parse Inverters and InverterPower fields from fields[6] and fields[7]
+	s.Inverters, err = decodeInt(fields[6])
+	if err != nil {
+		return
+	}
+	s.InverterPower, err = decodeInt(fields[7])
+	if err != nil {
+		return
+	}
+
+	// get InverterBrand and Orientation fields from fields[8] and fields[9]
+	s.InverterBrand = fields[8]
+	s.Orientation = fields[9]
+
+	// parse ArrayTilt field from fields[10]
+	s.ArrayTilt, err = decodeFloat(fields[10])
+	if err != nil {
+		return
+	}
+
+	// get Shade field from fields[11]
+	s.Shade = fields[11]
+
+	// parse InstallDate field from fields[12], which may be empty
+	if fields[12] != "" {
+		s.InstallDate, err = time.Parse("20060102", fields[12])
+		if err != nil {
+			return
+		}
+	}
+
+	// parse Latitude and Longitude fields from fields[13] and fields[14]
+	s.Latitude, err = decodeFloat(fields[13])
+	if err != nil {
+		return
+	}
+	s.Longitude, err = decodeFloat(fields[14])
+	if err != nil {
+		return
+	}
+
+	// parse StatusInterval field from fields[15]
+	s.StatusInterval, err = decodeInt(fields[15])
+	if err != nil {
+		return
+	}
+
+	return
+}
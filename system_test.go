@@ -0,0 +1,117 @@
+package pvoutput
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeSystemUpdate(t *testing.T) {
+	var result string
+	var err error
+	u := NewSystemUpdate()
+
+	// nothing set should not result in an API call
+	_, err = u.Encode()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "nothing to update")
+	}
+
+	// check name
+	u = NewSystemUpdate()
+	u.Name = "My System"
+	result, err = u.Encode()
+	assert.NoError(t, err)
+	assert.Equal(t, "n=My+System", result)
+
+	// empty or too long names are not accepted
+	u.Name = ""
+	_, err = u.Encode()
+	assert.Error(t, err)
+	u.Name = strings.Repeat("x", SystemNameMaxLength+1)
+	_, err = u.Encode()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "exceeds")
+	}
+
+	// check status interval
+	u = NewSystemUpdate()
+	u.StatusInterval = 10
+	result, err = u.Encode()
+	assert.NoError(t, err)
+	assert.Equal(t, "i=10", result)
+
+	u.StatusInterval = 7
+	_, err = u.Encode()
+	assert.Error(t, err)
+
+	// check extended data definitions
+	u = NewSystemUpdate()
+	u.Extended[7] = ExtendedDataDefinition{Label: "Irradiance", Unit: "W/m2", Colour: "ff9900"}
+	u.Extended[12] = ExtendedDataDefinition{Label: "Battery"}
+	result, err = u.Encode()
+	assert.NoError(t, err)
+	assert.Equal(t, "v12l=Battery&v7c=ff9900&v7l=Irradiance&v7u=W%2Fm2", result)
+
+	// only v7 to v12 exist
+	u = NewSystemUpdate()
+	u.Extended[6] = ExtendedDataDefinition{Label: "Voltage"}
+	_, err = u.Encode()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "v6")
+	}
+
+	// label and unit lengths are limited
+	u = NewSystemUpdate()
+	u.Extended[8] = ExtendedDataDefinition{Label: strings.Repeat("x", ExtendedLabelMaxLength+1)}
+	_, err = u.Encode()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "label of v8")
+	}
+	u.Extended[8] = ExtendedDataDefinition{Unit: strings.Repeat("x", ExtendedUnitMaxLength+1)}
+	_, err = u.Encode()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unit of v8")
+	}
+
+	// colours should be 6 hexadecimal characters
+	for _, c := range []string{"#ff9900", "ff99", "gg9900", "ff99001"} {
+		u.Extended[8] = ExtendedDataDefinition{Colour: c}
+		_, err = u.Encode()
+		if assert.Error(t, err, c) {
+			assert.Contains(t, err.Error(), "colour of v8")
+		}
+	}
+}
+
+func TestDecodeSystem(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/system/normal")
+	require.NoError(t, err)
+
+	s, err := decodeSystem(string(data))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Rooftop East", s.Name)
+		assert.Equal(t, 3960, s.Size)
+		assert.Equal(t, "3153", s.Postcode)
+		assert.Equal(t, 18, s.Panels)
+		assert.Equal(t, 220, s.PanelPower)
+		assert.Equal(t, "Sunpower", s.PanelBrand)
+		assert.Equal(t, 1, s.Inverters)
+		assert.Equal(t, 4000, s.InverterPower)
+		assert.Equal(t, "Fronius", s.InverterBrand)
+		assert.Equal(t, "N", s.Orientation)
+		assert.Equal(t, 30.0, s.ArrayTilt)
+		assert.Equal(t, "No", s.Shade)
+		assert.Equal(t, time.Date(2010, 8, 1, 0, 0, 0, 0, time.UTC), s.InstallDate)
+		assert.Equal(t, -37.8136, s.Latitude)
+		assert.Equal(t, 144.9631, s.Longitude)
+		assert.Equal(t, 5, s.StatusInterval)
+	}
+
+	_, err = decodeSystem("Rooftop East,3960")
+	assert.Error(t, err)
+}